@@ -1,25 +1,90 @@
 package configs
 
-import "github.com/spf13/viper"
+import (
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
 
-var cfg *config
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+// EnvPrefix prefixes the environment variable of every key, with dots
+// turned into underscores: database.host is read from CRUD_DATABASE_HOST.
+const EnvPrefix = "CRUD"
+
+// cfg is swapped as a whole on reload, so readers never see half of one
+// configuration and half of another.
+var cfg atomic.Pointer[config]
+
+// logLevel follows log.level across reloads; see LogLevel.
+var logLevel = new(slog.LevelVar)
 
 type config struct {
-	API APIConfig
-	DB  DBConf
-	AI  AIConf
+	API           APIConfig
+	DB            DBConf
+	AI            AIConf
+	Limits        LimitsConf
+	Metrics       MetricsConf
+	Tracing       TracingConf
+	Log           LogConf
+	Pricing       PricingConf
+	Jobs          JobsConf
+	Notify        NotifyConf
+	Transfers     TransfersConf
+	Invoicing     InvoicingConf
+	Subscriptions SubscriptionsConf
+	Payments      PaymentsConf
+	Orders        OrdersConf
+
+	// values holds every setting as read, by key, for Effective.
+	values   map[string]any
+	loadedAt time.Time
 }
 
+// APIConfig.CORSOrigins lists the browser origins allowed to call the API;
+// "*" allows any and one "*" inside an origin matches any run of characters.
+//
+// The timeouts bound each phase of an HTTP exchange; WriteTimeout must leave
+// room for the slowest chat call. On SIGTERM /readyz fails at once and the
+// listener stays open for ShutdownDelay so load balancers notice; then
+// ShutdownTimeout is how long in-flight requests and background work may
+// take to finish.
 type APIConfig struct {
-	Port string
+	Port              string
+	CORSOrigins       []string
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	ShutdownDelay     time.Duration
+	ShutdownTimeout   time.Duration
 }
 
+// DBConf locates the database either through URL or through the individual
+// fields, which are ignored when URL is set. A zero timeout or pool limit
+// means none.
 type DBConf struct {
-	Host     string
-	Port     string
-	User     string
-	Pass     string
-	Database string
+	URL              string
+	Host             string
+	Port             string
+	User             string
+	Pass             string
+	Database         string
+	SSLMode          string
+	ConnectTimeout   time.Duration
+	StatementTimeout time.Duration
+	MaxOpenConns     int
+	MaxIdleConns     int
+	ConnMaxLifetime  time.Duration
+	ConnMaxIdleTime  time.Duration
 }
 
 type AIConf struct {
@@ -27,16 +92,357 @@ type AIConf struct {
 	DefaultModel string
 }
 
-func init() {
-	viper.SetDefault("api.host", "localhost")
-	viper.SetDefault("api.port", "9000")
-	viper.SetDefault("database.host", "localhost")
-	viper.SetDefault("database.port", "5432")
-	viper.SetDefault("ai.ollama_host", "http://localhost:11434")
-	viper.SetDefault("ai.default_model", "gemma3:1b")
+// LimitsConf holds per-client request limits. Zero disables a limit.
+// TrustedProxies are the reverse proxies whose X-Forwarded-For is believed
+// when telling callers apart.
+type LimitsConf struct {
+	ChatRequestsPerMinute int
+	TrustedProxies        []netip.Prefix
+}
+
+// MetricsConf protects /metrics. An empty Token leaves it open, for
+// deployments that keep it off the public network instead.
+type MetricsConf struct {
+	Token string
+}
+
+// TracingConf selects where OpenTelemetry spans go: nowhere ("none"),
+// stdout for local debugging, or an OTLP/HTTP collector at OTLPEndpoint.
+// OTLPHeaders uses the OTEL_EXPORTER_OTLP_HEADERS form, key=value pairs
+// separated by commas. SampleRatio applies to traces started here; requests
+// arriving with a sampled trace context are always traced.
+type TracingConf struct {
+	Exporter     string
+	OTLPEndpoint string
+	OTLPHeaders  string
+	ServiceName  string
+	SampleRatio  float64
+}
+
+// LogConf sets the minimum level and whether logs are written as JSON
+// lines or as logfmt-style text.
+type LogConf struct {
+	Level  string
+	Format string
+}
+
+// PricingConf is the rate charged for models no model_pricing rule matches.
+type PricingConf struct {
+	DefaultPromptPer1K     float64
+	DefaultCompletionPer1K float64
+}
+
+type NotifyConf struct {
+	SMTPHost string
+	SMTPPort string
+	SMTPUser string
+	SMTPPass string
+	SMTPFrom string
+}
+
+type TransfersConf struct {
+	ApprovalLimitCredits int64
+}
+
+type InvoicingConf struct {
+	TaxRateBP                int
+	PostpaidCreditPriceCents int64
+}
+
+type SubscriptionsConf struct {
+	RenewalInterval time.Duration
+	RetryInterval   time.Duration
+	GracePeriod     time.Duration
+}
+
+type PaymentsConf struct {
+	Provider       string
+	WebhookSecret  string
+	PixKey         string
+	MerchantName   string
+	MerchantCity   string
+	BoletoBankCode string
+	BoletoDays     int
+}
+
+// OrdersConf holds how long a PENDING order waits for payment, per method.
+// A zero TTL means orders with that method never expire.
+type OrdersConf struct {
+	CardTTL   time.Duration
+	PixTTL    time.Duration
+	BoletoTTL time.Duration
+}
+
+type JobsConf struct {
+	CreditExpiryInterval time.Duration
+	OrderExpiryInterval  time.Duration
 }
 
+// setting is one configuration key. Secret keys may instead be read from
+// the file named by the same key with a _file suffix. Reloadable keys take
+// effect when config.toml changes; the rest need a restart.
+type setting struct {
+	key        string
+	def        any
+	secret     bool
+	reloadable bool
+}
+
+var settings = []setting{
+	{key: "api.port", def: "9000"},
+	{key: "api.cors_origins", def: []string{"http://localhost:3000", "*"}, reloadable: true},
+	{key: "api.read_header_timeout", def: "10s"},
+	{key: "api.read_timeout", def: "30s"},
+	{key: "api.write_timeout", def: "150s"},
+	{key: "api.idle_timeout", def: "2m"},
+	{key: "api.shutdown_delay", def: "5s"},
+	{key: "api.shutdown_timeout", def: "140s"},
+	{key: "log.level", def: "info", reloadable: true},
+	{key: "log.format", def: "json"},
+	{key: "metrics.token", secret: true},
+	{key: "tracing.exporter", def: "none"},
+	{key: "tracing.otlp_endpoint", def: "http://localhost:4318"},
+	{key: "tracing.otlp_headers", secret: true},
+	{key: "tracing.service_name", def: "crud-postgres"},
+	{key: "tracing.sample_ratio", def: 1.0},
+	{key: "limits.chat_requests_per_minute", def: 0, reloadable: true},
+	{key: "limits.trusted_proxies", def: []string{}, reloadable: true},
+	{key: "pricing.default_prompt_per_1k", def: 1.0, reloadable: true},
+	{key: "pricing.default_completion_per_1k", def: 1.0, reloadable: true},
+	{key: "database.url", secret: true},
+	{key: "database.host", def: "localhost"},
+	{key: "database.port", def: "5432"},
+	{key: "database.user"},
+	{key: "database.pass", secret: true},
+	{key: "database.name"},
+	{key: "database.sslmode", def: "disable"},
+	{key: "database.connect_timeout", def: "5s"},
+	{key: "database.statement_timeout", def: "0s"},
+	{key: "database.max_open_conns", def: 25},
+	{key: "database.max_idle_conns", def: 5},
+	{key: "database.conn_max_lifetime", def: "30m"},
+	{key: "database.conn_max_idle_time", def: "5m"},
+	{key: "ai.ollama_host", def: "http://localhost:11434", reloadable: true},
+	{key: "ai.default_model", def: "gemma3:1b", reloadable: true},
+	{key: "jobs.credit_expiry_interval", def: "15m"},
+	{key: "jobs.order_expiry_interval", def: "1m"},
+	{key: "orders.pending_ttl_card", def: "1h"},
+	{key: "orders.pending_ttl_pix", def: "30m"},
+	{key: "orders.pending_ttl_boleto", def: "72h"},
+	{key: "transfers.approval_limit_credits", def: 10000},
+	{key: "notify.smtp_host"},
+	{key: "notify.smtp_port", def: "1025"},
+	{key: "notify.smtp_user"},
+	{key: "notify.smtp_pass", secret: true},
+	{key: "notify.smtp_from", def: "billing@localhost"},
+	{key: "invoicing.tax_rate_bp", def: 0},
+	{key: "invoicing.postpaid_credit_price_cents", def: 10},
+	{key: "subscriptions.renewal_interval", def: "5m"},
+	{key: "subscriptions.retry_interval", def: "6h"},
+	{key: "subscriptions.grace_period", def: "72h"},
+	{key: "payments.provider", def: "fake"},
+	{key: "payments.webhook_secret", secret: true},
+	{key: "payments.pix_key"},
+	{key: "payments.merchant_name", def: "CRUD Postgres"},
+	{key: "payments.merchant_city", def: "Sousa"},
+	{key: "payments.boleto_bank_code", def: "001"},
+	{key: "payments.boleto_days", def: 3},
+}
+
+var (
+	sslModes         = []string{"disable", "require", "verify-ca", "verify-full"}
+	logLevels        = []string{"debug", "info", "warn", "error"}
+	logFormats       = []string{"json", "text"}
+	traceExporters   = []string{"none", "stdout", "otlp"}
+	paymentProviders = []string{"fake"}
+)
+
+// ValidationError lists every setting that is missing or invalid, so a bad
+// deployment can be fixed in one go.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// Load reads the configuration and validates it. Sources, highest precedence
+// first: command-line flags (see RegisterFlags), CRUD_* environment
+// variables, config.toml and the built-in defaults. config.toml is looked up
+// in path unless -config or CRUD_CONFIG names another directory or file.
 func Load(path string) error {
+	for _, s := range settings {
+		if s.def != nil {
+			viper.SetDefault(s.key, s.def)
+		}
+		env := envName(s.key)
+		if s.key == "database.url" {
+			viper.BindEnv(s.key, env, "DATABASE_URL")
+		} else {
+			viper.BindEnv(s.key, env)
+		}
+		if s.secret {
+			viper.BindEnv(s.key+"_file", env+"_FILE")
+		}
+	}
+
+	if err := readConfigFile(path); err != nil {
+		return err
+	}
+	applyFlags()
+
+	loaded, problems := build()
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+
+	store(loaded)
+	return nil
+}
+
+// build reads every setting from viper into a new config and validates it.
+func build() (*config, []string) {
+	r := &reader{values: map[string]any{}}
+	for _, s := range settings {
+		if s.secret {
+			r.secretFile(s.key)
+		}
+	}
+
+	loaded := &config{values: r.values, loadedAt: time.Now()}
+
+	loaded.API = APIConfig{
+		Port:              r.str("api.port"),
+		CORSOrigins:       r.list("api.cors_origins"),
+		ReadHeaderTimeout: r.duration("api.read_header_timeout"),
+		ReadTimeout:       r.duration("api.read_timeout"),
+		WriteTimeout:      r.duration("api.write_timeout"),
+		IdleTimeout:       r.duration("api.idle_timeout"),
+		ShutdownDelay:     r.duration("api.shutdown_delay"),
+		ShutdownTimeout:   r.duration("api.shutdown_timeout"),
+	}
+
+	loaded.Log = LogConf{
+		Level:  strings.ToLower(r.str("log.level")),
+		Format: strings.ToLower(r.str("log.format")),
+	}
+
+	loaded.Limits = LimitsConf{
+		ChatRequestsPerMinute: r.integer("limits.chat_requests_per_minute"),
+		TrustedProxies:        r.prefixes("limits.trusted_proxies"),
+	}
+
+	loaded.Metrics = MetricsConf{
+		Token: r.secret("metrics.token"),
+	}
+
+	loaded.Tracing = TracingConf{
+		Exporter:     strings.ToLower(r.str("tracing.exporter")),
+		OTLPEndpoint: r.str("tracing.otlp_endpoint"),
+		OTLPHeaders:  r.secret("tracing.otlp_headers"),
+		ServiceName:  r.str("tracing.service_name"),
+		SampleRatio:  r.float("tracing.sample_ratio"),
+	}
+
+	loaded.Pricing = PricingConf{
+		DefaultPromptPer1K:     r.float("pricing.default_prompt_per_1k"),
+		DefaultCompletionPer1K: r.float("pricing.default_completion_per_1k"),
+	}
+
+	loaded.DB = DBConf{
+		URL:              r.str("database.url"),
+		Host:             r.str("database.host"),
+		Port:             r.str("database.port"),
+		User:             r.str("database.user"),
+		Pass:             r.secret("database.pass"),
+		Database:         r.str("database.name"),
+		SSLMode:          r.str("database.sslmode"),
+		ConnectTimeout:   r.duration("database.connect_timeout"),
+		StatementTimeout: r.duration("database.statement_timeout"),
+		MaxOpenConns:     r.integer("database.max_open_conns"),
+		MaxIdleConns:     r.integer("database.max_idle_conns"),
+		ConnMaxLifetime:  r.duration("database.conn_max_lifetime"),
+		ConnMaxIdleTime:  r.duration("database.conn_max_idle_time"),
+	}
+
+	loaded.AI = AIConf{
+		OllamaHost:   r.str("ai.ollama_host"),
+		DefaultModel: r.str("ai.default_model"),
+	}
+
+	loaded.Jobs = JobsConf{
+		CreditExpiryInterval: r.duration("jobs.credit_expiry_interval"),
+		OrderExpiryInterval:  r.duration("jobs.order_expiry_interval"),
+	}
+
+	loaded.Orders = OrdersConf{
+		CardTTL:   r.duration("orders.pending_ttl_card"),
+		PixTTL:    r.duration("orders.pending_ttl_pix"),
+		BoletoTTL: r.duration("orders.pending_ttl_boleto"),
+	}
+
+	loaded.Notify = NotifyConf{
+		SMTPHost: r.str("notify.smtp_host"),
+		SMTPPort: r.str("notify.smtp_port"),
+		SMTPUser: r.str("notify.smtp_user"),
+		SMTPPass: r.secret("notify.smtp_pass"),
+		SMTPFrom: r.str("notify.smtp_from"),
+	}
+
+	loaded.Transfers = TransfersConf{
+		ApprovalLimitCredits: int64(r.integer("transfers.approval_limit_credits")),
+	}
+
+	loaded.Invoicing = InvoicingConf{
+		TaxRateBP:                r.integer("invoicing.tax_rate_bp"),
+		PostpaidCreditPriceCents: int64(r.integer("invoicing.postpaid_credit_price_cents")),
+	}
+
+	loaded.Subscriptions = SubscriptionsConf{
+		RenewalInterval: r.duration("subscriptions.renewal_interval"),
+		RetryInterval:   r.duration("subscriptions.retry_interval"),
+		GracePeriod:     r.duration("subscriptions.grace_period"),
+	}
+
+	loaded.Payments = PaymentsConf{
+		Provider:       r.str("payments.provider"),
+		WebhookSecret:  r.secret("payments.webhook_secret"),
+		PixKey:         r.str("payments.pix_key"),
+		MerchantName:   r.str("payments.merchant_name"),
+		MerchantCity:   r.str("payments.merchant_city"),
+		BoletoBankCode: r.str("payments.boleto_bank_code"),
+		BoletoDays:     r.integer("payments.boleto_days"),
+	}
+
+	return loaded, append(r.problems, loaded.validate()...)
+}
+
+func store(c *config) {
+	var level slog.Level
+	level.UnmarshalText([]byte(c.Log.Level))
+	logLevel.Set(level)
+	cfg.Store(c)
+}
+
+func readConfigFile(path string) error {
+	explicit := flags.configPath
+	if explicit == "" {
+		explicit = os.Getenv(EnvPrefix + "_CONFIG")
+	}
+
+	if explicit != "" {
+		if info, err := os.Stat(explicit); err == nil && info.IsDir() {
+			viper.SetConfigFile(filepath.Join(explicit, "config.toml"))
+		} else {
+			viper.SetConfigFile(explicit)
+		}
+		if err := viper.ReadInConfig(); err != nil {
+			return fmt.Errorf("read config %s: %w", explicit, err)
+		}
+		return nil
+	}
+
 	viper.SetConfigName("config")
 	viper.SetConfigType("toml")
 	viper.AddConfigPath(path) // pq o ideal é que esse arquivo com as variaveis sempre esteja ao lado do binário
@@ -46,37 +452,347 @@ func Load(path string) error {
 			return err
 		}
 	}
+	return nil
+}
+
+func envName(key string) string {
+	return EnvPrefix + "_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// reader converts raw settings, remembering every value it could not parse
+// instead of silently reading it as zero.
+type reader struct {
+	problems []string
+	values   map[string]any
+}
+
+func (r *reader) str(key string) string {
+	v := strings.TrimSpace(viper.GetString(key))
+	r.values[key] = v
+	return v
+}
+
+// secret is str without the trimming, since whitespace can be part of a
+// password.
+func (r *reader) secret(key string) string {
+	v := viper.GetString(key)
+	r.values[key] = v
+	return v
+}
+
+// list reads an array, or a comma-separated string as environment variables
+// and flags provide.
+func (r *reader) list(key string) []string {
+	var items []string
+	if raw, ok := viper.Get(key).(string); ok {
+		items = strings.Split(raw, ",")
+	} else {
+		var err error
+		if items, err = cast.ToStringSliceE(viper.Get(key)); err != nil {
+			r.problems = append(r.problems, fmt.Sprintf("%s: invalid list %q", key, viper.GetString(key)))
+		}
+	}
 
-	cfg = new(config)
+	list := []string{}
+	for _, item := range items {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	r.values[key] = list
+	return list
+}
 
-	cfg.API = APIConfig{
-		Port: viper.GetString("api.port"),
+// prefixes reads a list of IP addresses and CIDR ranges; a bare address is
+// a range of one.
+func (r *reader) prefixes(key string) []netip.Prefix {
+	prefixes := []netip.Prefix{}
+	for _, item := range r.list(key) {
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(item)
+			if addrErr != nil {
+				r.problems = append(r.problems, fmt.Sprintf("%s: %q is not an IP address or CIDR range", key, item))
+				continue
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		prefixes = append(prefixes, prefix.Masked())
 	}
+	return prefixes
+}
 
-	cfg.DB = DBConf{
-		Host:     viper.GetString("database.host"),
-		Port:     viper.GetString("database.port"),
-		User:     viper.GetString("database.user"),
-		Pass:     viper.GetString("database.pass"),
-		Database: viper.GetString("database.name"),
+func (r *reader) duration(key string) time.Duration {
+	d, err := cast.ToDurationE(viper.Get(key))
+	if err != nil {
+		r.problems = append(r.problems, fmt.Sprintf("%s: invalid duration %q", key, viper.GetString(key)))
 	}
+	r.values[key] = d.String()
+	return d
+}
 
-	cfg.AI = AIConf{
-		OllamaHost:   viper.GetString("ai.ollama_host"),
-		DefaultModel: viper.GetString("ai.default_model"),
+func (r *reader) integer(key string) int {
+	n, err := cast.ToIntE(viper.Get(key))
+	if err != nil {
+		r.problems = append(r.problems, fmt.Sprintf("%s: invalid integer %q", key, viper.GetString(key)))
 	}
+	r.values[key] = n
+	return n
+}
 
-	return nil
+func (r *reader) float(key string) float64 {
+	f, err := cast.ToFloat64E(viper.Get(key))
+	if err != nil {
+		r.problems = append(r.problems, fmt.Sprintf("%s: invalid number %q", key, viper.GetString(key)))
+	}
+	r.values[key] = f
+	return f
+}
+
+// secretFile replaces key with the contents of the file named by key_file,
+// when one is given, so secrets can come from mounted files rather than the
+// environment.
+func (r *reader) secretFile(key string) {
+	path := strings.TrimSpace(viper.GetString(key + "_file"))
+	if path == "" {
+		return
+	}
+	body, err := os.ReadFile(path)
+	if err != nil {
+		r.problems = append(r.problems, fmt.Sprintf("%s_file: %v", key, err))
+		return
+	}
+	viper.Set(key, strings.TrimRight(string(body), "\r\n"))
+}
+
+func (c *config) validate() []string {
+	var problems []string
+	add := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	checkPort := func(key, value string) {
+		if port, err := cast.ToIntE(value); err != nil || port < 1 || port > 65535 {
+			add("%s: %q is not a valid port", key, value)
+		}
+	}
+	nonNegative := func(key string, d time.Duration) {
+		if d < 0 {
+			add("%s: cannot be negative", key)
+		}
+	}
+	positive := func(key string, d time.Duration) {
+		if d <= 0 {
+			add("%s: must be positive", key)
+		}
+	}
+
+	checkPort("api.port", c.API.Port)
+	positive("api.read_header_timeout", c.API.ReadHeaderTimeout)
+	positive("api.read_timeout", c.API.ReadTimeout)
+	positive("api.write_timeout", c.API.WriteTimeout)
+	positive("api.idle_timeout", c.API.IdleTimeout)
+	nonNegative("api.shutdown_delay", c.API.ShutdownDelay)
+	positive("api.shutdown_timeout", c.API.ShutdownTimeout)
+	for _, origin := range c.API.CORSOrigins {
+		if strings.Count(origin, "*") > 1 {
+			add("api.cors_origins: %q may hold at most one *", origin)
+		}
+	}
+
+	if !slices.Contains(logLevels, c.Log.Level) {
+		add("log.level: %q is not one of %s", c.Log.Level, strings.Join(logLevels, ", "))
+	}
+	if !slices.Contains(logFormats, c.Log.Format) {
+		add("log.format: %q is not one of %s", c.Log.Format, strings.Join(logFormats, ", "))
+	}
+	if c.Limits.ChatRequestsPerMinute < 0 {
+		add("limits.chat_requests_per_minute: cannot be negative")
+	}
+	if c.Pricing.DefaultPromptPer1K <= 0 || c.Pricing.DefaultCompletionPer1K <= 0 {
+		add("pricing.default_prompt_per_1k and pricing.default_completion_per_1k must be positive")
+	}
+
+	if c.DB.URL != "" {
+		if u, err := url.Parse(c.DB.URL); err != nil || (u.Scheme != "postgres" && u.Scheme != "postgresql") {
+			add("database.url: must be a postgres:// URL")
+		}
+	} else {
+		for _, required := range []struct{ key, value string }{
+			{"database.host", c.DB.Host},
+			{"database.user", c.DB.User},
+			{"database.name", c.DB.Database},
+		} {
+			if required.value == "" {
+				add("%s: required unless database.url or DATABASE_URL is set", required.key)
+			}
+		}
+		checkPort("database.port", c.DB.Port)
+	}
+	if !slices.Contains(sslModes, c.DB.SSLMode) {
+		add("database.sslmode: %q is not one of %s", c.DB.SSLMode, strings.Join(sslModes, ", "))
+	}
+	if c.DB.ConnectTimeout%time.Second != 0 {
+		add("database.connect_timeout: must be whole seconds")
+	}
+	nonNegative("database.connect_timeout", c.DB.ConnectTimeout)
+	nonNegative("database.statement_timeout", c.DB.StatementTimeout)
+	nonNegative("database.conn_max_lifetime", c.DB.ConnMaxLifetime)
+	nonNegative("database.conn_max_idle_time", c.DB.ConnMaxIdleTime)
+	if c.DB.MaxOpenConns < 0 || c.DB.MaxIdleConns < 0 {
+		add("database.max_open_conns and database.max_idle_conns cannot be negative")
+	}
+	if c.DB.MaxOpenConns > 0 && c.DB.MaxIdleConns > c.DB.MaxOpenConns {
+		add("database.max_idle_conns: cannot exceed database.max_open_conns (%d)", c.DB.MaxOpenConns)
+	}
+
+	if u, err := url.Parse(c.AI.OllamaHost); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		add("ai.ollama_host: %q is not an http(s) URL", c.AI.OllamaHost)
+	}
+
+	if !slices.Contains(traceExporters, c.Tracing.Exporter) {
+		add("tracing.exporter: %q is not one of %s", c.Tracing.Exporter, strings.Join(traceExporters, ", "))
+	}
+	if c.Tracing.Exporter == "otlp" {
+		if u, err := url.Parse(c.Tracing.OTLPEndpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add("tracing.otlp_endpoint: %q is not an http(s) URL", c.Tracing.OTLPEndpoint)
+		}
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		add("tracing.sample_ratio: must be between 0 and 1")
+	}
+
+	positive("jobs.credit_expiry_interval", c.Jobs.CreditExpiryInterval)
+	positive("jobs.order_expiry_interval", c.Jobs.OrderExpiryInterval)
+
+	nonNegative("orders.pending_ttl_card", c.Orders.CardTTL)
+	nonNegative("orders.pending_ttl_pix", c.Orders.PixTTL)
+	nonNegative("orders.pending_ttl_boleto", c.Orders.BoletoTTL)
+
+	if c.Notify.SMTPHost != "" {
+		checkPort("notify.smtp_port", c.Notify.SMTPPort)
+	}
+
+	if c.Transfers.ApprovalLimitCredits < 0 {
+		add("transfers.approval_limit_credits: cannot be negative")
+	}
+
+	if c.Invoicing.TaxRateBP < 0 || c.Invoicing.TaxRateBP > 10000 {
+		add("invoicing.tax_rate_bp: must be between 0 and 10000")
+	}
+	if c.Invoicing.PostpaidCreditPriceCents < 0 {
+		add("invoicing.postpaid_credit_price_cents: cannot be negative")
+	}
+
+	positive("subscriptions.renewal_interval", c.Subscriptions.RenewalInterval)
+	positive("subscriptions.retry_interval", c.Subscriptions.RetryInterval)
+	nonNegative("subscriptions.grace_period", c.Subscriptions.GracePeriod)
+
+	if !slices.Contains(paymentProviders, c.Payments.Provider) {
+		add("payments.provider: %q is not one of %s", c.Payments.Provider, strings.Join(paymentProviders, ", "))
+	}
+	if c.Payments.WebhookSecret == "" {
+		add("payments.webhook_secret: required to verify payment webhooks")
+	}
+	if c.Payments.BoletoDays <= 0 {
+		add("payments.boleto_days: must be positive")
+	}
+
+	return problems
 }
 
 func GetDB() DBConf {
-	return cfg.DB
+	return cfg.Load().DB
 }
 
 func GetServerPort() string {
-	return cfg.API.Port
+	return cfg.Load().API.Port
+}
+
+func GetAPI() APIConfig {
+	return cfg.Load().API
+}
+
+func GetLimits() LimitsConf {
+	return cfg.Load().Limits
+}
+
+func GetMetrics() MetricsConf {
+	return cfg.Load().Metrics
+}
+
+func GetLog() LogConf {
+	return cfg.Load().Log
+}
+
+func GetTracing() TracingConf {
+	return cfg.Load().Tracing
+}
+
+func GetPricing() PricingConf {
+	return cfg.Load().Pricing
+}
+
+// LogLevel is the minimum level to log, updated in place on reload.
+func LogLevel() slog.Leveler {
+	return logLevel
+}
+
+// AllowsOrigin reports whether origin may call the API from a browser.
+func (c APIConfig) AllowsOrigin(origin string) bool {
+	origin = strings.ToLower(origin)
+	for _, allowed := range c.CORSOrigins {
+		allowed = strings.ToLower(allowed)
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+		if prefix, suffix, ok := strings.Cut(allowed, "*"); ok &&
+			len(origin) >= len(prefix)+len(suffix) && strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) {
+			return true
+		}
+	}
+	return false
 }
 
 func GetAI() AIConf {
-	return cfg.AI
+	return cfg.Load().AI
+}
+
+func GetJobs() JobsConf {
+	return cfg.Load().Jobs
+}
+
+func GetNotify() NotifyConf {
+	return cfg.Load().Notify
+}
+
+func GetTransfers() TransfersConf {
+	return cfg.Load().Transfers
+}
+
+func GetInvoicing() InvoicingConf {
+	return cfg.Load().Invoicing
+}
+
+func GetSubscriptions() SubscriptionsConf {
+	return cfg.Load().Subscriptions
+}
+
+func GetPayments() PaymentsConf {
+	return cfg.Load().Payments
+}
+
+// PendingTTL maps each payment method that expires to its TTL.
+func (c OrdersConf) PendingTTL() map[string]time.Duration {
+	ttls := map[string]time.Duration{}
+	for method, ttl := range map[string]time.Duration{"CARD": c.CardTTL, "PIX": c.PixTTL, "BOLETO": c.BoletoTTL} {
+		if ttl > 0 {
+			ttls[method] = ttl
+		}
+	}
+	return ttls
+}
+
+func GetOrders() OrdersConf {
+	return cfg.Load().Orders
 }
@@ -0,0 +1,175 @@
+package configs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func writeConfig(t *testing.T, body string) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "config.toml"), []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestLoadPrecedenceAndSecretFiles(t *testing.T) {
+	viper.Reset()
+	dir := writeConfig(t, `
+[database]
+host = "file-host"
+user = "app"
+pass = "from-file"
+name = "crud"
+max_open_conns = 10
+
+[payments]
+webhook_secret = "toml-secret"
+`)
+
+	secret := filepath.Join(t.TempDir(), "db_pass")
+	if err := os.WriteFile(secret, []byte("s3cret pass\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CRUD_DATABASE_HOST", "env-host")
+	t.Setenv("CRUD_DATABASE_PASS_FILE", secret)
+	t.Setenv("CRUD_DATABASE_STATEMENT_TIMEOUT", "2s")
+
+	if err := Load(dir); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	db := GetDB()
+	if db.Host != "env-host" {
+		t.Errorf("host = %q, want the environment to win over config.toml", db.Host)
+	}
+	if db.Pass != "s3cret pass" {
+		t.Errorf("pass = %q, want the secret file contents", db.Pass)
+	}
+	if db.StatementTimeout != 2*time.Second || db.MaxOpenConns != 10 || db.SSLMode != "disable" {
+		t.Errorf("unexpected db settings %+v", db)
+	}
+}
+
+func TestLoadReportsEveryProblem(t *testing.T) {
+	viper.Reset()
+	dir := writeConfig(t, `
+[api]
+port = "http"
+
+[jobs]
+credit_expiry_interval = "soon"
+
+[database]
+sslmode = "maybe"
+
+[limits]
+trusted_proxies = ["10.0.0.0/8", "proxy.internal"]
+`)
+
+	err := Load(dir)
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("err = %v, want a ValidationError", err)
+	}
+
+	want := []string{
+		"jobs.credit_expiry_interval: invalid duration",
+		"api.port",
+		"database.user",
+		"database.name",
+		"database.sslmode",
+		"payments.webhook_secret",
+		`limits.trusted_proxies: "proxy.internal"`,
+	}
+	for _, w := range want {
+		found := false
+		for _, p := range verr.Problems {
+			if strings.HasPrefix(p, w) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("problems %q do not mention %s", verr.Problems, w)
+		}
+	}
+}
+
+func TestReloadSwapsOnlyReloadableSettings(t *testing.T) {
+	viper.Reset()
+	dir := writeConfig(t, `
+[database]
+user = "app"
+name = "crud"
+
+[ai]
+default_model = "gemma3:1b"
+
+[payments]
+webhook_secret = "toml-secret"
+`)
+	if err := Load(dir); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	rewrite := func(body string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, "config.toml"), []byte(body), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		reload()
+	}
+
+	rewrite(`
+[database]
+user = "app"
+name = "other"
+
+[ai]
+default_model = "llama3"
+
+[payments]
+webhook_secret = "toml-secret"
+`)
+	if got := GetAI().DefaultModel; got != "llama3" {
+		t.Errorf("default model = %q, want the reloaded value", got)
+	}
+	if got := GetDB().Database; got != "crud" {
+		t.Errorf("database = %q, want the boot value until restart", got)
+	}
+
+	rewrite(`
+[database]
+user = "app"
+name = "crud"
+
+[ai]
+default_model = "mistral"
+ollama_host = "not a url"
+
+[payments]
+webhook_secret = "toml-secret"
+`)
+	if got := GetAI().DefaultModel; got != "llama3" {
+		t.Errorf("default model = %q, want an invalid file rejected whole", got)
+	}
+
+	eff := Effective()
+	if eff.Settings["payments.webhook_secret"] != redacted || eff.Settings["ai.default_model"] != "llama3" {
+		t.Errorf("unexpected effective settings %v", eff.Settings)
+	}
+}
+
+func TestShippedConfigLoads(t *testing.T) {
+	viper.Reset()
+	if err := Load("../main"); err != nil {
+		t.Fatalf("cmd/main/config.toml does not load: %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+package configs
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// flags holds the values of the flags added by RegisterFlags; Load applies
+// them over every other source.
+var flags struct {
+	configPath  string
+	port        string
+	databaseURL string
+	overrides   overrideFlag
+}
+
+// RegisterFlags adds the configuration flags to fs. Parse fs before Load.
+func RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&flags.configPath, "config", "", "config.toml, or the directory holding it")
+	fs.StringVar(&flags.port, "port", "", "HTTP port (api.port)")
+	fs.StringVar(&flags.databaseURL, "database-url", "", "postgres:// URL (database.url)")
+	fs.Var(&flags.overrides, "set", "override any setting as section.key=value; repeatable")
+}
+
+// overrideFlag collects repeated -set section.key=value flags.
+type overrideFlag []string
+
+func (o *overrideFlag) String() string {
+	return strings.Join(*o, ",")
+}
+
+func (o *overrideFlag) Set(raw string) error {
+	key, _, ok := strings.Cut(raw, "=")
+	if !ok || strings.TrimSpace(key) == "" {
+		return fmt.Errorf("want section.key=value, got %q", raw)
+	}
+	if !knownKey(strings.TrimSpace(key)) {
+		return fmt.Errorf("unknown setting %q", key)
+	}
+	*o = append(*o, raw)
+	return nil
+}
+
+func applyFlags() {
+	for _, raw := range flags.overrides {
+		key, value, _ := strings.Cut(raw, "=")
+		viper.Set(strings.TrimSpace(key), value)
+	}
+	if flags.port != "" {
+		viper.Set("api.port", flags.port)
+	}
+	if flags.databaseURL != "" {
+		viper.Set("database.url", flags.databaseURL)
+	}
+}
+
+func knownKey(key string) bool {
+	for _, s := range settings {
+		if s.key == key || (s.secret && s.key+"_file" == key) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+package configs
+
+import (
+	"fmt"
+	"log/slog"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+)
+
+const redacted = "[REDACTED]"
+
+// Watch reloads the reloadable settings whenever config.toml changes. It
+// does nothing when the configuration came only from the environment.
+func Watch() {
+	if viper.ConfigFileUsed() == "" {
+		return
+	}
+	viper.OnConfigChange(func(fsnotify.Event) { reload() })
+	viper.WatchConfig()
+}
+
+// reload re-reads config.toml and swaps in its reloadable settings. A file
+// that fails to parse or validate is rejected as a whole and the running
+// configuration stays. Other settings keep their boot values, with a warning
+// that they need a restart.
+func reload() {
+	// The watcher has already read the file but swallows parse errors.
+	if err := viper.ReadInConfig(); err != nil {
+		slog.Error("config reload rejected, keeping the running configuration", "file", viper.ConfigFileUsed(), "error", err)
+		return
+	}
+
+	next, problems := build()
+	if len(problems) > 0 {
+		slog.Error("config reload rejected, keeping the running configuration", "file", viper.ConfigFileUsed(), "problems", problems)
+		return
+	}
+
+	current := cfg.Load()
+	merged := *current
+	merged.API.CORSOrigins = next.API.CORSOrigins
+	merged.AI = next.AI
+	merged.Limits = next.Limits
+	merged.Log.Level = next.Log.Level
+	merged.Pricing = next.Pricing
+	merged.values = make(map[string]any, len(current.values))
+	merged.loadedAt = next.loadedAt
+
+	var changed, needRestart []string
+	for _, s := range settings {
+		before, after := current.values[s.key], next.values[s.key]
+		merged.values[s.key] = before
+		if reflect.DeepEqual(before, after) {
+			continue
+		}
+		if s.reloadable {
+			merged.values[s.key] = after
+			changed = append(changed, s.key)
+		} else {
+			needRestart = append(needRestart, s.key)
+		}
+	}
+
+	if len(needRestart) > 0 {
+		slog.Warn("config changes need a restart to apply", "settings", needRestart)
+	}
+	if len(changed) == 0 {
+		return
+	}
+
+	store(&merged)
+	slog.Info("config reloaded", "file", viper.ConfigFileUsed(), "changed", changed)
+}
+
+// EffectiveConfig is the configuration the process is running with.
+type EffectiveConfig struct {
+	LoadedAt   time.Time      `json:"loaded_at"`
+	Settings   map[string]any `json:"settings"`
+	Reloadable []string       `json:"reloadable"`
+}
+
+// Effective returns the running configuration with every secret that is set
+// replaced by a placeholder.
+func Effective() EffectiveConfig {
+	current := cfg.Load()
+	eff := EffectiveConfig{
+		LoadedAt: current.loadedAt,
+		Settings: make(map[string]any, len(settings)),
+	}
+
+	for _, s := range settings {
+		value := current.values[s.key]
+		if s.secret && fmt.Sprint(value) != "" {
+			value = redacted
+		}
+		eff.Settings[s.key] = value
+		if s.reloadable {
+			eff.Reloadable = append(eff.Reloadable, s.key)
+		}
+	}
+	sort.Strings(eff.Reloadable)
+
+	return eff
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Enilsonn/CRUD-Postgres/internal/model"
+)
+
+func runClients(ctx context.Context, a *app, args []string) error {
+	action, args, err := subcommand("clients", args, map[string]command{
+		"create": createClient,
+	})
+	if err != nil {
+		return err
+	}
+	return action(ctx, a, args)
+}
+
+func createClient(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("clients create")
+	name := fs.String("name", "", "client name (required)")
+	email := fs.String("email", "", "client email (required)")
+	phone := fs.String("phone", "", "client phone")
+	city := fs.String("city", "", "client city")
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+	if strings.TrimSpace(*name) == "" || strings.TrimSpace(*email) == "" {
+		return fmt.Errorf("%w: -name and -email are required", errUsage)
+	}
+
+	client := model.NewCliente(strings.TrimSpace(*name), strings.TrimSpace(*email), strings.TrimSpace(*phone))
+	if trimmed := strings.TrimSpace(*city); trimmed != "" {
+		client.City = sql.NullString{String: trimmed, Valid: true}
+	}
+
+	id, err := a.clients.CreateClient(ctx, *client)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("created client %d\n", id)
+	return nil
+}
+
+func runCredits(ctx context.Context, a *app, args []string) error {
+	action, args, err := subcommand("credits", args, map[string]command{
+		"grant":  grantCredits,
+		"adjust": adjustCredits,
+	})
+	if err != nil {
+		return err
+	}
+	return action(ctx, a, args)
+}
+
+func grantCredits(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("credits grant")
+	clientID := fs.Int64("client", 0, "client ID (required)")
+	credits := fs.Int64("credits", 0, "credits to grant (required)")
+	validityDays := fs.Int("validity-days", 0, "days until the granted credits expire; 0 never expires")
+	reason := fs.String("reason", "", "why the credits are granted (required)")
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+	if *clientID <= 0 || *credits <= 0 || strings.TrimSpace(*reason) == "" {
+		return fmt.Errorf("%w: -client, -credits and -reason are required and must be positive", errUsage)
+	}
+	if *validityDays < 0 {
+		return fmt.Errorf("%w: -validity-days cannot be negative", errUsage)
+	}
+
+	var validity *int
+	if *validityDays > 0 {
+		validity = validityDays
+	}
+
+	wallet, err := a.wallets.GrantCredits(ctx, *clientID, *credits, validity, strings.TrimSpace(*reason), a.actor)
+	if err != nil {
+		return err
+	}
+
+	printWallet(wallet)
+	return nil
+}
+
+func adjustCredits(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("credits adjust")
+	clientID := fs.Int64("client", 0, "client ID (required)")
+	delta := fs.Int64("delta", 0, "credits to add, or remove when negative (required)")
+	reason := fs.String("reason", "", "why the balance is corrected (required)")
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+	if *clientID <= 0 || *delta == 0 || strings.TrimSpace(*reason) == "" {
+		return fmt.Errorf("%w: -client, -delta and -reason are required", errUsage)
+	}
+
+	wallet, err := a.wallets.AdjustCredits(ctx, *clientID, *delta, strings.TrimSpace(*reason), a.actor)
+	if err != nil {
+		return err
+	}
+
+	printWallet(wallet)
+	return nil
+}
+
+func printWallet(w *model.Wallet) {
+	fmt.Printf("client %d: balance %d credits", w.ClientID, w.BalanceCredits)
+	if w.CreditLimitCredits > 0 {
+		fmt.Printf(", %d available on a %d credit line", w.AvailableCredits, w.CreditLimitCredits)
+	}
+	fmt.Println()
+}
+
+func runSellers(ctx context.Context, a *app, args []string) error {
+	action, args, err := subcommand("sellers", args, map[string]command{
+		"list":   listSellers,
+		"create": createSeller,
+	})
+	if err != nil {
+		return err
+	}
+	return action(ctx, a, args)
+}
+
+func listSellers(ctx context.Context, a *app, args []string) error {
+	if err := parseFlags(newFlagSet("sellers list"), args, 0); err != nil {
+		return err
+	}
+
+	sellers, err := a.sellers.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME")
+	for _, s := range sellers {
+		fmt.Fprintf(w, "%d\t%s\n", s.ID, s.Name)
+	}
+	return w.Flush()
+}
+
+func createSeller(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("sellers create")
+	if err := parseFlags(fs, args, 1); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("%w: usage: crudctl sellers create NAME", errUsage)
+	}
+
+	// Seller names are unique ignoring case, so this returns the existing
+	// seller rather than a duplicate.
+	id, err := a.sellers.GetOrCreateByName(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("seller %d\n", id)
+	return nil
+}
+
+func runReconcile(ctx context.Context, a *app, args []string) error {
+	if err := parseFlags(newFlagSet("reconcile"), args, 0); err != nil {
+		return err
+	}
+
+	drifts, err := a.wallets.ReconcileWallets(ctx)
+	if err != nil {
+		return err
+	}
+	if len(drifts) == 0 {
+		fmt.Println("all wallets reconcile")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "CLIENT\tBALANCE\tLEDGER\tLOTS\t")
+	for _, d := range drifts {
+		fmt.Fprintf(w, "%d\t%d\t%d\t%d\t\n", d.ClientID, d.BalanceCredits, d.LedgerCredits, d.LotCredits)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	return fmt.Errorf("%d wallets out of balance", len(drifts))
+}
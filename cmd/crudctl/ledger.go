@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Enilsonn/CRUD-Postgres/internal/model"
+	"github.com/Enilsonn/CRUD-Postgres/internal/service"
+)
+
+func runLedger(ctx context.Context, a *app, args []string) error {
+	action, args, err := subcommand("ledger", args, map[string]command{
+		"list": listLedger,
+	})
+	if err != nil {
+		return err
+	}
+	return action(ctx, a, args)
+}
+
+func listLedger(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("ledger list")
+	clientID := fs.Int64("client", 0, "client ID; 0 lists every client")
+	types := fs.String("type", "", "comma-separated entry types, e.g. TOPUP,USAGE")
+	from := fs.String("from", "", "entries at or after this date")
+	to := fs.String("to", "", "entries up to and including this date")
+	modelName := fs.String("model", "", "usage entries for this model")
+	orderID := fs.Int64("order", 0, "entries booked for this order")
+	limit := fs.Int("limit", 50, "entries per page")
+	cursor := fs.String("cursor", "", "next_cursor from a previous page")
+	asJSON := fs.Bool("json", false, "print the page as JSON")
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+
+	q := service.LedgerQuery{
+		ClientID: *clientID,
+		Types:    splitList(*types),
+		Model:    *modelName,
+		Cursor:   *cursor,
+		Limit:    *limit,
+	}
+	var err error
+	if q.From, err = parseTime(*from, false); err != nil {
+		return err
+	}
+	if q.To, err = parseTime(*to, true); err != nil {
+		return err
+	}
+	if *orderID > 0 {
+		q.OrderID = orderID
+	}
+
+	page, err := a.ledger.Search(ctx, q)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(page)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tCREATED\tCLIENT\tTYPE\tCREDITS\tCENTS\tMETA")
+	for _, e := range page.Entries {
+		fmt.Fprintf(w, "%d\t%s\t%d\t%s\t%d\t%d\t%s\n",
+			e.ID, e.CreatedAt.Local().Format(time.RFC3339), e.ClientID, e.Type, e.CreditsDelta, e.PriceCentsDelta, e.Meta)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Printf("\n%d entries matched: %d credits in, %d out\n", page.Totals.EntriesCount, page.Totals.CreditsIn, page.Totals.CreditsOut)
+	if page.NextCursor != "" {
+		fmt.Printf("next page: -cursor %s\n", page.NextCursor)
+	}
+	return nil
+}
+
+func runPricing(ctx context.Context, a *app, args []string) error {
+	action, args, err := subcommand("pricing", args, map[string]command{
+		"list":    listPricing,
+		"set":     setPricing,
+		"enable":  func(ctx context.Context, a *app, args []string) error { return togglePricing(ctx, a, args, true) },
+		"disable": func(ctx context.Context, a *app, args []string) error { return togglePricing(ctx, a, args, false) },
+	})
+	if err != nil {
+		return err
+	}
+	return action(ctx, a, args)
+}
+
+func listPricing(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("pricing list")
+	all := fs.Bool("all", false, "include disabled rules")
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+
+	var (
+		rates []*model.ModelPricing
+		err   error
+	)
+	if *all {
+		rates, err = a.pricing.ListAll(ctx)
+	} else {
+		rates, err = a.pricing.ListActive(ctx)
+	}
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tPRIORITY\tPATTERN\tPROMPT/1K\tCOMPLETION/1K\tACTIVE\tUPDATED")
+	for _, rate := range rates {
+		fmt.Fprintf(w, "%d\t%d\t%s\t%g\t%g\t%t\t%s\n", rate.ID, rate.Priority, rate.Pattern,
+			rate.CreditsPer1KPrompt, rate.CreditsPer1KCompletion, rate.Active, rate.UpdatedAt.Local().Format(time.RFC3339))
+	}
+	return w.Flush()
+}
+
+// setPricing creates a rule, or replaces rule -id, with the same checks the
+// API applies.
+func setPricing(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("pricing set")
+	id := fs.Int64("id", 0, "rule to replace; omit to create a new rule")
+	pattern := fs.String("pattern", "", "regular expression matched against the model name (required)")
+	prompt := fs.Float64("prompt", 0, "credits per 1K prompt tokens (required)")
+	completion := fs.Float64("completion", 0, "credits per 1K completion tokens (required)")
+	priority := fs.Int("priority", 100, "lower priorities are matched first")
+	inactive := fs.Bool("inactive", false, "save the rule disabled")
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(*pattern) == "" {
+		return fmt.Errorf("%w: -pattern is required", errUsage)
+	}
+	if _, err := regexp.Compile(*pattern); err != nil {
+		return fmt.Errorf("%w: invalid pattern: %v", errUsage, err)
+	}
+	if *prompt <= 0 || *completion <= 0 || math.IsNaN(*prompt) || math.IsNaN(*completion) {
+		return fmt.Errorf("%w: -prompt and -completion must be positive", errUsage)
+	}
+
+	rate, err := a.pricing.Upsert(ctx, &model.ModelPricing{
+		ID:                     *id,
+		Pattern:                *pattern,
+		CreditsPer1KPrompt:     *prompt,
+		CreditsPer1KCompletion: *completion,
+		Priority:               *priority,
+		Active:                 !*inactive,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("saved pricing rule %d\n", rate.ID)
+	return nil
+}
+
+func togglePricing(ctx context.Context, a *app, args []string, active bool) error {
+	fs := newFlagSet("pricing enable|disable")
+	if err := parseFlags(fs, args, 1); err != nil {
+		return err
+	}
+	id, err := strconv.ParseInt(fs.Arg(0), 10, 64)
+	if err != nil || id <= 0 {
+		return fmt.Errorf("%w: expected a pricing rule ID", errUsage)
+	}
+
+	return a.pricing.SetActive(ctx, id, active)
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Enilsonn/CRUD-Postgres/internal/service"
+	"github.com/Enilsonn/CRUD-Postgres/internal/view"
+)
+
+func runReports(ctx context.Context, a *app, args []string) error {
+	action, args, err := subcommand("reports", args, map[string]command{
+		"sales":     salesReport,
+		"orders":    ordersReport,
+		"statement": statementReport,
+	})
+	if err != nil {
+		return err
+	}
+	return action(ctx, a, args)
+}
+
+func salesReport(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("reports sales")
+	month := fs.String("month", "", "month as YYYY-MM; every month when omitted")
+	format := fs.String("format", "csv", "csv or json")
+	out := fs.String("out", "", "file to write; stdout when omitted")
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+
+	var monthPtr *time.Time
+	if *month != "" {
+		parsed, err := time.Parse("2006-01", *month)
+		if err != nil {
+			return fmt.Errorf("%w: -month must be in YYYY-MM format", errUsage)
+		}
+		monthPtr = &parsed
+	}
+	if *format != "csv" && *format != "json" {
+		return fmt.Errorf("%w: -format must be csv or json", errUsage)
+	}
+
+	sales, err := a.reports.SellerMonthlySales(ctx, monthPtr)
+	if err != nil {
+		return err
+	}
+
+	return writeReport(*out, func(w io.Writer) error {
+		if *format == "json" {
+			return json.NewEncoder(w).Encode(sales)
+		}
+		c := csv.NewWriter(w)
+		c.Write([]string{"month", "seller_id", "orders_count", "total_cents"})
+		for _, s := range sales {
+			c.Write([]string{
+				s.Month.Format("2006-01"),
+				strconv.FormatInt(s.SellerID, 10),
+				strconv.FormatInt(s.OrdersCount, 10),
+				strconv.FormatInt(s.TotalCents, 10),
+			})
+		}
+		c.Flush()
+		return c.Error()
+	})
+}
+
+// ordersReport streams the same CSV as GET /api/orders?format=csv.
+func ordersReport(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("reports orders")
+	statuses := fs.String("status", "", "comma-separated payment statuses")
+	methods := fs.String("method", "", "comma-separated payment methods")
+	clientID := fs.Int64("client", 0, "only this client's orders")
+	sellerID := fs.Int64("seller", 0, "only this seller's orders")
+	from := fs.String("from", "", "orders created at or after this date")
+	to := fs.String("to", "", "orders created up to and including this date")
+	out := fs.String("out", "", "file to write; stdout when omitted")
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+
+	q := service.OrderQuery{
+		Statuses:       splitList(strings.ToUpper(*statuses)),
+		PaymentMethods: splitList(strings.ToUpper(*methods)),
+		ClientID:       *clientID,
+		SellerID:       *sellerID,
+	}
+	var err error
+	if q.From, err = parseTime(*from, false); err != nil {
+		return err
+	}
+	if q.To, err = parseTime(*to, true); err != nil {
+		return err
+	}
+	if err := a.orders.ValidateOrderQuery(q); err != nil {
+		return fmt.Errorf("%w: %v", errUsage, err)
+	}
+
+	return writeReport(*out, func(w io.Writer) error {
+		c := view.NewOrderCSV(w)
+		if err := a.orders.ExportOrders(ctx, q, c.Order); err != nil {
+			return err
+		}
+		return c.Close()
+	})
+}
+
+func statementReport(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("reports statement")
+	clientID := fs.Int64("client", 0, "client ID (required)")
+	month := fs.String("month", "", "month as YYYY-MM (required)")
+	format := fs.String("format", "pdf", "json, csv or pdf")
+	out := fs.String("out", "", "file to write; statement-<client>-<month>.<format> when omitted")
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+	if *clientID <= 0 {
+		return fmt.Errorf("%w: -client is required", errUsage)
+	}
+	parsed, err := time.Parse("2006-01", *month)
+	if err != nil {
+		return fmt.Errorf("%w: -month must be in YYYY-MM format", errUsage)
+	}
+	if _, err := view.NewStatementRenderer(*format, io.Discard); err != nil {
+		return fmt.Errorf("%w: -format must be json, csv or pdf", errUsage)
+	}
+
+	path := *out
+	if path == "" {
+		path = fmt.Sprintf("statement-%d-%s.%s", *clientID, parsed.Format("2006-01"), *format)
+	}
+	if err := writeReport(path, func(w io.Writer) error {
+		renderer, err := view.NewStatementRenderer(*format, w)
+		if err != nil {
+			return err
+		}
+		if err := a.ledger.Statement(ctx, *clientID, parsed, renderer.Begin, renderer.Entry); err != nil {
+			return err
+		}
+		return renderer.End()
+	}); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "wrote %s\n", path)
+	return nil
+}
+
+// writeReport runs fn against path, or stdout when path is empty. A file is
+// removed again if fn fails, so a half-written report is never left behind.
+func writeReport(path string, fn func(io.Writer) error) error {
+	if path == "" {
+		return fn(os.Stdout)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := fn(f); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	return f.Close()
+}
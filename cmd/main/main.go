@@ -1,37 +1,69 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
+	"net/netip"
+	"os"
 
 	"github.com/Enilsonn/CRUD-Postgres/cmd/configs"
 	"github.com/Enilsonn/CRUD-Postgres/database"
 	"github.com/Enilsonn/CRUD-Postgres/database/migrations"
 	"github.com/Enilsonn/CRUD-Postgres/internal/controller"
+	"github.com/Enilsonn/CRUD-Postgres/internal/metrics"
+	"github.com/Enilsonn/CRUD-Postgres/internal/notify"
+	"github.com/Enilsonn/CRUD-Postgres/internal/payments"
 	"github.com/Enilsonn/CRUD-Postgres/internal/repository"
 	"github.com/Enilsonn/CRUD-Postgres/internal/service"
+	"github.com/Enilsonn/CRUD-Postgres/internal/tracing"
 	"github.com/Enilsonn/CRUD-Postgres/internal/utils"
 	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
 )
 
 func main() {
+	configs.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+
 	err := configs.Load("./cmd/main")
 	if err != nil {
-		panic(err)
+		log.Fatal(err)
+	}
+	slog.SetDefault(slog.New(utils.NewLogHandler(os.Stderr, configs.GetLog().Format, configs.LogLevel())))
+
+	// Tracing goes first so the connection pool is opened traced.
+	shutdownTracing, err := tracing.Setup(context.Background(), configs.GetTracing())
+	if err != nil {
+		fatal("unable to set up tracing", "err", err)
 	}
 
 	conn, err := database.OpenConnection()
 	if err != nil {
-		log.Fatalf("Unable to connect to database: %v", err)
+		fatal("unable to connect to database", "err", err)
 	}
 	defer conn.Close()
 
-	err = migrations.Up(conn)
+	if flag.Arg(0) == "migrate" {
+		err := runMigrate(conn, flag.Args()[1:])
+		shutdownTracing(context.Background())
+		if err != nil {
+			conn.Close()
+			fatal("migrate failed", "err", err)
+		}
+		return
+	}
+
+	migrator, err := migrations.NewMigrator(conn)
 	if err != nil {
-		log.Fatalf("Failed to run migrations: %v", err)
+		fatal("failed to load migrations", "err", err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		conn.Close()
+		fatal("failed to run migrations", "err", err)
 	}
 
 	clientRepository := repository.NewClientRepository(conn)
@@ -41,11 +73,62 @@ func main() {
 	orderRepository := repository.NewOrderRepository(conn)
 	reportRepository := repository.NewReportRepository(conn)
 	pricingRepository := repository.NewPricingRepository(conn)
+	alertRepository := repository.NewAlertRepository(conn)
+	transferRepository := repository.NewTransferRepository(conn)
+	organizationRepository := repository.NewOrganizationRepository(conn)
+	invoiceRepository := repository.NewInvoiceRepository(conn)
+	subscriptionRepository := repository.NewSubscriptionRepository(conn)
+	paymentRepository := repository.NewPaymentRepository(conn)
+
+	notifyConf := configs.GetNotify()
+	var emailSender notify.Sender = notify.LogSender{}
+	if notifyConf.SMTPHost != "" {
+		emailSender = notify.NewSMTPSender(notifyConf.SMTPHost, notifyConf.SMTPPort, notifyConf.SMTPUser, notifyConf.SMTPPass, notifyConf.SMTPFrom)
+	}
+	sender := notify.MultiSender{notify.NewWebhookSender(), emailSender}
+
+	paymentsConf := configs.GetPayments()
+	var paymentProvider payments.Provider
+	switch paymentsConf.Provider {
+	case "fake":
+		paymentProvider = &payments.FakeProvider{
+			Secret:       paymentsConf.WebhookSecret,
+			PixKey:       paymentsConf.PixKey,
+			MerchantName: paymentsConf.MerchantName,
+			MerchantCity: paymentsConf.MerchantCity,
+			BankCode:     paymentsConf.BoletoBankCode,
+			BoletoDays:   paymentsConf.BoletoDays,
+		}
+	default:
+		fatal("unknown payment provider", "provider", paymentsConf.Provider)
+	}
 
 	planService := service.NewPlanService(productRepository)
-	orderService := service.NewOrderService(orderRepository, clientRepository, sellerRepository, productRepository, walletRepository)
+	pendingTTL := configs.GetOrders().PendingTTL()
+	orderService := service.NewOrderService(orderRepository, clientRepository, sellerRepository, productRepository, walletRepository, pendingTTL)
+	orderExpiryService := service.NewOrderExpiryService(orderRepository, pendingTTL)
 	reportService := service.NewReportService(reportRepository)
 	pricingService := service.NewPricingService(pricingRepository)
+	pricingService.DefaultRates = func() (float64, float64) {
+		pricing := configs.GetPricing()
+		return pricing.DefaultPromptPer1K, pricing.DefaultCompletionPer1K
+	}
+	ledgerService := service.NewLedgerService(walletRepository)
+	creditExpiryService := service.NewCreditExpiryService(walletRepository)
+	transferService := service.NewTransferService(transferRepository, clientRepository, configs.GetTransfers().ApprovalLimitCredits)
+	organizationService := service.NewOrganizationService(organizationRepository, clientRepository)
+	invoicingConf := configs.GetInvoicing()
+	invoiceService := service.NewInvoiceService(invoiceRepository, clientRepository, repository.InvoiceRates{
+		TaxRateBP:                invoicingConf.TaxRateBP,
+		PostpaidCreditPriceCents: invoicingConf.PostpaidCreditPriceCents,
+	})
+	paymentService := service.NewPaymentService(paymentRepository, orderRepository, clientRepository, paymentProvider)
+	subscriptionsConf := configs.GetSubscriptions()
+	subscriptionService := service.NewSubscriptionService(subscriptionRepository, clientRepository, productRepository, sellerRepository, paymentService, repository.RenewalPolicy{
+		RetryInterval: subscriptionsConf.RetryInterval,
+		GracePeriod:   subscriptionsConf.GracePeriod,
+	})
+	alertService := service.NewBalanceAlertService(alertRepository, productRepository, sellerRepository, orderService, paymentService, sender)
 
 	clientHandler := controller.NewClientHandler(clientRepository)
 	productHandler := controller.NewProductHandler(productRepository, planService)
@@ -54,19 +137,46 @@ func main() {
 	reportHandler := controller.NewReportHandler(reportService)
 	pricingHandler := controller.NewPricingHandler(pricingRepository)
 	chatHandler := controller.NewChatHandler(walletRepository, pricingService)
+	ledgerHandler := controller.NewLedgerHandler(ledgerService)
+	alertHandler := controller.NewAlertHandler(alertService)
+	transferHandler := controller.NewTransferHandler(transferService)
+	organizationHandler := controller.NewOrganizationHandler(organizationService)
+	invoiceHandler := controller.NewInvoiceHandler(invoiceService)
+	subscriptionHandler := controller.NewSubscriptionHandler(subscriptionService)
+	paymentHandler := controller.NewPaymentHandler(paymentService)
+	configHandler := controller.NewConfigHandler()
+
+	metrics.RegisterDB(conn, "postgres")
+	metrics.Registry.MustRegister(metrics.NewLedgerCollector(orderRepository, walletRepository))
+	healthHandler := controller.NewHealthHandler(conn, migrator)
+
+	walletHandler.Alerts = alertService
+	chatHandler.Alerts = alertService
+
+	jobs := newJobGroup()
+	jobs.Go(creditExpiryService.Run, configs.GetJobs().CreditExpiryInterval)
+	jobs.Go(orderExpiryService.Run, configs.GetJobs().OrderExpiryInterval)
+	jobs.Go(subscriptionService.Run, subscriptionsConf.RenewalInterval)
+
+	// Only the settings marked reloadable in configs change here; the rest of
+	// this wiring keeps its boot values until restart.
+	configs.Watch()
 
 	r := chi.NewRouter()
 
+	r.Use(utils.RequestID)
+	r.Use(tracing.Middleware)
 	r.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   []string{"http://localhost:3000", "*"},
+		AllowOriginFunc:  func(r *http.Request, origin string) bool { return configs.GetAPI().AllowsOrigin(origin) },
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "X-Role", "X-Client-ID", "X-Employee-ID", utils.RequestIDHeader},
+		ExposedHeaders:   []string{"Link", utils.RequestIDHeader},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
 
-	r.Use(middleware.Logger)
+	r.Use(metrics.Middleware)
+	r.Use(utils.RequestLogger)
 	r.Use(utils.JsonMiddleware)
 
 	r.Get("/api/health", func(w http.ResponseWriter, r *http.Request) {
@@ -74,6 +184,9 @@ func main() {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte(`{"status":"ok"}`))
 	})
+	r.Get("/healthz", healthHandler.Live)
+	r.Get("/readyz", healthHandler.Ready)
+	r.Method(http.MethodGet, "/metrics", metrics.Handler(configs.GetMetrics().Token))
 
 	r.Route("/api/clients", func(r chi.Router) {
 		r.Post("/", clientHandler.CreateClient)
@@ -91,25 +204,94 @@ func main() {
 		r.With(utils.RequireEmployee).Get("/low-stock", productHandler.LowStock)
 		r.Get("/name/{name}", productHandler.GetClientProductByName)
 		r.Get("/{id}", productHandler.GetProductByID)
+		r.With(utils.RequireEmployee).Post("/{id}/restock", productHandler.Restock)
+		r.With(utils.RequireEmployee).Get("/{id}/inventory", productHandler.Inventory)
 		r.Put("/{id}", productHandler.UpdateClientProduct)
 		r.Delete("/{id}", productHandler.DeleteClientProduct)
 	})
 
+	ownsOrder := utils.RequireOwnerOf("id", orderService.ClientOf)
 	r.Route("/api/orders", func(r chi.Router) {
 		r.Post("/", orderHandler.CreateOrder)
-		r.Post("/{id}/finalize", orderHandler.FinalizeOrder)
+		r.With(utils.RequireEmployee).Get("/", orderHandler.ListOrders)
+		r.With(utils.RequireEmployee).Get("/{id}", orderHandler.GetOrder)
+		r.With(utils.RequireEmployee).Get("/{id}/events", orderHandler.OrderEvents)
+		r.With(ownsOrder).Post("/{id}/items", orderHandler.AddOrderItem)
+		r.With(ownsOrder).Patch("/{id}/items/{item_id}", orderHandler.UpdateOrderItem)
+		r.With(ownsOrder).Delete("/{id}/items/{item_id}", orderHandler.RemoveOrderItem)
+		r.With(ownsOrder).Post("/{id}/checkout", orderHandler.CheckoutOrder)
+		r.With(utils.RequireEmployee).Post("/{id}/finalize", orderHandler.FinalizeOrder)
+		r.With(ownsOrder).Post("/{id}/payment", paymentHandler.CreatePayment)
+		r.With(ownsOrder).Get("/{id}/payment", paymentHandler.GetPayment)
+		r.With(ownsOrder).Get("/{id}/payment/pix.png", paymentHandler.PixQRCode)
+		r.With(utils.RequireEmployee).Post("/{id}/payment/simulate", paymentHandler.SimulatePayment)
 	})
 
+	r.Post("/api/webhooks/payments/{provider}", paymentHandler.Webhook)
+
 	r.Get("/api/clients/{id}/orders", orderHandler.ListClientOrders)
+	r.With(utils.RequireOwner("id")).Get("/api/clients/{id}/invoices", invoiceHandler.ListClientInvoices)
+	r.With(utils.RequireOwner("id")).Post("/api/clients/{id}/subscriptions", subscriptionHandler.Subscribe)
+	r.With(utils.RequireOwner("id")).Get("/api/clients/{id}/subscriptions", subscriptionHandler.ListClientSubscriptions)
+
+	ownsSubscription := utils.RequireOwnerOf("id", subscriptionService.ClientOf)
+	r.Route("/api/subscriptions", func(r chi.Router) {
+		r.With(ownsSubscription).Get("/{id}", subscriptionHandler.GetSubscription)
+		r.With(ownsSubscription).Post("/{id}/pause", subscriptionHandler.PauseSubscription)
+		r.With(ownsSubscription).Post("/{id}/resume", subscriptionHandler.ResumeSubscription)
+		r.With(ownsSubscription).Post("/{id}/cancel", subscriptionHandler.CancelSubscription)
+		r.With(ownsSubscription).Post("/{id}/change-plan", subscriptionHandler.ChangePlan)
+	})
+
+	ownsInvoice := utils.RequireOwnerOf("id", invoiceService.ClientOf)
+	r.Route("/api/invoices", func(r chi.Router) {
+		r.With(utils.RequireEmployee).Post("/generate", invoiceHandler.GenerateInvoices)
+		r.With(ownsInvoice).Get("/{id}", invoiceHandler.GetInvoice)
+		r.With(utils.RequireEmployee).Post("/{id}/issue", invoiceHandler.IssueInvoice)
+		r.With(utils.RequireEmployee).Post("/{id}/pay", invoiceHandler.PayInvoice)
+		r.With(utils.RequireEmployee).Post("/{id}/void", invoiceHandler.VoidInvoice)
+	})
 
 	r.Route("/api/wallets", func(r chi.Router) {
 		r.Get("/{client_id}", walletHandler.GetWalletBalance)
 		r.Get("/{client_id}/ledger", walletHandler.GetLedgerEntries)
+		r.With(utils.RequireOwner("client_id")).Get("/{client_id}/ledger/query", ledgerHandler.QueryClientLedger)
+		r.With(utils.RequireOwner("client_id")).Get("/{client_id}/statement", ledgerHandler.Statement)
+		r.With(utils.RequireOwner("client_id")).Get("/{client_id}/lots", walletHandler.ListCreditLots)
+		r.With(utils.RequireEmployee).Put("/{client_id}/credit-line", walletHandler.SetCreditLine)
+		r.With(utils.RequireOwner("client_id")).Get("/{client_id}/alerts", alertHandler.GetAlert)
+		r.With(utils.RequireOwner("client_id")).Put("/{client_id}/alerts", alertHandler.SaveAlert)
+		r.With(utils.RequireOwner("client_id")).Get("/{client_id}/alerts/events", alertHandler.ListAlertEvents)
 		r.Post("/{client_id}/topups", walletHandler.TopUpCredits)
+		r.With(utils.RequireOwner("client_id")).Post("/{client_id}/transfers", transferHandler.CreateTransfer)
+		r.With(utils.RequireOwner("client_id")).Get("/{client_id}/transfers", transferHandler.ListClientTransfers)
+	})
+
+	r.Route("/api/transfers", func(r chi.Router) {
+		r.Get("/{id}", transferHandler.GetTransfer)
+		r.With(utils.RequireEmployee).Post("/{id}/approve", transferHandler.ApproveTransfer)
+		r.With(utils.RequireEmployee).Post("/{id}/reject", transferHandler.RejectTransfer)
 	})
 
-	r.Post("/api/usage", walletHandler.ProcessUsage)
-	r.Post("/api/chat/ollama", chatHandler.ChatOllama)
+	r.Route("/api/organizations", func(r chi.Router) {
+		r.With(utils.RequireEmployee).Post("/", organizationHandler.CreateOrganization)
+		r.Get("/{id}", organizationHandler.GetOrganization)
+		r.Post("/{id}/members", organizationHandler.AddMember)
+		r.Get("/{id}/members/{client_id}", organizationHandler.GetMember)
+		r.Put("/{id}/members/{client_id}", organizationHandler.UpdateMember)
+		r.Delete("/{id}/members/{client_id}", organizationHandler.RemoveMember)
+	})
+
+	r.With(utils.RequireEmployee).Get("/api/ledger", ledgerHandler.QueryAllLedger)
+
+	chatLimit := utils.RateLimit(
+		func() int { return configs.GetLimits().ChatRequestsPerMinute },
+		func() []netip.Prefix { return configs.GetLimits().TrustedProxies },
+	)
+	r.With(chatLimit).Post("/api/usage", walletHandler.ProcessUsage)
+	r.With(chatLimit).Post("/api/chat/ollama", chatHandler.ChatOllama)
+
+	r.With(utils.RequireEmployee).Get("/api/config", configHandler.Effective)
 
 	r.Route("/api/pricing", func(r chi.Router) {
 		r.Get("/", pricingHandler.ListActive)
@@ -143,11 +325,29 @@ func main() {
 		http.ServeFile(w, r, "./ui/chat.html")
 	})
 
-	serverPort := configs.GetServerPort()
-	log.Printf("Server starting on port %s...", serverPort)
-	log.Printf("Health check endpoint: http://localhost:%s/api/health", serverPort)
+	apiConf := configs.GetAPI()
+	srv := &http.Server{
+		Addr:              fmt.Sprintf(":%s", apiConf.Port),
+		Handler:           r,
+		ReadHeaderTimeout: apiConf.ReadHeaderTimeout,
+		ReadTimeout:       apiConf.ReadTimeout,
+		WriteTimeout:      apiConf.WriteTimeout,
+		IdleTimeout:       apiConf.IdleTimeout,
+	}
+
+	slog.Info("server starting", "port", apiConf.Port,
+		"health", fmt.Sprintf("http://localhost:%s/api/health", apiConf.Port),
+		"readiness", fmt.Sprintf("http://localhost:%s/readyz", apiConf.Port))
 
-	if err := http.ListenAndServe(fmt.Sprintf(":%s", serverPort), r); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	if err := serve(srv, apiConf, healthHandler.Drain, jobs, alertService.Wait, shutdownTracing); err != nil {
+		conn.Close()
+		fatal("server stopped", "err", err)
 	}
 }
+
+// fatal logs msg at error level and exits. log.Fatal would log it at info
+// level once slog is the default logger.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Enilsonn/CRUD-Postgres/database/migrations"
+)
+
+const migrateUsage = `usage: main migrate <command>
+
+commands:
+  status     list migrations and whether they are applied
+  up         apply every pending migration
+  down [N]   revert the last N applied migrations (default 1)
+  to V       migrate up or down to version V (0 reverts everything)`
+
+// runMigrate implements the "migrate" subcommand.
+func runMigrate(db *sql.DB, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%s", migrateUsage)
+	}
+
+	m, err := migrations.NewMigrator(db)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	var changed []migrations.Migration
+	switch args[0] {
+	case "status":
+		return printMigrationStatus(ctx, m)
+	case "up":
+		changed, err = m.Up(ctx)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil {
+				return fmt.Errorf("invalid step count %q", args[1])
+			}
+		}
+		changed, err = m.Down(ctx, steps)
+	case "to":
+		if len(args) < 2 {
+			return fmt.Errorf("migrate to needs a version\n%s", migrateUsage)
+		}
+		version, convErr := strconv.Atoi(args[1])
+		if convErr != nil {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+		changed, err = m.To(ctx, version)
+	default:
+		return fmt.Errorf("unknown migrate command %q\n%s", args[0], migrateUsage)
+	}
+
+	for _, mig := range changed {
+		fmt.Printf("%04d_%s\n", mig.Version, mig.Name)
+	}
+	if err != nil {
+		return err
+	}
+	if len(changed) == 0 {
+		fmt.Println("nothing to do")
+	}
+	return nil
+}
+
+func printMigrationStatus(ctx context.Context, m *migrations.Migrator) error {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+	for _, st := range statuses {
+		applied := "pending"
+		if st.AppliedAt != nil {
+			applied = st.AppliedAt.Local().Format(time.RFC3339)
+			if st.Modified {
+				applied += " (modified since)"
+			}
+		}
+		fmt.Fprintf(w, "%04d\t%s\t%s\n", st.Version, st.Name, applied)
+	}
+	return w.Flush()
+}
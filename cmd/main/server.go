@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Enilsonn/CRUD-Postgres/cmd/configs"
+)
+
+// jobGroup runs the background jobs until shutdown stops them.
+type jobGroup struct {
+	ctx  context.Context
+	stop context.CancelFunc
+	wg   sync.WaitGroup
+}
+
+func newJobGroup() *jobGroup {
+	ctx, stop := context.WithCancel(context.Background())
+	return &jobGroup{ctx: ctx, stop: stop}
+}
+
+func (g *jobGroup) Go(run func(ctx context.Context, every time.Duration), every time.Duration) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		run(g.ctx, every)
+	}()
+}
+
+// Stop cancels the jobs and waits for them to return or ctx to end. A job
+// caught mid-pass rolls its transaction back and picks the work up on the
+// next boot.
+func (g *jobGroup) Stop(ctx context.Context) error {
+	g.stop()
+
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// serve runs srv until SIGINT or SIGTERM. It then calls notReady so /readyz
+// starts failing, keeps serving for conf.ShutdownDelay while load balancers
+// catch up, stops accepting connections and gives in-flight requests,
+// background jobs and everything passed in drain up to conf.ShutdownTimeout
+// to finish. A second signal exits at once.
+func serve(srv *http.Server, conf configs.APIConfig, notReady func(), jobs *jobGroup, drain ...func(context.Context) error) error {
+	signals, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		jobs.stop()
+		return err
+	case <-signals.Done():
+	}
+	stopSignals()
+
+	notReady()
+	if conf.ShutdownDelay > 0 {
+		slog.Info("shutting down, failing readiness", "delay", conf.ShutdownDelay)
+		time.Sleep(conf.ShutdownDelay)
+	}
+
+	slog.Info("shutting down, draining requests", "timeout", conf.ShutdownTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), conf.ShutdownTimeout)
+	defer cancel()
+
+	var errs []error
+	if err := srv.Shutdown(ctx); err != nil {
+		errs = append(errs, err)
+		srv.Close()
+	}
+	if err := jobs.Stop(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	for _, fn := range drain {
+		if err := fn(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	slog.Info("shutdown complete")
+	return nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/Enilsonn/CRUD-Postgres/cmd/configs"
+)
+
+func TestServeDrainsInFlightRequestsOnSIGTERM(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	started := make(chan struct{})
+	srv := &http.Server{Addr: addr, Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		io.WriteString(w, "done")
+	})}
+
+	jobs := newJobGroup()
+	jobStopped := make(chan struct{})
+	jobs.Go(func(ctx context.Context, _ time.Duration) {
+		<-ctx.Done()
+		close(jobStopped)
+	}, time.Minute)
+
+	served := make(chan error, 1)
+	drained := make(chan struct{})
+	conf := configs.APIConfig{ShutdownDelay: 50 * time.Millisecond, ShutdownTimeout: 5 * time.Second}
+	go func() { served <- serve(srv, conf, func() { close(drained) }, jobs) }()
+
+	body := make(chan string, 1)
+	go func() {
+		var (
+			resp *http.Response
+			err  error
+		)
+		for i := 0; i < 50; i++ {
+			if resp, err = http.Get("http://" + addr); err == nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if err != nil {
+			body <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		body <- string(b)
+	}()
+
+	<-started
+	syscall.Kill(syscall.Getpid(), syscall.SIGTERM)
+
+	if got := <-body; got != "done" {
+		t.Errorf("in-flight request got %q, want it to complete", got)
+	}
+	if err := <-served; err != nil {
+		t.Errorf("serve: %v", err)
+	}
+	select {
+	case <-drained:
+	default:
+		t.Error("readiness was not failed before shutdown")
+	}
+	select {
+	case <-jobStopped:
+	default:
+		t.Error("background job still running after shutdown")
+	}
+}
@@ -1,25 +1,53 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/Enilsonn/CRUD-Postgres/cmd/configs"
-	_ "github.com/lib/pq"
+	"github.com/Enilsonn/CRUD-Postgres/internal/tracing"
+	"github.com/lib/pq"
 )
 
+// OpenConnection opens the pool configured in database and checks it can
+// connect. Statements are traced when tracing.Setup ran first.
 func OpenConnection() (*sql.DB, error) {
 	conf := configs.GetDB()
 
-	sc := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		conf.Host, conf.Port, conf.User, conf.Pass, conf.Database)
+	sc, err := connString(conf)
+	if err != nil {
+		return nil, err
+	}
 
-	conn, err := sql.Open("postgres", sc)
+	connector, err := pq.NewConnector(sc)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database connection: %w", err)
 	}
+	var conn *sql.DB
+	if tracing.Enabled() {
+		conn = sql.OpenDB(tracedConnector{Connector: connector})
+	} else {
+		conn = sql.OpenDB(connector)
+	}
 
-	err = conn.Ping()
+	conn.SetMaxOpenConns(conf.MaxOpenConns)
+	conn.SetMaxIdleConns(conf.MaxIdleConns)
+	conn.SetConnMaxLifetime(conf.ConnMaxLifetime)
+	conn.SetConnMaxIdleTime(conf.ConnMaxIdleTime)
+
+	ctx := context.Background()
+	if conf.ConnectTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, conf.ConnectTimeout)
+		defer cancel()
+	}
+
+	err = conn.PingContext(ctx)
 	if err != nil {
 		conn.Close()
 		return nil, fmt.Errorf("failed to ping database: %w", err)
@@ -27,3 +55,50 @@ func OpenConnection() (*sql.DB, error) {
 
 	return conn, nil
 }
+
+// connString builds a lib/pq connection string from conf. Settings spelled
+// out in a database URL win over the separate sslmode and timeout options.
+func connString(conf configs.DBConf) (string, error) {
+	params := []string{}
+	explicit := map[string]bool{}
+
+	if conf.URL != "" {
+		parsed, err := pq.ParseURL(conf.URL)
+		if err != nil {
+			return "", fmt.Errorf("invalid database url: %w", err)
+		}
+		params = append(params, parsed)
+		if u, err := url.Parse(conf.URL); err == nil {
+			for key := range u.Query() {
+				explicit[key] = true
+			}
+		}
+	} else {
+		params = append(params,
+			"host="+quote(conf.Host),
+			"port="+quote(conf.Port),
+			"user="+quote(conf.User),
+			"password="+quote(conf.Pass),
+			"dbname="+quote(conf.Database),
+		)
+	}
+
+	if !explicit["sslmode"] {
+		params = append(params, "sslmode="+quote(conf.SSLMode))
+	}
+	if !explicit["connect_timeout"] && conf.ConnectTimeout > 0 {
+		params = append(params, "connect_timeout="+strconv.Itoa(int(conf.ConnectTimeout/time.Second)))
+	}
+	// lib/pq passes unknown keys on as run-time parameters for the session.
+	if !explicit["statement_timeout"] && conf.StatementTimeout > 0 {
+		params = append(params, "statement_timeout="+strconv.FormatInt(conf.StatementTimeout.Milliseconds(), 10))
+	}
+
+	return strings.Join(params, " "), nil
+}
+
+// quote escapes a connection string value so spaces and quotes in passwords
+// survive.
+func quote(v string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v) + "'"
+}
@@ -0,0 +1,38 @@
+package database
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Enilsonn/CRUD-Postgres/cmd/configs"
+)
+
+func TestConnString(t *testing.T) {
+	got, err := connString(configs.DBConf{
+		Host:             "db",
+		Port:             "5432",
+		User:             "app",
+		Pass:             `it's a pass`,
+		Database:         "crud",
+		SSLMode:          "require",
+		ConnectTimeout:   5 * time.Second,
+		StatementTimeout: 1500 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `host='db' port='5432' user='app' password='it\'s a pass' dbname='crud' sslmode='require' connect_timeout=5 statement_timeout=1500`
+	if got != want {
+		t.Errorf("connString = %s\nwant %s", got, want)
+	}
+
+	// The URL's own sslmode wins over the separate setting.
+	got, err = connString(configs.DBConf{URL: "postgres://app:pw@db:5432/crud?sslmode=verify-full", SSLMode: "disable"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(got, "sslmode='verify-full'") || strings.Contains(got, "disable") {
+		t.Errorf("connString = %s, want the URL's sslmode only", got)
+	}
+}
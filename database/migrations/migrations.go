@@ -1,215 +1,414 @@
+// Package migrations versions the database schema. Each change is a pair of
+// numbered files in sql/, NNNN_name.up.sql and NNNN_name.down.sql, embedded
+// into the binary and recorded in schema_migrations once applied.
+//
+// Migrations run inside a transaction unless their first line is
+// "-- migrate:no-transaction". Never edit a migration that has shipped: add
+// a new one, and when it replaces a function, have its down file restore the
+// previous definition. A migration that cannot be undone says so with a down
+// file starting "-- migrate:irreversible"; reverting past it fails before
+// anything runs.
 package migrations
 
 import (
+	"context"
+	"crypto/sha256"
 	"database/sql"
+	"embed"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+//go:embed sql/*.sql
+var files embed.FS
+
+// advisoryLockKey serializes migrators across replicas sharing a database.
+const advisoryLockKey int64 = 0x6372756470676d67 // "crudpgmg"
+
+const (
+	noTransactionDirective = "-- migrate:no-transaction"
+	irreversibleDirective  = "-- migrate:irreversible"
+)
+
+var fileName = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+var (
+	ErrUnknownVersion = errors.New("unknown migration version")
+	ErrIrreversible   = errors.New("migration cannot be reverted")
 )
 
+type Migration struct {
+	Version  int
+	Name     string
+	Checksum string
+	up       string
+	down     string
+	noTx     bool
+	// irreversible migrations refuse to run their down file.
+	irreversible bool
+}
+
+// Status is a migration as seen by the database. Modified means the embedded
+// file no longer matches what was applied.
+type Status struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+	Modified  bool       `json:"modified,omitempty"`
+}
+
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+func NewMigrator(db *sql.DB) (*Migrator, error) {
+	migrations, err := load(files)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Up applies every pending migration. It is what the server runs on boot.
 func Up(db *sql.DB) error {
-	queries := []string{
-		`CREATE TABLE IF NOT EXISTS clients (
-			id               BIGSERIAL PRIMARY KEY,
-			name             TEXT        NOT NULL,
-			email            TEXT        NOT NULL UNIQUE,
-			phone            TEXT        NOT NULL,
-			status           BOOLEAN     NOT NULL DEFAULT TRUE,
-			registration_data TIMESTAMPTZ NOT NULL DEFAULT NOW()
-		);`,
-
-		`CREATE TABLE IF NOT EXISTS plans (
-			id              BIGSERIAL PRIMARY KEY,
-			plan_name       TEXT        NOT NULL UNIQUE,
-			price_cents     BIGINT      NOT NULL CHECK (price_cents >= 0),
-			amount_credits  INT         NOT NULL CHECK (amount_credits > 0),
-			status          BOOLEAN     NOT NULL DEFAULT TRUE
-		);`,
-
-		`CREATE TABLE IF NOT EXISTS wallets (
-			client_id       BIGINT      PRIMARY KEY REFERENCES clients(id) ON DELETE CASCADE,
-			balance_credits BIGINT      NOT NULL DEFAULT 0 CHECK (balance_credits >= 0)
-		);`,
-
-		`DO $$ BEGIN
-			CREATE TYPE credit_type AS ENUM ('TOPUP','USAGE','REFUND','ADJUST');
-		EXCEPTION
-			WHEN duplicate_object THEN null;
-		END $$;`,
-
-		`CREATE TABLE IF NOT EXISTS credit_ledger (
-			id                BIGSERIAL PRIMARY KEY,
-			client_id         BIGINT      NOT NULL REFERENCES clients(id) ON DELETE CASCADE,
-			type              credit_type NOT NULL,
-			credits_delta     BIGINT      NOT NULL,
-			price_cents_delta BIGINT      NOT NULL DEFAULT 0,
-			meta              JSONB       NOT NULL DEFAULT '{}',
-			created_at        TIMESTAMPTZ NOT NULL DEFAULT NOW()
-		);`,
-
-		`CREATE TABLE IF NOT EXISTS usage_events (
-			id               BIGSERIAL PRIMARY KEY,
-			client_id        BIGINT      NOT NULL REFERENCES clients(id) ON DELETE CASCADE,
-			model            TEXT        NOT NULL,
-			prompt_tokens    BIGINT      NOT NULL DEFAULT 0,
-			completion_tokens BIGINT     NOT NULL DEFAULT 0,
-			credits_spent    BIGINT      NOT NULL DEFAULT 0,
-			created_at       TIMESTAMPTZ NOT NULL DEFAULT NOW()
-		);`,
-
-		`CREATE TABLE IF NOT EXISTS model_pricing(
-			id BIGSERIAL PRIMARY KEY,
-			pattern TEXT NOT NULL,
-			credits_per_1k_prompt NUMERIC NOT NULL,
-			credits_per_1k_completion NUMERIC NOT NULL,
-			priority INT NOT NULL DEFAULT 100,
-			active BOOLEAN NOT NULL DEFAULT TRUE,
-			updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
-		);`,
-
-		`CREATE INDEX IF NOT EXISTS idx_model_pricing_active_priority ON model_pricing(active, priority);`,
-
-		`INSERT INTO model_pricing(pattern,credits_per_1k_prompt,credits_per_1k_completion,priority)
-		SELECT '^gemma3:1b$',1.0,1.0,10
-		WHERE NOT EXISTS (SELECT 1 FROM model_pricing);`,
-
-		`INSERT INTO model_pricing(pattern,credits_per_1k_prompt,credits_per_1k_completion,priority)
-		SELECT '^llama3\\.1:8b.*$',1.2,1.5,20
-		WHERE NOT EXISTS (SELECT 1 FROM model_pricing WHERE pattern='^llama3\\.1:8b.*$');`,
-	}
-
-	for i, query := range queries {
-		if _, err := db.Exec(query); err != nil {
-			return fmt.Errorf("failed to execute migration %d: %w", i+1, err)
-		}
-	}
-
-	if err := runPhaseTwo(db); err != nil {
-		return fmt.Errorf("failed to execute phase 2 migration: %w", err)
+	m, err := NewMigrator(db)
+	if err != nil {
+		return err
 	}
+	_, err = m.Up(context.Background())
+	return err
+}
 
-	return nil
+// Latest is the highest version known to this binary.
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Current is the highest version applied to the database, read without the
+// migration lock so it stays cheap enough for readiness probes. A database
+// that was never migrated is at version 0.
+func (m *Migrator) Current(ctx context.Context) (int, error) {
+	var version int
+	err := m.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "42P01" { // undefined_table
+			return 0, nil
+		}
+		return 0, fmt.Errorf("query schema version: %w", err)
+	}
+	return version, nil
+}
+
+// Status lists every known migration and whether it is applied. Like Current
+// it only reads: it neither takes the migration lock nor creates
+// schema_migrations, so a database never migrated shows nothing applied.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := readApplied(ctx, m.db.QueryContext)
+	if err != nil {
+		var pqErr *pq.Error
+		if !errors.As(err, &pqErr) || pqErr.Code != "42P01" { // undefined_table
+			return nil, err
+		}
+		applied = map[int]appliedMigration{}
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		st := Status{Version: mig.Version, Name: mig.Name}
+		if a, ok := applied[mig.Version]; ok {
+			appliedAt := a.appliedAt
+			st.AppliedAt = &appliedAt
+			st.Modified = a.checksum != mig.Checksum
+		}
+		statuses = append(statuses, st)
+	}
+	return statuses, nil
+}
+
+// Up applies every pending migration in order and returns what it applied.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	return m.To(ctx, m.Latest())
+}
+
+// Down reverts the steps most recently applied migrations.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	if steps <= 0 {
+		return nil, fmt.Errorf("invalid steps %d: must be positive", steps)
+	}
+
+	var reverted []Migration
+	err := m.withLock(ctx, func(conn *sql.Conn, applied map[int]appliedMigration) error {
+		var plan []Migration
+		for i := len(m.migrations) - 1; i >= 0 && len(plan) < steps; i-- {
+			if _, ok := applied[m.migrations[i].Version]; ok {
+				plan = append(plan, m.migrations[i])
+			}
+		}
+		if err := checkReversible(plan); err != nil {
+			return err
+		}
+
+		for _, mig := range plan {
+			if err := m.revert(ctx, conn, mig); err != nil {
+				return err
+			}
+			reverted = append(reverted, mig)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// To migrates up or down until exactly the migrations up to version are
+// applied. Version 0 reverts everything.
+func (m *Migrator) To(ctx context.Context, version int) ([]Migration, error) {
+	if version != 0 && m.find(version) < 0 {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+	}
+
+	var changed []Migration
+	err := m.withLock(ctx, func(conn *sql.Conn, applied map[int]appliedMigration) error {
+		var plan []Migration
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			mig := m.migrations[i]
+			if _, ok := applied[mig.Version]; ok && mig.Version > version {
+				plan = append(plan, mig)
+			}
+		}
+		if err := checkReversible(plan); err != nil {
+			return err
+		}
+
+		for _, mig := range plan {
+			if err := m.revert(ctx, conn, mig); err != nil {
+				return err
+			}
+			changed = append(changed, mig)
+		}
+
+		for _, mig := range m.migrations {
+			if _, ok := applied[mig.Version]; ok || mig.Version > version {
+				continue
+			}
+			if err := m.apply(ctx, conn, mig); err != nil {
+				return err
+			}
+			changed = append(changed, mig)
+		}
+		return nil
+	})
+	return changed, err
+}
+
+type appliedMigration struct {
+	checksum  string
+	appliedAt time.Time
+}
+
+type execFunc func(ctx context.Context, query string, args ...any) (sql.Result, error)
+
+// withLock runs fn on a single connection holding the migration advisory
+// lock, so replicas booting together apply each migration exactly once.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn, applied map[int]appliedMigration) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("acquire migration connection: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, advisoryLockKey); err != nil {
+		return fmt.Errorf("acquire migration lock: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, advisoryLockKey)
+
+	if _, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version bigint PRIMARY KEY,
+		name text NOT NULL,
+		checksum text NOT NULL,
+		applied_at timestamptz NOT NULL DEFAULT now()
+	)`); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	applied, err := readApplied(ctx, conn.QueryContext)
+	if err != nil {
+		return err
+	}
+
+	return fn(conn, applied)
 }
 
-func runPhaseTwo(db *sql.DB) error {
-	statements := []string{
-		`DO $$ BEGIN
-	  CREATE TYPE payment_method AS ENUM ('CARD','BOLETO','PIX');
-EXCEPTION WHEN duplicate_object THEN NULL; END $$;`,
-		`DO $$ BEGIN
-	  CREATE TYPE payment_status AS ENUM ('PENDING','CONFIRMED','FAILED','CANCELED');
-EXCEPTION WHEN duplicate_object THEN NULL; END $$;`,
-		`ALTER TABLE clients
-  ADD COLUMN IF NOT EXISTS supports_flamengo boolean DEFAULT false,
-  ADD COLUMN IF NOT EXISTS watches_one_piece boolean DEFAULT false,
-  ADD COLUMN IF NOT EXISTS city text;`,
-		`CREATE TABLE IF NOT EXISTS sellers (
-  id BIGSERIAL PRIMARY KEY,
-  name text NOT NULL
-);`,
-		`ALTER TABLE plans
-  ADD COLUMN IF NOT EXISTS category text NOT NULL DEFAULT 'CREDITS',
-  ADD COLUMN IF NOT EXISTS manufactured_in_mari boolean NOT NULL DEFAULT false,
-  ADD COLUMN IF NOT EXISTS stock int NOT NULL DEFAULT 999999 CHECK (stock >= 0);`,
-		`CREATE TABLE IF NOT EXISTS orders (
-  id BIGSERIAL PRIMARY KEY,
-  client_id bigint NOT NULL REFERENCES clients(id),
-  seller_id bigint NOT NULL REFERENCES sellers(id),
-  created_at timestamptz NOT NULL DEFAULT now(),
-  payment_method payment_method NOT NULL,
-  payment_status payment_status NOT NULL DEFAULT 'PENDING',
-  subtotal_cents bigint NOT NULL DEFAULT 0 CHECK (subtotal_cents >= 0),
-  discount_cents bigint NOT NULL DEFAULT 0 CHECK (discount_cents >= 0),
-  total_cents bigint NOT NULL DEFAULT 0 CHECK (total_cents >= 0)
-);`,
-		`CREATE TABLE IF NOT EXISTS order_items (
-  id BIGSERIAL PRIMARY KEY,
-  order_id bigint NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
-  plan_id bigint NOT NULL REFERENCES plans(id),
-  quantity int NOT NULL CHECK (quantity > 0),
-  unit_price_cents bigint NOT NULL CHECK (unit_price_cents >= 0)
-);`,
-		`CREATE INDEX IF NOT EXISTS idx_plans_name ON plans USING gin (to_tsvector('simple', plan_name));`,
-		`CREATE INDEX IF NOT EXISTS idx_plans_category ON plans(category);`,
-		`CREATE INDEX IF NOT EXISTS idx_plans_price ON plans(price_cents);`,
-		`CREATE INDEX IF NOT EXISTS idx_plans_mari ON plans(manufactured_in_mari);`,
-		`CREATE INDEX IF NOT EXISTS idx_plans_lowstock ON plans(stock) WHERE stock < 5;`,
-		`CREATE OR REPLACE VIEW seller_monthly_sales AS
-SELECT date_trunc('month', o.created_at) AS month,
-       o.seller_id,
-       COUNT(DISTINCT o.id) AS orders_count,
-       SUM(o.total_cents)  AS total_cents
-FROM orders o
-WHERE o.payment_status = 'CONFIRMED'
-GROUP BY 1,2;`,
-		`CREATE OR REPLACE FUNCTION sp_finalize_order(p_order_id bigint)
-RETURNS void AS $$
-DECLARE
-  v_client RECORD;
-  v_item RECORD;
-  v_discount_rate numeric := 0.0;
-  v_credits_added bigint := 0;
-BEGIN
-  SELECT c.* INTO v_client
-  FROM orders o JOIN clients c ON c.id = o.client_id
-  WHERE o.id = p_order_id FOR UPDATE;
-
-  IF v_client.supports_flamengo OR v_client.watches_one_piece OR lower(coalesce(v_client.city,'')) = 'sousa' THEN
-    v_discount_rate := 0.10;
-  END IF;
-
-  UPDATE orders SET subtotal_cents = 0, discount_cents = 0, total_cents = 0
-  WHERE id = p_order_id;
-
-  FOR v_item IN
-    SELECT oi.*, p.stock, p.amount_credits
-    FROM order_items oi JOIN plans p ON p.id = oi.plan_id
-    WHERE oi.order_id = p_order_id
-  LOOP
-    IF v_item.stock < v_item.quantity THEN
-      RAISE EXCEPTION 'insufficient stock for plan %', v_item.plan_id;
-    END IF;
-
-    UPDATE plans SET stock = stock - v_item.quantity WHERE id = v_item.plan_id;
-
-    UPDATE orders
-    SET subtotal_cents = subtotal_cents + (v_item.unit_price_cents * v_item.quantity)
-    WHERE id = p_order_id;
-
-    v_credits_added := v_credits_added + (v_item.quantity * v_item.amount_credits);
-  END LOOP;
-
-  UPDATE orders
-  SET discount_cents = floor(subtotal_cents * v_discount_rate),
-      total_cents    = subtotal_cents - discount_cents,
-      payment_status = 'CONFIRMED'
-  WHERE id = p_order_id;
-
-  INSERT INTO credit_ledger (client_id, type, credits_delta, price_cents_delta, meta)
-  SELECT o.client_id, 'TOPUP', v_credits_added, o.total_cents, jsonb_build_object('order_id', o.id)
-  FROM orders o WHERE o.id = p_order_id;
-
-  INSERT INTO wallets (client_id, balance_credits) VALUES
-    ((SELECT client_id FROM orders WHERE id = p_order_id), v_credits_added)
-  ON CONFLICT (client_id)
-  DO UPDATE SET balance_credits = wallets.balance_credits + EXCLUDED.balance_credits;
-END; $$ LANGUAGE plpgsql;`,
-	}
-
-	for i, stmt := range statements {
-		if _, err := db.Exec(stmt); err != nil {
-			return fmt.Errorf("phase 2 statement %d failed: %w", i+1, err)
-		}
-	}
-
-	var sellerCount int
-	if err := db.QueryRow(`SELECT COUNT(*) FROM sellers`).Scan(&sellerCount); err != nil {
-		return fmt.Errorf("failed to count sellers: %w", err)
-	}
-
-	if sellerCount == 0 {
-		if _, err := db.Exec(`INSERT INTO sellers (name) VALUES ($1), ($2)`, "WebStore", "AdminPanel"); err != nil {
-			return fmt.Errorf("failed to seed sellers: %w", err)
+type queryFunc func(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+
+func readApplied(ctx context.Context, query queryFunc) (map[int]appliedMigration, error) {
+	rows, err := query(ctx, `SELECT version, checksum, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("list applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := map[int]appliedMigration{}
+	for rows.Next() {
+		var version int
+		var a appliedMigration
+		if err := rows.Scan(&version, &a.checksum, &a.appliedAt); err != nil {
+			return nil, fmt.Errorf("scan applied migration: %w", err)
 		}
+		applied[version] = a
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate applied migrations: %w", err)
 	}
+	return applied, nil
+}
 
+// checkReversible refuses a plan of reverts that would cross an irreversible
+// migration, so none of them runs.
+func checkReversible(plan []Migration) error {
+	for _, mig := range plan {
+		if mig.irreversible {
+			return fmt.Errorf("revert migration %04d_%s: %w", mig.Version, mig.Name, ErrIrreversible)
+		}
+	}
 	return nil
 }
+
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, mig Migration) error {
+	record := func(exec execFunc) error {
+		_, err := exec(ctx, `INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)`,
+			mig.Version, mig.Name, mig.Checksum)
+		return err
+	}
+	if err := run(ctx, conn, mig.noTx, mig.up, record); err != nil {
+		return fmt.Errorf("apply migration %04d_%s: %w", mig.Version, mig.Name, err)
+	}
+	return nil
+}
+
+func (m *Migrator) revert(ctx context.Context, conn *sql.Conn, mig Migration) error {
+	record := func(exec execFunc) error {
+		_, err := exec(ctx, `DELETE FROM schema_migrations WHERE version = $1`, mig.Version)
+		return err
+	}
+	if err := run(ctx, conn, mig.noTx, mig.down, record); err != nil {
+		return fmt.Errorf("revert migration %04d_%s: %w", mig.Version, mig.Name, err)
+	}
+	return nil
+}
+
+func (m *Migrator) find(version int) int {
+	for i, mig := range m.migrations {
+		if mig.Version == version {
+			return i
+		}
+	}
+	return -1
+}
+
+// run executes body and then record, together in one transaction unless
+// noTx is set.
+func run(ctx context.Context, conn *sql.Conn, noTx bool, body string, record func(execFunc) error) error {
+	if noTx {
+		if !isBlank(body) {
+			if _, err := conn.ExecContext(ctx, body); err != nil {
+				return err
+			}
+		}
+		return record(conn.ExecContext)
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if !isBlank(body) {
+		if _, err := tx.ExecContext(ctx, body); err != nil {
+			return err
+		}
+	}
+	if err := record(tx.ExecContext); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// load pairs up the up and down files in fsys, ordered by version.
+func load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, "sql")
+	if err != nil {
+		return nil, fmt.Errorf("read migrations: %w", err)
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("unexpected migration file %s", entry.Name())
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		body, err := fs.ReadFile(fsys, path.Join("sql", entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("read migration %s: %w", entry.Name(), err)
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = mig
+		}
+		if mig.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, mig.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			mig.up = string(body)
+			sum := sha256.Sum256(body)
+			mig.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			mig.down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.up == "" || mig.down == "" {
+			return nil, fmt.Errorf("migration %04d_%s needs both an up and a down file", mig.Version, mig.Name)
+		}
+		// Both directions of a migration share its transaction mode.
+		mig.noTx = strings.HasPrefix(mig.up, noTransactionDirective)
+		mig.irreversible = strings.HasPrefix(mig.down, irreversibleDirective)
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// isBlank reports whether body holds nothing but comments and whitespace.
+func isBlank(body string) bool {
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "--") {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,195 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+)
+
+func TestEmbeddedMigrationsAreComplete(t *testing.T) {
+	migrations, err := load(files)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if len(migrations) == 0 {
+		t.Fatalf("no migrations embedded")
+	}
+	for i, mig := range migrations {
+		if mig.Version != i+1 {
+			t.Fatalf("migration %d_%s breaks the sequence, want version %d", mig.Version, mig.Name, i+1)
+		}
+	}
+}
+
+func TestLoadRejectsMissingDown(t *testing.T) {
+	fsys := fstest.MapFS{
+		"sql/0001_a.up.sql":   {Data: []byte("SELECT 1;")},
+		"sql/0001_a.down.sql": {Data: []byte("SELECT 1;")},
+		"sql/0002_b.up.sql":   {Data: []byte("SELECT 2;")},
+	}
+	if _, err := load(fsys); err == nil {
+		t.Fatalf("expected an error for a migration without a down file")
+	}
+}
+
+func TestUpAppliesPendingUnderLock(t *testing.T) {
+	fsys := fstest.MapFS{
+		"sql/0001_a.up.sql":   {Data: []byte("CREATE TABLE a (id int);")},
+		"sql/0001_a.down.sql": {Data: []byte("DROP TABLE a;")},
+		"sql/0002_b.up.sql":   {Data: []byte(noTransactionDirective + "\nALTER TYPE t ADD VALUE IF NOT EXISTS 'X';")},
+		"sql/0002_b.down.sql": {Data: []byte("-- nothing to undo\n")},
+		"sql/0003_c.up.sql":   {Data: []byte("CREATE TABLE c (id int);")},
+		"sql/0003_c.down.sql": {Data: []byte("DROP TABLE c;")},
+	}
+	migrations, err := load(fsys)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec(regexp.QuoteMeta(`SELECT pg_advisory_lock($1)`)).WithArgs(advisoryLockKey).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS schema_migrations`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT version, checksum, applied_at FROM schema_migrations`).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "checksum", "applied_at"}).AddRow(1, migrations[0].Checksum, time.Now()))
+
+	mock.ExpectExec(regexp.QuoteMeta(`ALTER TYPE t ADD VALUE`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO schema_migrations`).WithArgs(2, "b", migrations[1].Checksum).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`CREATE TABLE c (id int);`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO schema_migrations`).WithArgs(3, "c", migrations[2].Checksum).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	mock.ExpectExec(regexp.QuoteMeta(`SELECT pg_advisory_unlock($1)`)).WithArgs(advisoryLockKey).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	m := &Migrator{db: db, migrations: migrations}
+	applied, err := m.Up(context.Background())
+	if err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	if len(applied) != 2 || applied[0].Version != 2 || applied[1].Version != 3 {
+		t.Fatalf("unexpected applied migrations %+v", applied)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
+
+func TestDownRefusesIrreversibleMigration(t *testing.T) {
+	fsys := fstest.MapFS{
+		"sql/0001_a.up.sql":   {Data: []byte("CREATE TABLE a (id int);")},
+		"sql/0001_a.down.sql": {Data: []byte(irreversibleDirective + "\n-- a cannot go\n")},
+		"sql/0002_b.up.sql":   {Data: []byte("CREATE TABLE b (id int);")},
+		"sql/0002_b.down.sql": {Data: []byte("DROP TABLE b;")},
+	}
+	migrations, err := load(fsys)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	// Nothing is reverted, not even b, which comes first.
+	mock.ExpectExec(regexp.QuoteMeta(`SELECT pg_advisory_lock($1)`)).WithArgs(advisoryLockKey).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS schema_migrations`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT version, checksum, applied_at FROM schema_migrations`).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "checksum", "applied_at"}).
+			AddRow(1, migrations[0].Checksum, time.Now()).
+			AddRow(2, migrations[1].Checksum, time.Now()))
+	mock.ExpectExec(regexp.QuoteMeta(`SELECT pg_advisory_unlock($1)`)).WithArgs(advisoryLockKey).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	m := &Migrator{db: db, migrations: migrations}
+	reverted, err := m.Down(context.Background(), 2)
+	if !errors.Is(err, ErrIrreversible) {
+		t.Fatalf("down: err = %v, want ErrIrreversible", err)
+	}
+	if len(reverted) != 0 {
+		t.Errorf("reverted %+v, want nothing", reverted)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
+
+func TestEmbeddedIrreversibleMigrations(t *testing.T) {
+	migrations, err := load(files)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	for _, mig := range migrations {
+		want := mig.Version == 3 || mig.Version == 18
+		if mig.irreversible != want {
+			t.Errorf("migration %04d_%s: irreversible = %v, want %v", mig.Version, mig.Name, mig.irreversible, want)
+		}
+	}
+}
+
+func TestStatusOnlyReads(t *testing.T) {
+	migrations, err := load(files)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	// A database never migrated has no schema_migrations, and Status must
+	// not create it.
+	mock.ExpectQuery(`SELECT version, checksum, applied_at FROM schema_migrations`).
+		WillReturnError(&pq.Error{Code: "42P01", Message: `relation "schema_migrations" does not exist`})
+
+	m := &Migrator{db: db, migrations: migrations}
+	statuses, err := m.Status(context.Background())
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	if len(statuses) != len(migrations) {
+		t.Fatalf("got %d statuses, want %d", len(statuses), len(migrations))
+	}
+	for _, st := range statuses {
+		if st.AppliedAt != nil {
+			t.Errorf("migration %d reported applied", st.Version)
+		}
+	}
+
+	applied := time.Now()
+	mock.ExpectQuery(`SELECT version, checksum, applied_at FROM schema_migrations`).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "checksum", "applied_at"}).
+			AddRow(1, migrations[0].Checksum, applied).
+			AddRow(2, "stale", applied))
+	statuses, err = m.Status(context.Background())
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	if statuses[0].AppliedAt == nil || statuses[0].Modified {
+		t.Errorf("migration 1: %+v, want applied and unmodified", statuses[0])
+	}
+	if !statuses[1].Modified {
+		t.Errorf("migration 2: %+v, want modified", statuses[1])
+	}
+	if statuses[2].AppliedAt != nil {
+		t.Errorf("migration 3: %+v, want pending", statuses[2])
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS model_pricing;
+DROP TABLE IF EXISTS usage_events;
+DROP TABLE IF EXISTS credit_ledger;
+DROP TYPE IF EXISTS credit_type;
+DROP TABLE IF EXISTS wallets;
+DROP TABLE IF EXISTS plans;
+DROP TABLE IF EXISTS clients;
@@ -0,0 +1,16 @@
+DROP VIEW IF EXISTS seller_monthly_sales;
+DROP TABLE IF EXISTS order_items;
+DROP TABLE IF EXISTS orders;
+DROP TABLE IF EXISTS sellers;
+DROP INDEX IF EXISTS idx_plans_name;
+DROP INDEX IF EXISTS idx_plans_price;
+ALTER TABLE plans
+  DROP COLUMN IF EXISTS category,
+  DROP COLUMN IF EXISTS manufactured_in_mari,
+  DROP COLUMN IF EXISTS stock;
+ALTER TABLE clients
+  DROP COLUMN IF EXISTS supports_flamengo,
+  DROP COLUMN IF EXISTS watches_one_piece,
+  DROP COLUMN IF EXISTS city;
+DROP TYPE IF EXISTS payment_status;
+DROP TYPE IF EXISTS payment_method;
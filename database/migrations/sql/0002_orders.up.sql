@@ -0,0 +1,61 @@
+DO $$ BEGIN
+  CREATE TYPE payment_method AS ENUM ('CARD','BOLETO','PIX');
+EXCEPTION WHEN duplicate_object THEN NULL; END $$;
+
+DO $$ BEGIN
+  CREATE TYPE payment_status AS ENUM ('PENDING','CONFIRMED','FAILED','CANCELED');
+EXCEPTION WHEN duplicate_object THEN NULL; END $$;
+
+ALTER TABLE clients
+  ADD COLUMN IF NOT EXISTS supports_flamengo boolean DEFAULT false,
+  ADD COLUMN IF NOT EXISTS watches_one_piece boolean DEFAULT false,
+  ADD COLUMN IF NOT EXISTS city text;
+
+CREATE TABLE IF NOT EXISTS sellers (
+  id BIGSERIAL PRIMARY KEY,
+  name text NOT NULL
+);
+
+ALTER TABLE plans
+  ADD COLUMN IF NOT EXISTS category text NOT NULL DEFAULT 'CREDITS',
+  ADD COLUMN IF NOT EXISTS manufactured_in_mari boolean NOT NULL DEFAULT false,
+  ADD COLUMN IF NOT EXISTS stock int NOT NULL DEFAULT 999999 CHECK (stock >= 0);
+
+CREATE TABLE IF NOT EXISTS orders (
+  id BIGSERIAL PRIMARY KEY,
+  client_id bigint NOT NULL REFERENCES clients(id),
+  seller_id bigint NOT NULL REFERENCES sellers(id),
+  created_at timestamptz NOT NULL DEFAULT now(),
+  payment_method payment_method NOT NULL,
+  payment_status payment_status NOT NULL DEFAULT 'PENDING',
+  subtotal_cents bigint NOT NULL DEFAULT 0 CHECK (subtotal_cents >= 0),
+  discount_cents bigint NOT NULL DEFAULT 0 CHECK (discount_cents >= 0),
+  total_cents bigint NOT NULL DEFAULT 0 CHECK (total_cents >= 0)
+);
+
+CREATE TABLE IF NOT EXISTS order_items (
+  id BIGSERIAL PRIMARY KEY,
+  order_id bigint NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+  plan_id bigint NOT NULL REFERENCES plans(id),
+  quantity int NOT NULL CHECK (quantity > 0),
+  unit_price_cents bigint NOT NULL CHECK (unit_price_cents >= 0)
+);
+
+CREATE INDEX IF NOT EXISTS idx_plans_name ON plans USING gin (to_tsvector('simple', plan_name));
+CREATE INDEX IF NOT EXISTS idx_plans_category ON plans(category);
+CREATE INDEX IF NOT EXISTS idx_plans_price ON plans(price_cents);
+CREATE INDEX IF NOT EXISTS idx_plans_mari ON plans(manufactured_in_mari);
+CREATE INDEX IF NOT EXISTS idx_plans_lowstock ON plans(stock) WHERE stock < 5;
+
+CREATE OR REPLACE VIEW seller_monthly_sales AS
+SELECT date_trunc('month', o.created_at) AS month,
+       o.seller_id,
+       COUNT(DISTINCT o.id) AS orders_count,
+       SUM(o.total_cents)  AS total_cents
+FROM orders o
+WHERE o.payment_status = 'CONFIRMED'
+GROUP BY 1,2;
+
+INSERT INTO sellers (name)
+SELECT name FROM (VALUES ('WebStore'), ('AdminPanel')) AS seed(name)
+WHERE NOT EXISTS (SELECT 1 FROM sellers);
@@ -0,0 +1,2 @@
+-- migrate:irreversible
+-- Postgres cannot drop enum values, and ledger rows may already use them.
@@ -0,0 +1,7 @@
+-- migrate:no-transaction
+-- New enum values cannot be used by the transaction that adds them, so these
+-- run on their own.
+ALTER TYPE credit_type ADD VALUE IF NOT EXISTS 'EXPIRE';
+ALTER TYPE credit_type ADD VALUE IF NOT EXISTS 'TRANSFER_OUT';
+ALTER TYPE credit_type ADD VALUE IF NOT EXISTS 'TRANSFER_IN';
+ALTER TYPE credit_type ADD VALUE IF NOT EXISTS 'DEBT_SETTLEMENT';
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS credit_lots;
+ALTER TABLE plans DROP COLUMN IF EXISTS validity_days;
+DROP INDEX IF EXISTS idx_credit_ledger_type;
+DROP INDEX IF EXISTS idx_credit_ledger_created;
+DROP INDEX IF EXISTS idx_credit_ledger_client_created;
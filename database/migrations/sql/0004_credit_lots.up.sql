@@ -0,0 +1,28 @@
+CREATE INDEX IF NOT EXISTS idx_credit_ledger_client_created ON credit_ledger(client_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_credit_ledger_created ON credit_ledger(created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_credit_ledger_type ON credit_ledger(type);
+
+ALTER TABLE plans ADD COLUMN IF NOT EXISTS validity_days int CHECK (validity_days > 0);
+
+CREATE TABLE IF NOT EXISTS credit_lots (
+  id BIGSERIAL PRIMARY KEY,
+  client_id bigint NOT NULL REFERENCES clients(id) ON DELETE CASCADE,
+  source text NOT NULL,
+  ledger_id bigint REFERENCES credit_ledger(id),
+  order_id bigint REFERENCES orders(id),
+  plan_id bigint REFERENCES plans(id),
+  credits_total bigint NOT NULL CHECK (credits_total >= 0),
+  credits_remaining bigint NOT NULL CHECK (credits_remaining >= 0),
+  expires_at timestamptz,
+  expired_at timestamptz,
+  created_at timestamptz NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_credit_lots_client_open ON credit_lots(client_id, expires_at) WHERE credits_remaining > 0;
+CREATE INDEX IF NOT EXISTS idx_credit_lots_expiring ON credit_lots(expires_at) WHERE credits_remaining > 0 AND expires_at IS NOT NULL;
+
+-- Balances that predate lots become a single non-expiring lot.
+INSERT INTO credit_lots (client_id, source, credits_total, credits_remaining)
+SELECT w.client_id, 'LEGACY', w.balance_credits, w.balance_credits
+FROM wallets w
+WHERE w.balance_credits > 0
+  AND NOT EXISTS (SELECT 1 FROM credit_lots l WHERE l.client_id = w.client_id);
@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS balance_alerts (
+  client_id bigint PRIMARY KEY REFERENCES clients(id) ON DELETE CASCADE,
+  threshold_credits bigint NOT NULL CHECK (threshold_credits >= 0),
+  webhook_url text,
+  email text,
+  auto_recharge_plan_id bigint REFERENCES plans(id),
+  max_recharges_per_day int NOT NULL DEFAULT 1 CHECK (max_recharges_per_day >= 0),
+  cooldown_minutes int NOT NULL DEFAULT 60 CHECK (cooldown_minutes >= 0),
+  enabled boolean NOT NULL DEFAULT true,
+  armed boolean NOT NULL DEFAULT true,
+  last_triggered_at timestamptz,
+  updated_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS balance_alert_events (
+  id BIGSERIAL PRIMARY KEY,
+  client_id bigint NOT NULL REFERENCES clients(id) ON DELETE CASCADE,
+  kind text NOT NULL,
+  status text NOT NULL,
+  detail jsonb NOT NULL DEFAULT '{}',
+  created_at timestamptz NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_balance_alert_events_client ON balance_alert_events(client_id, kind, created_at DESC);
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS credit_transfers (
+  id BIGSERIAL PRIMARY KEY,
+  from_client_id bigint NOT NULL REFERENCES clients(id),
+  to_client_id bigint NOT NULL REFERENCES clients(id),
+  credits bigint NOT NULL CHECK (credits > 0),
+  status text NOT NULL,
+  note text NOT NULL DEFAULT '',
+  request_id text,
+  requested_by text NOT NULL,
+  reviewed_by text,
+  debit_entry_id bigint REFERENCES credit_ledger(id),
+  credit_entry_id bigint REFERENCES credit_ledger(id),
+  created_at timestamptz NOT NULL DEFAULT now(),
+  completed_at timestamptz,
+  CHECK (from_client_id <> to_client_id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_credit_transfers_request ON credit_transfers(from_client_id, request_id) WHERE request_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_credit_transfers_from ON credit_transfers(from_client_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_credit_transfers_to ON credit_transfers(to_client_id, created_at DESC);
@@ -0,0 +1,6 @@
+ALTER TABLE credit_ledger
+  DROP COLUMN IF EXISTS member_client_id,
+  DROP COLUMN IF EXISTS org_id;
+DROP TABLE IF EXISTS organization_members;
+DROP TYPE IF EXISTS org_role;
+DROP TABLE IF EXISTS organizations;
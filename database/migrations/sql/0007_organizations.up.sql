@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS organizations (
+  id BIGSERIAL PRIMARY KEY,
+  name text NOT NULL UNIQUE,
+  billing_client_id bigint NOT NULL UNIQUE REFERENCES clients(id),
+  created_at timestamptz NOT NULL DEFAULT now()
+);
+
+DO $$ BEGIN
+  CREATE TYPE org_role AS ENUM ('OWNER','ADMIN','MEMBER');
+EXCEPTION WHEN duplicate_object THEN NULL; END $$;
+
+CREATE TABLE IF NOT EXISTS organization_members (
+  org_id bigint NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+  client_id bigint NOT NULL UNIQUE REFERENCES clients(id) ON DELETE CASCADE,
+  role org_role NOT NULL DEFAULT 'MEMBER',
+  monthly_limit_credits bigint CHECK (monthly_limit_credits >= 0),
+  joined_at timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY (org_id, client_id)
+);
+
+ALTER TABLE credit_ledger
+  ADD COLUMN IF NOT EXISTS org_id bigint REFERENCES organizations(id),
+  ADD COLUMN IF NOT EXISTS member_client_id bigint REFERENCES clients(id);
+CREATE INDEX IF NOT EXISTS idx_credit_ledger_org_member ON credit_ledger(org_id, member_client_id, created_at) WHERE org_id IS NOT NULL;
@@ -0,0 +1,4 @@
+-- Fails while any wallet is still overdrawn, which is the point.
+ALTER TABLE wallets DROP CONSTRAINT IF EXISTS wallets_balance_within_credit_limit;
+ALTER TABLE wallets DROP COLUMN IF EXISTS credit_limit_credits;
+ALTER TABLE wallets ADD CONSTRAINT wallets_balance_credits_check CHECK (balance_credits >= 0);
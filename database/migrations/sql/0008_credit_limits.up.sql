@@ -0,0 +1,6 @@
+ALTER TABLE wallets ADD COLUMN IF NOT EXISTS credit_limit_credits bigint NOT NULL DEFAULT 0 CHECK (credit_limit_credits >= 0);
+ALTER TABLE wallets DROP CONSTRAINT IF EXISTS wallets_balance_credits_check;
+
+DO $$ BEGIN
+  ALTER TABLE wallets ADD CONSTRAINT wallets_balance_within_credit_limit CHECK (balance_credits >= -credit_limit_credits);
+EXCEPTION WHEN duplicate_object THEN NULL; END $$;
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS invoice_counters;
+DROP TABLE IF EXISTS invoice_lines;
+DROP TABLE IF EXISTS invoices;
+DROP TYPE IF EXISTS invoice_status;
@@ -0,0 +1,41 @@
+DO $$ BEGIN
+  CREATE TYPE invoice_status AS ENUM ('DRAFT','ISSUED','PAID','VOID');
+EXCEPTION WHEN duplicate_object THEN NULL; END $$;
+
+CREATE TABLE IF NOT EXISTS invoices (
+  id BIGSERIAL PRIMARY KEY,
+  client_id bigint NOT NULL REFERENCES clients(id),
+  number text UNIQUE,
+  period_start date NOT NULL,
+  period_end date NOT NULL,
+  status invoice_status NOT NULL DEFAULT 'DRAFT',
+  currency text NOT NULL DEFAULT 'BRL',
+  subtotal_cents bigint NOT NULL DEFAULT 0,
+  tax_rate_bp int NOT NULL DEFAULT 0 CHECK (tax_rate_bp >= 0),
+  tax_cents bigint NOT NULL DEFAULT 0,
+  total_cents bigint NOT NULL DEFAULT 0,
+  created_at timestamptz NOT NULL DEFAULT now(),
+  issued_at timestamptz,
+  paid_at timestamptz,
+  voided_at timestamptz,
+  CHECK (period_end > period_start)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS uq_invoices_client_period ON invoices(client_id, period_start) WHERE status <> 'VOID';
+
+CREATE TABLE IF NOT EXISTS invoice_lines (
+  id BIGSERIAL PRIMARY KEY,
+  invoice_id bigint NOT NULL REFERENCES invoices(id) ON DELETE CASCADE,
+  kind text NOT NULL,
+  description text NOT NULL,
+  quantity bigint NOT NULL,
+  unit_price_cents bigint NOT NULL,
+  amount_cents bigint NOT NULL,
+  order_id bigint REFERENCES orders(id),
+  plan_id bigint REFERENCES plans(id)
+);
+CREATE INDEX IF NOT EXISTS idx_invoice_lines_invoice ON invoice_lines(invoice_id, id);
+
+CREATE TABLE IF NOT EXISTS invoice_counters (
+  year int PRIMARY KEY,
+  last_number int NOT NULL
+);
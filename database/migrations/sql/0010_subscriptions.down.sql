@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS subscription_cycles;
+DROP TABLE IF EXISTS subscriptions;
+DROP TYPE IF EXISTS subscription_status;
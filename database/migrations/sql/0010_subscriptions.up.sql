@@ -0,0 +1,42 @@
+DO $$ BEGIN
+  CREATE TYPE subscription_status AS ENUM ('ACTIVE','PAST_DUE','PAUSED','CANCELED');
+EXCEPTION WHEN duplicate_object THEN NULL; END $$;
+
+CREATE TABLE IF NOT EXISTS subscriptions (
+  id BIGSERIAL PRIMARY KEY,
+  client_id bigint NOT NULL REFERENCES clients(id),
+  plan_id bigint NOT NULL REFERENCES plans(id),
+  pending_plan_id bigint REFERENCES plans(id),
+  quantity int NOT NULL DEFAULT 1 CHECK (quantity > 0),
+  billing_interval text NOT NULL CHECK (billing_interval IN ('WEEKLY','MONTHLY','YEARLY')),
+  payment_method payment_method NOT NULL DEFAULT 'CARD',
+  status subscription_status NOT NULL DEFAULT 'ACTIVE',
+  current_period_start timestamptz NOT NULL,
+  current_period_end timestamptz NOT NULL,
+  next_renewal_at timestamptz,
+  failed_attempts int NOT NULL DEFAULT 0,
+  grace_until timestamptz,
+  cancel_at_period_end boolean NOT NULL DEFAULT false,
+  cancel_reason text,
+  paused_at timestamptz,
+  canceled_at timestamptz,
+  created_at timestamptz NOT NULL DEFAULT now(),
+  updated_at timestamptz NOT NULL DEFAULT now()
+);
+CREATE UNIQUE INDEX IF NOT EXISTS uq_subscriptions_client_plan ON subscriptions(client_id, plan_id) WHERE status <> 'CANCELED';
+CREATE INDEX IF NOT EXISTS idx_subscriptions_due ON subscriptions(next_renewal_at) WHERE status IN ('ACTIVE','PAST_DUE');
+
+CREATE TABLE IF NOT EXISTS subscription_cycles (
+  id BIGSERIAL PRIMARY KEY,
+  subscription_id bigint NOT NULL REFERENCES subscriptions(id) ON DELETE CASCADE,
+  order_id bigint REFERENCES orders(id),
+  kind text NOT NULL,
+  status text NOT NULL,
+  period_start timestamptz NOT NULL,
+  period_end timestamptz NOT NULL,
+  amount_cents bigint NOT NULL DEFAULT 0,
+  credits_granted bigint NOT NULL DEFAULT 0,
+  error text,
+  created_at timestamptz NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_subscription_cycles_sub ON subscription_cycles(subscription_id, created_at DESC);
@@ -0,0 +1,28 @@
+CREATE TABLE IF NOT EXISTS payment_charges (
+  id BIGSERIAL PRIMARY KEY,
+  order_id bigint NOT NULL UNIQUE REFERENCES orders(id) ON DELETE CASCADE,
+  provider text NOT NULL,
+  provider_ref text NOT NULL,
+  method payment_method NOT NULL,
+  status payment_status NOT NULL DEFAULT 'PENDING',
+  amount_cents bigint NOT NULL CHECK (amount_cents >= 0),
+  pix_payload text,
+  boleto_line text,
+  expires_at timestamptz,
+  failure_reason text,
+  created_at timestamptz NOT NULL DEFAULT now(),
+  updated_at timestamptz NOT NULL DEFAULT now(),
+  UNIQUE (provider, provider_ref)
+);
+
+CREATE TABLE IF NOT EXISTS payment_webhook_events (
+  id BIGSERIAL PRIMARY KEY,
+  provider text NOT NULL,
+  event_id text NOT NULL,
+  event_type text NOT NULL,
+  provider_ref text NOT NULL,
+  payload jsonb NOT NULL,
+  result text NOT NULL,
+  received_at timestamptz NOT NULL DEFAULT now(),
+  UNIQUE (provider, event_id)
+);
@@ -0,0 +1,4 @@
+ALTER TABLE orders
+  DROP COLUMN IF EXISTS canceled_at,
+  DROP COLUMN IF EXISTS cancel_reason,
+  DROP COLUMN IF EXISTS expires_at;
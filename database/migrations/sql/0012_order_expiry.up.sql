@@ -0,0 +1,4 @@
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS expires_at timestamptz;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS cancel_reason text;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS canceled_at timestamptz;
+CREATE INDEX IF NOT EXISTS idx_orders_pending_expiry ON orders(expires_at) WHERE payment_status = 'PENDING';
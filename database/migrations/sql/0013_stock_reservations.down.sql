@@ -0,0 +1 @@
+ALTER TABLE plans DROP COLUMN IF EXISTS reserved_stock;
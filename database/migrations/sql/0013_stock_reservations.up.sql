@@ -0,0 +1,13 @@
+-- Orders already PENDING when reservations arrive hold their stock too.
+DO $$ BEGIN
+  IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'plans' AND column_name = 'reserved_stock') THEN
+    ALTER TABLE plans ADD COLUMN reserved_stock int NOT NULL DEFAULT 0 CHECK (reserved_stock >= 0);
+    UPDATE plans p SET reserved_stock = r.quantity
+    FROM (SELECT oi.plan_id, SUM(oi.quantity) AS quantity
+          FROM order_items oi JOIN orders o ON o.id = oi.order_id
+          WHERE o.payment_status = 'PENDING'
+          GROUP BY oi.plan_id) r
+    WHERE p.id = r.plan_id;
+  END IF;
+END $$;
+CREATE INDEX IF NOT EXISTS idx_plans_low_available ON plans((stock - reserved_stock)) WHERE status;
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS inventory_movements (
+  id BIGSERIAL PRIMARY KEY,
+  plan_id bigint NOT NULL REFERENCES plans(id) ON DELETE CASCADE,
+  kind text NOT NULL CHECK (kind IN ('INITIAL','SALE','RESTOCK','CORRECTION','RESERVATION','CANCEL_RETURN')),
+  stock_delta int NOT NULL,
+  reserved_delta int NOT NULL DEFAULT 0,
+  stock_after int NOT NULL,
+  reserved_after int NOT NULL,
+  order_id bigint REFERENCES orders(id) ON DELETE SET NULL,
+  actor text NOT NULL,
+  reason text,
+  created_at timestamptz NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_inventory_movements_plan ON inventory_movements(plan_id, created_at DESC, id DESC);
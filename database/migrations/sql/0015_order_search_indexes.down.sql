@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_orders_seller;
+DROP INDEX IF EXISTS idx_orders_total_id;
+DROP INDEX IF EXISTS idx_orders_created_id;
@@ -0,0 +1,4 @@
+-- Back-office order browsing pages by (created_at, id) or (total_cents, id).
+CREATE INDEX IF NOT EXISTS idx_orders_created_id ON orders(created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_orders_total_id ON orders(total_cents, id);
+CREATE INDEX IF NOT EXISTS idx_orders_seller ON orders(seller_id, created_at DESC);
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS order_events (
+  id BIGSERIAL PRIMARY KEY,
+  order_id bigint NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+  type text NOT NULL CHECK (type IN ('CREATED','ITEM_ADDED','ITEM_UPDATED','ITEM_REMOVED','DISCOUNT_APPLIED','STATUS_CHANGED','REFUNDED')),
+  actor text NOT NULL,
+  payload jsonb NOT NULL DEFAULT '{}'::jsonb,
+  created_at timestamptz NOT NULL DEFAULT clock_timestamp()
+);
+CREATE INDEX IF NOT EXISTS idx_order_events_order ON order_events(order_id, id);
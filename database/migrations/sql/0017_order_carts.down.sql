@@ -0,0 +1,3 @@
+ALTER TABLE orders
+  DROP COLUMN IF EXISTS checked_out_at,
+  DROP COLUMN IF EXISTS price_lock;
@@ -0,0 +1,5 @@
+-- ITEM keeps the price seen when each item was added; CHECKOUT reprices the
+-- cart until checked_out_at is set.
+ALTER TABLE orders
+  ADD COLUMN IF NOT EXISTS price_lock text NOT NULL DEFAULT 'ITEM' CHECK (price_lock IN ('ITEM','CHECKOUT')),
+  ADD COLUMN IF NOT EXISTS checked_out_at timestamptz;
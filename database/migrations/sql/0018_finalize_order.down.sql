@@ -0,0 +1,4 @@
+-- migrate:irreversible
+-- sp_finalize_order predates versioned migrations and this is its first
+-- versioned definition; orders and payments cannot work without it or
+-- sp_recalculate_order, and there is no earlier version to restore.
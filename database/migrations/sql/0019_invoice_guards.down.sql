@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS trg_invoice_lines_immutable ON invoice_lines;
+DROP TRIGGER IF EXISTS trg_invoice_immutable ON invoices;
+DROP FUNCTION IF EXISTS invoice_lines_immutable();
+DROP FUNCTION IF EXISTS invoice_immutable();
@@ -0,0 +1,54 @@
+-- Invoices are immutable once they leave DRAFT: only the status and its
+-- timestamps may change, and their lines are frozen.
+
+CREATE OR REPLACE FUNCTION invoice_immutable()
+RETURNS trigger AS $$
+BEGIN
+  IF TG_OP = 'DELETE' THEN
+    IF OLD.status <> 'DRAFT' THEN
+      RAISE EXCEPTION 'invoice % is % and cannot be deleted', OLD.id, OLD.status;
+    END IF;
+    RETURN OLD;
+  END IF;
+
+  IF OLD.status <> 'DRAFT' AND
+     (NEW.client_id, NEW.number, NEW.period_start, NEW.period_end, NEW.currency,
+      NEW.subtotal_cents, NEW.tax_rate_bp, NEW.tax_cents, NEW.total_cents, NEW.issued_at)
+     IS DISTINCT FROM
+     (OLD.client_id, OLD.number, OLD.period_start, OLD.period_end, OLD.currency,
+      OLD.subtotal_cents, OLD.tax_rate_bp, OLD.tax_cents, OLD.total_cents, OLD.issued_at) THEN
+    RAISE EXCEPTION 'invoice % is % and can no longer be changed', OLD.id, OLD.status;
+  END IF;
+  RETURN NEW;
+END; $$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION invoice_lines_immutable()
+RETURNS trigger AS $$
+DECLARE
+  v_invoice_id bigint;
+  v_status invoice_status;
+BEGIN
+  IF TG_OP = 'DELETE' THEN
+    v_invoice_id := OLD.invoice_id;
+  ELSE
+    v_invoice_id := NEW.invoice_id;
+  END IF;
+
+  SELECT status INTO v_status FROM invoices WHERE id = v_invoice_id;
+  IF v_status IS NOT NULL AND v_status <> 'DRAFT' THEN
+    RAISE EXCEPTION 'invoice % is % and its lines can no longer be changed', v_invoice_id, v_status;
+  END IF;
+
+  IF TG_OP = 'DELETE' THEN
+    RETURN OLD;
+  END IF;
+  RETURN NEW;
+END; $$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_invoice_immutable ON invoices;
+CREATE TRIGGER trg_invoice_immutable BEFORE UPDATE OR DELETE ON invoices
+  FOR EACH ROW EXECUTE FUNCTION invoice_immutable();
+
+DROP TRIGGER IF EXISTS trg_invoice_lines_immutable ON invoice_lines;
+CREATE TRIGGER trg_invoice_lines_immutable BEFORE INSERT OR UPDATE OR DELETE ON invoice_lines
+  FOR EACH ROW EXECUTE FUNCTION invoice_lines_immutable();
@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS trg_orders_release_stock ON orders;
+DROP TRIGGER IF EXISTS trg_order_items_reserve_stock ON order_items;
+DROP FUNCTION IF EXISTS orders_release_stock();
+DROP FUNCTION IF EXISTS order_items_reserve_stock();
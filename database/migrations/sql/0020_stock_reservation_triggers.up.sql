@@ -0,0 +1,94 @@
+-- plans.reserved_stock tracks the quantities on PENDING orders. Items reserve
+-- stock as they are written; the order gives it all back when it leaves
+-- PENDING, whether finalized, failed, canceled or expired. sp_finalize_order
+-- takes the sold units out of stock itself.
+
+CREATE OR REPLACE FUNCTION order_items_reserve_stock()
+RETURNS trigger AS $$
+DECLARE
+  v_prev_kind text := current_setting('app.stock_kind', true);
+  v_prev_order text := current_setting('app.order_id', true);
+BEGIN
+  PERFORM set_config('app.stock_kind', 'RESERVATION', true);
+  IF TG_OP = 'DELETE' THEN
+    PERFORM set_config('app.order_id', OLD.order_id::text, true);
+  ELSE
+    PERFORM set_config('app.order_id', NEW.order_id::text, true);
+  END IF;
+
+  IF TG_OP IN ('UPDATE', 'DELETE')
+     AND EXISTS (SELECT 1 FROM orders WHERE id = OLD.order_id AND payment_status = 'PENDING') THEN
+    UPDATE plans SET reserved_stock = reserved_stock - OLD.quantity WHERE id = OLD.plan_id;
+  END IF;
+
+  IF TG_OP IN ('INSERT', 'UPDATE')
+     AND EXISTS (SELECT 1 FROM orders WHERE id = NEW.order_id AND payment_status = 'PENDING') THEN
+    UPDATE plans SET reserved_stock = reserved_stock + NEW.quantity WHERE id = NEW.plan_id;
+  END IF;
+
+  PERFORM set_config('app.stock_kind', COALESCE(v_prev_kind, ''), true);
+  PERFORM set_config('app.order_id', COALESCE(v_prev_order, ''), true);
+  RETURN NULL;
+END; $$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION orders_release_stock()
+RETURNS trigger AS $$
+DECLARE
+  v_sign int := 0;
+  v_order_id bigint;
+  v_prev_kind text;
+  v_prev_order text;
+BEGIN
+  IF TG_OP = 'DELETE' THEN
+    v_order_id := OLD.id;
+    IF OLD.payment_status = 'PENDING' THEN
+      v_sign := -1;
+    END IF;
+  ELSE
+    v_order_id := NEW.id;
+    IF OLD.payment_status = 'PENDING' AND NEW.payment_status <> 'PENDING' THEN
+      v_sign := -1;
+    ELSIF OLD.payment_status <> 'PENDING' AND NEW.payment_status = 'PENDING' THEN
+      v_sign := 1;
+    END IF;
+  END IF;
+
+  IF v_sign <> 0 THEN
+    -- A confirmation inside sp_finalize_order is already labeled SALE.
+    v_prev_kind := current_setting('app.stock_kind', true);
+    v_prev_order := current_setting('app.order_id', true);
+    IF TG_OP = 'UPDATE' AND NEW.payment_status = 'CONFIRMED' THEN
+      PERFORM set_config('app.stock_kind', COALESCE(NULLIF(v_prev_kind, ''), 'SALE'), true);
+    ELSIF v_sign < 0 THEN
+      PERFORM set_config('app.stock_kind', 'CANCEL_RETURN', true);
+    ELSE
+      PERFORM set_config('app.stock_kind', 'RESERVATION', true);
+    END IF;
+    PERFORM set_config('app.order_id', v_order_id::text, true);
+
+    UPDATE plans p
+    SET reserved_stock = p.reserved_stock + v_sign * r.quantity
+    FROM (SELECT plan_id, SUM(quantity) AS quantity
+          FROM order_items WHERE order_id = v_order_id
+          GROUP BY plan_id) r
+    WHERE p.id = r.plan_id;
+
+    PERFORM set_config('app.stock_kind', COALESCE(v_prev_kind, ''), true);
+    PERFORM set_config('app.order_id', COALESCE(v_prev_order, ''), true);
+  END IF;
+
+  IF TG_OP = 'DELETE' THEN
+    RETURN OLD;
+  END IF;
+  RETURN NEW;
+END; $$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_order_items_reserve_stock ON order_items;
+CREATE TRIGGER trg_order_items_reserve_stock AFTER INSERT OR UPDATE OF plan_id, quantity OR DELETE ON order_items
+  FOR EACH ROW EXECUTE FUNCTION order_items_reserve_stock();
+
+-- BEFORE DELETE so the items are still there to release when a whole
+-- order is deleted and its items go with it.
+DROP TRIGGER IF EXISTS trg_orders_release_stock ON orders;
+CREATE TRIGGER trg_orders_release_stock BEFORE UPDATE OF payment_status OR DELETE ON orders
+  FOR EACH ROW EXECUTE FUNCTION orders_release_stock();
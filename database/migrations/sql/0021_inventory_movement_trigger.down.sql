@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS trg_plans_inventory_movement ON plans;
+DROP FUNCTION IF EXISTS plans_record_inventory_movement();
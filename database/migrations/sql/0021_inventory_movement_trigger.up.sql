@@ -0,0 +1,39 @@
+-- Every change to a plan's stock or reservations is logged. Writers label
+-- their changes through transaction-local settings: app.stock_kind,
+-- app.order_id, app.actor and app.stock_reason. Unlabeled changes are plan
+-- creation (INITIAL) or manual edits (CORRECTION).
+
+CREATE OR REPLACE FUNCTION plans_record_inventory_movement()
+RETURNS trigger AS $$
+DECLARE
+  v_stock_delta int;
+  v_reserved_delta int;
+  v_kind text := NULLIF(current_setting('app.stock_kind', true), '');
+BEGIN
+  IF TG_OP = 'INSERT' THEN
+    v_stock_delta := NEW.stock;
+    v_reserved_delta := NEW.reserved_stock;
+    v_kind := COALESCE(v_kind, 'INITIAL');
+  ELSE
+    v_stock_delta := NEW.stock - OLD.stock;
+    v_reserved_delta := NEW.reserved_stock - OLD.reserved_stock;
+    IF v_stock_delta = 0 AND v_reserved_delta = 0 THEN
+      RETURN NULL;
+    END IF;
+    v_kind := COALESCE(v_kind, 'CORRECTION');
+  END IF;
+
+  INSERT INTO inventory_movements
+    (plan_id, kind, stock_delta, reserved_delta, stock_after, reserved_after, order_id, actor, reason)
+  VALUES
+    (NEW.id, v_kind, v_stock_delta, v_reserved_delta, NEW.stock, NEW.reserved_stock,
+     NULLIF(current_setting('app.order_id', true), '')::bigint,
+     COALESCE(NULLIF(current_setting('app.actor', true), ''), 'system'),
+     NULLIF(current_setting('app.stock_reason', true), ''));
+
+  RETURN NULL;
+END; $$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_plans_inventory_movement ON plans;
+CREATE TRIGGER trg_plans_inventory_movement AFTER INSERT OR UPDATE OF stock, reserved_stock ON plans
+  FOR EACH ROW EXECUTE FUNCTION plans_record_inventory_movement();
@@ -0,0 +1,7 @@
+DROP TRIGGER IF EXISTS trg_credit_ledger_record_refund ON credit_ledger;
+DROP TRIGGER IF EXISTS trg_order_items_record_event ON order_items;
+DROP TRIGGER IF EXISTS trg_orders_record_event ON orders;
+DROP FUNCTION IF EXISTS credit_ledger_record_refund();
+DROP FUNCTION IF EXISTS order_items_record_event();
+DROP FUNCTION IF EXISTS orders_record_event();
+DROP FUNCTION IF EXISTS order_event_actor();
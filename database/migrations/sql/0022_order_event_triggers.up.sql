@@ -0,0 +1,118 @@
+-- order_events is written from inside the transaction that changes an order,
+-- sp_finalize_order included. Writers name themselves through app.actor and
+-- may explain a status change through app.order_reason; the order's
+-- cancel_reason is used otherwise. Refunds are REFUND ledger entries whose
+-- meta carries the order_id.
+
+CREATE OR REPLACE FUNCTION order_event_actor()
+RETURNS text AS $$
+  SELECT COALESCE(NULLIF(current_setting('app.actor', true), ''), 'system');
+$$ LANGUAGE sql STABLE;
+
+CREATE OR REPLACE FUNCTION orders_record_event()
+RETURNS trigger AS $$
+BEGIN
+  IF TG_OP = 'INSERT' THEN
+    INSERT INTO order_events (order_id, type, actor, payload)
+    VALUES (NEW.id, 'CREATED', order_event_actor(), jsonb_build_object(
+      'client_id', NEW.client_id,
+      'seller_id', NEW.seller_id,
+      'payment_method', NEW.payment_method,
+      'payment_status', NEW.payment_status,
+      'expires_at', NEW.expires_at));
+    RETURN NULL;
+  END IF;
+
+  IF NEW.discount_cents > 0 AND NEW.discount_cents IS DISTINCT FROM OLD.discount_cents THEN
+    INSERT INTO order_events (order_id, type, actor, payload)
+    VALUES (NEW.id, 'DISCOUNT_APPLIED', order_event_actor(), jsonb_build_object(
+      'subtotal_cents', NEW.subtotal_cents,
+      'discount_cents', NEW.discount_cents,
+      'total_cents', NEW.total_cents));
+  END IF;
+
+  IF NEW.payment_status IS DISTINCT FROM OLD.payment_status THEN
+    INSERT INTO order_events (order_id, type, actor, payload)
+    VALUES (NEW.id, 'STATUS_CHANGED', order_event_actor(), jsonb_strip_nulls(jsonb_build_object(
+      'from', OLD.payment_status,
+      'to', NEW.payment_status,
+      'total_cents', NEW.total_cents,
+      'reason', COALESCE(NULLIF(current_setting('app.order_reason', true), ''), NEW.cancel_reason))));
+  END IF;
+
+  RETURN NULL;
+END; $$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION order_items_record_event()
+RETURNS trigger AS $$
+DECLARE
+  v_order_id bigint;
+BEGIN
+  IF TG_OP = 'DELETE' THEN
+    v_order_id := OLD.order_id;
+  ELSE
+    v_order_id := NEW.order_id;
+  END IF;
+
+  -- Items deleted along with their order leave nothing to attach to.
+  IF NOT EXISTS (SELECT 1 FROM orders WHERE id = v_order_id) THEN
+    RETURN NULL;
+  END IF;
+
+  IF TG_OP = 'INSERT' THEN
+    INSERT INTO order_events (order_id, type, actor, payload)
+    VALUES (v_order_id, 'ITEM_ADDED', order_event_actor(), jsonb_build_object(
+      'item_id', NEW.id, 'plan_id', NEW.plan_id,
+      'quantity', NEW.quantity, 'unit_price_cents', NEW.unit_price_cents));
+  ELSIF TG_OP = 'UPDATE' THEN
+    IF (NEW.plan_id, NEW.quantity, NEW.unit_price_cents) IS NOT DISTINCT FROM (OLD.plan_id, OLD.quantity, OLD.unit_price_cents) THEN
+      RETURN NULL;
+    END IF;
+    INSERT INTO order_events (order_id, type, actor, payload)
+    VALUES (v_order_id, 'ITEM_UPDATED', order_event_actor(), jsonb_build_object(
+      'item_id', NEW.id, 'plan_id', NEW.plan_id,
+      'quantity_before', OLD.quantity, 'quantity', NEW.quantity,
+      'unit_price_cents_before', OLD.unit_price_cents, 'unit_price_cents', NEW.unit_price_cents));
+  ELSE
+    INSERT INTO order_events (order_id, type, actor, payload)
+    VALUES (v_order_id, 'ITEM_REMOVED', order_event_actor(), jsonb_build_object(
+      'item_id', OLD.id, 'plan_id', OLD.plan_id,
+      'quantity', OLD.quantity, 'unit_price_cents', OLD.unit_price_cents));
+  END IF;
+
+  RETURN NULL;
+END; $$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION credit_ledger_record_refund()
+RETURNS trigger AS $$
+DECLARE
+  v_order_id bigint;
+BEGIN
+  IF NEW.meta->>'order_id' !~ '^[0-9]+$' THEN
+    RETURN NULL;
+  END IF;
+  v_order_id := (NEW.meta->>'order_id')::bigint;
+  IF NOT EXISTS (SELECT 1 FROM orders WHERE id = v_order_id) THEN
+    RETURN NULL;
+  END IF;
+
+  INSERT INTO order_events (order_id, type, actor, payload)
+  VALUES (v_order_id, 'REFUNDED', order_event_actor(), jsonb_strip_nulls(jsonb_build_object(
+    'ledger_entry_id', NEW.id,
+    'credits_delta', NEW.credits_delta,
+    'price_cents_delta', NEW.price_cents_delta,
+    'reason', NULLIF(current_setting('app.order_reason', true), ''))));
+  RETURN NULL;
+END; $$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_orders_record_event ON orders;
+CREATE TRIGGER trg_orders_record_event AFTER INSERT OR UPDATE OF payment_status, discount_cents ON orders
+  FOR EACH ROW EXECUTE FUNCTION orders_record_event();
+
+DROP TRIGGER IF EXISTS trg_order_items_record_event ON order_items;
+CREATE TRIGGER trg_order_items_record_event AFTER INSERT OR UPDATE OR DELETE ON order_items
+  FOR EACH ROW EXECUTE FUNCTION order_items_record_event();
+
+DROP TRIGGER IF EXISTS trg_credit_ledger_record_refund ON credit_ledger;
+CREATE TRIGGER trg_credit_ledger_record_refund AFTER INSERT ON credit_ledger
+  FOR EACH ROW WHEN (NEW.type = 'REFUND') EXECUTE FUNCTION credit_ledger_record_refund();
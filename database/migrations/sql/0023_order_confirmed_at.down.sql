@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS trg_orders_stamp_confirmed_at ON orders;
+DROP FUNCTION IF EXISTS orders_stamp_confirmed_at();
+DROP INDEX IF EXISTS idx_orders_confirmed_at;
+ALTER TABLE orders DROP COLUMN IF EXISTS confirmed_at;
@@ -0,0 +1,28 @@
+-- Invoices bill an order in the period it was paid, not the one it was
+-- opened in, so orders remember when they were confirmed. Orders confirmed
+-- before this migration take the time their STATUS_CHANGED event was
+-- recorded, or their creation time when they predate order_events.
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS confirmed_at timestamptz;
+
+UPDATE orders o
+SET confirmed_at = COALESCE(
+  (SELECT MAX(e.created_at) FROM order_events e
+   WHERE e.order_id = o.id AND e.type = 'STATUS_CHANGED' AND e.payload->>'to' = 'CONFIRMED'),
+  o.created_at)
+WHERE o.payment_status = 'CONFIRMED' AND o.confirmed_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_orders_confirmed_at ON orders(confirmed_at) WHERE confirmed_at IS NOT NULL;
+
+CREATE OR REPLACE FUNCTION orders_stamp_confirmed_at()
+RETURNS trigger AS $$
+BEGIN
+  IF NEW.payment_status = 'CONFIRMED' AND OLD.payment_status IS DISTINCT FROM 'CONFIRMED' THEN
+    NEW.confirmed_at := clock_timestamp();
+  END IF;
+  RETURN NEW;
+END; $$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_orders_stamp_confirmed_at ON orders;
+CREATE TRIGGER trg_orders_stamp_confirmed_at BEFORE UPDATE OF payment_status ON orders
+  FOR EACH ROW EXECUTE FUNCTION orders_stamp_confirmed_at();
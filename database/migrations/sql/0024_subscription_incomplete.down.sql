@@ -0,0 +1,6 @@
+-- Postgres cannot drop an enum value; subscriptions that never got paid are
+-- canceled instead, so nothing is left in a state older code doesn't know.
+UPDATE subscriptions
+SET status = 'CANCELED', canceled_at = COALESCE(canceled_at, now()),
+    cancel_reason = COALESCE(cancel_reason, 'first charge never confirmed'), next_renewal_at = NULL
+WHERE status = 'INCOMPLETE';
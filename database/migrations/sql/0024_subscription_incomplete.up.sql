@@ -0,0 +1,3 @@
+-- migrate:no-transaction
+-- A subscription is INCOMPLETE until the provider confirms its first charge.
+ALTER TYPE subscription_status ADD VALUE IF NOT EXISTS 'INCOMPLETE' BEFORE 'ACTIVE';
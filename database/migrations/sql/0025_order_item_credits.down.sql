@@ -0,0 +1,120 @@
+-- Restores sp_finalize_order as defined by 0018.
+
+CREATE OR REPLACE FUNCTION sp_finalize_order(p_order_id bigint)
+RETURNS void AS $$
+DECLARE
+  v_client RECORD;
+  v_item RECORD;
+  v_discount_rate numeric := 0.0;
+  v_credits_added bigint := 0;
+  v_item_credits bigint := 0;
+  v_balance bigint;
+  v_settle bigint := 0;
+  v_take bigint;
+  v_lot RECORD;
+  v_topup_id bigint;
+  v_status text;
+  v_prev_kind text;
+  v_prev_order text;
+BEGIN
+  SELECT payment_status::text INTO v_status
+  FROM orders WHERE id = p_order_id FOR UPDATE;
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'order % not found', p_order_id;
+  END IF;
+  IF v_status <> 'PENDING' THEN
+    RAISE EXCEPTION 'order % is not pending (%)', p_order_id, v_status;
+  END IF;
+
+  -- Finalizing checks the order out if nothing else did, fixing its prices.
+  PERFORM sp_recalculate_order(p_order_id, true);
+
+  SELECT c.* INTO v_client
+  FROM orders o JOIN clients c ON c.id = o.client_id
+  WHERE o.id = p_order_id FOR UPDATE;
+
+  SELECT balance_credits INTO v_balance
+  FROM wallets WHERE client_id = v_client.id FOR UPDATE;
+
+  IF v_client.supports_flamengo OR v_client.watches_one_piece OR lower(coalesce(v_client.city,'')) = 'sousa' THEN
+    v_discount_rate := 0.10;
+  END IF;
+
+  UPDATE orders SET subtotal_cents = 0, discount_cents = 0, total_cents = 0
+  WHERE id = p_order_id;
+
+  -- Stock and reservation changes below are logged as this order's sale.
+  v_prev_kind := current_setting('app.stock_kind', true);
+  v_prev_order := current_setting('app.order_id', true);
+  PERFORM set_config('app.stock_kind', 'SALE', true);
+  PERFORM set_config('app.order_id', p_order_id::text, true);
+
+  FOR v_item IN
+    SELECT oi.*, p.stock, p.amount_credits, p.validity_days
+    FROM order_items oi JOIN plans p ON p.id = oi.plan_id
+    WHERE oi.order_id = p_order_id
+  LOOP
+    IF v_item.stock < v_item.quantity THEN
+      RAISE EXCEPTION 'insufficient stock for plan %', v_item.plan_id;
+    END IF;
+
+    UPDATE plans SET stock = stock - v_item.quantity WHERE id = v_item.plan_id;
+
+    UPDATE orders
+    SET subtotal_cents = subtotal_cents + (v_item.unit_price_cents * v_item.quantity)
+    WHERE id = p_order_id;
+
+    v_item_credits := v_item.quantity * v_item.amount_credits;
+    v_credits_added := v_credits_added + v_item_credits;
+
+    INSERT INTO credit_lots (client_id, source, order_id, plan_id, credits_total, credits_remaining, expires_at)
+    VALUES (v_client.id, 'ORDER', p_order_id, v_item.plan_id, v_item_credits, v_item_credits,
+            CASE WHEN v_item.validity_days IS NULL THEN NULL
+                 ELSE NOW() + make_interval(days => v_item.validity_days) END);
+  END LOOP;
+
+  UPDATE orders
+  SET discount_cents = floor(subtotal_cents * v_discount_rate),
+      total_cents    = subtotal_cents - discount_cents,
+      payment_status = 'CONFIRMED'
+  WHERE id = p_order_id;
+
+  PERFORM set_config('app.stock_kind', COALESCE(v_prev_kind, ''), true);
+  PERFORM set_config('app.order_id', COALESCE(v_prev_order, ''), true);
+
+  INSERT INTO credit_ledger (client_id, type, credits_delta, price_cents_delta, meta)
+  SELECT o.client_id, 'TOPUP', v_credits_added, o.total_cents, jsonb_build_object('order_id', o.id)
+  FROM orders o WHERE o.id = p_order_id
+  RETURNING id INTO v_topup_id;
+
+  -- Credits that pay back an overdraft come out of this order's lots,
+  -- soonest expiry first, mirroring how usage would have drawn them.
+  v_settle := LEAST(GREATEST(-COALESCE(v_balance, 0), 0), v_credits_added);
+  IF v_settle > 0 THEN
+    INSERT INTO credit_ledger (client_id, type, credits_delta, price_cents_delta, meta)
+    VALUES (v_client.id, 'DEBT_SETTLEMENT', 0, 0, jsonb_build_object(
+      'type', 'debt_settlement',
+      'settled_credits', v_settle,
+      'debt_before', -v_balance,
+      'debt_after', -v_balance - v_settle,
+      'settled_by_entry_id', v_topup_id));
+
+    FOR v_lot IN
+      SELECT id, credits_remaining FROM credit_lots
+      WHERE order_id = p_order_id
+      ORDER BY expires_at ASC NULLS LAST, id ASC
+    LOOP
+      EXIT WHEN v_settle = 0;
+      v_take := LEAST(v_lot.credits_remaining, v_settle);
+      UPDATE credit_lots SET credits_remaining = credits_remaining - v_take WHERE id = v_lot.id;
+      v_settle := v_settle - v_take;
+    END LOOP;
+  END IF;
+
+  INSERT INTO wallets (client_id, balance_credits) VALUES
+    ((SELECT client_id FROM orders WHERE id = p_order_id), v_credits_added)
+  ON CONFLICT (client_id)
+  DO UPDATE SET balance_credits = wallets.balance_credits + EXCLUDED.balance_credits;
+END; $$ LANGUAGE plpgsql;
+
+ALTER TABLE order_items DROP COLUMN IF EXISTS credits_per_unit;
@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS trg_wallets_rearm_balance_alert ON wallets;
+DROP FUNCTION IF EXISTS wallets_rearm_balance_alert();
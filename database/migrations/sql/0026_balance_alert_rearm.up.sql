@@ -0,0 +1,24 @@
+-- A low-balance alert re-arms as soon as the wallet climbs back to its
+-- threshold, whichever path credited it: top-ups, finalized orders, grants,
+-- transfers or adjustments. Otherwise it would stay disarmed until the next
+-- usage check, and a balance that dips again before then would not notify.
+
+CREATE OR REPLACE FUNCTION wallets_rearm_balance_alert()
+RETURNS trigger AS $$
+BEGIN
+  IF TG_OP = 'UPDATE' AND NEW.balance_credits <= OLD.balance_credits THEN
+    RETURN NULL;
+  END IF;
+
+  UPDATE balance_alerts
+  SET armed = true, updated_at = now()
+  WHERE client_id = NEW.client_id
+    AND NOT armed
+    AND NEW.balance_credits >= threshold_credits;
+
+  RETURN NULL;
+END; $$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_wallets_rearm_balance_alert ON wallets;
+CREATE TRIGGER trg_wallets_rearm_balance_alert AFTER INSERT OR UPDATE OF balance_credits ON wallets
+  FOR EACH ROW EXECUTE FUNCTION wallets_rearm_balance_alert();
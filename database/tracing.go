@@ -0,0 +1,147 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"runtime"
+	"strings"
+
+	"github.com/Enilsonn/CRUD-Postgres/internal/tracing"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const repositoryPackage = "/internal/repository."
+
+// tracedConnector wraps lib/pq so every statement gets a client span. Spans
+// are named after the repository function that ran the statement, e.g.
+// OrderRepository.GetOrderByID, and carry the SQL operation but never the
+// query text or its arguments. A query's span ends when its first result is
+// ready, not when its rows have been read.
+type tracedConnector struct {
+	driver.Connector
+}
+
+func (c tracedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &tracedConn{Conn: conn}, nil
+}
+
+// tracedConn forwards the optional driver interfaces lib/pq implements.
+type tracedConn struct {
+	driver.Conn
+}
+
+func (c *tracedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	ctx, span := startStatement(ctx, query)
+	rows, err := queryer.QueryContext(ctx, query, args)
+	endStatement(span, err)
+	return rows, err
+}
+
+func (c *tracedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	ctx, span := startStatement(ctx, query)
+	result, err := execer.ExecContext(ctx, query, args)
+	endStatement(span, err)
+	return result, err
+}
+
+func (c *tracedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return preparer.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c *tracedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c *tracedConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *tracedConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *tracedConn) IsValid() bool {
+	if validator, ok := c.Conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+func startStatement(ctx context.Context, query string) (context.Context, trace.Span) {
+	operation := sqlOperation(query)
+	name := statementName()
+	if name == "" {
+		name = operation
+	}
+	return tracing.Tracer().Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemNamePostgreSQL,
+			semconv.DBOperationName(operation),
+		))
+}
+
+func endStatement(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// statementName is the innermost repository function on the stack, as
+// Type.Method or function, or "" for statements issued elsewhere.
+func statementName() string {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs)])
+	for {
+		frame, more := frames.Next()
+		if i := strings.LastIndex(frame.Function, repositoryPackage); i >= 0 {
+			name := frame.Function[i+len(repositoryPackage):]
+			name = strings.NewReplacer("(*", "", ")", "").Replace(name)
+			// Closures show up as Method.func1; the method is name enough.
+			if j := strings.Index(name, ".func"); j >= 0 {
+				name = name[:j]
+			}
+			return name
+		}
+		if !more {
+			return ""
+		}
+	}
+}
+
+// sqlOperation is the statement's leading keyword, e.g. SELECT or WITH.
+func sqlOperation(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.ToUpper(strings.TrimLeft(fields[0], "("))
+}
@@ -0,0 +1,52 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// fakeConn answers every statement with err.
+type fakeConn struct {
+	driver.Conn
+	err error
+}
+
+func (c fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return driver.RowsAffected(1), c.err
+}
+
+func TestTracedConnRecordsStatementWithoutArgs(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	conn := &tracedConn{Conn: fakeConn{err: errors.New("boom")}}
+	args := []driver.NamedValue{{Ordinal: 1, Value: "s3cret"}}
+	if _, err := conn.ExecContext(context.Background(), "\n\tUPDATE wallets SET balance_credits = $1", args); err == nil {
+		t.Fatal("want the driver's error back")
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(spans))
+	}
+	span := spans[0]
+	// Outside the repository package the operation names the span.
+	if span.Name() != "UPDATE" {
+		t.Errorf("span name = %q, want UPDATE", span.Name())
+	}
+	if span.Status().Code != codes.Error {
+		t.Errorf("status = %v, want the error recorded", span.Status())
+	}
+	for _, attr := range span.Attributes() {
+		if attr.Value.Emit() == "s3cret" {
+			t.Errorf("attribute %s leaks a statement argument", attr.Key)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/Enilsonn/CRUD-Postgres/internal/repository"
+	"github.com/Enilsonn/CRUD-Postgres/internal/service"
+	"github.com/Enilsonn/CRUD-Postgres/internal/utils"
+	"github.com/go-chi/chi/v5"
+)
+
+type AlertHandler struct {
+	service *service.BalanceAlertService
+}
+
+func NewAlertHandler(service *service.BalanceAlertService) *AlertHandler {
+	return &AlertHandler{service: service}
+}
+
+func (h *AlertHandler) GetAlert(w http.ResponseWriter, r *http.Request) {
+	clientID, err := strconv.ParseInt(chi.URLParam(r, "client_id"), 10, 64)
+	if err != nil {
+		utils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+			"error":   true,
+			"code":    "INVALID_CLIENT_ID",
+			"message": "invalid client ID",
+		})
+		return
+	}
+
+	alert, err := h.service.Get(r.Context(), clientID)
+	if err != nil {
+		status := http.StatusInternalServerError
+		code := "DATABASE_ERROR"
+		if errors.Is(err, repository.ErrAlertNotFound) {
+			status = http.StatusNotFound
+			code = "ALERT_NOT_FOUND"
+		}
+		utils.EncodeJson(w, r, status, map[string]any{
+			"error":   true,
+			"code":    code,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	utils.EncodeJson(w, r, http.StatusOK, alert)
+}
+
+func (h *AlertHandler) SaveAlert(w http.ResponseWriter, r *http.Request) {
+	clientID, err := strconv.ParseInt(chi.URLParam(r, "client_id"), 10, 64)
+	if err != nil {
+		utils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+			"error":   true,
+			"code":    "INVALID_CLIENT_ID",
+			"message": "invalid client ID",
+		})
+		return
+	}
+
+	type req struct {
+		ThresholdCredits   int64  `json:"threshold_credits"`
+		WebhookURL         string `json:"webhook_url"`
+		Email              string `json:"email"`
+		AutoRechargePlanID *int64 `json:"auto_recharge_plan_id"`
+		MaxRechargesPerDay *int   `json:"max_recharges_per_day"`
+		CooldownMinutes    *int   `json:"cooldown_minutes"`
+		Enabled            *bool  `json:"enabled"`
+	}
+
+	payload, err := utils.DecodeJson[req](r)
+	if err != nil {
+		utils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+			"error":   true,
+			"code":    "INVALID_REQUEST",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	alert, err := h.service.Save(r.Context(), service.SaveBalanceAlertRequest{
+		ClientID:           clientID,
+		ThresholdCredits:   payload.ThresholdCredits,
+		WebhookURL:         payload.WebhookURL,
+		Email:              payload.Email,
+		AutoRechargePlanID: payload.AutoRechargePlanID,
+		MaxRechargesPerDay: payload.MaxRechargesPerDay,
+		CooldownMinutes:    payload.CooldownMinutes,
+		Enabled:            payload.Enabled,
+	})
+	if err != nil {
+		status := http.StatusInternalServerError
+		code := "ALERT_SAVE_FAILED"
+
+		switch {
+		case errors.Is(err, repository.ErrInvalidInput):
+			status = http.StatusBadRequest
+			code = "INVALID_ALERT"
+		case errors.Is(err, repository.ErrNotFound):
+			status = http.StatusNotFound
+			code = "NOT_FOUND"
+		}
+
+		utils.EncodeJson(w, r, status, map[string]any{
+			"error":   true,
+			"code":    code,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	utils.EncodeJson(w, r, http.StatusOK, alert)
+}
+
+func (h *AlertHandler) ListAlertEvents(w http.ResponseWriter, r *http.Request) {
+	clientID, err := strconv.ParseInt(chi.URLParam(r, "client_id"), 10, 64)
+	if err != nil {
+		utils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+			"error":   true,
+			"code":    "INVALID_CLIENT_ID",
+			"message": "invalid client ID",
+		})
+		return
+	}
+
+	events, err := h.service.Events(r.Context(), clientID)
+	if err != nil {
+		utils.EncodeJson(w, r, http.StatusInternalServerError, map[string]any{
+			"error":   true,
+			"code":    "DATABASE_ERROR",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	utils.EncodeJson(w, r, http.StatusOK, events)
+}
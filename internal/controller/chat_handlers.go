@@ -3,16 +3,25 @@ package controller
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"math"
+	"log/slog"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/Enilsonn/CRUD-Postgres/cmd/configs"
+	"github.com/Enilsonn/CRUD-Postgres/internal/metrics"
 	"github.com/Enilsonn/CRUD-Postgres/internal/repository"
 	"github.com/Enilsonn/CRUD-Postgres/internal/service"
+	"github.com/Enilsonn/CRUD-Postgres/internal/tracing"
 	"github.com/Enilsonn/CRUD-Postgres/internal/utils"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	oteltrace "go.opentelemetry.io/otel/trace"
 )
 
 // ChatHandler provides endpoints backed by local Ollama chat models.
@@ -20,6 +29,7 @@ type ChatHandler struct {
 	WalletRepo *repository.WalletRepository
 	HTTPClient *http.Client
 	PricingSvc *service.PricingService
+	Alerts     *service.BalanceAlertService
 }
 
 // NewChatHandler wires the dependencies required for chat operations.
@@ -96,6 +106,7 @@ func (h *ChatHandler) ChatOllama(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
+	utils.AddLogAttrs(ctx, slog.Int64("client_id", req.ClientID))
 
 	if req.ClientID == 0 || len(req.Messages) == 0 {
 		utils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
@@ -122,6 +133,18 @@ func (h *ChatHandler) ChatOllama(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The rate is looked up before Ollama runs, so a pricing failure costs no
+	// completion and the Ollama metrics can be labeled by pricing rule.
+	rate, err := h.PricingSvc.RateFor(ctx, model)
+	if err != nil {
+		utils.EncodeJson(w, r, http.StatusInternalServerError, map[string]any{
+			"error":   true,
+			"code":    "PRICING_FAILED",
+			"message": err.Error(),
+		})
+		return
+	}
+
 	oMessages := make([]ollamaMessage, 0, len(req.Messages))
 	for _, msg := range req.Messages {
 		oMessages = append(oMessages, ollamaMessage{Role: msg.Role, Content: msg.Content})
@@ -144,9 +167,30 @@ func (h *ChatHandler) ChatOllama(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The span covers only the call to Ollama; billing below hangs off the
+	// request's span.
+	oCtx, span := tracing.Tracer().Start(ctx, "ollama.chat",
+		oteltrace.WithSpanKind(oteltrace.SpanKindClient),
+		oteltrace.WithAttributes(
+			attribute.String("gen_ai.system", "ollama"),
+			attribute.String("gen_ai.operation.name", "chat"),
+			attribute.String("gen_ai.request.model", model),
+			attribute.String("server.address", ai.OllamaHost),
+		))
+	ollamaStart := time.Now()
+	finishOllama := func(reason string, err error) {
+		metrics.ObserveOllama(rate.Rule, time.Since(ollamaStart), reason)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, reason)
+		}
+		span.End()
+	}
+
 	oURL := fmt.Sprintf("%s/api/chat", ai.OllamaHost)
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, oURL, buf)
+	httpReq, err := http.NewRequestWithContext(oCtx, http.MethodPost, oURL, buf)
 	if err != nil {
+		span.End()
 		utils.EncodeJson(w, r, http.StatusInternalServerError, map[string]any{
 			"error":   true,
 			"code":    "REQUEST_BUILD_FAILED",
@@ -155,9 +199,11 @@ func (h *ChatHandler) ChatOllama(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	httpReq.Header.Set("Content-Type", "application/json")
+	otel.GetTextMapPropagator().Inject(oCtx, propagation.HeaderCarrier(httpReq.Header))
 
 	resp, err := h.HTTPClient.Do(httpReq)
 	if err != nil {
+		finishOllama("unavailable", err)
 		utils.EncodeJson(w, r, http.StatusInternalServerError, map[string]any{
 			"error":   true,
 			"code":    "OLLAMA_UNAVAILABLE",
@@ -169,6 +215,7 @@ func (h *ChatHandler) ChatOllama(w http.ResponseWriter, r *http.Request) {
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
+		finishOllama("read", err)
 		utils.EncodeJson(w, r, http.StatusBadGateway, map[string]any{
 			"error":   true,
 			"code":    "OLLAMA_READ_ERROR",
@@ -178,6 +225,7 @@ func (h *ChatHandler) ChatOllama(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if resp.StatusCode >= http.StatusMultipleChoices {
+		finishOllama("status_"+strconv.Itoa(resp.StatusCode), fmt.Errorf("ollama answered %s", resp.Status))
 		utils.EncodeJson(w, r, http.StatusBadGateway, map[string]any{
 			"error":  true,
 			"code":   "OLLAMA_ERROR",
@@ -189,6 +237,7 @@ func (h *ChatHandler) ChatOllama(w http.ResponseWriter, r *http.Request) {
 
 	var oResp ollamaChatResponse
 	if err := json.Unmarshal(body, &oResp); err != nil {
+		finishOllama("parse", err)
 		utils.EncodeJson(w, r, http.StatusBadGateway, map[string]any{
 			"error":   true,
 			"code":    "OLLAMA_PARSE_ERROR",
@@ -199,44 +248,50 @@ func (h *ChatHandler) ChatOllama(w http.ResponseWriter, r *http.Request) {
 
 	promptTokens := oResp.PromptEvalCount
 	completionTokens := oResp.EvalCount
-	totalTokens := promptTokens + completionTokens
-	var (
-		credits int64
-		ppk     float64 = 1.0
-		cpk     float64 = 1.0
+	span.SetAttributes(
+		attribute.String("gen_ai.response.model", oResp.Model),
+		attribute.Int64("gen_ai.usage.input_tokens", promptTokens),
+		attribute.Int64("gen_ai.usage.output_tokens", completionTokens),
 	)
+	finishOllama("", nil)
 
-	if h.PricingSvc != nil {
-		credits, ppk, cpk, err = h.PricingSvc.ComputeCredits(ctx, model, promptTokens, completionTokens)
-		if err != nil {
-			utils.EncodeJson(w, r, http.StatusInternalServerError, map[string]any{
-				"error":   true,
-				"code":    "PRICING_FAILED",
-				"message": err.Error(),
-			})
-			return
-		}
-	} else {
-		credits = int64(math.Ceil(float64(totalTokens) / 1000.0))
-	}
+	totalTokens := promptTokens + completionTokens
+	credits := rate.Credits(promptTokens, completionTokens)
 
 	meta := map[string]any{
 		"model": model,
-		"ppk":   ppk,
-		"cpk":   cpk,
+		"ppk":   rate.PromptPer1K,
+		"cpk":   rate.CompletionPer1K,
 	}
 
-	newBalance, err := h.WalletRepo.ProcessUsage(ctx, req.ClientID, model, promptTokens, completionTokens, credits, meta)
+	charge, err := h.WalletRepo.ProcessUsage(ctx, req.ClientID, model, promptTokens, completionTokens, credits, meta)
 	if err != nil {
-		switch err.Error() {
-		case "insufficient credits":
+		switch {
+		case errors.Is(err, repository.ErrInsufficientCredits):
+			metrics.RejectCredits("chat", "INSUFFICIENT_CREDITS")
 			utils.EncodeJson(w, r, http.StatusConflict, map[string]any{
 				"error":   true,
 				"code":    "INSUFFICIENT_CREDITS",
 				"message": "not enough credits",
 			})
 			return
-		case "wallet not found":
+		case errors.Is(err, repository.ErrCreditLimitExceeded):
+			metrics.RejectCredits("chat", "CREDIT_LIMIT_EXCEEDED")
+			utils.EncodeJson(w, r, http.StatusConflict, map[string]any{
+				"error":   true,
+				"code":    "CREDIT_LIMIT_EXCEEDED",
+				"message": "usage would exceed the wallet credit limit",
+			})
+			return
+		case errors.Is(err, repository.ErrMemberLimitExceeded):
+			metrics.RejectCredits("chat", "MEMBER_LIMIT_EXCEEDED")
+			utils.EncodeJson(w, r, http.StatusConflict, map[string]any{
+				"error":   true,
+				"code":    "MEMBER_LIMIT_EXCEEDED",
+				"message": err.Error(),
+			})
+			return
+		case errors.Is(err, repository.ErrWalletNotFound):
 			utils.EncodeJson(w, r, http.StatusNotFound, map[string]any{
 				"error":   true,
 				"code":    "UNKNOWN_CLIENT",
@@ -253,6 +308,9 @@ func (h *ChatHandler) ChatOllama(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	metrics.ObserveUsage(rate.Rule, promptTokens, completionTokens, credits)
+	h.Alerts.CheckAsync(charge.WalletClientID, charge.BalanceCredits)
+
 	respBody := ChatResponse{
 		Model:            model,
 		Reply:            oResp.Message.Content,
@@ -260,7 +318,7 @@ func (h *ChatHandler) ChatOllama(w http.ResponseWriter, r *http.Request) {
 		CompletionTokens: completionTokens,
 		TotalTokens:      totalTokens,
 		CreditsCharged:   credits,
-		WalletBalance:    newBalance,
+		WalletBalance:    charge.BalanceCredits,
 	}
 
 	utils.EncodeJson(w, r, http.StatusOK, respBody)
@@ -5,7 +5,9 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	sqlmock "github.com/DATA-DOG/go-sqlmock"
 	"github.com/Enilsonn/CRUD-Postgres/cmd/configs"
@@ -30,6 +32,8 @@ func setupConfig(t *testing.T, host string, defaultModel string) {
 	viper.Reset()
 	viper.Set("ai.ollama_host", host)
 	viper.Set("ai.default_model", defaultModel)
+	viper.Set("database.url", "postgres://test@localhost/test")
+	viper.Set("payments.webhook_secret", "test-secret")
 	if err := configs.Load("./cmd/main"); err != nil {
 		t.Fatalf("load config: %v", err)
 	}
@@ -73,15 +77,29 @@ func TestChatOllamaCredits(t *testing.T) {
 				WillReturnRows(tc.pricingRows)
 
 			mock.ExpectBegin()
-			mock.ExpectQuery(`(?s)SELECT COALESCE\(balance_credits, 0\) FROM wallets`).
+			mock.ExpectQuery(`(?s)SELECT m.org_id, o.billing_client_id, m.monthly_limit_credits FROM organization_members`).
 				WithArgs(int64(1)).
-				WillReturnRows(sqlmock.NewRows([]string{"balance_credits"}).AddRow(tc.walletBalanceBefore))
+				WillReturnRows(sqlmock.NewRows([]string{"org_id", "billing_client_id", "monthly_limit_credits"}))
+			mock.ExpectQuery(`(?s)SELECT COALESCE\(balance_credits, 0\), credit_limit_credits FROM wallets`).
+				WithArgs(int64(1)).
+				WillReturnRows(sqlmock.NewRows([]string{"balance_credits", "credit_limit_credits"}).AddRow(tc.walletBalanceBefore, int64(0)))
 			mock.ExpectExec(`(?s)INSERT INTO usage_events`).
 				WithArgs(int64(1), tc.model, tc.promptTokens, tc.completionTokens, tc.expectedCredits).
 				WillReturnResult(sqlmock.NewResult(1, 1))
 			mock.ExpectExec(`(?s)INSERT INTO credit_ledger`).
-				WithArgs(int64(1), -tc.expectedCredits, sqlmock.AnyArg()).
+				WithArgs(int64(1), -tc.expectedCredits, sqlmock.AnyArg(), nil, nil).
 				WillReturnResult(sqlmock.NewResult(1, 1))
+			mock.ExpectQuery(`(?s)SELECT id, credits_remaining, expires_at FROM credit_lots .* ORDER BY expires_at ASC NULLS LAST, id ASC FOR UPDATE`).
+				WithArgs(int64(1)).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "credits_remaining", "expires_at"}).
+					AddRow(int64(11), int64(1), time.Now().Add(time.Hour)).
+					AddRow(int64(12), tc.walletBalanceBefore, nil))
+			mock.ExpectExec(`(?s)UPDATE credit_lots SET credits_remaining = credits_remaining - \$2`).
+				WithArgs(int64(11), int64(1)).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(`(?s)UPDATE credit_lots SET credits_remaining = credits_remaining - \$2`).
+				WithArgs(int64(12), tc.expectedCredits-1).
+				WillReturnResult(sqlmock.NewResult(0, 1))
 			mock.ExpectQuery(`(?s)UPDATE wallets`).
 				WithArgs(int64(1), tc.expectedCredits).
 				WillReturnRows(sqlmock.NewRows([]string{"balance_credits"}).AddRow(tc.walletBalanceAfter))
@@ -158,3 +176,63 @@ func TestChatOllamaCredits(t *testing.T) {
 		})
 	}
 }
+
+// expectUsageShortOfLots expects ProcessUsage for client 1 to find a balance
+// of 10 but only 1 credit in open lots, so the lot draw fails.
+func expectUsageShortOfLots(mock sqlmock.Sqlmock, model string, credits int64) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(`(?s)SELECT m.org_id, o.billing_client_id, m.monthly_limit_credits FROM organization_members`).
+		WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"org_id", "billing_client_id", "monthly_limit_credits"}))
+	mock.ExpectQuery(`(?s)SELECT COALESCE\(balance_credits, 0\), credit_limit_credits FROM wallets`).
+		WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"balance_credits", "credit_limit_credits"}).AddRow(int64(10), int64(0)))
+	mock.ExpectExec(`(?s)INSERT INTO usage_events`).
+		WithArgs(int64(1), model, sqlmock.AnyArg(), sqlmock.AnyArg(), credits).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`(?s)INSERT INTO credit_ledger`).
+		WithArgs(int64(1), -credits, sqlmock.AnyArg(), nil, nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(`(?s)FROM credit_lots`).
+		WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "credits_remaining", "expires_at"}).AddRow(int64(11), int64(1), nil))
+	mock.ExpectRollback()
+}
+
+func TestChatOllamaRejectsUsageTheLotsCannotCover(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock new: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(`(?s)SELECT pattern, credits_per_1k_prompt, credits_per_1k_completion FROM model_pricing`).
+		WillReturnRows(sqlmock.NewRows([]string{"pattern", "credits_per_1k_prompt", "credits_per_1k_completion"}))
+	expectUsageShortOfLots(mock, "gemma3:1b", 2)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"model":             "gemma3:1b",
+			"message":           map[string]any{"role": "assistant", "content": "hi"},
+			"done":              true,
+			"prompt_eval_count": 900,
+			"eval_count":        900,
+		})
+	}))
+	defer server.Close()
+	setupConfig(t, server.URL, "gemma3:1b")
+
+	handler := NewChatHandler(repository.NewWalletRepository(db), service.NewPricingService(repository.NewPricingRepository(db)))
+	handler.HTTPClient = server.Client()
+
+	body := bytes.NewBufferString(`{"client_id":1,"model":"gemma3:1b","messages":[{"role":"user","content":"hello"}]}`)
+	rr := httptest.NewRecorder()
+	handler.ChatOllama(rr, httptest.NewRequest(http.MethodPost, "/api/chat/ollama", body))
+
+	if rr.Code != http.StatusConflict || !strings.Contains(rr.Body.String(), "INSUFFICIENT_CREDITS") {
+		t.Errorf("status %d body %s, want 409 INSUFFICIENT_CREDITS", rr.Code, rr.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
@@ -0,0 +1,19 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/Enilsonn/CRUD-Postgres/cmd/configs"
+	"github.com/Enilsonn/CRUD-Postgres/internal/utils"
+)
+
+type ConfigHandler struct{}
+
+func NewConfigHandler() *ConfigHandler {
+	return &ConfigHandler{}
+}
+
+// Effective serves the running configuration, secrets redacted.
+func (h *ConfigHandler) Effective(w http.ResponseWriter, r *http.Request) {
+	utils.EncodeJson(w, r, http.StatusOK, configs.Effective())
+}
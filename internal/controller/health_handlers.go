@@ -0,0 +1,223 @@
+package controller
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Enilsonn/CRUD-Postgres/cmd/configs"
+	"github.com/Enilsonn/CRUD-Postgres/database/migrations"
+	"github.com/Enilsonn/CRUD-Postgres/internal/utils"
+)
+
+// healthCheckTimeout bounds each dependency check so a hung dependency makes
+// /readyz fail instead of hang.
+const healthCheckTimeout = 2 * time.Second
+
+const (
+	healthOK       = "ok"
+	healthFail     = "fail"
+	healthReady    = "ready"
+	healthDegraded = "degraded"
+	healthNotReady = "not_ready"
+)
+
+// HealthHandler serves the liveness and readiness probes. Readiness needs the
+// database reachable and migrated; Ollama only affects chat, so when it or
+// the default model is missing the service reports degraded but stays ready.
+type HealthHandler struct {
+	DB         *sql.DB
+	Migrator   *migrations.Migrator
+	HTTPClient *http.Client
+
+	draining atomic.Bool
+}
+
+func NewHealthHandler(db *sql.DB, migrator *migrations.Migrator) *HealthHandler {
+	return &HealthHandler{
+		DB:         db,
+		Migrator:   migrator,
+		HTTPClient: &http.Client{Timeout: healthCheckTimeout},
+	}
+}
+
+// ComponentHealth is the outcome of one dependency check.
+type ComponentHealth struct {
+	Status    string         `json:"status"`
+	LatencyMS float64        `json:"latency_ms"`
+	Critical  bool           `json:"critical"`
+	Error     string         `json:"error,omitempty"`
+	Details   map[string]any `json:"details,omitempty"`
+}
+
+type healthCheck struct {
+	name     string
+	critical bool
+	run      func(ctx context.Context) (map[string]any, error)
+}
+
+// Drain makes readiness fail from now on, so load balancers stop routing
+// here while in-flight requests finish.
+func (h *HealthHandler) Drain() {
+	h.draining.Store(true)
+}
+
+// Live answers GET /healthz: the process is up and serving.
+func (h *HealthHandler) Live(w http.ResponseWriter, r *http.Request) {
+	utils.EncodeJson(w, r, http.StatusOK, map[string]any{"status": healthOK})
+}
+
+// Ready answers GET /readyz with every component's status and latency.
+func (h *HealthHandler) Ready(w http.ResponseWriter, r *http.Request) {
+	if h.draining.Load() {
+		utils.EncodeJson(w, r, http.StatusServiceUnavailable, map[string]any{
+			"status": healthNotReady,
+			"reason": "shutting down",
+		})
+		return
+	}
+
+	checks := []healthCheck{
+		{name: "database", critical: true, run: h.checkDatabase},
+		{name: "migrations", critical: true, run: h.checkMigrations},
+		{name: "ollama", run: h.checkOllama},
+		{name: "default_model", run: h.checkDefaultModel},
+	}
+
+	results := make(map[string]ComponentHealth, len(checks))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, c := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+			defer cancel()
+
+			start := time.Now()
+			details, err := c.run(ctx)
+			result := ComponentHealth{
+				Status:    healthOK,
+				LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+				Critical:  c.critical,
+				Details:   details,
+			}
+			if err != nil {
+				result.Status = healthFail
+				result.Error = err.Error()
+			}
+
+			mu.Lock()
+			results[c.name] = result
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	status, code := healthReady, http.StatusOK
+	for _, result := range results {
+		if result.Status == healthOK {
+			continue
+		}
+		if result.Critical {
+			status, code = healthNotReady, http.StatusServiceUnavailable
+			break
+		}
+		status = healthDegraded
+	}
+
+	utils.EncodeJson(w, r, code, map[string]any{
+		"status":     status,
+		"components": results,
+	})
+}
+
+func (h *HealthHandler) checkDatabase(ctx context.Context) (map[string]any, error) {
+	if err := h.DB.PingContext(ctx); err != nil {
+		return nil, err
+	}
+	stats := h.DB.Stats()
+	return map[string]any{
+		"open_connections": stats.OpenConnections,
+		"in_use":           stats.InUse,
+		"idle":             stats.Idle,
+	}, nil
+}
+
+// checkMigrations passes when the schema is at least as new as this binary
+// expects; a newer schema means another replica already migrated ahead.
+func (h *HealthHandler) checkMigrations(ctx context.Context) (map[string]any, error) {
+	current, err := h.Migrator.Current(ctx)
+	if err != nil {
+		return nil, err
+	}
+	details := map[string]any{"version": current, "expected": h.Migrator.Latest()}
+	if current < h.Migrator.Latest() {
+		return details, fmt.Errorf("schema at version %d, expected %d", current, h.Migrator.Latest())
+	}
+	return details, nil
+}
+
+func (h *HealthHandler) checkOllama(ctx context.Context) (map[string]any, error) {
+	models, err := h.ollamaModels(ctx)
+	details := map[string]any{"host": configs.GetAI().OllamaHost}
+	if err != nil {
+		return details, err
+	}
+	details["models"] = len(models)
+	return details, nil
+}
+
+func (h *HealthHandler) checkDefaultModel(ctx context.Context) (map[string]any, error) {
+	model := configs.GetAI().DefaultModel
+	details := map[string]any{"model": model}
+
+	models, err := h.ollamaModels(ctx)
+	if err != nil {
+		return details, err
+	}
+	for _, name := range models {
+		// Ollama reports untagged models with an explicit :latest.
+		if name == model || name == model+":latest" {
+			return details, nil
+		}
+	}
+	return details, fmt.Errorf("model %q is not pulled", model)
+}
+
+// ollamaModels lists the models the configured Ollama has pulled.
+func (h *HealthHandler) ollamaModels(ctx context.Context) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(configs.GetAI().OllamaHost, "/")+"/api/tags", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := h.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ollama answered %s", resp.Status)
+	}
+
+	var tags struct {
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tags); err != nil {
+		return nil, fmt.Errorf("decode ollama models: %w", err)
+	}
+
+	names := make([]string, 0, len(tags.Models))
+	for _, m := range tags.Models {
+		names = append(names, m.Name)
+	}
+	return names, nil
+}
@@ -0,0 +1,90 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/Enilsonn/CRUD-Postgres/database/migrations"
+)
+
+type readyResponse struct {
+	Status     string                     `json:"status"`
+	Reason     string                     `json:"reason"`
+	Components map[string]ComponentHealth `json:"components"`
+}
+
+func TestReadyReportsComponentsAndFailsWhileDraining(t *testing.T) {
+	ollama := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/tags" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"models":[{"name":"gemma3:1b"},{"name":"llama3:latest"}]}`))
+	}))
+	defer ollama.Close()
+
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	migrator, err := migrations.NewMigrator(db)
+	if err != nil {
+		t.Fatalf("migrator: %v", err)
+	}
+	// The checks run concurrently, so the ping and the query may come in either order.
+	mock.MatchExpectationsInOrder(false)
+	h := NewHealthHandler(db, migrator)
+
+	ready := func(defaultModel string, version int) (int, readyResponse) {
+		t.Helper()
+		setupConfig(t, ollama.URL, defaultModel)
+		mock.ExpectPing()
+		mock.ExpectQuery(`SELECT COALESCE\(MAX\(version\), 0\) FROM schema_migrations`).
+			WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(version))
+
+		rec := httptest.NewRecorder()
+		h.Ready(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+		var body readyResponse
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return rec.Code, body
+	}
+
+	code, body := ready("llama3", migrator.Latest())
+	if code != http.StatusOK || body.Status != "ready" {
+		t.Fatalf("got %d %+v, want 200 ready", code, body)
+	}
+	for _, name := range []string{"database", "migrations", "ollama", "default_model"} {
+		if c, ok := body.Components[name]; !ok || c.Status != "ok" {
+			t.Errorf("component %s = %+v, want ok", name, c)
+		}
+	}
+
+	code, body = ready("mistral", migrator.Latest())
+	if code != http.StatusOK || body.Status != "degraded" || body.Components["default_model"].Status != "fail" {
+		t.Errorf("missing model: got %d %+v, want 200 degraded", code, body)
+	}
+
+	code, body = ready("llama3", migrator.Latest()-1)
+	if code != http.StatusServiceUnavailable || body.Status != "not_ready" {
+		t.Errorf("stale schema: got %d %+v, want 503 not_ready", code, body)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+
+	h.Drain()
+	rec := httptest.NewRecorder()
+	h.Ready(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("draining: got %d, want 503", rec.Code)
+	}
+}
@@ -0,0 +1,209 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Enilsonn/CRUD-Postgres/internal/model"
+	"github.com/Enilsonn/CRUD-Postgres/internal/repository"
+	"github.com/Enilsonn/CRUD-Postgres/internal/service"
+	"github.com/Enilsonn/CRUD-Postgres/internal/utils"
+	"github.com/Enilsonn/CRUD-Postgres/internal/view"
+	"github.com/go-chi/chi/v5"
+)
+
+type InvoiceHandler struct {
+	service *service.InvoiceService
+}
+
+func NewInvoiceHandler(service *service.InvoiceService) *InvoiceHandler {
+	return &InvoiceHandler{service: service}
+}
+
+// GenerateInvoices handles POST /api/invoices/generate with
+// {"month":"YYYY-MM","client_id":N}; without client_id every client is billed.
+func (h *InvoiceHandler) GenerateInvoices(w http.ResponseWriter, r *http.Request) {
+	type req struct {
+		Month    string `json:"month"`
+		ClientID int64  `json:"client_id,omitempty"`
+	}
+
+	payload, err := utils.DecodeJson[req](r)
+	if err != nil {
+		utils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+			"error":   true,
+			"code":    "INVALID_REQUEST",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	month, err := time.Parse("2006-01", strings.TrimSpace(payload.Month))
+	if err != nil {
+		utils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+			"error":   true,
+			"code":    "INVALID_MONTH",
+			"message": "month must be in YYYY-MM format",
+		})
+		return
+	}
+
+	invoices, err := h.service.Generate(r.Context(), payload.ClientID, month)
+	if err != nil {
+		writeInvoiceError(w, r, err)
+		return
+	}
+
+	utils.EncodeJson(w, r, http.StatusOK, map[string]any{
+		"month":    month.Format("2006-01"),
+		"count":    len(invoices),
+		"invoices": invoices,
+	})
+}
+
+func (h *InvoiceHandler) ListClientInvoices(w http.ResponseWriter, r *http.Request) {
+	clientID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		utils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+			"error":   true,
+			"code":    "INVALID_CLIENT_ID",
+			"message": "invalid client ID",
+		})
+		return
+	}
+
+	invoices, err := h.service.ListByClient(r.Context(), clientID)
+	if err != nil {
+		writeInvoiceError(w, r, err)
+		return
+	}
+
+	utils.EncodeJson(w, r, http.StatusOK, invoices)
+}
+
+// GetInvoice handles GET /api/invoices/{id}?format=json|html|pdf.
+func (h *InvoiceHandler) GetInvoice(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseInvoiceID(w, r)
+	if !ok {
+		return
+	}
+
+	format := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("format")))
+	if format != "" && format != "json" && format != "html" && format != "pdf" {
+		utils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+			"error":   true,
+			"code":    "INVALID_FORMAT",
+			"message": "format must be json, html or pdf",
+		})
+		return
+	}
+
+	inv, err := h.service.Get(r.Context(), id)
+	if err != nil {
+		writeInvoiceError(w, r, err)
+		return
+	}
+
+	switch format {
+	case "html":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		if err := view.RenderInvoiceHTML(w, inv); err != nil {
+			slog.ErrorContext(r.Context(), "invoice render failed", "invoice_id", id, "format", format, "err", err)
+		}
+	case "pdf":
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.pdf"`, invoiceFileName(inv)))
+		w.WriteHeader(http.StatusOK)
+		if err := view.RenderInvoicePDF(w, inv); err != nil {
+			slog.ErrorContext(r.Context(), "invoice render failed", "invoice_id", id, "format", format, "err", err)
+		}
+	default:
+		utils.EncodeJson(w, r, http.StatusOK, inv)
+	}
+}
+
+func (h *InvoiceHandler) IssueInvoice(w http.ResponseWriter, r *http.Request) {
+	h.transition(w, r, h.service.Issue)
+}
+
+func (h *InvoiceHandler) PayInvoice(w http.ResponseWriter, r *http.Request) {
+	h.transition(w, r, h.service.MarkPaid)
+}
+
+func (h *InvoiceHandler) VoidInvoice(w http.ResponseWriter, r *http.Request) {
+	h.transition(w, r, h.service.Void)
+}
+
+func (h *InvoiceHandler) transition(w http.ResponseWriter, r *http.Request, apply func(ctx context.Context, id int64) (*model.Invoice, error)) {
+	id, ok := parseInvoiceID(w, r)
+	if !ok {
+		return
+	}
+
+	inv, err := apply(r.Context(), id)
+	if err != nil {
+		writeInvoiceError(w, r, err)
+		return
+	}
+
+	utils.EncodeJson(w, r, http.StatusOK, inv)
+}
+
+func invoiceFileName(inv *model.Invoice) string {
+	if inv.Number != "" {
+		return inv.Number
+	}
+	return fmt.Sprintf("invoice-draft-%d", inv.ID)
+}
+
+func parseInvoiceID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		utils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+			"error":   true,
+			"code":    "INVALID_INVOICE_ID",
+			"message": "invalid invoice id",
+		})
+		return 0, false
+	}
+	return id, true
+}
+
+func writeInvoiceError(w http.ResponseWriter, r *http.Request, err error) {
+	status := http.StatusInternalServerError
+	code := "INVOICE_FAILED"
+
+	switch {
+	case errors.Is(err, repository.ErrInvoiceNotFound):
+		status = http.StatusNotFound
+		code = "INVOICE_NOT_FOUND"
+	case errors.Is(err, repository.ErrInvoiceFinalized):
+		status = http.StatusConflict
+		code = "INVOICE_ALREADY_ISSUED"
+	case errors.Is(err, repository.ErrInvoiceStatus):
+		status = http.StatusConflict
+		code = "INVALID_INVOICE_STATUS"
+	case errors.Is(err, repository.ErrNothingToInvoice):
+		status = http.StatusUnprocessableEntity
+		code = "NOTHING_TO_INVOICE"
+	case errors.Is(err, repository.ErrInvalidInput):
+		status = http.StatusBadRequest
+		code = "INVALID_INVOICE"
+	case errors.Is(err, repository.ErrNotFound):
+		status = http.StatusNotFound
+		code = "NOT_FOUND"
+	}
+
+	utils.EncodeJson(w, r, status, map[string]any{
+		"error":   true,
+		"code":    code,
+		"message": err.Error(),
+	})
+}
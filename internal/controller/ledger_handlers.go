@@ -0,0 +1,245 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Enilsonn/CRUD-Postgres/internal/model"
+	"github.com/Enilsonn/CRUD-Postgres/internal/repository"
+	"github.com/Enilsonn/CRUD-Postgres/internal/service"
+	"github.com/Enilsonn/CRUD-Postgres/internal/utils"
+	"github.com/Enilsonn/CRUD-Postgres/internal/view"
+	"github.com/go-chi/chi/v5"
+)
+
+type LedgerHandler struct {
+	service *service.LedgerService
+}
+
+func NewLedgerHandler(service *service.LedgerService) *LedgerHandler {
+	return &LedgerHandler{service: service}
+}
+
+// QueryClientLedger handles GET /api/wallets/{client_id}/ledger/query.
+func (h *LedgerHandler) QueryClientLedger(w http.ResponseWriter, r *http.Request) {
+	clientID, err := strconv.ParseInt(chi.URLParam(r, "client_id"), 10, 64)
+	if err != nil || clientID <= 0 {
+		utils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+			"error":   true,
+			"code":    "INVALID_CLIENT_ID",
+			"message": "invalid client ID",
+		})
+		return
+	}
+
+	h.search(w, r, clientID)
+}
+
+// QueryAllLedger handles GET /api/ledger for employees, optionally scoped by ?client_id=.
+func (h *LedgerHandler) QueryAllLedger(w http.ResponseWriter, r *http.Request) {
+	var clientID int64
+	if raw := strings.TrimSpace(r.URL.Query().Get("client_id")); raw != "" {
+		parsed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || parsed <= 0 {
+			utils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+				"error":   true,
+				"code":    "INVALID_CLIENT_ID",
+				"message": "client_id must be a positive integer",
+			})
+			return
+		}
+		clientID = parsed
+	}
+
+	h.search(w, r, clientID)
+}
+
+// Statement handles GET /api/wallets/{client_id}/statement?month=YYYY-MM&format=json|csv|pdf.
+func (h *LedgerHandler) Statement(w http.ResponseWriter, r *http.Request) {
+	clientID, err := strconv.ParseInt(chi.URLParam(r, "client_id"), 10, 64)
+	if err != nil || clientID <= 0 {
+		utils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+			"error":   true,
+			"code":    "INVALID_CLIENT_ID",
+			"message": "invalid client ID",
+		})
+		return
+	}
+
+	month, err := time.Parse("2006-01", strings.TrimSpace(r.URL.Query().Get("month")))
+	if err != nil {
+		utils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+			"error":   true,
+			"code":    "INVALID_MONTH",
+			"message": "month must be in YYYY-MM format",
+		})
+		return
+	}
+
+	renderer, err := view.NewStatementRenderer(strings.ToLower(strings.TrimSpace(r.URL.Query().Get("format"))), w)
+	if err != nil {
+		utils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+			"error":   true,
+			"code":    "INVALID_FORMAT",
+			"message": "format must be json, csv or pdf",
+		})
+		return
+	}
+
+	// Headers go out with the summary, so only a failure before it can still
+	// be reported; later ones can only be logged.
+	started := false
+	err = h.service.Statement(r.Context(), clientID, month, func(stmt *model.WalletStatement) error {
+		w.Header().Set("Content-Type", renderer.ContentType())
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="statement-%d-%s.%s"`, clientID, stmt.Month, renderer.FileExtension()))
+		w.WriteHeader(http.StatusOK)
+		started = true
+		return renderer.Begin(stmt)
+	}, renderer.Entry)
+	if err == nil {
+		err = renderer.End()
+	}
+	if err == nil {
+		return
+	}
+	if started {
+		slog.ErrorContext(r.Context(), "statement failed", "client_id", clientID, "err", err)
+		return
+	}
+	utils.EncodeJson(w, r, http.StatusInternalServerError, map[string]any{
+		"error":   true,
+		"code":    "STATEMENT_FAILED",
+		"message": err.Error(),
+	})
+}
+
+func (h *LedgerHandler) search(w http.ResponseWriter, r *http.Request, clientID int64) {
+	query := r.URL.Query()
+	q := service.LedgerQuery{
+		ClientID: clientID,
+		Model:    query.Get("model"),
+		Cursor:   strings.TrimSpace(query.Get("cursor")),
+	}
+
+	for _, raw := range query["type"] {
+		q.Types = append(q.Types, strings.Split(raw, ",")...)
+	}
+
+	if v := strings.TrimSpace(query.Get("from")); v != "" {
+		from, err := parseLedgerTime(v, false)
+		if err != nil {
+			utils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+				"error":   true,
+				"code":    "INVALID_FROM",
+				"message": "from must be YYYY-MM-DD or RFC3339",
+			})
+			return
+		}
+		q.From = &from
+	}
+
+	if v := strings.TrimSpace(query.Get("to")); v != "" {
+		to, err := parseLedgerTime(v, true)
+		if err != nil {
+			utils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+				"error":   true,
+				"code":    "INVALID_TO",
+				"message": "to must be YYYY-MM-DD or RFC3339",
+			})
+			return
+		}
+		q.To = &to
+	}
+
+	if v := strings.TrimSpace(query.Get("order_id")); v != "" {
+		orderID, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || orderID <= 0 {
+			utils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+				"error":   true,
+				"code":    "INVALID_ORDER_ID",
+				"message": "order_id must be a positive integer",
+			})
+			return
+		}
+		q.OrderID = &orderID
+	}
+
+	for param, dst := range map[string]**int64{"org_id": &q.OrgID, "member_id": &q.MemberID} {
+		v := strings.TrimSpace(query.Get(param))
+		if v == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id <= 0 {
+			utils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+				"error":   true,
+				"code":    "INVALID_" + strings.ToUpper(param),
+				"message": param + " must be a positive integer",
+			})
+			return
+		}
+		*dst = &id
+	}
+
+	if v := strings.TrimSpace(query.Get("limit")); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			utils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+				"error":   true,
+				"code":    "INVALID_LIMIT",
+				"message": "limit must be a positive integer",
+			})
+			return
+		}
+		q.Limit = limit
+	}
+
+	page, err := h.service.Search(r.Context(), q)
+	if err != nil {
+		status := http.StatusInternalServerError
+		code := "LEDGER_QUERY_FAILED"
+
+		switch {
+		case errors.Is(err, service.ErrInvalidLedgerCursor):
+			status = http.StatusBadRequest
+			code = "INVALID_CURSOR"
+		case errors.Is(err, service.ErrInvalidLedgerType):
+			status = http.StatusBadRequest
+			code = "INVALID_TYPE"
+		case errors.Is(err, repository.ErrInvalidInput):
+			status = http.StatusBadRequest
+			code = "INVALID_QUERY"
+		}
+
+		utils.EncodeJson(w, r, status, map[string]any{
+			"error":   true,
+			"code":    code,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	utils.EncodeJson(w, r, http.StatusOK, page)
+}
+
+// parseLedgerTime accepts RFC3339 timestamps or plain dates. A plain date used
+// as the upper bound is pushed to the next midnight so the whole day is included.
+func parseLedgerTime(raw string, upper bool) (time.Time, error) {
+	if ts, err := time.Parse(time.RFC3339, raw); err == nil {
+		return ts.UTC(), nil
+	}
+
+	day, err := time.Parse("2006-01-02", raw)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if upper {
+		day = day.AddDate(0, 0, 1)
+	}
+	return day.UTC(), nil
+}
@@ -2,13 +2,17 @@ package controller
 
 import (
 	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Enilsonn/CRUD-Postgres/internal/repository"
 	"github.com/Enilsonn/CRUD-Postgres/internal/service"
 	"github.com/Enilsonn/CRUD-Postgres/internal/utils"
+	"github.com/Enilsonn/CRUD-Postgres/internal/view"
 	"github.com/go-chi/chi/v5"
 )
 
@@ -29,6 +33,7 @@ func (h *OrderHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
 		ClientID      int64  `json:"client_id"`
 		SellerID      int64  `json:"seller_id"`
 		PaymentMethod string `json:"payment_method"`
+		PriceLock     string `json:"price_lock"`
 		Items         []item `json:"items"`
 	}
 
@@ -42,6 +47,8 @@ func (h *OrderHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	utils.AddLogAttrs(r.Context(), slog.Int64("client_id", payload.ClientID))
+
 	items := make([]service.OrderItemRequest, len(payload.Items))
 	for idx, it := range payload.Items {
 		items[idx] = service.OrderItemRequest{PlanID: it.PlanID, Quantity: it.Quantity}
@@ -52,6 +59,8 @@ func (h *OrderHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
 		SellerID:      payload.SellerID,
 		PaymentMethod: payload.PaymentMethod,
 		Items:         items,
+		PriceLock:     payload.PriceLock,
+		Actor:         utils.Actor(r),
 	})
 	if err != nil {
 		status := http.StatusInternalServerError
@@ -61,13 +70,13 @@ func (h *OrderHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
 		case errors.Is(err, repository.ErrOrderWithoutItems):
 			status = http.StatusBadRequest
 			code = "INVALID_ORDER"
-		case strings.Contains(strings.ToLower(err.Error()), "invalid"):
+		case errors.Is(err, repository.ErrInvalidInput):
 			status = http.StatusBadRequest
 			code = "INVALID_ORDER"
-		case strings.Contains(strings.ToLower(err.Error()), "not found"):
+		case errors.Is(err, repository.ErrNotFound):
 			status = http.StatusNotFound
 			code = "NOT_FOUND"
-		case strings.Contains(strings.ToLower(err.Error()), "insufficient stock"):
+		case errors.Is(err, repository.ErrInsufficientStock):
 			status = http.StatusConflict
 			code = "INSUFFICIENT_STOCK"
 		}
@@ -79,6 +88,7 @@ func (h *OrderHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
+	utils.AddLogAttrs(r.Context(), slog.Int64("order_id", order.ID))
 
 	utils.EncodeJson(w, r, http.StatusCreated, order)
 }
@@ -94,7 +104,7 @@ func (h *OrderHandler) FinalizeOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	resp, err := h.service.FinalizeOrder(r.Context(), orderID)
+	resp, err := h.service.FinalizeOrder(r.Context(), orderID, utils.Actor(r))
 	if err != nil {
 		status := http.StatusInternalServerError
 		code := "FINALIZE_ORDER_FAILED"
@@ -106,6 +116,9 @@ func (h *OrderHandler) FinalizeOrder(w http.ResponseWriter, r *http.Request) {
 		case errors.Is(err, repository.ErrOrderNotFound):
 			status = http.StatusNotFound
 			code = "ORDER_NOT_FOUND"
+		case errors.Is(err, repository.ErrOrderNotPending):
+			status = http.StatusConflict
+			code = "ORDER_NOT_PENDING"
 		default:
 			status = http.StatusInternalServerError
 		}
@@ -147,3 +160,370 @@ func (h *OrderHandler) ListClientOrders(w http.ResponseWriter, r *http.Request)
 
 	utils.EncodeJson(w, r, http.StatusOK, orders)
 }
+
+// GetOrder handles GET /api/orders/{id}, returning the order with its items.
+func (h *OrderHandler) GetOrder(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || orderID <= 0 {
+		utils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+			"error":   true,
+			"code":    "INVALID_ORDER_ID",
+			"message": "invalid order id",
+		})
+		return
+	}
+
+	order, err := h.service.GetOrder(r.Context(), orderID)
+	if err != nil {
+		status := http.StatusInternalServerError
+		code := "GET_ORDER_FAILED"
+		if errors.Is(err, repository.ErrOrderNotFound) {
+			status = http.StatusNotFound
+			code = "ORDER_NOT_FOUND"
+		}
+
+		utils.EncodeJson(w, r, status, map[string]any{
+			"error":   true,
+			"code":    code,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	utils.EncodeJson(w, r, http.StatusOK, order)
+}
+
+// AddOrderItem handles POST /api/orders/{id}/items on a PENDING order.
+func (h *OrderHandler) AddOrderItem(w http.ResponseWriter, r *http.Request) {
+	type req struct {
+		PlanID   int64 `json:"plan_id"`
+		Quantity int   `json:"quantity"`
+	}
+
+	orderID, _, ok := parseOrderItemIDs(w, r, false)
+	if !ok {
+		return
+	}
+
+	payload, err := utils.DecodeJson[req](r)
+	if err != nil {
+		utils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+			"error":   true,
+			"code":    "INVALID_REQUEST",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	order, err := h.service.AddItem(r.Context(), orderID, service.OrderItemRequest{PlanID: payload.PlanID, Quantity: payload.Quantity}, utils.Actor(r))
+	if err != nil {
+		writeCartError(w, r, err)
+		return
+	}
+
+	utils.EncodeJson(w, r, http.StatusOK, order)
+}
+
+// UpdateOrderItem handles PATCH /api/orders/{id}/items/{item_id}.
+func (h *OrderHandler) UpdateOrderItem(w http.ResponseWriter, r *http.Request) {
+	type req struct {
+		Quantity int `json:"quantity"`
+	}
+
+	orderID, itemID, ok := parseOrderItemIDs(w, r, true)
+	if !ok {
+		return
+	}
+
+	payload, err := utils.DecodeJson[req](r)
+	if err != nil {
+		utils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+			"error":   true,
+			"code":    "INVALID_REQUEST",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	order, err := h.service.UpdateItem(r.Context(), orderID, itemID, payload.Quantity, utils.Actor(r))
+	if err != nil {
+		writeCartError(w, r, err)
+		return
+	}
+
+	utils.EncodeJson(w, r, http.StatusOK, order)
+}
+
+// RemoveOrderItem handles DELETE /api/orders/{id}/items/{item_id}.
+func (h *OrderHandler) RemoveOrderItem(w http.ResponseWriter, r *http.Request) {
+	orderID, itemID, ok := parseOrderItemIDs(w, r, true)
+	if !ok {
+		return
+	}
+
+	order, err := h.service.RemoveItem(r.Context(), orderID, itemID, utils.Actor(r))
+	if err != nil {
+		writeCartError(w, r, err)
+		return
+	}
+
+	utils.EncodeJson(w, r, http.StatusOK, order)
+}
+
+// CheckoutOrder handles POST /api/orders/{id}/checkout, freezing the cart.
+func (h *OrderHandler) CheckoutOrder(w http.ResponseWriter, r *http.Request) {
+	orderID, _, ok := parseOrderItemIDs(w, r, false)
+	if !ok {
+		return
+	}
+
+	order, err := h.service.Checkout(r.Context(), orderID, utils.Actor(r))
+	if err != nil {
+		writeCartError(w, r, err)
+		return
+	}
+
+	utils.EncodeJson(w, r, http.StatusOK, order)
+}
+
+func parseOrderItemIDs(w http.ResponseWriter, r *http.Request, withItem bool) (orderID, itemID int64, ok bool) {
+	orderID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || orderID <= 0 {
+		utils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+			"error":   true,
+			"code":    "INVALID_ORDER_ID",
+			"message": "invalid order id",
+		})
+		return 0, 0, false
+	}
+	if !withItem {
+		return orderID, 0, true
+	}
+
+	itemID, err = strconv.ParseInt(chi.URLParam(r, "item_id"), 10, 64)
+	if err != nil || itemID <= 0 {
+		utils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+			"error":   true,
+			"code":    "INVALID_ITEM_ID",
+			"message": "invalid item id",
+		})
+		return 0, 0, false
+	}
+	return orderID, itemID, true
+}
+
+func writeCartError(w http.ResponseWriter, r *http.Request, err error) {
+	status := http.StatusInternalServerError
+	code := "UPDATE_ORDER_FAILED"
+
+	switch {
+	case errors.Is(err, repository.ErrOrderNotFound):
+		status = http.StatusNotFound
+		code = "ORDER_NOT_FOUND"
+	case errors.Is(err, repository.ErrOrderItemNotFound):
+		status = http.StatusNotFound
+		code = "ORDER_ITEM_NOT_FOUND"
+	case errors.Is(err, repository.ErrOrderNotPending):
+		status = http.StatusConflict
+		code = "ORDER_NOT_PENDING"
+	case errors.Is(err, repository.ErrOrderCheckedOut):
+		status = http.StatusConflict
+		code = "ORDER_CHECKED_OUT"
+	case errors.Is(err, repository.ErrInsufficientStock):
+		status = http.StatusConflict
+		code = "INSUFFICIENT_STOCK"
+	case errors.Is(err, repository.ErrOrderWithoutItems):
+		status = http.StatusConflict
+		code = "LAST_ITEM"
+	case errors.Is(err, repository.ErrInvalidInput):
+		status = http.StatusBadRequest
+		code = "INVALID_ITEM"
+	case errors.Is(err, repository.ErrNotFound):
+		status = http.StatusNotFound
+		code = "NOT_FOUND"
+	}
+
+	utils.EncodeJson(w, r, status, map[string]any{
+		"error":   true,
+		"code":    code,
+		"message": err.Error(),
+	})
+}
+
+// OrderEvents handles GET /api/orders/{id}/events, the order's audit timeline.
+func (h *OrderHandler) OrderEvents(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || orderID <= 0 {
+		utils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+			"error":   true,
+			"code":    "INVALID_ORDER_ID",
+			"message": "invalid order id",
+		})
+		return
+	}
+
+	events, err := h.service.Events(r.Context(), orderID)
+	if err != nil {
+		status := http.StatusInternalServerError
+		code := "ORDER_EVENTS_FAILED"
+		if errors.Is(err, repository.ErrOrderNotFound) {
+			status = http.StatusNotFound
+			code = "ORDER_NOT_FOUND"
+		}
+
+		utils.EncodeJson(w, r, status, map[string]any{
+			"error":   true,
+			"code":    code,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	utils.EncodeJson(w, r, http.StatusOK, events)
+}
+
+// ListOrders handles GET /api/orders for employees. ?format=csv exports every
+// matching order instead of one page.
+func (h *OrderHandler) ListOrders(w http.ResponseWriter, r *http.Request) {
+	q, ok := parseOrderQuery(w, r)
+	if !ok {
+		return
+	}
+
+	if strings.EqualFold(strings.TrimSpace(r.URL.Query().Get("format")), "csv") {
+		h.exportOrders(w, r, q)
+		return
+	}
+
+	page, err := h.service.SearchOrders(r.Context(), q)
+	if err != nil {
+		writeOrderQueryError(w, r, err)
+		return
+	}
+
+	utils.EncodeJson(w, r, http.StatusOK, page)
+}
+
+func (h *OrderHandler) exportOrders(w http.ResponseWriter, r *http.Request, q service.OrderQuery) {
+	// Validate before committing to a CSV response, so bad filters still get a JSON error.
+	if err := h.service.ValidateOrderQuery(q); err != nil {
+		writeOrderQueryError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="orders-%s.csv"`, time.Now().UTC().Format("20060102-150405")))
+	w.WriteHeader(http.StatusOK)
+
+	// Headers are gone by now, so failures past this point can only be logged.
+	out := view.NewOrderCSV(w)
+	if err := h.service.ExportOrders(r.Context(), q, out.Order); err != nil {
+		slog.ErrorContext(r.Context(), "order export failed", "err", err)
+		return
+	}
+	if err := out.Close(); err != nil {
+		slog.ErrorContext(r.Context(), "order export failed", "err", err)
+	}
+}
+
+func parseOrderQuery(w http.ResponseWriter, r *http.Request) (service.OrderQuery, bool) {
+	query := r.URL.Query()
+	q := service.OrderQuery{
+		Sort:      query.Get("sort"),
+		Direction: query.Get("order"),
+		Cursor:    strings.TrimSpace(query.Get("cursor")),
+	}
+
+	for _, raw := range query["status"] {
+		q.Statuses = append(q.Statuses, strings.Split(raw, ",")...)
+	}
+	for _, raw := range query["payment_method"] {
+		q.PaymentMethods = append(q.PaymentMethods, strings.Split(raw, ",")...)
+	}
+
+	for param, dst := range map[string]*int64{"client_id": &q.ClientID, "seller_id": &q.SellerID} {
+		v := strings.TrimSpace(query.Get(param))
+		if v == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id <= 0 {
+			utils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+				"error":   true,
+				"code":    "INVALID_" + strings.ToUpper(param),
+				"message": param + " must be a positive integer",
+			})
+			return q, false
+		}
+		*dst = id
+	}
+
+	for param, dst := range map[string]**time.Time{"from": &q.From, "to": &q.To} {
+		v := strings.TrimSpace(query.Get(param))
+		if v == "" {
+			continue
+		}
+		ts, err := parseLedgerTime(v, param == "to")
+		if err != nil {
+			utils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+				"error":   true,
+				"code":    "INVALID_" + strings.ToUpper(param),
+				"message": param + " must be YYYY-MM-DD or RFC3339",
+			})
+			return q, false
+		}
+		*dst = &ts
+	}
+
+	for param, dst := range map[string]**int64{"min_total": &q.MinTotalCents, "max_total": &q.MaxTotalCents} {
+		v := strings.TrimSpace(query.Get(param))
+		if v == "" {
+			continue
+		}
+		cents, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || cents < 0 {
+			utils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+				"error":   true,
+				"code":    "INVALID_" + strings.ToUpper(param),
+				"message": param + " must be a non-negative amount in cents",
+			})
+			return q, false
+		}
+		*dst = &cents
+	}
+
+	if v := strings.TrimSpace(query.Get("limit")); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			utils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+				"error":   true,
+				"code":    "INVALID_LIMIT",
+				"message": "limit must be a positive integer",
+			})
+			return q, false
+		}
+		q.Limit = limit
+	}
+
+	return q, true
+}
+
+func writeOrderQueryError(w http.ResponseWriter, r *http.Request, err error) {
+	status := http.StatusInternalServerError
+	code := "LIST_ORDERS_FAILED"
+
+	switch {
+	case errors.Is(err, service.ErrInvalidOrderCursor):
+		status = http.StatusBadRequest
+		code = "INVALID_CURSOR"
+	case errors.Is(err, repository.ErrInvalidInput):
+		status = http.StatusBadRequest
+		code = "INVALID_QUERY"
+	}
+
+	utils.EncodeJson(w, r, status, map[string]any{
+		"error":   true,
+		"code":    code,
+		"message": err.Error(),
+	})
+}
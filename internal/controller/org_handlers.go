@@ -0,0 +1,242 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/Enilsonn/CRUD-Postgres/internal/repository"
+	"github.com/Enilsonn/CRUD-Postgres/internal/service"
+	"github.com/Enilsonn/CRUD-Postgres/internal/utils"
+	"github.com/go-chi/chi/v5"
+)
+
+type OrganizationHandler struct {
+	service *service.OrganizationService
+}
+
+func NewOrganizationHandler(service *service.OrganizationService) *OrganizationHandler {
+	return &OrganizationHandler{service: service}
+}
+
+type memberPayload struct {
+	ClientID            int64  `json:"client_id"`
+	Role                string `json:"role"`
+	MonthlyLimitCredits *int64 `json:"monthly_limit_credits"`
+}
+
+func (h *OrganizationHandler) CreateOrganization(w http.ResponseWriter, r *http.Request) {
+	type req struct {
+		Name            string `json:"name"`
+		BillingClientID int64  `json:"billing_client_id"`
+		OwnerClientID   int64  `json:"owner_client_id"`
+	}
+
+	payload, err := utils.DecodeJson[req](r)
+	if err != nil {
+		utils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+			"error":   true,
+			"code":    "INVALID_REQUEST",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	org, err := h.service.Create(r.Context(), service.CreateOrganizationRequest{
+		Name:            payload.Name,
+		BillingClientID: payload.BillingClientID,
+		OwnerClientID:   payload.OwnerClientID,
+	})
+	if err != nil {
+		writeOrganizationError(w, r, err)
+		return
+	}
+
+	utils.EncodeJson(w, r, http.StatusCreated, org)
+}
+
+func (h *OrganizationHandler) GetOrganization(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := parseOrgID(w, r)
+	if !ok {
+		return
+	}
+
+	org, err := h.service.Get(r.Context(), orgActor(r), orgID)
+	if err != nil {
+		writeOrganizationError(w, r, err)
+		return
+	}
+
+	utils.EncodeJson(w, r, http.StatusOK, org)
+}
+
+func (h *OrganizationHandler) AddMember(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := parseOrgID(w, r)
+	if !ok {
+		return
+	}
+
+	payload, err := utils.DecodeJson[memberPayload](r)
+	if err != nil {
+		utils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+			"error":   true,
+			"code":    "INVALID_REQUEST",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	member, err := h.service.AddMember(r.Context(), orgActor(r), service.SaveMemberRequest{
+		OrgID:               orgID,
+		ClientID:            payload.ClientID,
+		Role:                payload.Role,
+		MonthlyLimitCredits: payload.MonthlyLimitCredits,
+	})
+	if err != nil {
+		writeOrganizationError(w, r, err)
+		return
+	}
+
+	utils.EncodeJson(w, r, http.StatusCreated, member)
+}
+
+func (h *OrganizationHandler) GetMember(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := parseOrgID(w, r)
+	if !ok {
+		return
+	}
+	clientID, ok := parseMemberID(w, r)
+	if !ok {
+		return
+	}
+
+	member, err := h.service.Member(r.Context(), orgActor(r), orgID, clientID)
+	if err != nil {
+		writeOrganizationError(w, r, err)
+		return
+	}
+
+	utils.EncodeJson(w, r, http.StatusOK, member)
+}
+
+func (h *OrganizationHandler) UpdateMember(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := parseOrgID(w, r)
+	if !ok {
+		return
+	}
+	clientID, ok := parseMemberID(w, r)
+	if !ok {
+		return
+	}
+
+	payload, err := utils.DecodeJson[memberPayload](r)
+	if err != nil {
+		utils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+			"error":   true,
+			"code":    "INVALID_REQUEST",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	member, err := h.service.UpdateMember(r.Context(), orgActor(r), service.SaveMemberRequest{
+		OrgID:               orgID,
+		ClientID:            clientID,
+		Role:                payload.Role,
+		MonthlyLimitCredits: payload.MonthlyLimitCredits,
+	})
+	if err != nil {
+		writeOrganizationError(w, r, err)
+		return
+	}
+
+	utils.EncodeJson(w, r, http.StatusOK, member)
+}
+
+func (h *OrganizationHandler) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := parseOrgID(w, r)
+	if !ok {
+		return
+	}
+	clientID, ok := parseMemberID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.service.RemoveMember(r.Context(), orgActor(r), orgID, clientID); err != nil {
+		writeOrganizationError(w, r, err)
+		return
+	}
+
+	utils.EncodeJson(w, r, http.StatusOK, map[string]any{
+		"org_id":    orgID,
+		"client_id": clientID,
+		"removed":   true,
+	})
+}
+
+func orgActor(r *http.Request) service.OrgActor {
+	clientID, _ := strconv.ParseInt(r.Header.Get("X-Client-ID"), 10, 64)
+	return service.OrgActor{ClientID: clientID, IsEmployee: utils.IsEmployee(r)}
+}
+
+func parseOrgID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		utils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+			"error":   true,
+			"code":    "INVALID_ORG_ID",
+			"message": "invalid organization id",
+		})
+		return 0, false
+	}
+	return id, true
+}
+
+func parseMemberID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "client_id"), 10, 64)
+	if err != nil {
+		utils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+			"error":   true,
+			"code":    "INVALID_CLIENT_ID",
+			"message": "invalid client ID",
+		})
+		return 0, false
+	}
+	return id, true
+}
+
+func writeOrganizationError(w http.ResponseWriter, r *http.Request, err error) {
+	status := http.StatusInternalServerError
+	code := "ORGANIZATION_FAILED"
+
+	switch {
+	case errors.Is(err, service.ErrOrgForbidden), errors.Is(err, service.ErrOrgNotMember):
+		status = http.StatusForbidden
+		code = "FORBIDDEN"
+	case errors.Is(err, repository.ErrOrganizationNotFound):
+		status = http.StatusNotFound
+		code = "ORGANIZATION_NOT_FOUND"
+	case errors.Is(err, repository.ErrMemberNotFound):
+		status = http.StatusNotFound
+		code = "MEMBER_NOT_FOUND"
+	case errors.Is(err, repository.ErrAlreadyMember):
+		status = http.StatusConflict
+		code = "ALREADY_MEMBER"
+	case errors.Is(err, repository.ErrLastOwner):
+		status = http.StatusConflict
+		code = "LAST_OWNER"
+	case errors.Is(err, repository.ErrInvalidInput):
+		status = http.StatusBadRequest
+		code = "INVALID_ORGANIZATION"
+	case errors.Is(err, repository.ErrNotFound):
+		status = http.StatusNotFound
+		code = "NOT_FOUND"
+	}
+
+	utils.EncodeJson(w, r, status, map[string]any{
+		"error":   true,
+		"code":    code,
+		"message": err.Error(),
+	})
+}
@@ -0,0 +1,182 @@
+package controller
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/Enilsonn/CRUD-Postgres/internal/payments"
+	"github.com/Enilsonn/CRUD-Postgres/internal/repository"
+	"github.com/Enilsonn/CRUD-Postgres/internal/service"
+	"github.com/Enilsonn/CRUD-Postgres/internal/utils"
+	"github.com/go-chi/chi/v5"
+)
+
+const maxWebhookBodyBytes = 1 << 20
+
+type PaymentHandler struct {
+	service *service.PaymentService
+}
+
+func NewPaymentHandler(service *service.PaymentService) *PaymentHandler {
+	return &PaymentHandler{service: service}
+}
+
+// CreatePayment handles POST /api/orders/{id}/payment and returns the charge
+// with its PIX payload or boleto line, depending on the order's method.
+func (h *PaymentHandler) CreatePayment(w http.ResponseWriter, r *http.Request) {
+	orderID, ok := parsePaymentOrderID(w, r)
+	if !ok {
+		return
+	}
+
+	charge, err := h.service.CreateCharge(r.Context(), orderID, utils.Actor(r))
+	if err != nil {
+		writePaymentError(w, r, err)
+		return
+	}
+
+	utils.EncodeJson(w, r, http.StatusCreated, charge)
+}
+
+func (h *PaymentHandler) GetPayment(w http.ResponseWriter, r *http.Request) {
+	orderID, ok := parsePaymentOrderID(w, r)
+	if !ok {
+		return
+	}
+
+	charge, err := h.service.GetCharge(r.Context(), orderID)
+	if err != nil {
+		writePaymentError(w, r, err)
+		return
+	}
+
+	utils.EncodeJson(w, r, http.StatusOK, charge)
+}
+
+// PixQRCode handles GET /api/orders/{id}/payment/pix.png.
+func (h *PaymentHandler) PixQRCode(w http.ResponseWriter, r *http.Request) {
+	orderID, ok := parsePaymentOrderID(w, r)
+	if !ok {
+		return
+	}
+
+	png, err := h.service.PixQRCode(r.Context(), orderID)
+	if err != nil {
+		writePaymentError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.WriteHeader(http.StatusOK)
+	w.Write(png)
+}
+
+// SimulatePayment handles POST /api/orders/{id}/payment/simulate with
+// {"status":"CONFIRMED"|"FAILED","reason":"..."}.
+func (h *PaymentHandler) SimulatePayment(w http.ResponseWriter, r *http.Request) {
+	type req struct {
+		Status string `json:"status"`
+		Reason string `json:"reason"`
+	}
+
+	orderID, ok := parsePaymentOrderID(w, r)
+	if !ok {
+		return
+	}
+
+	payload, err := utils.DecodeJson[req](r)
+	if err != nil {
+		utils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+			"error":   true,
+			"code":    "INVALID_REQUEST",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	result, err := h.service.Simulate(r.Context(), orderID, payload.Status, payload.Reason)
+	if err != nil {
+		writePaymentError(w, r, err)
+		return
+	}
+
+	utils.EncodeJson(w, r, http.StatusOK, result)
+}
+
+// Webhook handles POST /api/webhooks/payments/{provider}. Anything but a 2xx
+// tells the provider to retry later.
+func (h *PaymentHandler) Webhook(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBodyBytes))
+	if err != nil {
+		utils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+			"error":   true,
+			"code":    "INVALID_REQUEST",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	result, err := h.service.HandleWebhook(r.Context(), chi.URLParam(r, "provider"), r.Header, body)
+	if err != nil {
+		writePaymentError(w, r, err)
+		return
+	}
+
+	utils.EncodeJson(w, r, http.StatusOK, result)
+}
+
+func parsePaymentOrderID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		utils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+			"error":   true,
+			"code":    "INVALID_ORDER_ID",
+			"message": "invalid order id",
+		})
+		return 0, false
+	}
+	return id, true
+}
+
+func writePaymentError(w http.ResponseWriter, r *http.Request, err error) {
+	status := http.StatusInternalServerError
+	code := "PAYMENT_FAILED"
+
+	switch {
+	case errors.Is(err, payments.ErrInvalidSignature):
+		status = http.StatusUnauthorized
+		code = "INVALID_SIGNATURE"
+	case errors.Is(err, payments.ErrInvalidWebhook):
+		status = http.StatusBadRequest
+		code = "INVALID_WEBHOOK"
+	case errors.Is(err, repository.ErrOrderNotFound):
+		status = http.StatusNotFound
+		code = "ORDER_NOT_FOUND"
+	case errors.Is(err, repository.ErrChargeNotFound):
+		status = http.StatusNotFound
+		code = "PAYMENT_NOT_FOUND"
+	case errors.Is(err, repository.ErrChargeNotSaved):
+		status = http.StatusServiceUnavailable
+		code = "CHARGE_NOT_SAVED"
+	case errors.Is(err, repository.ErrOrderNotPending):
+		status = http.StatusConflict
+		code = "ORDER_NOT_PENDING"
+	case errors.Is(err, repository.ErrInsufficientStock):
+		status = http.StatusConflict
+		code = "INSUFFICIENT_STOCK"
+	case errors.Is(err, repository.ErrInvalidInput):
+		status = http.StatusBadRequest
+		code = "INVALID_PAYMENT"
+	case errors.Is(err, repository.ErrNotFound):
+		status = http.StatusNotFound
+		code = "NOT_FOUND"
+	}
+
+	utils.EncodeJson(w, r, status, map[string]any{
+		"error":   true,
+		"code":    code,
+		"message": err.Error(),
+	})
+}
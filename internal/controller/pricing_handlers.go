@@ -19,7 +19,7 @@ func NewPricingHandler(repo *repository.PricingRepository) *PricingHandler {
 }
 
 func (h *PricingHandler) ListActive(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
+	ctx := context.WithoutCancel(r.Context())
 
 	rates, err := h.Repo.ListActive(ctx)
 	if err != nil {
@@ -35,7 +35,7 @@ func (h *PricingHandler) ListActive(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *PricingHandler) Upsert(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
+	ctx := context.WithoutCancel(r.Context())
 
 	type req struct {
 		ID                     int64   `json:"id,omitempty"`
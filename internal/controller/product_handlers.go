@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -33,6 +34,7 @@ func (h *ProductHandler) CreateClientProduct(w http.ResponseWriter, r *http.Requ
 		Category           *string `json:"category"`
 		ManufacturedInMari *bool   `json:"manufactured_in_mari"`
 		Stock              *int    `json:"stock"`
+		ValidityDays       *int    `json:"validity_days"`
 	}
 
 	payload, err := utils.DecodeJson[req](r)
@@ -63,6 +65,19 @@ func (h *ProductHandler) CreateClientProduct(w http.ResponseWriter, r *http.Requ
 		}
 		plan.Stock = *payload.Stock
 	}
+	if payload.ValidityDays != nil {
+		if *payload.ValidityDays < 0 {
+			utils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+				"error":   true,
+				"code":    "INVALID_VALIDITY",
+				"message": "validity_days must be non-negative",
+			})
+			return
+		}
+		if *payload.ValidityDays > 0 {
+			plan.ValidityDays = payload.ValidityDays
+		}
+	}
 
 	id, err := h.Repo.CreateClientProduct(r.Context(), *plan)
 	if err != nil {
@@ -169,6 +184,7 @@ func (h *ProductHandler) UpdateClientProduct(w http.ResponseWriter, r *http.Requ
 		Category           *string `json:"category"`
 		ManufacturedInMari *bool   `json:"manufactured_in_mari"`
 		Stock              *int    `json:"stock"`
+		ValidityDays       *int    `json:"validity_days"`
 	}
 
 	payload, err := utils.DecodeJson[req](r)
@@ -226,8 +242,23 @@ func (h *ProductHandler) UpdateClientProduct(w http.ResponseWriter, r *http.Requ
 		}
 		current.Stock = *payload.Stock
 	}
+	if payload.ValidityDays != nil {
+		if *payload.ValidityDays < 0 {
+			utils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+				"error":   true,
+				"code":    "INVALID_VALIDITY",
+				"message": "validity_days must be non-negative",
+			})
+			return
+		}
+		// 0 clears the validity period so credits from this plan never expire.
+		current.ValidityDays = nil
+		if *payload.ValidityDays > 0 {
+			current.ValidityDays = payload.ValidityDays
+		}
+	}
 
-	if _, err := h.Repo.UpdateClientProduct(r.Context(), id, *current); err != nil {
+	if _, err := h.Repo.UpdateClientProduct(r.Context(), id, *current, utils.Actor(r)); err != nil {
 		utils.EncodeJson(w, r, http.StatusInternalServerError, map[string]any{
 			"error":   true,
 			"code":    "DATABASE_ERROR",
@@ -335,3 +366,85 @@ func (h *ProductHandler) LowStock(w http.ResponseWriter, r *http.Request) {
 
 	utils.EncodeJson(w, r, http.StatusOK, plans)
 }
+
+// Restock handles POST /api/plans/{id}/restock with {"quantity":N,"reason":"..."}.
+func (h *ProductHandler) Restock(w http.ResponseWriter, r *http.Request) {
+	type req struct {
+		Quantity int    `json:"quantity"`
+		Reason   string `json:"reason"`
+	}
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		utils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+			"error":   true,
+			"code":    "INVALID_PLAN_ID",
+			"message": "invalid plan id",
+		})
+		return
+	}
+
+	payload, err := utils.DecodeJson[req](r)
+	if err != nil {
+		utils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+			"error":   true,
+			"code":    "INVALID_REQUEST",
+			"message": fmt.Sprintf("invalid request body: %v", err),
+		})
+		return
+	}
+
+	movement, err := h.PlanService.Restock(r.Context(), id, payload.Quantity, utils.Actor(r), payload.Reason)
+	if err != nil {
+		status := http.StatusInternalServerError
+		code := "RESTOCK_FAILED"
+		switch {
+		case errors.Is(err, repository.ErrInvalidInput):
+			status = http.StatusBadRequest
+			code = "INVALID_QUANTITY"
+		case errors.Is(err, repository.ErrNotFound):
+			status = http.StatusNotFound
+			code = "PLAN_NOT_FOUND"
+		}
+		utils.EncodeJson(w, r, status, map[string]any{
+			"error":   true,
+			"code":    code,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	utils.EncodeJson(w, r, http.StatusCreated, movement)
+}
+
+// Inventory handles GET /api/plans/{id}/inventory: the plan's stock and
+// reservation history, newest first.
+func (h *ProductHandler) Inventory(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		utils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+			"error":   true,
+			"code":    "INVALID_PLAN_ID",
+			"message": "invalid plan id",
+		})
+		return
+	}
+
+	movements, err := h.PlanService.Inventory(r.Context(), id)
+	if err != nil {
+		status := http.StatusInternalServerError
+		code := "INVENTORY_FAILED"
+		if errors.Is(err, repository.ErrNotFound) {
+			status = http.StatusNotFound
+			code = "PLAN_NOT_FOUND"
+		}
+		utils.EncodeJson(w, r, status, map[string]any{
+			"error":   true,
+			"code":    code,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	utils.EncodeJson(w, r, http.StatusOK, movements)
+}
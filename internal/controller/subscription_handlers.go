@@ -0,0 +1,207 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/Enilsonn/CRUD-Postgres/internal/model"
+	"github.com/Enilsonn/CRUD-Postgres/internal/repository"
+	"github.com/Enilsonn/CRUD-Postgres/internal/service"
+	"github.com/Enilsonn/CRUD-Postgres/internal/utils"
+	"github.com/go-chi/chi/v5"
+)
+
+type SubscriptionHandler struct {
+	service *service.SubscriptionService
+}
+
+func NewSubscriptionHandler(service *service.SubscriptionService) *SubscriptionHandler {
+	return &SubscriptionHandler{service: service}
+}
+
+// Subscribe handles POST /api/clients/{id}/subscriptions with
+// {"plan_id":N,"quantity":N,"billing_interval":"MONTHLY","payment_method":"CARD"}.
+func (h *SubscriptionHandler) Subscribe(w http.ResponseWriter, r *http.Request) {
+	type req struct {
+		PlanID          int64  `json:"plan_id"`
+		Quantity        int    `json:"quantity"`
+		BillingInterval string `json:"billing_interval"`
+		PaymentMethod   string `json:"payment_method"`
+	}
+
+	clientID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		utils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+			"error":   true,
+			"code":    "INVALID_CLIENT_ID",
+			"message": "invalid client ID",
+		})
+		return
+	}
+
+	payload, err := utils.DecodeJson[req](r)
+	if err != nil {
+		utils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+			"error":   true,
+			"code":    "INVALID_REQUEST",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	sub, err := h.service.Subscribe(r.Context(), service.SubscribeRequest{
+		ClientID:        clientID,
+		PlanID:          payload.PlanID,
+		Quantity:        payload.Quantity,
+		BillingInterval: payload.BillingInterval,
+		PaymentMethod:   payload.PaymentMethod,
+	})
+	if err != nil {
+		writeSubscriptionError(w, r, err)
+		return
+	}
+
+	utils.EncodeJson(w, r, http.StatusCreated, sub)
+}
+
+func (h *SubscriptionHandler) ListClientSubscriptions(w http.ResponseWriter, r *http.Request) {
+	clientID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		utils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+			"error":   true,
+			"code":    "INVALID_CLIENT_ID",
+			"message": "invalid client ID",
+		})
+		return
+	}
+
+	subs, err := h.service.ListByClient(r.Context(), clientID)
+	if err != nil {
+		writeSubscriptionError(w, r, err)
+		return
+	}
+
+	utils.EncodeJson(w, r, http.StatusOK, subs)
+}
+
+func (h *SubscriptionHandler) GetSubscription(w http.ResponseWriter, r *http.Request) {
+	h.apply(w, r, h.service.Get)
+}
+
+func (h *SubscriptionHandler) PauseSubscription(w http.ResponseWriter, r *http.Request) {
+	h.apply(w, r, h.service.Pause)
+}
+
+func (h *SubscriptionHandler) ResumeSubscription(w http.ResponseWriter, r *http.Request) {
+	h.apply(w, r, h.service.Resume)
+}
+
+// CancelSubscription handles POST /api/subscriptions/{id}/cancel with an
+// optional {"at_period_end":true} to keep the paid period running.
+func (h *SubscriptionHandler) CancelSubscription(w http.ResponseWriter, r *http.Request) {
+	type req struct {
+		AtPeriodEnd bool `json:"at_period_end"`
+	}
+
+	var payload req
+	if r.ContentLength != 0 {
+		decoded, err := utils.DecodeJson[req](r)
+		if err != nil {
+			utils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+				"error":   true,
+				"code":    "INVALID_REQUEST",
+				"message": err.Error(),
+			})
+			return
+		}
+		payload = decoded
+	}
+
+	h.apply(w, r, func(ctx context.Context, id int64) (*model.Subscription, error) {
+		return h.service.Cancel(ctx, id, payload.AtPeriodEnd)
+	})
+}
+
+// ChangePlan handles POST /api/subscriptions/{id}/change-plan with
+// {"plan_id":N}. Upgrades are prorated now; downgrades apply at renewal.
+func (h *SubscriptionHandler) ChangePlan(w http.ResponseWriter, r *http.Request) {
+	type req struct {
+		PlanID int64 `json:"plan_id"`
+	}
+
+	payload, err := utils.DecodeJson[req](r)
+	if err != nil {
+		utils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+			"error":   true,
+			"code":    "INVALID_REQUEST",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	h.apply(w, r, func(ctx context.Context, id int64) (*model.Subscription, error) {
+		return h.service.ChangePlan(ctx, id, payload.PlanID)
+	})
+}
+
+func (h *SubscriptionHandler) apply(w http.ResponseWriter, r *http.Request, fn func(ctx context.Context, id int64) (*model.Subscription, error)) {
+	id, ok := parseSubscriptionID(w, r)
+	if !ok {
+		return
+	}
+
+	sub, err := fn(r.Context(), id)
+	if err != nil {
+		writeSubscriptionError(w, r, err)
+		return
+	}
+
+	utils.EncodeJson(w, r, http.StatusOK, sub)
+}
+
+func parseSubscriptionID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		utils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+			"error":   true,
+			"code":    "INVALID_SUBSCRIPTION_ID",
+			"message": "invalid subscription id",
+		})
+		return 0, false
+	}
+	return id, true
+}
+
+func writeSubscriptionError(w http.ResponseWriter, r *http.Request, err error) {
+	status := http.StatusInternalServerError
+	code := "SUBSCRIPTION_FAILED"
+
+	switch {
+	case errors.Is(err, repository.ErrSubscriptionNotFound):
+		status = http.StatusNotFound
+		code = "SUBSCRIPTION_NOT_FOUND"
+	case errors.Is(err, repository.ErrSubscriptionExists):
+		status = http.StatusConflict
+		code = "ALREADY_SUBSCRIBED"
+	case errors.Is(err, repository.ErrSubscriptionStatus):
+		status = http.StatusConflict
+		code = "INVALID_SUBSCRIPTION_STATUS"
+	case errors.Is(err, repository.ErrChargeFailed):
+		status = http.StatusPaymentRequired
+		code = "CHARGE_FAILED"
+	case errors.Is(err, repository.ErrInvalidInput):
+		status = http.StatusBadRequest
+		code = "INVALID_SUBSCRIPTION"
+	case errors.Is(err, repository.ErrNotFound):
+		status = http.StatusNotFound
+		code = "NOT_FOUND"
+	}
+
+	utils.EncodeJson(w, r, status, map[string]any{
+		"error":   true,
+		"code":    code,
+		"message": err.Error(),
+	})
+}
@@ -0,0 +1,195 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/Enilsonn/CRUD-Postgres/internal/metrics"
+	"github.com/Enilsonn/CRUD-Postgres/internal/repository"
+	"github.com/Enilsonn/CRUD-Postgres/internal/service"
+	"github.com/Enilsonn/CRUD-Postgres/internal/utils"
+	"github.com/go-chi/chi/v5"
+)
+
+type TransferHandler struct {
+	service *service.TransferService
+}
+
+func NewTransferHandler(service *service.TransferService) *TransferHandler {
+	return &TransferHandler{service: service}
+}
+
+func (h *TransferHandler) CreateTransfer(w http.ResponseWriter, r *http.Request) {
+	fromClientID, err := strconv.ParseInt(chi.URLParam(r, "client_id"), 10, 64)
+	if err != nil {
+		utils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+			"error":   true,
+			"code":    "INVALID_CLIENT_ID",
+			"message": "invalid client ID",
+		})
+		return
+	}
+
+	type req struct {
+		ToClientID int64  `json:"to_client_id"`
+		Credits    int64  `json:"credits"`
+		Note       string `json:"note,omitempty"`
+		RequestID  string `json:"request_id,omitempty"`
+	}
+
+	payload, err := utils.DecodeJson[req](r)
+	if err != nil {
+		utils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+			"error":   true,
+			"code":    "INVALID_REQUEST",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	transfer, err := h.service.Create(r.Context(), service.CreateTransferRequest{
+		FromClientID: fromClientID,
+		ToClientID:   payload.ToClientID,
+		Credits:      payload.Credits,
+		Note:         payload.Note,
+		RequestID:    payload.RequestID,
+		RequestedBy:  utils.Actor(r),
+		ByEmployee:   utils.IsEmployee(r),
+	})
+	if err != nil {
+		writeTransferError(w, r, err)
+		return
+	}
+
+	status := http.StatusCreated
+	if transfer.Status == repository.TransferPendingApproval {
+		status = http.StatusAccepted
+	}
+	utils.EncodeJson(w, r, status, transfer)
+}
+
+func (h *TransferHandler) ListClientTransfers(w http.ResponseWriter, r *http.Request) {
+	clientID, err := strconv.ParseInt(chi.URLParam(r, "client_id"), 10, 64)
+	if err != nil {
+		utils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+			"error":   true,
+			"code":    "INVALID_CLIENT_ID",
+			"message": "invalid client ID",
+		})
+		return
+	}
+
+	transfers, err := h.service.ListByClient(r.Context(), clientID)
+	if err != nil {
+		writeTransferError(w, r, err)
+		return
+	}
+
+	utils.EncodeJson(w, r, http.StatusOK, transfers)
+}
+
+func (h *TransferHandler) GetTransfer(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseTransferID(w, r)
+	if !ok {
+		return
+	}
+
+	transfer, err := h.service.Get(r.Context(), id)
+	if err != nil {
+		writeTransferError(w, r, err)
+		return
+	}
+
+	// Either side of a transfer may see it; nobody else but employees.
+	if caller := r.Header.Get("X-Client-ID"); !utils.IsEmployee(r) &&
+		caller != strconv.FormatInt(transfer.FromClientID, 10) && caller != strconv.FormatInt(transfer.ToClientID, 10) {
+		utils.EncodeJson(w, r, http.StatusForbidden, map[string]any{
+			"error":   true,
+			"code":    "FORBIDDEN",
+			"message": "only the sender or recipient of transfer " + strconv.FormatInt(id, 10) + " may view it",
+		})
+		return
+	}
+
+	utils.EncodeJson(w, r, http.StatusOK, transfer)
+}
+
+func (h *TransferHandler) ApproveTransfer(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseTransferID(w, r)
+	if !ok {
+		return
+	}
+
+	transfer, err := h.service.Approve(r.Context(), id, utils.Actor(r))
+	if err != nil {
+		writeTransferError(w, r, err)
+		return
+	}
+
+	utils.EncodeJson(w, r, http.StatusOK, transfer)
+}
+
+func (h *TransferHandler) RejectTransfer(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseTransferID(w, r)
+	if !ok {
+		return
+	}
+
+	transfer, err := h.service.Reject(r.Context(), id, utils.Actor(r))
+	if err != nil {
+		writeTransferError(w, r, err)
+		return
+	}
+
+	utils.EncodeJson(w, r, http.StatusOK, transfer)
+}
+
+func parseTransferID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		utils.EncodeJson(w, r, http.StatusBadRequest, map[string]any{
+			"error":   true,
+			"code":    "INVALID_TRANSFER_ID",
+			"message": "invalid transfer id",
+		})
+		return 0, false
+	}
+	return id, true
+}
+
+func writeTransferError(w http.ResponseWriter, r *http.Request, err error) {
+	status := http.StatusInternalServerError
+	code := "TRANSFER_FAILED"
+
+	switch {
+	case errors.Is(err, repository.ErrInsufficientCredits):
+		status = http.StatusConflict
+		code = "INSUFFICIENT_CREDITS"
+		metrics.RejectCredits("transfer", code)
+	case errors.Is(err, repository.ErrWalletNotFound):
+		status = http.StatusNotFound
+		code = "WALLET_NOT_FOUND"
+	case errors.Is(err, repository.ErrTransferNotFound):
+		status = http.StatusNotFound
+		code = "TRANSFER_NOT_FOUND"
+	case errors.Is(err, repository.ErrTransferNotPending):
+		status = http.StatusConflict
+		code = "TRANSFER_NOT_PENDING"
+	case errors.Is(err, repository.ErrTransferReplayed):
+		status = http.StatusConflict
+		code = "REQUEST_ID_REUSED"
+	case errors.Is(err, repository.ErrInvalidInput):
+		status = http.StatusBadRequest
+		code = "INVALID_TRANSFER"
+	case errors.Is(err, repository.ErrNotFound):
+		status = http.StatusNotFound
+		code = "NOT_FOUND"
+	}
+
+	utils.EncodeJson(w, r, status, map[string]any{
+		"error":   true,
+		"code":    code,
+		"message": err.Error(),
+	})
+}
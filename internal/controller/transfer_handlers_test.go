@@ -0,0 +1,62 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/Enilsonn/CRUD-Postgres/internal/repository"
+	"github.com/Enilsonn/CRUD-Postgres/internal/service"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestGetTransferOnlyShowsItToItsParties(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    int
+	}{
+		{"sender", map[string]string{"X-Client-ID": "1"}, http.StatusOK},
+		{"recipient", map[string]string{"X-Client-ID": "2"}, http.StatusOK},
+		{"employee", map[string]string{"X-Role": "employee"}, http.StatusOK},
+		{"stranger", map[string]string{"X-Client-ID": "3"}, http.StatusForbidden},
+		{"anonymous", nil, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("sqlmock new: %v", err)
+			}
+			defer db.Close()
+
+			mock.ExpectQuery(`FROM credit_transfers WHERE id = \$1`).WithArgs(int64(9)).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "from_client_id", "to_client_id", "credits", "status", "note",
+					"request_id", "requested_by", "reviewed_by", "debit_entry_id", "credit_entry_id", "created_at", "completed_at"}).
+					AddRow(9, 1, 2, 50, "COMPLETED", "", "", "client:1", "", 11, 12, time.Now(), time.Now()))
+
+			handler := NewTransferHandler(service.NewTransferService(repository.NewTransferRepository(db), nil, 0))
+			req := httptest.NewRequest(http.MethodGet, "/api/transfers/9", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", "9")
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+			rr := httptest.NewRecorder()
+			handler.GetTransfer(rr, req)
+
+			if rr.Code != tt.want {
+				t.Errorf("status %d body %s, want %d", rr.Code, rr.Body.String(), tt.want)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+		})
+	}
+}
@@ -2,11 +2,13 @@ package controller
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"math"
+	"log/slog"
 	"net/http"
 	"strconv"
 
+	"github.com/Enilsonn/CRUD-Postgres/internal/metrics"
 	"github.com/Enilsonn/CRUD-Postgres/internal/repository"
 	"github.com/Enilsonn/CRUD-Postgres/internal/service"
 	"github.com/Enilsonn/CRUD-Postgres/internal/utils"
@@ -17,6 +19,7 @@ type WalletHandler struct {
 	WalletRepo *repository.WalletRepository
 	PlanRepo   *repository.ProductRepository
 	PricingSvc *service.PricingService
+	Alerts     *service.BalanceAlertService
 }
 
 func NewWalletHandler(walletRepo *repository.WalletRepository, planRepo *repository.ProductRepository, pricingSvc *service.PricingService) *WalletHandler {
@@ -28,7 +31,7 @@ func NewWalletHandler(walletRepo *repository.WalletRepository, planRepo *reposit
 }
 
 func (h *WalletHandler) GetWalletBalance(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
+	ctx := context.WithoutCancel(r.Context())
 	clientID, err := strconv.ParseInt(chi.URLParam(r, "client_id"), 10, 64)
 	if err != nil {
 		utils.EncodeJson(w, r, http.StatusBadRequest,
@@ -54,8 +57,34 @@ func (h *WalletHandler) GetWalletBalance(w http.ResponseWriter, r *http.Request)
 	utils.EncodeJson(w, r, http.StatusOK, wallet)
 }
 
+func (h *WalletHandler) ListCreditLots(w http.ResponseWriter, r *http.Request) {
+	clientID, err := strconv.ParseInt(chi.URLParam(r, "client_id"), 10, 64)
+	if err != nil {
+		utils.EncodeJson(w, r, http.StatusBadRequest,
+			map[string]any{
+				"error":   true,
+				"code":    "INVALID_CLIENT_ID",
+				"message": "invalid client ID",
+			})
+		return
+	}
+
+	lots, err := h.WalletRepo.ListOpenLots(r.Context(), clientID)
+	if err != nil {
+		utils.EncodeJson(w, r, http.StatusInternalServerError,
+			map[string]any{
+				"error":   true,
+				"code":    "DATABASE_ERROR",
+				"message": err.Error(),
+			})
+		return
+	}
+
+	utils.EncodeJson(w, r, http.StatusOK, lots)
+}
+
 func (h *WalletHandler) GetLedgerEntries(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
+	ctx := context.WithoutCancel(r.Context())
 	clientID, err := strconv.ParseInt(chi.URLParam(r, "client_id"), 10, 64)
 	if err != nil {
 		utils.EncodeJson(w, r, http.StatusBadRequest,
@@ -96,7 +125,7 @@ func (h *WalletHandler) GetLedgerEntries(w http.ResponseWriter, r *http.Request)
 }
 
 func (h *WalletHandler) TopUpCredits(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
+	ctx := context.WithoutCancel(r.Context())
 	clientID, err := strconv.ParseInt(chi.URLParam(r, "client_id"), 10, 64)
 	if err != nil {
 		utils.EncodeJson(w, r, http.StatusBadRequest,
@@ -137,7 +166,7 @@ func (h *WalletHandler) TopUpCredits(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Process top-up transaction
-	newBalance, err := h.WalletRepo.ProcessTopUp(ctx, clientID, plan.AmountCredits, plan.PriceCents, topup.RequestID)
+	newBalance, err := h.WalletRepo.ProcessTopUp(ctx, clientID, plan.AmountCredits, plan.PriceCents, plan.ValidityDays, topup.RequestID)
 	if err != nil {
 		utils.EncodeJson(w, r, http.StatusInternalServerError,
 			map[string]any{
@@ -157,8 +186,53 @@ func (h *WalletHandler) TopUpCredits(w http.ResponseWriter, r *http.Request) {
 		})
 }
 
+func (h *WalletHandler) SetCreditLine(w http.ResponseWriter, r *http.Request) {
+	clientID, err := strconv.ParseInt(chi.URLParam(r, "client_id"), 10, 64)
+	if err != nil {
+		utils.EncodeJson(w, r, http.StatusBadRequest,
+			map[string]any{
+				"error":   true,
+				"code":    "INVALID_CLIENT_ID",
+				"message": "invalid client ID",
+			})
+		return
+	}
+
+	type req struct {
+		CreditLimitCredits int64 `json:"credit_limit_credits"`
+	}
+
+	payload, err := utils.DecodeJson[req](r)
+	if err != nil || payload.CreditLimitCredits < 0 {
+		utils.EncodeJson(w, r, http.StatusBadRequest,
+			map[string]any{
+				"error":   true,
+				"code":    "INVALID_REQUEST",
+				"message": "credit_limit_credits must be a non-negative integer",
+			})
+		return
+	}
+
+	wallet, err := h.WalletRepo.SetCreditLimit(r.Context(), clientID, payload.CreditLimitCredits)
+	if err != nil {
+		status, code := http.StatusInternalServerError, "CREDIT_LINE_FAILED"
+		if errors.Is(err, repository.ErrInvalidInput) {
+			status, code = http.StatusConflict, "LIMIT_BELOW_DEBT"
+		}
+		utils.EncodeJson(w, r, status,
+			map[string]any{
+				"error":   true,
+				"code":    code,
+				"message": err.Error(),
+			})
+		return
+	}
+
+	utils.EncodeJson(w, r, http.StatusOK, wallet)
+}
+
 func (h *WalletHandler) ProcessUsage(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
+	ctx := context.WithoutCancel(r.Context())
 	type req struct {
 		ClientID         int64  `json:"client_id"`
 		Model            string `json:"model"`
@@ -176,41 +250,56 @@ func (h *WalletHandler) ProcessUsage(w http.ResponseWriter, r *http.Request) {
 			})
 		return
 	}
+	utils.AddLogAttrs(ctx, slog.Int64("client_id", usage.ClientID))
 
 	// Calculate credits to deduct, using dynamic pricing when available
-	totalTokens := usage.PromptTokens + usage.CompletionTokens
-	creditsNeeded := int64(math.Ceil(float64(totalTokens) / 1000.0))
+	rate, err := h.PricingSvc.RateFor(ctx, usage.Model)
+	if err != nil {
+		utils.EncodeJson(w, r, http.StatusInternalServerError,
+			map[string]any{
+				"error":   true,
+				"code":    "PRICING_FAILED",
+				"message": err.Error(),
+			})
+		return
+	}
+	creditsNeeded := rate.Credits(usage.PromptTokens, usage.CompletionTokens)
 	meta := map[string]any{
 		"model": usage.Model,
-		"ppk":   1.0,
-		"cpk":   1.0,
+		"ppk":   rate.PromptPer1K,
+		"cpk":   rate.CompletionPer1K,
 	}
 
-	if h.PricingSvc != nil {
-		calcCredits, ppk, cpk, err := h.PricingSvc.ComputeCredits(ctx, usage.Model, usage.PromptTokens, usage.CompletionTokens)
-		if err != nil {
-			utils.EncodeJson(w, r, http.StatusInternalServerError,
+	// Process usage transaction
+	charge, err := h.WalletRepo.ProcessUsage(ctx, usage.ClientID, usage.Model, usage.PromptTokens, usage.CompletionTokens, creditsNeeded, meta)
+	if err != nil {
+		if errors.Is(err, repository.ErrInsufficientCredits) {
+			metrics.RejectCredits("usage", "INSUFFICIENT_CREDITS")
+			utils.EncodeJson(w, r, http.StatusConflict,
 				map[string]any{
 					"error":   true,
-					"code":    "PRICING_FAILED",
-					"message": err.Error(),
+					"code":    "INSUFFICIENT_CREDITS",
+					"message": "not enough credits",
 				})
 			return
 		}
-		creditsNeeded = calcCredits
-		meta["ppk"] = ppk
-		meta["cpk"] = cpk
-	}
-
-	// Process usage transaction
-	newBalance, err := h.WalletRepo.ProcessUsage(ctx, usage.ClientID, usage.Model, usage.PromptTokens, usage.CompletionTokens, creditsNeeded, meta)
-	if err != nil {
-		if err.Error() == "insufficient credits" {
+		if errors.Is(err, repository.ErrCreditLimitExceeded) {
+			metrics.RejectCredits("usage", "CREDIT_LIMIT_EXCEEDED")
 			utils.EncodeJson(w, r, http.StatusConflict,
 				map[string]any{
 					"error":   true,
-					"code":    "INSUFFICIENT_CREDITS",
-					"message": "not enough credits",
+					"code":    "CREDIT_LIMIT_EXCEEDED",
+					"message": "usage would exceed the wallet credit limit",
+				})
+			return
+		}
+		if errors.Is(err, repository.ErrMemberLimitExceeded) {
+			metrics.RejectCredits("usage", "MEMBER_LIMIT_EXCEEDED")
+			utils.EncodeJson(w, r, http.StatusConflict,
+				map[string]any{
+					"error":   true,
+					"code":    "MEMBER_LIMIT_EXCEEDED",
+					"message": err.Error(),
 				})
 			return
 		}
@@ -223,11 +312,16 @@ func (h *WalletHandler) ProcessUsage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	metrics.ObserveUsage(rate.Rule, usage.PromptTokens, usage.CompletionTokens, creditsNeeded)
+	h.Alerts.CheckAsync(charge.WalletClientID, charge.BalanceCredits)
+
 	utils.EncodeJson(w, r, http.StatusOK,
 		map[string]any{
 			"client_id":        usage.ClientID,
-			"balance_credits":  newBalance,
+			"wallet_client_id": charge.WalletClientID,
+			"org_id":           charge.OrgID,
+			"balance_credits":  charge.BalanceCredits,
 			"credits_spent":    creditsNeeded,
-			"tokens_processed": totalTokens,
+			"tokens_processed": usage.PromptTokens + usage.CompletionTokens,
 		})
 }
@@ -0,0 +1,36 @@
+package controller
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/Enilsonn/CRUD-Postgres/internal/repository"
+)
+
+func TestProcessUsageRejectsUsageTheLotsCannotCover(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock new: %v", err)
+	}
+	defer db.Close()
+
+	// Lapsed lots the expiry job has not swept yet leave the balance
+	// looking sufficient; the wrapped lot error must still answer 409.
+	expectUsageShortOfLots(mock, "gemma3:1b", 2)
+
+	handler := NewWalletHandler(repository.NewWalletRepository(db), nil, nil)
+	body := bytes.NewBufferString(`{"client_id":1,"model":"gemma3:1b","prompt_tokens":900,"completion_tokens":900}`)
+	rr := httptest.NewRecorder()
+	handler.ProcessUsage(rr, httptest.NewRequest(http.MethodPost, "/api/usage", body))
+
+	if rr.Code != http.StatusConflict || !strings.Contains(rr.Body.String(), "INSUFFICIENT_CREDITS") {
+		t.Errorf("status %d body %s, want 409 INSUFFICIENT_CREDITS", rr.Code, rr.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package metrics
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/Enilsonn/CRUD-Postgres/internal/model"
+	"github.com/Enilsonn/CRUD-Postgres/internal/repository"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ledgerSettle is how old a row must be before it is counted. Writers commit
+// well within it, so no row with a lower id can still appear afterwards.
+const ledgerSettle = time.Minute
+
+var (
+	orderTransitionsDesc = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "order_status_transitions_total"),
+		"Order payment status changes, by from and to status.", []string{"from", "to"}, nil)
+	topUpsDesc = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "topups_total"),
+		"TOPUP ledger entries, purchases and free grants alike.", nil, nil)
+	topUpCreditsDesc = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "topup_credits_total"),
+		"Credits added by TOPUP ledger entries.", nil, nil)
+	topUpRevenueDesc = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "topup_revenue_cents_total"),
+		"Revenue from TOPUP ledger entries, in cents.", nil, nil)
+)
+
+// ledgerCollector reports order status transitions and top-up revenue from
+// order_events and credit_ledger, which database triggers, jobs and crudctl
+// write as well as the API. Each scrape only reads rows past the last one
+// counted, lagging ledgerSettle behind. Every replica reports the same
+// totals, so aggregate them with max rather than sum.
+type ledgerCollector struct {
+	orders  *repository.OrderRepository
+	wallets *repository.WalletRepository
+
+	mu          sync.Mutex
+	orderAfter  int64
+	topUpAfter  int64
+	transitions map[[2]string]int64
+	topUps      model.TopUpTotals
+}
+
+// NewLedgerCollector builds the database-backed order and top-up metrics, to
+// be registered on Registry.
+func NewLedgerCollector(orders *repository.OrderRepository, wallets *repository.WalletRepository) prometheus.Collector {
+	return &ledgerCollector{
+		orders:      orders,
+		wallets:     wallets,
+		transitions: map[[2]string]int64{},
+	}
+}
+
+func (c *ledgerCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- orderTransitionsDesc
+	ch <- topUpsDesc
+	ch <- topUpCreditsDesc
+	ch <- topUpRevenueDesc
+}
+
+// Collect catches up on new rows and reports the running totals. When the
+// database cannot be read the totals so far are reported unchanged.
+func (c *ledgerCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ctx := context.Background()
+	settledBefore := time.Now().Add(-ledgerSettle)
+
+	counts, lastID, err := c.orders.StatusChangesSince(ctx, c.orderAfter, settledBefore)
+	if err != nil {
+		slog.Warn("collect order metrics", "err", err)
+	} else {
+		for _, count := range counts {
+			c.transitions[[2]string{count.From, count.To}] += count.Count
+		}
+		c.orderAfter = lastID
+	}
+
+	totals, lastID, err := c.wallets.TopUpsSince(ctx, c.topUpAfter, settledBefore)
+	if err != nil {
+		slog.Warn("collect top-up metrics", "err", err)
+	} else {
+		c.topUps.Entries += totals.Entries
+		c.topUps.Credits += totals.Credits
+		c.topUps.PriceCents += totals.PriceCents
+		c.topUpAfter = lastID
+	}
+
+	for key, count := range c.transitions {
+		ch <- prometheus.MustNewConstMetric(orderTransitionsDesc, prometheus.CounterValue, float64(count), key[0], key[1])
+	}
+	ch <- prometheus.MustNewConstMetric(topUpsDesc, prometheus.CounterValue, float64(c.topUps.Entries))
+	ch <- prometheus.MustNewConstMetric(topUpCreditsDesc, prometheus.CounterValue, float64(c.topUps.Credits))
+	ch <- prometheus.MustNewConstMetric(topUpRevenueDesc, prometheus.CounterValue, float64(c.topUps.PriceCents))
+}
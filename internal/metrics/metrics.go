@@ -0,0 +1,139 @@
+// Package metrics exposes the service's Prometheus metrics. Request, Ollama
+// and usage metrics are counted as they happen; order and top-up totals are
+// read from the database at scrape time, see NewLedgerCollector.
+package metrics
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "crud"
+
+// Registry holds every metric served on /metrics.
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests served, by route pattern and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time to serve HTTP requests, by route pattern.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	ollamaDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "ollama_request_duration_seconds",
+		Help:      "Time Ollama took to answer chat calls, by pricing rule and outcome.",
+		Buckets:   []float64{0.25, 0.5, 1, 2.5, 5, 10, 20, 40, 80, 120},
+	}, []string{"pricing_rule", "outcome"})
+
+	ollamaErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ollama_errors_total",
+		Help:      "Failed Ollama chat calls, by pricing rule and reason.",
+	}, []string{"pricing_rule", "reason"})
+
+	tokens = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "llm_tokens_total",
+		Help:      "Tokens billed, by pricing rule and kind (prompt or completion).",
+	}, []string{"pricing_rule", "kind"})
+
+	creditsConsumed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "llm_credits_consumed_total",
+		Help:      "Credits debited for LLM usage, by pricing rule.",
+	}, []string{"pricing_rule"})
+
+	creditRejections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "insufficient_credit_rejections_total",
+		Help:      "Requests refused for lack of credits, by operation and error code.",
+	}, []string{"operation", "code"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests, httpDuration,
+		ollamaDuration, ollamaErrors,
+		tokens, creditsConsumed, creditRejections,
+	)
+}
+
+// Handler serves Registry in the Prometheus text format. When token is not
+// empty, scrapers must send it as a bearer token.
+func Handler(token string) http.Handler {
+	h := promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+	if token == "" {
+		return h
+	}
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// RegisterDB exports db's connection pool stats.
+func RegisterDB(db *sql.DB, name string) {
+	Registry.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
+
+// otherRule labels models no pricing rule matched.
+const otherRule = "other"
+
+// ruleLabel keeps model series bounded: callers name any model they like, so
+// metrics carry the pricing rule it matched instead, and "other" for none.
+func ruleLabel(rule string) string {
+	if rule == "" {
+		return otherRule
+	}
+	return rule
+}
+
+// ObserveOllama records one chat call to Ollama for a model billed under
+// rule, empty when no rule matched. reason is empty when the call succeeded
+// and names the failure otherwise.
+func ObserveOllama(rule string, took time.Duration, reason string) {
+	rule = ruleLabel(rule)
+	outcome := "ok"
+	if reason != "" {
+		outcome = "error"
+		ollamaErrors.WithLabelValues(rule, reason).Inc()
+	}
+	ollamaDuration.WithLabelValues(rule, outcome).Observe(took.Seconds())
+}
+
+// ObserveUsage records tokens and credits billed for a usage debit under
+// rule, empty when no rule matched.
+func ObserveUsage(rule string, promptTokens, completionTokens, credits int64) {
+	rule = ruleLabel(rule)
+	tokens.WithLabelValues(rule, "prompt").Add(float64(promptTokens))
+	tokens.WithLabelValues(rule, "completion").Add(float64(completionTokens))
+	creditsConsumed.WithLabelValues(rule).Add(float64(credits))
+}
+
+// RejectCredits records a request refused because the wallet could not pay,
+// code being the error code returned to the caller.
+func RejectCredits(operation, code string) {
+	creditRejections.WithLabelValues(operation, code).Inc()
+}
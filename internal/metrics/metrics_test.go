@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/Enilsonn/CRUD-Postgres/internal/repository"
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMiddlewareLabelsByRoutePattern(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(Middleware)
+	r.Get("/api/orders/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	for _, path := range []string{"/api/orders/1", "/api/orders/2", "/nowhere"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	if got := testutil.ToFloat64(httpRequests.WithLabelValues("GET", "/api/orders/{id}", "404")); got != 2 {
+		t.Errorf("requests for /api/orders/{id} = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(httpRequests.WithLabelValues("GET", unmatchedRoute, "404")); got != 1 {
+		t.Errorf("unmatched requests = %v, want 1", got)
+	}
+}
+
+func TestLedgerCollectorAccumulatesNewRows(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	collector := NewLedgerCollector(repository.NewOrderRepository(db), repository.NewWalletRepository(db))
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(collector)
+
+	mock.ExpectQuery(`FROM order_events`).WithArgs(int64(0), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"from", "to", "count", "max"}).
+			AddRow("PENDING", "CONFIRMED", 3, 10).
+			AddRow("PENDING", "CANCELED", 1, 7))
+	mock.ExpectQuery(`FROM credit_ledger`).WithArgs(int64(0), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"count", "credits", "cents", "max"}).AddRow(2, 1500, 4990, 20))
+
+	mock.ExpectQuery(`FROM order_events`).WithArgs(int64(10), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"from", "to", "count", "max"}).AddRow("PENDING", "CONFIRMED", 2, 12))
+	mock.ExpectQuery(`FROM credit_ledger`).WithArgs(int64(20), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"count", "credits", "cents", "max"}).AddRow(1, 500, 1990, 21))
+
+	if _, err := reg.Gather(); err != nil {
+		t.Fatalf("first gather: %v", err)
+	}
+
+	want := `
+# HELP crud_order_status_transitions_total Order payment status changes, by from and to status.
+# TYPE crud_order_status_transitions_total counter
+crud_order_status_transitions_total{from="PENDING",to="CANCELED"} 1
+crud_order_status_transitions_total{from="PENDING",to="CONFIRMED"} 5
+# HELP crud_topup_revenue_cents_total Revenue from TOPUP ledger entries, in cents.
+# TYPE crud_topup_revenue_cents_total counter
+crud_topup_revenue_cents_total 6980
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(want),
+		"crud_order_status_transitions_total", "crud_topup_revenue_cents_total"); err != nil {
+		t.Error(err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestUsageIsLabeledByPricingRule(t *testing.T) {
+	before := testutil.ToFloat64(creditsConsumed.WithLabelValues(otherRule))
+
+	ObserveUsage("^llama3", 100, 50, 4)
+	ObserveUsage("", 10, 5, 1)
+	ObserveUsage("", 10, 5, 2)
+
+	if got := testutil.ToFloat64(creditsConsumed.WithLabelValues("^llama3")); got != 4 {
+		t.Errorf("credits under ^llama3 = %v, want 4", got)
+	}
+	if got := testutil.ToFloat64(creditsConsumed.WithLabelValues(otherRule)) - before; got != 3 {
+		t.Errorf("credits under other = %v, want 3", got)
+	}
+	if got := testutil.ToFloat64(tokens.WithLabelValues("^llama3", "prompt")); got != 100 {
+		t.Errorf("prompt tokens under ^llama3 = %v, want 100", got)
+	}
+}
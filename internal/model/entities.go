@@ -37,6 +37,9 @@ type Plan struct {
 	Category           string `json:"category"`
 	ManufacturedInMari bool   `json:"manufactured_in_mari"`
 	Stock              int    `json:"stock"`
+	ReservedStock      int    `json:"reserved_stock"`
+	AvailableStock     int    `json:"available_stock"`
+	ValidityDays       *int   `json:"validity_days,omitempty"`
 }
 
 func NewPlan(planName string, priceCents int64, amountCredits int) *Plan {
@@ -50,9 +53,35 @@ func NewPlan(planName string, priceCents int64, amountCredits int) *Plan {
 	}
 }
 
+// Wallet balances may go negative down to -CreditLimitCredits for clients on
+// a postpaid credit line; DebtCredits is the overdrawn amount.
 type Wallet struct {
+	ClientID           int64 `json:"client_id"`
+	BalanceCredits     int64 `json:"balance_credits"`
+	CreditLimitCredits int64 `json:"credit_limit_credits"`
+	DebtCredits        int64 `json:"debt_credits"`
+	AvailableCredits   int64 `json:"available_credits"`
+}
+
+// WalletDrift is a wallet whose balance no longer matches the sum of its
+// ledger entries or, when positive, the credits left in its lots.
+type WalletDrift struct {
 	ClientID       int64 `json:"client_id"`
 	BalanceCredits int64 `json:"balance_credits"`
+	LedgerCredits  int64 `json:"ledger_credits"`
+	LotCredits     int64 `json:"lot_credits"`
+}
+
+type CreditLot struct {
+	ID               int64      `json:"id"`
+	ClientID         int64      `json:"client_id"`
+	Source           string     `json:"source"`
+	OrderID          *int64     `json:"order_id,omitempty"`
+	PlanID           *int64     `json:"plan_id,omitempty"`
+	CreditsTotal     int64      `json:"credits_total"`
+	CreditsRemaining int64      `json:"credits_remaining"`
+	ExpiresAt        *time.Time `json:"expires_at,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
 }
 
 type CreditLedgerEntry struct {
@@ -62,9 +91,19 @@ type CreditLedgerEntry struct {
 	CreditsDelta    int64           `json:"credits_delta"`
 	PriceCentsDelta int64           `json:"price_cents_delta"`
 	Meta            json.RawMessage `json:"meta"`
+	OrgID           *int64          `json:"org_id,omitempty"`
+	MemberClientID  *int64          `json:"member_client_id,omitempty"`
 	CreatedAt       time.Time       `json:"created_at"`
 }
 
+// UsageCharge reports which wallet paid for a usage debit. For organization
+// members that is the organization's shared wallet, not their own.
+type UsageCharge struct {
+	WalletClientID int64  `json:"wallet_client_id"`
+	OrgID          *int64 `json:"org_id,omitempty"`
+	BalanceCredits int64  `json:"balance_credits"`
+}
+
 type UsageEvent struct {
 	ID               int64     `json:"id"`
 	ClientID         int64     `json:"client_id"`
@@ -100,15 +139,37 @@ type Order struct {
 	SubtotalCents int64       `json:"subtotal_cents"`
 	DiscountCents int64       `json:"discount_cents"`
 	TotalCents    int64       `json:"total_cents"`
+	ExpiresAt     *time.Time  `json:"expires_at,omitempty"`
+	CancelReason  string      `json:"cancel_reason,omitempty"`
+	CanceledAt    *time.Time  `json:"canceled_at,omitempty"`
+	PriceLock     string      `json:"price_lock"`
+	CheckedOutAt  *time.Time  `json:"checked_out_at,omitempty"`
 	Items         []OrderItem `json:"items,omitempty"`
 }
 
 type OrderItem struct {
-	ID             int64 `json:"id"`
-	OrderID        int64 `json:"order_id"`
-	PlanID         int64 `json:"plan_id"`
-	Quantity       int   `json:"quantity"`
-	UnitPriceCents int64 `json:"unit_price_cents"`
+	ID             int64  `json:"id"`
+	OrderID        int64  `json:"order_id"`
+	PlanID         int64  `json:"plan_id"`
+	PlanName       string `json:"plan_name,omitempty"`
+	Quantity       int    `json:"quantity"`
+	UnitPriceCents int64  `json:"unit_price_cents"`
+}
+
+// OrderEvent is one entry in an order's timeline. Payload holds the
+// type-specific detail, e.g. the from/to statuses of STATUS_CHANGED.
+type OrderEvent struct {
+	ID        int64           `json:"id"`
+	OrderID   int64           `json:"order_id"`
+	Type      string          `json:"type"`
+	Actor     string          `json:"actor"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+type OrderPage struct {
+	Orders     []Order `json:"orders"`
+	NextCursor string  `json:"next_cursor,omitempty"`
 }
 
 type SellerMonthlySales struct {
@@ -117,3 +178,201 @@ type SellerMonthlySales struct {
 	OrdersCount int64     `json:"orders_count"`
 	TotalCents  int64     `json:"total_cents"`
 }
+
+type LedgerTotals struct {
+	EntriesCount    int64            `json:"entries_count"`
+	CreditsIn       int64            `json:"credits_in"`
+	CreditsOut      int64            `json:"credits_out"`
+	NetCredits      int64            `json:"net_credits"`
+	PriceCentsTotal int64            `json:"price_cents_total"`
+	CreditsByType   map[string]int64 `json:"credits_by_type"`
+}
+
+type LedgerPage struct {
+	Entries    []*CreditLedgerEntry `json:"entries"`
+	NextCursor string               `json:"next_cursor,omitempty"`
+	Totals     LedgerTotals         `json:"totals"`
+}
+
+type WalletStatement struct {
+	ClientID       int64     `json:"client_id"`
+	Month          string    `json:"month"`
+	PeriodStart    time.Time `json:"period_start"`
+	PeriodEnd      time.Time `json:"period_end"`
+	OpeningBalance int64     `json:"opening_balance"`
+	CreditsIn      int64     `json:"credits_in"`
+	CreditsOut     int64     `json:"credits_out"`
+	ClosingBalance int64     `json:"closing_balance"`
+	CentsSpent     int64     `json:"cents_spent"`
+	EntriesCount   int64     `json:"entries_count"`
+}
+
+type BalanceAlert struct {
+	ClientID           int64      `json:"client_id"`
+	ThresholdCredits   int64      `json:"threshold_credits"`
+	WebhookURL         string     `json:"webhook_url,omitempty"`
+	Email              string     `json:"email,omitempty"`
+	AutoRechargePlanID *int64     `json:"auto_recharge_plan_id,omitempty"`
+	MaxRechargesPerDay int        `json:"max_recharges_per_day"`
+	CooldownMinutes    int        `json:"cooldown_minutes"`
+	Enabled            bool       `json:"enabled"`
+	Armed              bool       `json:"armed"`
+	LastTriggeredAt    *time.Time `json:"last_triggered_at,omitempty"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+}
+
+type BalanceAlertEvent struct {
+	ID        int64           `json:"id"`
+	ClientID  int64           `json:"client_id"`
+	Kind      string          `json:"kind"`
+	Status    string          `json:"status"`
+	Detail    json.RawMessage `json:"detail"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+type CreditTransfer struct {
+	ID            int64      `json:"id"`
+	FromClientID  int64      `json:"from_client_id"`
+	ToClientID    int64      `json:"to_client_id"`
+	Credits       int64      `json:"credits"`
+	Status        string     `json:"status"`
+	Note          string     `json:"note,omitempty"`
+	RequestID     string     `json:"request_id,omitempty"`
+	RequestedBy   string     `json:"requested_by"`
+	ReviewedBy    string     `json:"reviewed_by,omitempty"`
+	DebitEntryID  *int64     `json:"debit_entry_id,omitempty"`
+	CreditEntryID *int64     `json:"credit_entry_id,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	CompletedAt   *time.Time `json:"completed_at,omitempty"`
+}
+
+type Organization struct {
+	ID              int64                `json:"id"`
+	Name            string               `json:"name"`
+	BillingClientID int64                `json:"billing_client_id"`
+	CreatedAt       time.Time            `json:"created_at"`
+	Members         []OrganizationMember `json:"members,omitempty"`
+}
+
+type OrganizationMember struct {
+	OrgID               int64     `json:"org_id"`
+	ClientID            int64     `json:"client_id"`
+	Role                string    `json:"role"`
+	MonthlyLimitCredits *int64    `json:"monthly_limit_credits,omitempty"`
+	SpentThisMonth      int64     `json:"spent_this_month"`
+	JoinedAt            time.Time `json:"joined_at"`
+}
+
+type Invoice struct {
+	ID            int64         `json:"id"`
+	ClientID      int64         `json:"client_id"`
+	ClientName    string        `json:"client_name,omitempty"`
+	Number        string        `json:"number,omitempty"`
+	PeriodStart   time.Time     `json:"period_start"`
+	PeriodEnd     time.Time     `json:"period_end"`
+	Status        string        `json:"status"`
+	Currency      string        `json:"currency"`
+	SubtotalCents int64         `json:"subtotal_cents"`
+	TaxRateBP     int           `json:"tax_rate_bp"`
+	TaxCents      int64         `json:"tax_cents"`
+	TotalCents    int64         `json:"total_cents"`
+	CreatedAt     time.Time     `json:"created_at"`
+	IssuedAt      *time.Time    `json:"issued_at,omitempty"`
+	PaidAt        *time.Time    `json:"paid_at,omitempty"`
+	VoidedAt      *time.Time    `json:"voided_at,omitempty"`
+	Lines         []InvoiceLine `json:"lines,omitempty"`
+}
+
+type InvoiceLine struct {
+	ID             int64  `json:"id"`
+	Kind           string `json:"kind"`
+	Description    string `json:"description"`
+	Quantity       int64  `json:"quantity"`
+	UnitPriceCents int64  `json:"unit_price_cents"`
+	AmountCents    int64  `json:"amount_cents"`
+	OrderID        *int64 `json:"order_id,omitempty"`
+	PlanID         *int64 `json:"plan_id,omitempty"`
+}
+
+type Subscription struct {
+	ID                 int64               `json:"id"`
+	ClientID           int64               `json:"client_id"`
+	PlanID             int64               `json:"plan_id"`
+	PendingPlanID      *int64              `json:"pending_plan_id,omitempty"`
+	Quantity           int                 `json:"quantity"`
+	BillingInterval    string              `json:"billing_interval"`
+	PaymentMethod      string              `json:"payment_method"`
+	Status             string              `json:"status"`
+	CurrentPeriodStart time.Time           `json:"current_period_start"`
+	CurrentPeriodEnd   time.Time           `json:"current_period_end"`
+	NextRenewalAt      *time.Time          `json:"next_renewal_at,omitempty"`
+	FailedAttempts     int                 `json:"failed_attempts"`
+	GraceUntil         *time.Time          `json:"grace_until,omitempty"`
+	CancelAtPeriodEnd  bool                `json:"cancel_at_period_end"`
+	CancelReason       string              `json:"cancel_reason,omitempty"`
+	PausedAt           *time.Time          `json:"paused_at,omitempty"`
+	CanceledAt         *time.Time          `json:"canceled_at,omitempty"`
+	CreatedAt          time.Time           `json:"created_at"`
+	Cycles             []SubscriptionCycle `json:"cycles,omitempty"`
+}
+
+type SubscriptionCycle struct {
+	ID             int64     `json:"id"`
+	SubscriptionID int64     `json:"subscription_id"`
+	OrderID        *int64    `json:"order_id,omitempty"`
+	Kind           string    `json:"kind"`
+	Status         string    `json:"status"`
+	PeriodStart    time.Time `json:"period_start"`
+	PeriodEnd      time.Time `json:"period_end"`
+	AmountCents    int64     `json:"amount_cents"`
+	CreditsGranted int64     `json:"credits_granted"`
+	Error          string    `json:"error,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+type PaymentCharge struct {
+	ID            int64      `json:"id"`
+	OrderID       int64      `json:"order_id"`
+	Provider      string     `json:"provider"`
+	ProviderRef   string     `json:"provider_ref"`
+	Method        string     `json:"method"`
+	Status        string     `json:"status"`
+	AmountCents   int64      `json:"amount_cents"`
+	PixPayload    string     `json:"pix_payload,omitempty"`
+	BoletoLine    string     `json:"boleto_line,omitempty"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+	FailureReason string     `json:"failure_reason,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// InventoryMovement is one change to a plan's stock or reserved stock.
+type InventoryMovement struct {
+	ID            int64     `json:"id"`
+	PlanID        int64     `json:"plan_id"`
+	Kind          string    `json:"kind"`
+	StockDelta    int       `json:"stock_delta"`
+	ReservedDelta int       `json:"reserved_delta"`
+	StockAfter    int       `json:"stock_after"`
+	ReservedAfter int       `json:"reserved_after"`
+	OrderID       *int64    `json:"order_id,omitempty"`
+	Actor         string    `json:"actor"`
+	Reason        string    `json:"reason,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// OrderTransitionCount is how many times orders moved From one payment
+// status To another.
+type OrderTransitionCount struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Count int64  `json:"count"`
+}
+
+// TopUpTotals sums TOPUP ledger entries: purchases and free grants alike,
+// the latter priced at zero.
+type TopUpTotals struct {
+	Entries    int64 `json:"entries"`
+	Credits    int64 `json:"credits"`
+	PriceCents int64 `json:"price_cents"`
+}
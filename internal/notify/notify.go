@@ -0,0 +1,48 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+)
+
+// Notification is a channel-agnostic message. Senders pick the fields they
+// need: webhooks post Payload as JSON, email uses Subject and Body.
+type Notification struct {
+	Event      string
+	ClientID   int64
+	Email      string
+	WebhookURL string
+	Subject    string
+	Body       string
+	Payload    map[string]any
+}
+
+type Sender interface {
+	Send(ctx context.Context, n Notification) error
+}
+
+// MultiSender fans a notification out to every sender and joins their errors.
+type MultiSender []Sender
+
+func (m MultiSender) Send(ctx context.Context, n Notification) error {
+	var errs []error
+	for _, s := range m {
+		if err := s.Send(ctx, n); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// LogSender writes notifications to the process log. It is the fallback when
+// no SMTP server is configured.
+type LogSender struct{}
+
+func (LogSender) Send(ctx context.Context, n Notification) error {
+	if n.Email == "" {
+		return nil
+	}
+	slog.InfoContext(ctx, "notify", "event", n.Event, "client_id", n.ClientID, "email", n.Email, "subject", n.Subject)
+	return nil
+}
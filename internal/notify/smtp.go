@@ -0,0 +1,115 @@
+package notify
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// SMTPSender delivers plain-text email. In development it points at the
+// mailpit container from docker-compose, which accepts anything on :1025.
+type SMTPSender struct {
+	Addr string
+	From string
+	Auth smtp.Auth
+	// Timeout bounds a whole delivery, from dialing to QUIT.
+	Timeout time.Duration
+}
+
+func NewSMTPSender(host, port, user, pass, from string) *SMTPSender {
+	s := &SMTPSender{
+		Addr:    net.JoinHostPort(host, port),
+		From:    from,
+		Timeout: 10 * time.Second,
+	}
+	if user != "" {
+		s.Auth = smtp.PlainAuth("", user, pass, host)
+	}
+	return s
+}
+
+func (s *SMTPSender) Send(ctx context.Context, n Notification) error {
+	if n.Email == "" {
+		return nil
+	}
+	// The address goes into a header; anything but a bare address could
+	// smuggle extra headers or recipients in.
+	if addr, err := mail.ParseAddress(n.Email); err != nil || addr.Address != n.Email {
+		return fmt.Errorf("send email: invalid address %q", n.Email)
+	}
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", s.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", n.Email)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", strings.NewReplacer("\r", " ", "\n", " ").Replace(n.Subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(n.Body, "\n", "\r\n"))
+
+	if err := s.deliver(ctx, n.Email, msg.String()); err != nil {
+		return fmt.Errorf("send email to %s: %w", n.Email, err)
+	}
+	return nil
+}
+
+// deliver is smtp.SendMail over a connection that gives up once Timeout
+// passes or ctx ends, whichever is first.
+func (s *SMTPSender) deliver(ctx context.Context, to, msg string) error {
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+	}
+
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	// Cancelling ctx mid-conversation unblocks whatever read is pending.
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	host, _, _ := net.SplitHostPort(s.Addr)
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if s.Auth != nil {
+		if err := c.Auth(s.Auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(s.From); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte(msg)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
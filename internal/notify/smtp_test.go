@@ -0,0 +1,48 @@
+package notify
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSMTPSenderGivesUpOnSilentServer(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	// Accept and never greet, like a server that hangs.
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	s := NewSMTPSender(host, port, "", "", "billing@localhost")
+	s.Timeout = 100 * time.Millisecond
+
+	start := time.Now()
+	err = s.Send(context.Background(), Notification{Email: "ops@example.com", Subject: "low balance"})
+	if err == nil {
+		t.Fatal("want an error from a server that never answers")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Send took %v, want it bounded by the timeout", elapsed)
+	}
+}
+
+func TestSMTPSenderRefusesHeaderInjection(t *testing.T) {
+	s := NewSMTPSender("127.0.0.1", "1", "", "", "billing@localhost")
+	err := s.Send(context.Background(), Notification{Email: "ops@example.com\r\nBcc: everyone@example.com"})
+	if err == nil || !strings.Contains(err.Error(), "invalid address") {
+		t.Errorf("err = %v, want the address refused before dialing", err)
+	}
+}
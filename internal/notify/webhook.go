@@ -0,0 +1,51 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+type WebhookSender struct {
+	HTTPClient *http.Client
+}
+
+func NewWebhookSender() *WebhookSender {
+	return &WebhookSender{HTTPClient: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (s *WebhookSender) Send(ctx context.Context, n Notification) error {
+	if n.WebhookURL == "" {
+		return nil
+	}
+
+	body, err := json.Marshal(map[string]any{
+		"event":     n.Event,
+		"client_id": n.ClientID,
+		"data":      n.Payload,
+		"sent_at":   time.Now().UTC(),
+	})
+	if err != nil {
+		return fmt.Errorf("encode webhook payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("build webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("deliver webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("webhook %s answered %d", n.WebhookURL, resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package payments
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const FakeSignatureHeader = "X-Fake-Signature"
+
+// FakeProvider is a local stand-in for a real gateway. It issues real PIX
+// payloads and boleto lines but never moves money: PIX and boleto payments
+// are confirmed by posting a signed webhook, which SimulateWebhook can
+// produce, and card charges are captured as if the card were on file.
+type FakeProvider struct {
+	Secret       string
+	PixKey       string
+	MerchantName string
+	MerchantCity string
+	BankCode     string
+	BoletoDays   int
+}
+
+type fakeWebhook struct {
+	ID          string `json:"id"`
+	Type        string `json:"type"`
+	ChargeID    string `json:"charge_id"`
+	AmountCents *int64 `json:"amount_cents,omitempty"`
+	Reason      string `json:"reason,omitempty"`
+}
+
+func (p *FakeProvider) Name() string {
+	return "fake"
+}
+
+func (p *FakeProvider) CreateCharge(_ context.Context, req ChargeRequest) (*Charge, error) {
+	ref, err := randomRef("fake_ch_")
+	if err != nil {
+		return nil, err
+	}
+	charge := &Charge{ProviderRef: ref}
+
+	switch req.Method {
+	case "PIX":
+		charge.PixPayload = PixPayload{
+			Key:          p.PixKey,
+			MerchantName: p.MerchantName,
+			MerchantCity: p.MerchantCity,
+			AmountCents:  req.AmountCents,
+			TxID:         fmt.Sprintf("ORDER%d", req.OrderID),
+		}.String()
+		charge.ExpiresAt = req.ExpiresAt
+	case "BOLETO":
+		due := time.Now().UTC().AddDate(0, 0, p.BoletoDays)
+		if req.ExpiresAt != nil {
+			due = req.ExpiresAt.UTC()
+		}
+		line, err := Boleto{
+			BankCode:    p.BankCode,
+			DueDate:     due,
+			AmountCents: req.AmountCents,
+			FreeField:   fmt.Sprintf("%025d", req.OrderID),
+		}.LineNumber()
+		if err != nil {
+			return nil, err
+		}
+		charge.BoletoLine = line
+		charge.ExpiresAt = &due
+	default:
+		charge.ExpiresAt = req.ExpiresAt
+		charge.Captured = true
+	}
+
+	return charge, nil
+}
+
+func (p *FakeProvider) ParseWebhook(header http.Header, body []byte) (*WebhookEvent, error) {
+	if err := VerifySignature(p.Secret, body, header.Get(FakeSignatureHeader)); err != nil {
+		return nil, err
+	}
+
+	var hook fakeWebhook
+	if err := json.Unmarshal(body, &hook); err != nil {
+		return nil, fmt.Errorf("%w body: %v", ErrInvalidWebhook, err)
+	}
+	if hook.ID == "" || hook.ChargeID == "" {
+		return nil, fmt.Errorf("%w body: id and charge_id are required", ErrInvalidWebhook)
+	}
+	if hook.Type != EventPaymentConfirmed && hook.Type != EventPaymentFailed {
+		return nil, fmt.Errorf("%w type %q", ErrInvalidWebhook, hook.Type)
+	}
+	if hook.Type == EventPaymentConfirmed && (hook.AmountCents == nil || *hook.AmountCents < 0) {
+		return nil, fmt.Errorf("%w body: a confirmation needs amount_cents", ErrInvalidWebhook)
+	}
+
+	event := &WebhookEvent{
+		ID:          hook.ID,
+		Type:        hook.Type,
+		ProviderRef: hook.ChargeID,
+		Reason:      hook.Reason,
+		Payload:     body,
+	}
+	if hook.AmountCents != nil {
+		event.AmountCents = *hook.AmountCents
+	}
+	return event, nil
+}
+
+// SimulateWebhook builds the signed request the fake gateway would send
+// when the charge with providerRef is settled for amountCents.
+func (p *FakeProvider) SimulateWebhook(providerRef, eventType string, amountCents int64, reason string) (http.Header, []byte, error) {
+	id, err := randomRef("fake_evt_")
+	if err != nil {
+		return nil, nil, err
+	}
+	body, err := json.Marshal(fakeWebhook{ID: id, Type: eventType, ChargeID: providerRef, AmountCents: &amountCents, Reason: reason})
+	if err != nil {
+		return nil, nil, fmt.Errorf("encode webhook: %w", err)
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	header.Set(FakeSignatureHeader, Sign(p.Secret, body))
+	return header, body, nil
+}
+
+func randomRef(prefix string) (string, error) {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate reference: %w", err)
+	}
+	return prefix + hex.EncodeToString(buf), nil
+}
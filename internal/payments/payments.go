@@ -0,0 +1,84 @@
+package payments
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	EventPaymentConfirmed = "payment.confirmed"
+	EventPaymentFailed    = "payment.failed"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrInvalidWebhook   = errors.New("invalid webhook")
+)
+
+// ChargeRequest describes what the customer owes for one order.
+type ChargeRequest struct {
+	OrderID     int64
+	Method      string
+	AmountCents int64
+	PayerName   string
+	Description string
+	// ExpiresAt is when the order stops accepting payment, if ever.
+	ExpiresAt *time.Time
+}
+
+// Charge is what a provider hands back: its own reference for the payment
+// plus whatever the payer needs to complete it for the chosen method.
+// Captured is set when the provider already collected the payment, as card
+// gateways do with a card on file; no webhook needs to confirm it.
+type Charge struct {
+	ProviderRef string
+	PixPayload  string
+	BoletoLine  string
+	ExpiresAt   *time.Time
+	Captured    bool
+}
+
+// WebhookEvent is a provider notification, already verified and decoded.
+// AmountCents is what the provider says was paid; confirmations carry it.
+type WebhookEvent struct {
+	ID          string
+	Type        string
+	ProviderRef string
+	AmountCents int64
+	Reason      string
+	Payload     []byte
+}
+
+// Provider is a payment gateway. ParseWebhook must reject requests whose
+// signature does not verify with ErrInvalidSignature, and signed requests it
+// cannot make sense of with an error wrapping ErrInvalidWebhook.
+type Provider interface {
+	Name() string
+	CreateCharge(ctx context.Context, req ChargeRequest) (*Charge, error)
+	ParseWebhook(header http.Header, body []byte) (*WebhookEvent, error)
+}
+
+// Sign returns the hex HMAC-SHA256 of body under secret, prefixed with
+// "sha256=" as sent in signature headers.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature checks signature against Sign(secret, body) in constant time.
+func VerifySignature(secret string, body []byte, signature string) error {
+	if secret == "" || !strings.HasPrefix(signature, "sha256=") {
+		return ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(Sign(secret, body)), []byte(strings.TrimSpace(signature))) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCRC16CCITT(t *testing.T) {
+	if got := crc16CCITT([]byte("123456789")); got != 0x29B1 {
+		t.Fatalf("crc16 check value = %04X, want 29B1", got)
+	}
+}
+
+func TestPixPayload(t *testing.T) {
+	payload := PixPayload{
+		Key:          "pix@example.com",
+		MerchantName: "João da Silva Comércio e Serviços",
+		MerchantCity: "São Paulo",
+		AmountCents:  1050,
+		TxID:         "ORDER 42",
+	}.String()
+
+	for _, want := range []string{"000201", "0014br.gov.bcb.pix0115pix@example.com", "540510.50", "5924Joao da Silva Comercio e6009", "6009Sao Paulo", "62110507ORDER42"} {
+		if !strings.Contains(payload, want) {
+			t.Fatalf("payload %q missing %q", payload, want)
+		}
+	}
+
+	body, crc := payload[:len(payload)-4], payload[len(payload)-4:]
+	if !strings.HasSuffix(body, "6304") || crc != fmt.Sprintf("%04X", crc16CCITT([]byte(body))) {
+		t.Fatalf("bad checksum in %q", payload)
+	}
+}
+
+func TestBoletoDueFactor(t *testing.T) {
+	cases := map[string]int{
+		"2000-07-03": 1000,
+		"2025-02-21": 9999,
+		"2025-02-22": 1000,
+		"2025-02-23": 1001,
+	}
+	for day, want := range cases {
+		due, _ := time.Parse("2006-01-02", day)
+		if got := boletoDueFactor(due); got != want {
+			t.Errorf("factor(%s) = %d, want %d", day, got, want)
+		}
+	}
+}
+
+func TestBoletoLineNumber(t *testing.T) {
+	b := Boleto{
+		BankCode:    "001",
+		DueDate:     time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC),
+		AmountCents: 12345,
+		FreeField:   fmt.Sprintf("%025d", 42),
+	}
+
+	code, err := b.Barcode()
+	if err != nil {
+		t.Fatalf("barcode: %v", err)
+	}
+	if len(code) != 44 {
+		t.Fatalf("barcode length = %d", len(code))
+	}
+	if dv := mod11(code[:4] + code[5:]); fmt.Sprint(dv) != code[4:5] {
+		t.Fatalf("general check digit %s, want %d", code[4:5], dv)
+	}
+
+	line, err := b.LineNumber()
+	if err != nil {
+		t.Fatalf("line: %v", err)
+	}
+	digits := strings.NewReplacer(".", "", " ", "").Replace(line)
+	if len(digits) != 47 {
+		t.Fatalf("line %q has %d digits", line, len(digits))
+	}
+	for _, field := range [][2]int{{0, 10}, {10, 21}, {21, 32}} {
+		f := digits[field[0]:field[1]]
+		if fmt.Sprint(mod10(f[:len(f)-1])) != f[len(f)-1:] {
+			t.Fatalf("field %q has a bad check digit", f)
+		}
+	}
+	if !strings.HasSuffix(digits, "10070000012345") {
+		t.Fatalf("line %q does not end in factor and amount", line)
+	}
+}
+
+func TestFakeProviderWebhookSignature(t *testing.T) {
+	p := &FakeProvider{Secret: "s3cret", BankCode: "001", BoletoDays: 3}
+
+	charge, err := p.CreateCharge(context.Background(), ChargeRequest{OrderID: 7, Method: "BOLETO", AmountCents: 990})
+	if err != nil {
+		t.Fatalf("create charge: %v", err)
+	}
+	if charge.BoletoLine == "" || charge.ExpiresAt == nil {
+		t.Fatalf("boleto charge missing line or expiry: %+v", charge)
+	}
+
+	header, body, err := p.SimulateWebhook(charge.ProviderRef, EventPaymentConfirmed, 990, "")
+	if err != nil {
+		t.Fatalf("simulate: %v", err)
+	}
+
+	event, err := p.ParseWebhook(header, body)
+	if err != nil {
+		t.Fatalf("parse signed webhook: %v", err)
+	}
+	if event.ProviderRef != charge.ProviderRef || event.Type != EventPaymentConfirmed || event.AmountCents != 990 {
+		t.Fatalf("unexpected event %+v", event)
+	}
+
+	tampered := []byte(strings.Replace(string(body), EventPaymentConfirmed, EventPaymentFailed, 1))
+	if _, err := p.ParseWebhook(header, tampered); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("tampered body: err = %v, want ErrInvalidSignature", err)
+	}
+
+	unpriced := []byte(`{"id":"evt_1","type":"payment.confirmed","charge_id":"` + charge.ProviderRef + `"}`)
+	header.Set(FakeSignatureHeader, Sign(p.Secret, unpriced))
+	if _, err := p.ParseWebhook(header, unpriced); !errors.Is(err, ErrInvalidWebhook) {
+		t.Fatalf("confirmation without amount: err = %v, want ErrInvalidWebhook", err)
+	}
+}
+
+func TestFakePixChargeExpiresWithOrder(t *testing.T) {
+	p := &FakeProvider{PixKey: "pix@example.com", MerchantName: "Loja", MerchantCity: "Recife"}
+	deadline := time.Now().Add(30 * time.Minute)
+
+	charge, err := p.CreateCharge(context.Background(), ChargeRequest{OrderID: 7, Method: "PIX", AmountCents: 990, ExpiresAt: &deadline})
+	if err != nil {
+		t.Fatalf("create charge: %v", err)
+	}
+	if charge.PixPayload == "" {
+		t.Fatalf("pix charge missing payload: %+v", charge)
+	}
+	if charge.ExpiresAt == nil || !charge.ExpiresAt.Equal(deadline) {
+		t.Errorf("expires_at = %v, want %v", charge.ExpiresAt, deadline)
+	}
+	if charge.Captured {
+		t.Error("pix charge captured before the payer paid it")
+	}
+}
+
+func TestFakeProviderCapturesCardCharges(t *testing.T) {
+	p := &FakeProvider{}
+
+	charge, err := p.CreateCharge(context.Background(), ChargeRequest{OrderID: 7, Method: "CARD", AmountCents: 990})
+	if err != nil {
+		t.Fatalf("create charge: %v", err)
+	}
+	if !charge.Captured {
+		t.Errorf("card charge not captured: %+v", charge)
+	}
+}
@@ -0,0 +1,218 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Enilsonn/CRUD-Postgres/internal/model"
+	"github.com/lib/pq"
+)
+
+var ErrAlertNotFound = NotFoundf("balance alert not found")
+
+type AlertRepository struct {
+	db *sql.DB
+}
+
+func NewAlertRepository(db *sql.DB) *AlertRepository {
+	return &AlertRepository{db: db}
+}
+
+const alertColumns = `client_id, threshold_credits, COALESCE(webhook_url, ''), COALESCE(email, ''), auto_recharge_plan_id,
+	max_recharges_per_day, cooldown_minutes, enabled, armed, last_triggered_at, updated_at`
+
+func scanAlert(row interface{ Scan(...any) error }) (*model.BalanceAlert, error) {
+	alert := &model.BalanceAlert{}
+	err := row.Scan(
+		&alert.ClientID,
+		&alert.ThresholdCredits,
+		&alert.WebhookURL,
+		&alert.Email,
+		&alert.AutoRechargePlanID,
+		&alert.MaxRechargesPerDay,
+		&alert.CooldownMinutes,
+		&alert.Enabled,
+		&alert.Armed,
+		&alert.LastTriggeredAt,
+		&alert.UpdatedAt,
+	)
+	return alert, err
+}
+
+func (r *AlertRepository) Get(ctx context.Context, clientID int64) (*model.BalanceAlert, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	alert, err := scanAlert(r.db.QueryRowContext(ctx, `SELECT `+alertColumns+` FROM balance_alerts WHERE client_id = $1`, clientID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrAlertNotFound
+		}
+		return nil, fmt.Errorf("query balance alert for client %d: %w", clientID, err)
+	}
+
+	return alert, nil
+}
+
+// Upsert saves the alert settings and re-arms it, so a changed threshold is
+// evaluated fresh on the next balance check.
+func (r *AlertRepository) Upsert(ctx context.Context, alert *model.BalanceAlert) (*model.BalanceAlert, error) {
+	if alert == nil {
+		return nil, fmt.Errorf("alert payload is required")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	saved, err := scanAlert(r.db.QueryRowContext(ctx, `INSERT INTO balance_alerts
+			(client_id, threshold_credits, webhook_url, email, auto_recharge_plan_id, max_recharges_per_day, cooldown_minutes, enabled)
+		VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), $5, $6, $7, $8)
+		ON CONFLICT (client_id) DO UPDATE SET
+			threshold_credits = EXCLUDED.threshold_credits,
+			webhook_url = EXCLUDED.webhook_url,
+			email = EXCLUDED.email,
+			auto_recharge_plan_id = EXCLUDED.auto_recharge_plan_id,
+			max_recharges_per_day = EXCLUDED.max_recharges_per_day,
+			cooldown_minutes = EXCLUDED.cooldown_minutes,
+			enabled = EXCLUDED.enabled,
+			armed = true,
+			updated_at = NOW()
+		RETURNING `+alertColumns,
+		alert.ClientID,
+		alert.ThresholdCredits,
+		alert.WebhookURL,
+		alert.Email,
+		alert.AutoRechargePlanID,
+		alert.MaxRechargesPerDay,
+		alert.CooldownMinutes,
+		alert.Enabled,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("save balance alert for client %d: %w", alert.ClientID, err)
+	}
+
+	return saved, nil
+}
+
+// Claim decides, under a row lock, whether the balance should fire the alert.
+// A fired alert disarms until the balance climbs back to the threshold, and
+// never fires twice inside its cooldown, so bursts of usage notify once.
+// Credits re-arm it through the wallets trigger as they land; Claim re-arms
+// too, for alerts disarmed before that trigger existed.
+func (r *AlertRepository) Claim(ctx context.Context, clientID, balance int64, now time.Time) (*model.BalanceAlert, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, false, fmt.Errorf("begin alert claim: %w", err)
+	}
+	defer tx.Rollback()
+
+	alert, err := scanAlert(tx.QueryRowContext(ctx, `SELECT `+alertColumns+` FROM balance_alerts WHERE client_id = $1 FOR UPDATE`, clientID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("lock balance alert for client %d: %w", clientID, err)
+	}
+
+	if !alert.Enabled {
+		return alert, false, nil
+	}
+
+	if balance >= alert.ThresholdCredits {
+		if !alert.Armed {
+			if _, err := tx.ExecContext(ctx, `UPDATE balance_alerts SET armed = true WHERE client_id = $1`, clientID); err != nil {
+				return nil, false, fmt.Errorf("re-arm balance alert for client %d: %w", clientID, err)
+			}
+			if err := tx.Commit(); err != nil {
+				return nil, false, fmt.Errorf("commit alert re-arm: %w", err)
+			}
+			alert.Armed = true
+		}
+		return alert, false, nil
+	}
+
+	if !alert.Armed {
+		return alert, false, nil
+	}
+	if alert.LastTriggeredAt != nil && now.Sub(*alert.LastTriggeredAt) < time.Duration(alert.CooldownMinutes)*time.Minute {
+		return alert, false, nil
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE balance_alerts SET armed = false, last_triggered_at = $2 WHERE client_id = $1`, clientID, now.UTC()); err != nil {
+		return nil, false, fmt.Errorf("disarm balance alert for client %d: %w", clientID, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, false, fmt.Errorf("commit alert claim: %w", err)
+	}
+
+	alert.Armed = false
+	alert.LastTriggeredAt = &now
+	return alert, true, nil
+}
+
+func (r *AlertRepository) RecordEvent(ctx context.Context, clientID int64, kind, status string, detail map[string]any) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	payload, err := json.Marshal(detail)
+	if err != nil {
+		return fmt.Errorf("encode alert event detail: %w", err)
+	}
+
+	if _, err := r.db.ExecContext(ctx, `INSERT INTO balance_alert_events (client_id, kind, status, detail) VALUES ($1, $2, $3, $4)`,
+		clientID, kind, status, payload); err != nil {
+		return fmt.Errorf("insert alert event: %w", err)
+	}
+
+	return nil
+}
+
+// CountEventsSince counts the client's events of kind, in any of statuses,
+// recorded at or after since.
+func (r *AlertRepository) CountEventsSince(ctx context.Context, clientID int64, kind string, since time.Time, statuses ...string) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var count int
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM balance_alert_events
+		WHERE client_id = $1 AND kind = $2 AND status = ANY($3) AND created_at >= $4`,
+		clientID, kind, pq.Array(statuses), since.UTC()).Scan(&count); err != nil {
+		return 0, fmt.Errorf("count alert events: %w", err)
+	}
+
+	return count, nil
+}
+
+func (r *AlertRepository) ListEvents(ctx context.Context, clientID int64, limit int) ([]model.BalanceAlertEvent, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `SELECT id, client_id, kind, status, detail, created_at
+		FROM balance_alert_events WHERE client_id = $1
+		ORDER BY created_at DESC, id DESC LIMIT $2`, clientID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list alert events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []model.BalanceAlertEvent
+	for rows.Next() {
+		var (
+			event  model.BalanceAlertEvent
+			detail []byte
+		)
+		if err := rows.Scan(&event.ID, &event.ClientID, &event.Kind, &event.Status, &detail, &event.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan alert event: %w", err)
+		}
+		event.Detail = json.RawMessage(detail)
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
@@ -0,0 +1,33 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidInput and ErrNotFound classify errors that have no sentinel of
+// their own, so handlers can answer 400 and 404 with errors.Is instead of
+// reading messages. Build them with Invalidf and NotFoundf.
+var (
+	ErrInvalidInput = errors.New("invalid input")
+	ErrNotFound     = errors.New("not found")
+)
+
+type kindError struct {
+	err  error
+	kind error
+}
+
+func (e *kindError) Error() string   { return e.err.Error() }
+func (e *kindError) Unwrap() []error { return []error{e.err, e.kind} }
+
+// Invalidf formats an error that matches ErrInvalidInput. The message is the
+// formatted text alone, and %w verbs still wrap as in fmt.Errorf.
+func Invalidf(format string, args ...any) error {
+	return &kindError{err: fmt.Errorf(format, args...), kind: ErrInvalidInput}
+}
+
+// NotFoundf formats an error that matches ErrNotFound, like Invalidf.
+func NotFoundf(format string, args ...any) error {
+	return &kindError{err: fmt.Errorf(format, args...), kind: ErrNotFound}
+}
@@ -0,0 +1,26 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestKindErrorsKeepMessageAndChain(t *testing.T) {
+	cause := errors.New("bad pattern")
+	err := fmt.Errorf("upsert rule: %w", Invalidf("invalid pricing pattern %q: %w", "gpt-*", cause))
+
+	if !errors.Is(err, ErrInvalidInput) || !errors.Is(err, cause) {
+		t.Errorf("%v should match both ErrInvalidInput and its cause", err)
+	}
+	if errors.Is(err, ErrNotFound) {
+		t.Errorf("%v should not match ErrNotFound", err)
+	}
+	if want := `upsert rule: invalid pricing pattern "gpt-*": bad pattern`; err.Error() != want {
+		t.Errorf("message = %q, want %q", err.Error(), want)
+	}
+
+	if !errors.Is(fmt.Errorf("get order: %w", ErrOrderNotFound), ErrNotFound) {
+		t.Error("specific not-found sentinels should match ErrNotFound")
+	}
+}
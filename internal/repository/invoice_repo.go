@@ -0,0 +1,406 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Enilsonn/CRUD-Postgres/internal/model"
+)
+
+const (
+	InvoiceDraft  = "DRAFT"
+	InvoiceIssued = "ISSUED"
+	InvoicePaid   = "PAID"
+	InvoiceVoid   = "VOID"
+
+	InvoiceLineOrder    = "ORDER"
+	InvoiceLineDiscount = "DISCOUNT"
+	InvoiceLinePostpaid = "POSTPAID_USAGE"
+)
+
+var (
+	ErrInvoiceNotFound  = NotFoundf("invoice not found")
+	ErrInvoiceFinalized = errors.New("invoice already issued for this period")
+	ErrInvoiceStatus    = errors.New("invoice status does not allow this change")
+	ErrNothingToInvoice = errors.New("nothing to invoice for this period")
+)
+
+type InvoiceRepository struct {
+	db *sql.DB
+}
+
+func NewInvoiceRepository(db *sql.DB) *InvoiceRepository {
+	return &InvoiceRepository{db: db}
+}
+
+// InvoiceRates are the prices applied when a draft is built.
+type InvoiceRates struct {
+	TaxRateBP                int
+	PostpaidCreditPriceCents int64
+}
+
+const invoiceColumns = `i.id, i.client_id, c.name, COALESCE(i.number, ''), i.period_start, i.period_end, i.status::text, i.currency,
+	i.subtotal_cents, i.tax_rate_bp, i.tax_cents, i.total_cents, i.created_at, i.issued_at, i.paid_at, i.voided_at`
+
+func scanInvoice(row interface{ Scan(...any) error }) (*model.Invoice, error) {
+	inv := &model.Invoice{}
+	err := row.Scan(
+		&inv.ID,
+		&inv.ClientID,
+		&inv.ClientName,
+		&inv.Number,
+		&inv.PeriodStart,
+		&inv.PeriodEnd,
+		&inv.Status,
+		&inv.Currency,
+		&inv.SubtotalCents,
+		&inv.TaxRateBP,
+		&inv.TaxCents,
+		&inv.TotalCents,
+		&inv.CreatedAt,
+		&inv.IssuedAt,
+		&inv.PaidAt,
+		&inv.VoidedAt,
+	)
+	return inv, err
+}
+
+// ClientsToInvoice lists clients with orders confirmed or postpaid usage drawn
+// in [from, to).
+func (r *InvoiceRepository) ClientsToInvoice(ctx context.Context, from, to time.Time) ([]int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `SELECT client_id FROM orders
+		WHERE payment_status = 'CONFIRMED' AND confirmed_at >= $1 AND confirmed_at < $2
+		UNION
+		SELECT client_id FROM credit_ledger
+		WHERE type = 'USAGE' AND meta ? 'overdraft_credits' AND created_at >= $1 AND created_at < $2
+		ORDER BY client_id`, from.UTC(), to.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("list clients to invoice: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("scan client to invoice: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// GenerateDraft builds (or rebuilds) the client's DRAFT invoice for [from, to)
+// from orders confirmed and unsettled postpaid usage drawn in the period.
+func (r *InvoiceRepository) GenerateDraft(ctx context.Context, clientID int64, from, to time.Time, rates InvoiceRates) (*model.Invoice, error) {
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin generate invoice: %w", err)
+	}
+	defer tx.Rollback()
+
+	var (
+		invoiceID int64
+		status    string
+	)
+	err = tx.QueryRowContext(ctx, `SELECT id, status::text FROM invoices
+		WHERE client_id = $1 AND period_start = $2 AND status <> 'VOID'
+		FOR UPDATE`, clientID, from.UTC()).Scan(&invoiceID, &status)
+	switch {
+	case err == sql.ErrNoRows:
+		err = tx.QueryRowContext(ctx, `INSERT INTO invoices (client_id, period_start, period_end, tax_rate_bp)
+			VALUES ($1, $2, $3, $4) RETURNING id`, clientID, from.UTC(), to.UTC(), rates.TaxRateBP).Scan(&invoiceID)
+		if err != nil {
+			return nil, fmt.Errorf("insert invoice: %w", err)
+		}
+	case err != nil:
+		return nil, fmt.Errorf("lock invoice: %w", err)
+	case status != InvoiceDraft:
+		return nil, ErrInvoiceFinalized
+	default:
+		if _, err := tx.ExecContext(ctx, `DELETE FROM invoice_lines WHERE invoice_id = $1`, invoiceID); err != nil {
+			return nil, fmt.Errorf("clear draft invoice lines: %w", err)
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `INSERT INTO invoice_lines (invoice_id, kind, description, quantity, unit_price_cents, amount_cents, order_id, plan_id)
+		SELECT $1, 'ORDER', 'Order #' || o.id || ' - ' || p.plan_name, oi.quantity, oi.unit_price_cents,
+		       oi.quantity * oi.unit_price_cents, o.id, p.id
+		FROM orders o
+		JOIN order_items oi ON oi.order_id = o.id
+		JOIN plans p ON p.id = oi.plan_id
+		WHERE o.client_id = $2 AND o.payment_status = 'CONFIRMED' AND o.confirmed_at >= $3 AND o.confirmed_at < $4
+		ORDER BY o.id, oi.id`, invoiceID, clientID, from.UTC(), to.UTC()); err != nil {
+		return nil, fmt.Errorf("insert order invoice lines: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `INSERT INTO invoice_lines (invoice_id, kind, description, quantity, unit_price_cents, amount_cents, order_id)
+		SELECT $1, 'DISCOUNT', 'Discount on order #' || o.id, 1, -o.discount_cents, -o.discount_cents, o.id
+		FROM orders o
+		WHERE o.client_id = $2 AND o.payment_status = 'CONFIRMED' AND o.confirmed_at >= $3 AND o.confirmed_at < $4
+		  AND o.discount_cents > 0
+		ORDER BY o.id`, invoiceID, clientID, from.UTC(), to.UTC()); err != nil {
+		return nil, fmt.Errorf("insert discount invoice lines: %w", err)
+	}
+
+	// Only overdraft that is still owed at period end is billed; whatever a
+	// top-up already settled was paid for through that top-up.
+	var overdraft, closing int64
+	if err := tx.QueryRowContext(ctx, `SELECT
+			COALESCE(SUM((meta->>'overdraft_credits')::bigint) FILTER (WHERE type = 'USAGE' AND created_at >= $2), 0),
+			COALESCE(SUM(credits_delta), 0)
+		FROM credit_ledger
+		WHERE client_id = $1 AND created_at < $3`, clientID, from.UTC(), to.UTC()).Scan(&overdraft, &closing); err != nil {
+		return nil, fmt.Errorf("sum postpaid usage: %w", err)
+	}
+	if owed := min(overdraft, max(-closing, 0)); owed > 0 {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO invoice_lines (invoice_id, kind, description, quantity, unit_price_cents, amount_cents)
+			VALUES ($1, 'POSTPAID_USAGE', 'Postpaid usage (credits drawn on credit line)', $2, $3, $4)`,
+			invoiceID, owed, rates.PostpaidCreditPriceCents, owed*rates.PostpaidCreditPriceCents); err != nil {
+			return nil, fmt.Errorf("insert postpaid invoice line: %w", err)
+		}
+	}
+
+	var (
+		lines    int
+		subtotal int64
+	)
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*), COALESCE(SUM(amount_cents), 0) FROM invoice_lines WHERE invoice_id = $1`,
+		invoiceID).Scan(&lines, &subtotal); err != nil {
+		return nil, fmt.Errorf("sum invoice lines: %w", err)
+	}
+	if lines == 0 {
+		return nil, ErrNothingToInvoice
+	}
+
+	// Tax is rounded half up to the cent.
+	tax := (subtotal*int64(rates.TaxRateBP) + 5000) / 10000
+	if _, err := tx.ExecContext(ctx, `UPDATE invoices
+		SET subtotal_cents = $2, tax_rate_bp = $3, tax_cents = $4, total_cents = $5
+		WHERE id = $1`, invoiceID, subtotal, rates.TaxRateBP, tax, subtotal+tax); err != nil {
+		return nil, fmt.Errorf("update invoice totals: %w", err)
+	}
+
+	inv, err := getInvoice(ctx, tx, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit generate invoice: %w", err)
+	}
+
+	return inv, nil
+}
+
+// ClientOf returns the id of the client an invoice bills.
+func (r *InvoiceRepository) ClientOf(ctx context.Context, id int64) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var clientID int64
+	if err := r.db.QueryRowContext(ctx, `SELECT client_id FROM invoices WHERE id = $1`, id).Scan(&clientID); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, ErrInvoiceNotFound
+		}
+		return 0, fmt.Errorf("query invoice %d: %w", id, err)
+	}
+	return clientID, nil
+}
+
+func (r *InvoiceRepository) GetByID(ctx context.Context, id int64) (*model.Invoice, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("begin read invoice: %w", err)
+	}
+	defer tx.Rollback()
+
+	return getInvoice(ctx, tx, id)
+}
+
+func getInvoice(ctx context.Context, tx *sql.Tx, id int64) (*model.Invoice, error) {
+	inv, err := scanInvoice(tx.QueryRowContext(ctx, `SELECT `+invoiceColumns+`
+		FROM invoices i JOIN clients c ON c.id = i.client_id
+		WHERE i.id = $1`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrInvoiceNotFound
+		}
+		return nil, fmt.Errorf("query invoice %d: %w", id, err)
+	}
+
+	rows, err := tx.QueryContext(ctx, `SELECT id, kind, description, quantity, unit_price_cents, amount_cents, order_id, plan_id
+		FROM invoice_lines WHERE invoice_id = $1 ORDER BY id`, id)
+	if err != nil {
+		return nil, fmt.Errorf("query invoice lines: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var line model.InvoiceLine
+		if err := rows.Scan(&line.ID, &line.Kind, &line.Description, &line.Quantity, &line.UnitPriceCents, &line.AmountCents, &line.OrderID, &line.PlanID); err != nil {
+			return nil, fmt.Errorf("scan invoice line: %w", err)
+		}
+		inv.Lines = append(inv.Lines, line)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate invoice lines: %w", err)
+	}
+
+	return inv, nil
+}
+
+func (r *InvoiceRepository) ListByClient(ctx context.Context, clientID int64) ([]*model.Invoice, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `SELECT `+invoiceColumns+`
+		FROM invoices i JOIN clients c ON c.id = i.client_id
+		WHERE i.client_id = $1
+		ORDER BY i.period_start DESC, i.id DESC`, clientID)
+	if err != nil {
+		return nil, fmt.Errorf("list invoices for client %d: %w", clientID, err)
+	}
+	defer rows.Close()
+
+	var invoices []*model.Invoice
+	for rows.Next() {
+		inv, err := scanInvoice(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan invoice: %w", err)
+		}
+		invoices = append(invoices, inv)
+	}
+
+	return invoices, rows.Err()
+}
+
+// Issue freezes a draft and gives it the next number of the year it is
+// issued in. Numbers come from a counter row updated in the same transaction,
+// so they are gapless.
+func (r *InvoiceRepository) Issue(ctx context.Context, id int64, now time.Time) (*model.Invoice, error) {
+	return r.transition(ctx, id, []string{InvoiceDraft}, func(tx *sql.Tx) error {
+		var seq int
+		year := now.UTC().Year()
+		if err := tx.QueryRowContext(ctx, `INSERT INTO invoice_counters (year, last_number) VALUES ($1, 1)
+			ON CONFLICT (year) DO UPDATE SET last_number = invoice_counters.last_number + 1
+			RETURNING last_number`, year).Scan(&seq); err != nil {
+			return fmt.Errorf("allocate invoice number: %w", err)
+		}
+
+		if _, err := tx.ExecContext(ctx, `UPDATE invoices SET status = 'ISSUED', number = $2, issued_at = $3 WHERE id = $1`,
+			id, fmt.Sprintf("INV-%d-%06d", year, seq), now.UTC()); err != nil {
+			return fmt.Errorf("issue invoice %d: %w", id, err)
+		}
+		return nil
+	})
+}
+
+// MarkPaid records payment of an issued invoice. Postpaid usage billed on it
+// is credited back to the wallet, which settles the matching debt.
+func (r *InvoiceRepository) MarkPaid(ctx context.Context, id int64, now time.Time) (*model.Invoice, error) {
+	return r.transition(ctx, id, []string{InvoiceIssued}, func(tx *sql.Tx) error {
+		var (
+			clientID       int64
+			number         string
+			credits, cents int64
+		)
+		if err := tx.QueryRowContext(ctx, `SELECT i.client_id, i.number,
+				COALESCE(SUM(l.quantity) FILTER (WHERE l.kind = 'POSTPAID_USAGE'), 0),
+				COALESCE(SUM(l.amount_cents) FILTER (WHERE l.kind = 'POSTPAID_USAGE'), 0)
+			FROM invoices i LEFT JOIN invoice_lines l ON l.invoice_id = i.id
+			WHERE i.id = $1
+			GROUP BY i.client_id, i.number`, id).Scan(&clientID, &number, &credits, &cents); err != nil {
+			return fmt.Errorf("sum postpaid lines of invoice %d: %w", id, err)
+		}
+
+		if credits > 0 {
+			// Debt may have been settled by a top-up since the invoice was
+			// issued; the client still paid for these credits, so they stay.
+			if _, err := grantCredits(ctx, tx, creditGrant{
+				clientID:   clientID,
+				credits:    credits,
+				priceCents: cents,
+				lotSource:  "INVOICE",
+				meta: map[string]any{
+					"type":           "invoice_payment",
+					"invoice_id":     id,
+					"invoice_number": number,
+				},
+			}); err != nil {
+				return err
+			}
+		}
+
+		if _, err := tx.ExecContext(ctx, `UPDATE invoices SET status = 'PAID', paid_at = $2 WHERE id = $1`, id, now.UTC()); err != nil {
+			return fmt.Errorf("mark invoice %d paid: %w", id, err)
+		}
+		return nil
+	})
+}
+
+func (r *InvoiceRepository) Void(ctx context.Context, id int64, now time.Time) (*model.Invoice, error) {
+	return r.transition(ctx, id, []string{InvoiceDraft, InvoiceIssued}, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `UPDATE invoices SET status = 'VOID', voided_at = $2 WHERE id = $1`, id, now.UTC()); err != nil {
+			return fmt.Errorf("void invoice %d: %w", id, err)
+		}
+		return nil
+	})
+}
+
+// transition locks the invoice, checks its status is one of from, runs apply
+// and returns the reloaded invoice.
+func (r *InvoiceRepository) transition(ctx context.Context, id int64, from []string, apply func(tx *sql.Tx) error) (*model.Invoice, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin invoice transition: %w", err)
+	}
+	defer tx.Rollback()
+
+	var status string
+	if err := tx.QueryRowContext(ctx, `SELECT status::text FROM invoices WHERE id = $1 FOR UPDATE`, id).Scan(&status); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrInvoiceNotFound
+		}
+		return nil, fmt.Errorf("lock invoice %d: %w", id, err)
+	}
+
+	allowed := false
+	for _, s := range from {
+		allowed = allowed || s == status
+	}
+	if !allowed {
+		return nil, fmt.Errorf("%w: invoice %d is %s", ErrInvoiceStatus, id, status)
+	}
+
+	if err := apply(tx); err != nil {
+		return nil, err
+	}
+
+	inv, err := getInvoice(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit invoice transition: %w", err)
+	}
+
+	return inv, nil
+}
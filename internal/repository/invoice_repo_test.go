@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func invoiceRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "client_id", "name", "number", "period_start", "period_end", "status", "currency",
+		"subtotal_cents", "tax_rate_bp", "tax_cents", "total_cents", "created_at", "issued_at", "paid_at", "voided_at"})
+}
+
+func TestGenerateDraftBillsOrdersByConfirmationTime(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	from := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, 0)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT id, status::text FROM invoices`).WithArgs(int64(7), from).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status"}))
+	mock.ExpectQuery(`INSERT INTO invoices`).WithArgs(int64(7), from, to, 1000).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(9))
+	mock.ExpectExec(`'ORDER'.*o\.confirmed_at >= \$3 AND o\.confirmed_at < \$4`).
+		WithArgs(int64(9), int64(7), from, to).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`'DISCOUNT'.*o\.confirmed_at >= \$3 AND o\.confirmed_at < \$4`).
+		WithArgs(int64(9), int64(7), from, to).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`FROM credit_ledger`).WithArgs(int64(7), from, to).
+		WillReturnRows(sqlmock.NewRows([]string{"overdraft", "closing"}).AddRow(0, 0))
+	mock.ExpectQuery(`SELECT COUNT\(\*\), COALESCE\(SUM\(amount_cents\), 0\) FROM invoice_lines`).WithArgs(int64(9)).
+		WillReturnRows(sqlmock.NewRows([]string{"count", "sum"}).AddRow(1, 1005))
+	// 10% of 10.05 is 1.005, rounded half up to 1.01.
+	mock.ExpectExec(`UPDATE invoices`).WithArgs(int64(9), int64(1005), 1000, int64(101), int64(1106)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`FROM invoices i JOIN clients c`).WithArgs(int64(9)).
+		WillReturnRows(invoiceRows().AddRow(9, 7, "Ana", "", from, to, InvoiceDraft, "BRL", 1005, 1000, 101, 1106, time.Now(), nil, nil, nil))
+	mock.ExpectQuery(`FROM invoice_lines WHERE invoice_id = \$1`).WithArgs(int64(9)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "kind", "description", "quantity", "unit_price_cents", "amount_cents", "order_id", "plan_id"}).
+			AddRow(1, InvoiceLineOrder, "Order #3 - Basic", 1, 1005, 1005, 3, 2))
+	mock.ExpectCommit()
+
+	inv, err := NewInvoiceRepository(db).GenerateDraft(context.Background(), 7, from, to, InvoiceRates{TaxRateBP: 1000})
+	if err != nil {
+		t.Fatalf("GenerateDraft: %v", err)
+	}
+	if inv.TotalCents != 1106 || len(inv.Lines) != 1 {
+		t.Errorf("invoice = %+v, want total 1106 with one line", inv)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGenerateDraftRefusesIssuedInvoice(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	from := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT id, status::text FROM invoices`).WithArgs(int64(7), from).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status"}).AddRow(9, InvoiceIssued))
+	mock.ExpectRollback()
+
+	_, err = NewInvoiceRepository(db).GenerateDraft(context.Background(), 7, from, from.AddDate(0, 1, 0), InvoiceRates{})
+	if !errors.Is(err, ErrInvoiceFinalized) {
+		t.Errorf("err = %v, want ErrInvoiceFinalized", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestInvoiceTransitionChecksStatus(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT status::text FROM invoices WHERE id = \$1 FOR UPDATE`).WithArgs(int64(9)).
+		WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(InvoicePaid))
+	mock.ExpectRollback()
+
+	// A paid invoice must not draw a number from the counter.
+	if _, err := NewInvoiceRepository(db).Issue(context.Background(), 9, time.Now()); !errors.Is(err, ErrInvoiceStatus) {
+		t.Errorf("err = %v, want ErrInvoiceStatus", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strings"
@@ -13,20 +14,153 @@ import (
 )
 
 var (
-	ErrOrderNotFound     = errors.New("order not found")
+	ErrOrderNotFound     = NotFoundf("order not found")
 	ErrOrderWithoutItems = errors.New("order must contain at least one item")
 	ErrInsufficientStock = errors.New("insufficient stock")
+	ErrOrderNotPending   = errors.New("order is not pending")
+	ErrOrderCheckedOut   = errors.New("order is already checked out")
+	ErrOrderItemNotFound = NotFoundf("order item not found")
+)
+
+const (
+	PriceLockItem     = "ITEM"
+	PriceLockCheckout = "CHECKOUT"
 )
 
 type OrderRepository struct {
 	db *sql.DB
 }
 
+// Columns orders can be sorted by. Both are paired with id so the order is total.
+const (
+	OrderSortCreatedAt = "created_at"
+	OrderSortTotal     = "total_cents"
+)
+
+// OrderFilters narrows back-office order reads. Nil or empty fields match everything.
+type OrderFilters struct {
+	Statuses       []string
+	PaymentMethods []string
+	ClientID       *int64
+	SellerID       *int64
+	From           *time.Time
+	To             *time.Time
+	MinTotalCents  *int64
+	MaxTotalCents  *int64
+}
+
+// OrderSort is the column and direction of an order listing.
+type OrderSort struct {
+	Field string
+	Desc  bool
+}
+
+// OrderCursor is the keyset position of the last order already returned.
+// Only the value of the sort column is meaningful.
+type OrderCursor struct {
+	CreatedAt  time.Time
+	TotalCents int64
+	ID         int64
+}
+
+// column maps Field onto a known column so it is safe to splice into SQL.
+func (s OrderSort) column() string {
+	if s.Field == OrderSortTotal {
+		return OrderSortTotal
+	}
+	return OrderSortCreatedAt
+}
+
+func (s OrderSort) orderBy() string {
+	if s.Desc {
+		return s.column() + " DESC, id DESC"
+	}
+	return s.column() + " ASC, id ASC"
+}
+
+func (f OrderFilters) where(argPos int) (string, []any) {
+	var (
+		clauses []string
+		args    []any
+	)
+
+	if len(f.Statuses) > 0 {
+		clauses = append(clauses, fmt.Sprintf("payment_status::text = ANY($%d)", argPos))
+		args = append(args, pq.Array(f.Statuses))
+		argPos++
+	}
+	if len(f.PaymentMethods) > 0 {
+		clauses = append(clauses, fmt.Sprintf("payment_method::text = ANY($%d)", argPos))
+		args = append(args, pq.Array(f.PaymentMethods))
+		argPos++
+	}
+	if f.ClientID != nil {
+		clauses = append(clauses, fmt.Sprintf("client_id = $%d", argPos))
+		args = append(args, *f.ClientID)
+		argPos++
+	}
+	if f.SellerID != nil {
+		clauses = append(clauses, fmt.Sprintf("seller_id = $%d", argPos))
+		args = append(args, *f.SellerID)
+		argPos++
+	}
+	if f.From != nil {
+		clauses = append(clauses, fmt.Sprintf("created_at >= $%d", argPos))
+		args = append(args, f.From.UTC())
+		argPos++
+	}
+	if f.To != nil {
+		clauses = append(clauses, fmt.Sprintf("created_at < $%d", argPos))
+		args = append(args, f.To.UTC())
+		argPos++
+	}
+	if f.MinTotalCents != nil {
+		clauses = append(clauses, fmt.Sprintf("total_cents >= $%d", argPos))
+		args = append(args, *f.MinTotalCents)
+		argPos++
+	}
+	if f.MaxTotalCents != nil {
+		clauses = append(clauses, fmt.Sprintf("total_cents <= $%d", argPos))
+		args = append(args, *f.MaxTotalCents)
+		argPos++
+	}
+
+	if len(clauses) == 0 {
+		return "TRUE", args
+	}
+	return strings.Join(clauses, " AND "), args
+}
+
 func NewOrderRepository(db *sql.DB) *OrderRepository {
 	return &OrderRepository{db: db}
 }
 
-func (r *OrderRepository) CreateOrder(ctx context.Context, o *model.Order) (int64, error) {
+const orderColumns = `id, client_id, seller_id, created_at, payment_method::text, payment_status::text,
+	subtotal_cents, discount_cents, total_cents, expires_at, COALESCE(cancel_reason, ''), canceled_at,
+	price_lock, checked_out_at`
+
+func scanOrder(row interface{ Scan(...any) error }) (*model.Order, error) {
+	order := &model.Order{}
+	err := row.Scan(
+		&order.ID,
+		&order.ClientID,
+		&order.SellerID,
+		&order.CreatedAt,
+		&order.PaymentMethod,
+		&order.PaymentStatus,
+		&order.SubtotalCents,
+		&order.DiscountCents,
+		&order.TotalCents,
+		&order.ExpiresAt,
+		&order.CancelReason,
+		&order.CanceledAt,
+		&order.PriceLock,
+		&order.CheckedOutAt,
+	)
+	return order, err
+}
+
+func (r *OrderRepository) CreateOrder(ctx context.Context, o *model.Order, actor string) (int64, error) {
 	if o == nil {
 		return 0, errors.New("order payload is nil")
 	}
@@ -43,17 +177,28 @@ func (r *OrderRepository) CreateOrder(ctx context.Context, o *model.Order) (int6
 	}
 	defer tx.Rollback()
 
+	if err := setOrderContext(ctx, tx, actor, ""); err != nil {
+		return 0, err
+	}
+
+	if o.PriceLock == "" {
+		o.PriceLock = PriceLockItem
+	}
+
 	var createdAt time.Time
-	err = tx.QueryRowContext(ctx, `INSERT INTO orders (client_id, seller_id, payment_method, payment_status)
-        VALUES ($1, $2, $3, 'PENDING')
+	err = tx.QueryRowContext(ctx, `INSERT INTO orders (client_id, seller_id, payment_method, payment_status, expires_at, price_lock)
+        VALUES ($1, $2, $3, 'PENDING', $4, $5)
         RETURNING id, created_at`,
-		o.ClientID, o.SellerID, o.PaymentMethod,
+		o.ClientID, o.SellerID, o.PaymentMethod, o.ExpiresAt, o.PriceLock,
 	).Scan(&o.ID, &createdAt)
 	if err != nil {
 		return 0, fmt.Errorf("insert order header: %w", err)
 	}
 
-	priceStmt, err := tx.PrepareContext(ctx, `SELECT price_cents FROM plans WHERE id = $1`)
+	// Locking the plan row serializes orders competing for its last units;
+	// each inserted item then reserves its quantity until the order leaves
+	// PENDING.
+	priceStmt, err := tx.PrepareContext(ctx, `SELECT price_cents, stock - reserved_stock FROM plans WHERE id = $1 FOR UPDATE`)
 	if err != nil {
 		return 0, fmt.Errorf("prepare price statement: %w", err)
 	}
@@ -70,16 +215,20 @@ func (r *OrderRepository) CreateOrder(ctx context.Context, o *model.Order) (int6
 	for idx := range o.Items {
 		item := &o.Items[idx]
 		if item.Quantity <= 0 {
-			return 0, fmt.Errorf("invalid quantity for plan %d", item.PlanID)
+			return 0, Invalidf("invalid quantity for plan %d", item.PlanID)
 		}
 
 		var price int64
-		if err := priceStmt.QueryRowContext(ctx, item.PlanID).Scan(&price); err != nil {
+		var available int
+		if err := priceStmt.QueryRowContext(ctx, item.PlanID).Scan(&price, &available); err != nil {
 			if err == sql.ErrNoRows {
-				return 0, fmt.Errorf("plan %d not found", item.PlanID)
+				return 0, NotFoundf("plan %d not found", item.PlanID)
 			}
 			return 0, fmt.Errorf("query plan price for plan %d: %w", item.PlanID, err)
 		}
+		if available < item.Quantity {
+			return 0, fmt.Errorf("plan %d has %d available: %w", item.PlanID, available, ErrInsufficientStock)
+		}
 
 		var itemID int64
 		if err := itemStmt.QueryRowContext(ctx, o.ID, item.PlanID, item.Quantity, price).Scan(&itemID); err != nil {
@@ -110,23 +259,199 @@ func (r *OrderRepository) CreateOrder(ctx context.Context, o *model.Order) (int6
 	return o.ID, nil
 }
 
+// AddItem puts quantity units of a plan into a PENDING cart at the plan's
+// current price. They merge into the plan's line only if it has that price;
+// a line kept at an older price by an ITEM lock stays as it is and the new
+// units get a line of their own.
+func (r *OrderRepository) AddItem(ctx context.Context, orderID, planID int64, quantity int, actor string) error {
+	return r.editCart(ctx, orderID, actor, func(tx *sql.Tx) error {
+		price, err := lockPlanFor(ctx, tx, planID, quantity)
+		if err != nil {
+			return err
+		}
+
+		res, err := tx.ExecContext(ctx, `UPDATE order_items SET quantity = quantity + $3
+			WHERE id = (SELECT id FROM order_items WHERE order_id = $1 AND plan_id = $2 AND unit_price_cents = $4 ORDER BY id LIMIT 1)`,
+			orderID, planID, quantity, price)
+		if err != nil {
+			return fmt.Errorf("update order item for plan %d: %w", planID, err)
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			return nil
+		}
+
+		if _, err := tx.ExecContext(ctx, `INSERT INTO order_items (order_id, plan_id, quantity, unit_price_cents)
+			VALUES ($1, $2, $3, $4)`, orderID, planID, quantity, price); err != nil {
+			return fmt.Errorf("insert order item for plan %d: %w", planID, err)
+		}
+		return nil
+	})
+}
+
+// UpdateItemQuantity sets the quantity of one line in a PENDING cart.
+func (r *OrderRepository) UpdateItemQuantity(ctx context.Context, orderID, itemID int64, quantity int, actor string) error {
+	return r.editCart(ctx, orderID, actor, func(tx *sql.Tx) error {
+		var planID int64
+		var current int
+		err := tx.QueryRowContext(ctx, `SELECT plan_id, quantity FROM order_items WHERE id = $1 AND order_id = $2 FOR UPDATE`,
+			itemID, orderID).Scan(&planID, &current)
+		if err == sql.ErrNoRows {
+			return ErrOrderItemNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("query order item %d: %w", itemID, err)
+		}
+
+		// Only growth needs stock; this line already reserves what it has.
+		if quantity > current {
+			if _, err := lockPlanFor(ctx, tx, planID, quantity-current); err != nil {
+				return err
+			}
+		}
+
+		if _, err := tx.ExecContext(ctx, `UPDATE order_items SET quantity = $2 WHERE id = $1`, itemID, quantity); err != nil {
+			return fmt.Errorf("update order item %d: %w", itemID, err)
+		}
+		return nil
+	})
+}
+
+// RemoveItem drops one line from a PENDING cart. The last line cannot be
+// removed; cancel the order instead.
+func (r *OrderRepository) RemoveItem(ctx context.Context, orderID, itemID int64, actor string) error {
+	return r.editCart(ctx, orderID, actor, func(tx *sql.Tx) error {
+		var count int
+		if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM order_items WHERE order_id = $1`, orderID).Scan(&count); err != nil {
+			return fmt.Errorf("count order items: %w", err)
+		}
+
+		res, err := tx.ExecContext(ctx, `DELETE FROM order_items WHERE id = $1 AND order_id = $2`, itemID, orderID)
+		if err != nil {
+			return fmt.Errorf("delete order item %d: %w", itemID, err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrOrderItemNotFound
+		}
+		if count <= 1 {
+			return ErrOrderWithoutItems
+		}
+		return nil
+	})
+}
+
+// Checkout fixes a PENDING order's prices and totals. Carts can no longer be
+// edited afterwards. Checking out twice is harmless.
+func (r *OrderRepository) Checkout(ctx context.Context, orderID int64, actor string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("begin checkout transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := setOrderContext(ctx, tx, actor, ""); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `SELECT sp_recalculate_order($1, true)`, orderID); err != nil {
+		return orderStateError("checkout", orderID, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit checkout of order %d: %w", orderID, err)
+	}
+
+	return nil
+}
+
+// editCart runs edit against a locked, PENDING, not yet checked out order
+// and recomputes its totals in the same transaction.
+func (r *OrderRepository) editCart(ctx context.Context, orderID int64, actor string, edit func(tx *sql.Tx) error) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("begin cart transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := setOrderContext(ctx, tx, actor, ""); err != nil {
+		return err
+	}
+
+	var status string
+	var checkedOutAt *time.Time
+	err = tx.QueryRowContext(ctx, `SELECT payment_status::text, checked_out_at FROM orders WHERE id = $1 FOR UPDATE`,
+		orderID).Scan(&status, &checkedOutAt)
+	if err == sql.ErrNoRows {
+		return ErrOrderNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("lock order %d: %w", orderID, err)
+	}
+	if status != "PENDING" {
+		return fmt.Errorf("order %d is %s: %w", orderID, status, ErrOrderNotPending)
+	}
+	if checkedOutAt != nil {
+		return fmt.Errorf("order %d: %w", orderID, ErrOrderCheckedOut)
+	}
+
+	if err := edit(tx); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `SELECT sp_recalculate_order($1, false)`, orderID); err != nil {
+		return orderStateError("recalculate", orderID, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit cart change: %w", err)
+	}
+
+	return nil
+}
+
+// lockPlanFor locks an active plan and checks that quantity more units are
+// available, returning its current price.
+func lockPlanFor(ctx context.Context, tx *sql.Tx, planID int64, quantity int) (int64, error) {
+	var price int64
+	var available int
+	err := tx.QueryRowContext(ctx, `SELECT price_cents, stock - reserved_stock FROM plans WHERE id = $1 AND status = true FOR UPDATE`,
+		planID).Scan(&price, &available)
+	if err == sql.ErrNoRows {
+		return 0, NotFoundf("plan %d not found", planID)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("query plan price for plan %d: %w", planID, err)
+	}
+	if available < quantity {
+		return 0, fmt.Errorf("plan %d has %d available: %w", planID, available, ErrInsufficientStock)
+	}
+	return price, nil
+}
+
+// ClientOf returns the id of the client an order belongs to.
+func (r *OrderRepository) ClientOf(ctx context.Context, id int64) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var clientID int64
+	if err := r.db.QueryRowContext(ctx, `SELECT client_id FROM orders WHERE id = $1`, id).Scan(&clientID); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, ErrOrderNotFound
+		}
+		return 0, fmt.Errorf("query order %d: %w", id, err)
+	}
+	return clientID, nil
+}
+
 func (r *OrderRepository) GetOrderByID(ctx context.Context, id int64) (*model.Order, error) {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	order := &model.Order{}
-	err := r.db.QueryRowContext(ctx, `SELECT id, client_id, seller_id, created_at, payment_method::text, payment_status::text, subtotal_cents, discount_cents, total_cents
-        FROM orders WHERE id = $1`, id).Scan(
-		&order.ID,
-		&order.ClientID,
-		&order.SellerID,
-		&order.CreatedAt,
-		&order.PaymentMethod,
-		&order.PaymentStatus,
-		&order.SubtotalCents,
-		&order.DiscountCents,
-		&order.TotalCents,
-	)
+	order, err := scanOrder(r.db.QueryRowContext(ctx, `SELECT `+orderColumns+` FROM orders WHERE id = $1`, id))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, ErrOrderNotFound
@@ -147,7 +472,7 @@ func (r *OrderRepository) ListOrdersByClient(ctx context.Context, clientID int64
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
-	rows, err := r.db.QueryContext(ctx, `SELECT id, client_id, seller_id, created_at, payment_method::text, payment_status::text, subtotal_cents, discount_cents, total_cents
+	rows, err := r.db.QueryContext(ctx, `SELECT `+orderColumns+`
         FROM orders WHERE client_id = $1 ORDER BY created_at DESC, id DESC`, clientID)
 	if err != nil {
 		return nil, fmt.Errorf("list orders for client %d: %w", clientID, err)
@@ -157,21 +482,11 @@ func (r *OrderRepository) ListOrdersByClient(ctx context.Context, clientID int64
 	var orders []model.Order
 	var orderIDs []int64
 	for rows.Next() {
-		var order model.Order
-		if err := rows.Scan(
-			&order.ID,
-			&order.ClientID,
-			&order.SellerID,
-			&order.CreatedAt,
-			&order.PaymentMethod,
-			&order.PaymentStatus,
-			&order.SubtotalCents,
-			&order.DiscountCents,
-			&order.TotalCents,
-		); err != nil {
+		order, err := scanOrder(rows)
+		if err != nil {
 			return nil, fmt.Errorf("scan order: %w", err)
 		}
-		orders = append(orders, order)
+		orders = append(orders, *order)
 		orderIDs = append(orderIDs, order.ID)
 	}
 
@@ -191,8 +506,103 @@ func (r *OrderRepository) ListOrdersByClient(ctx context.Context, clientID int64
 	return orders, nil
 }
 
+// SearchOrders returns one page of orders matching filters in the requested
+// order, starting after the keyset position when one is given.
+func (r *OrderRepository) SearchOrders(ctx context.Context, filters OrderFilters, sort OrderSort, after *OrderCursor, limit int) ([]model.Order, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	where, args := filters.where(1)
+
+	query := strings.Builder{}
+	query.WriteString(`SELECT ` + orderColumns + ` FROM orders WHERE `)
+	query.WriteString(where)
+
+	if after != nil {
+		op := ">"
+		if sort.Desc {
+			op = "<"
+		}
+		var value any = after.CreatedAt.UTC()
+		if sort.column() == OrderSortTotal {
+			value = after.TotalCents
+		}
+		query.WriteString(fmt.Sprintf(" AND (%s, id) %s ($%d, $%d)", sort.column(), op, len(args)+1, len(args)+2))
+		args = append(args, value, after.ID)
+	}
+
+	query.WriteString(fmt.Sprintf(" ORDER BY %s LIMIT $%d", sort.orderBy(), len(args)+1))
+	args = append(args, limit)
+
+	rows, err := r.db.QueryContext(ctx, query.String(), args...)
+	if err != nil {
+		return nil, fmt.Errorf("search orders: %w", err)
+	}
+	defer rows.Close()
+
+	var orders []model.Order
+	var orderIDs []int64
+	for rows.Next() {
+		order, err := scanOrder(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan order: %w", err)
+		}
+		orders = append(orders, *order)
+		orderIDs = append(orderIDs, order.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate orders: %w", err)
+	}
+
+	if len(orderIDs) == 0 {
+		return orders, nil
+	}
+
+	itemsByOrder, err := r.fetchItems(ctx, orderIDs)
+	if err != nil {
+		return nil, err
+	}
+	for idx := range orders {
+		orders[idx].Items = itemsByOrder[orders[idx].ID]
+	}
+
+	return orders, nil
+}
+
+// StreamOrders walks every order matching filters, handing each one to fn as
+// it is scanned so exports never hold the full result in memory. Items are
+// not loaded.
+func (r *OrderRepository) StreamOrders(ctx context.Context, filters OrderFilters, sort OrderSort, fn func(*model.Order) error) error {
+	where, args := filters.where(1)
+
+	rows, err := r.db.QueryContext(ctx, `SELECT `+orderColumns+` FROM orders WHERE `+where+` ORDER BY `+sort.orderBy(), args...)
+	if err != nil {
+		return fmt.Errorf("stream orders: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		order, err := scanOrder(rows)
+		if err != nil {
+			return fmt.Errorf("scan order: %w", err)
+		}
+		if err := fn(order); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterate orders: %w", err)
+	}
+
+	return nil
+}
+
 func (r *OrderRepository) fetchItems(ctx context.Context, orderIDs []int64) (map[int64][]model.OrderItem, error) {
-	rows, err := r.db.QueryContext(ctx, `SELECT id, order_id, plan_id, quantity, unit_price_cents FROM order_items WHERE order_id = ANY($1) ORDER BY id`, pq.Array(orderIDs))
+	rows, err := r.db.QueryContext(ctx, `SELECT oi.id, oi.order_id, oi.plan_id, COALESCE(p.plan_name, ''), oi.quantity, oi.unit_price_cents
+        FROM order_items oi
+        LEFT JOIN plans p ON p.id = oi.plan_id
+        WHERE oi.order_id = ANY($1) ORDER BY oi.id`, pq.Array(orderIDs))
 	if err != nil {
 		return nil, fmt.Errorf("list order items: %w", err)
 	}
@@ -201,7 +611,7 @@ func (r *OrderRepository) fetchItems(ctx context.Context, orderIDs []int64) (map
 	result := make(map[int64][]model.OrderItem, len(orderIDs))
 	for rows.Next() {
 		var item model.OrderItem
-		if err := rows.Scan(&item.ID, &item.OrderID, &item.PlanID, &item.Quantity, &item.UnitPriceCents); err != nil {
+		if err := rows.Scan(&item.ID, &item.OrderID, &item.PlanID, &item.PlanName, &item.Quantity, &item.UnitPriceCents); err != nil {
 			return nil, fmt.Errorf("scan order item: %w", err)
 		}
 		result[item.OrderID] = append(result[item.OrderID], item)
@@ -210,19 +620,200 @@ func (r *OrderRepository) fetchItems(ctx context.Context, orderIDs []int64) (map
 	return result, nil
 }
 
-func (r *OrderRepository) FinalizeOrder(ctx context.Context, orderID int64) error {
+func (r *OrderRepository) FinalizeOrder(ctx context.Context, orderID int64, actor string) error {
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
-	if _, err := r.db.ExecContext(ctx, `SELECT sp_finalize_order($1)`, orderID); err != nil {
-		if pqErr, ok := err.(*pq.Error); ok {
-			lowered := strings.ToLower(pqErr.Message)
-			if strings.Contains(lowered, "insufficient stock") {
-				return fmt.Errorf("finalize order %d: %w", orderID, ErrInsufficientStock)
-			}
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("begin finalize transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := setOrderContext(ctx, tx, actor, ""); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `SELECT sp_finalize_order($1)`, orderID); err != nil {
+		return orderStateError("finalize", orderID, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit finalize order %d: %w", orderID, err)
+	}
+
+	return nil
+}
+
+// ListOrderEvents returns an order's timeline, oldest first.
+func (r *OrderRepository) ListOrderEvents(ctx context.Context, orderID int64) ([]model.OrderEvent, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var exists bool
+	if err := r.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM orders WHERE id = $1)`, orderID).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("query order %d: %w", orderID, err)
+	}
+	if !exists {
+		return nil, ErrOrderNotFound
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT id, order_id, type, actor, payload, created_at
+		FROM order_events WHERE order_id = $1 ORDER BY id`, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("list events for order %d: %w", orderID, err)
+	}
+	defer rows.Close()
+
+	events := []model.OrderEvent{}
+	for rows.Next() {
+		var event model.OrderEvent
+		var payload []byte
+		if err := rows.Scan(&event.ID, &event.OrderID, &event.Type, &event.Actor, &payload, &event.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan order event: %w", err)
 		}
-		return fmt.Errorf("finalize order %d: %w", orderID, err)
+		event.Payload = json.RawMessage(payload)
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+// StatusChangesSince counts the STATUS_CHANGED events after afterID that were
+// recorded before settledBefore, grouped by from/to status. Callers pass a
+// settledBefore old enough that no transaction still holds a lower id, so
+// the returned id is safe to resume from.
+func (r *OrderRepository) StatusChangesSince(ctx context.Context, afterID int64, settledBefore time.Time) ([]model.OrderTransitionCount, int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `SELECT payload->>'from', payload->>'to', COUNT(*), MAX(id)
+		FROM order_events
+		WHERE type = 'STATUS_CHANGED' AND id > $1 AND created_at < $2
+		GROUP BY 1, 2`, afterID, settledBefore.UTC())
+	if err != nil {
+		return nil, afterID, fmt.Errorf("count order status changes: %w", err)
+	}
+	defer rows.Close()
+
+	lastID := afterID
+	var counts []model.OrderTransitionCount
+	for rows.Next() {
+		var (
+			c     model.OrderTransitionCount
+			maxID int64
+		)
+		if err := rows.Scan(&c.From, &c.To, &c.Count, &maxID); err != nil {
+			return nil, afterID, fmt.Errorf("scan order status changes: %w", err)
+		}
+		counts = append(counts, c)
+		lastID = max(lastID, maxID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, afterID, fmt.Errorf("iterate order status changes: %w", err)
 	}
 
+	return counts, lastID, nil
+}
+
+// setOrderContext names who is changing orders in tx, and optionally why,
+// for the order_events triggers. The actor also labels stock movements.
+func setOrderContext(ctx context.Context, tx *sql.Tx, actor, reason string) error {
+	if _, err := tx.ExecContext(ctx, `SELECT set_config('app.actor', $1, true), set_config('app.order_reason', $2, true)`,
+		actor, reason); err != nil {
+		return fmt.Errorf("set order context: %w", err)
+	}
 	return nil
 }
+
+// orderStateError maps the exceptions raised by sp_finalize_order and
+// sp_recalculate_order onto the repository's sentinel errors.
+func orderStateError(action string, orderID int64, err error) error {
+	if pqErr, ok := err.(*pq.Error); ok {
+		lowered := strings.ToLower(pqErr.Message)
+		switch {
+		case strings.Contains(lowered, "insufficient stock"):
+			return fmt.Errorf("%s order %d: %w", action, orderID, ErrInsufficientStock)
+		case strings.Contains(lowered, "is not pending"):
+			return fmt.Errorf("%s order %d: %w", action, orderID, ErrOrderNotPending)
+		case strings.Contains(lowered, "not found"):
+			return fmt.Errorf("%s order %d: %w", action, orderID, ErrOrderNotFound)
+		}
+	}
+	return fmt.Errorf("%s order %d: %w", action, orderID, err)
+}
+
+// ExpirePending cancels up to limit PENDING orders past their deadline. An
+// order without expires_at, created before deadlines existed, falls back to
+// created_at plus the TTL for its payment method; methods missing from ttls
+// never expire that way. Orders whose provider charge is still open are left
+// for the provider to settle, so a payment in flight is never stranded on a
+// canceled order; a charge without an expiry of its own lasts as long as its
+// order. It returns the ids of the canceled orders.
+func (r *OrderRepository) ExpirePending(ctx context.Context, now time.Time, ttls map[string]time.Duration, limit int) ([]int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	methods := make([]string, 0, len(ttls))
+	seconds := make([]int64, 0, len(ttls))
+	for method, ttl := range ttls {
+		methods = append(methods, method)
+		seconds = append(seconds, int64(ttl/time.Second))
+	}
+
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("begin expiry transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := setOrderContext(ctx, tx, "system:order-expiry", ""); err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.QueryContext(ctx, `WITH ttl AS (
+			SELECT * FROM unnest($2::text[], $3::bigint[]) AS t(method, seconds)
+		), due AS (
+			SELECT o.id
+			FROM orders o
+			LEFT JOIN ttl ON ttl.method = o.payment_method::text
+			WHERE o.payment_status = 'PENDING'
+			  AND COALESCE(o.expires_at, o.created_at + make_interval(secs => ttl.seconds)) <= $1
+			  AND NOT EXISTS (
+			    SELECT 1 FROM payment_charges c
+			    WHERE c.order_id = o.id AND c.status = 'PENDING'
+			      AND COALESCE(c.expires_at, o.expires_at, o.created_at + make_interval(secs => ttl.seconds)) > $1)
+			ORDER BY o.id
+			LIMIT $4
+			FOR UPDATE OF o SKIP LOCKED
+		)
+		UPDATE orders o
+		SET payment_status = 'CANCELED',
+		    canceled_at = $1,
+		    cancel_reason = 'expired: ' || o.payment_method::text || ' payment not received in time'
+		FROM due
+		WHERE o.id = due.id
+		RETURNING o.id`, now.UTC(), pq.Array(methods), pq.Array(seconds), limit)
+	if err != nil {
+		return nil, fmt.Errorf("expire pending orders: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("scan expired order: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate expired orders: %w", err)
+	}
+	rows.Close()
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit order expiry: %w", err)
+	}
+
+	return ids, nil
+}
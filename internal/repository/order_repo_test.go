@@ -0,0 +1,229 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/Enilsonn/CRUD-Postgres/internal/model"
+	"github.com/lib/pq"
+)
+
+// expectOrderHeader expects CreateOrder up to its first plan lookup, which
+// reports available units of plan 2 at 500 cents.
+func expectOrderHeader(mock sqlmock.Sqlmock, available int) {
+	mock.ExpectBegin()
+	mock.ExpectExec(`set_config\('app.actor'`).WithArgs("client:7", "").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`INSERT INTO orders`).WithArgs(int64(7), int64(9), "PIX", nil, PriceLockItem).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(40, time.Now()))
+	price := mock.ExpectPrepare(`SELECT price_cents, stock - reserved_stock FROM plans WHERE id = \$1 FOR UPDATE`)
+	mock.ExpectPrepare(`INSERT INTO order_items`)
+	price.ExpectQuery().WithArgs(int64(2)).
+		WillReturnRows(sqlmock.NewRows([]string{"price_cents", "available"}).AddRow(500, available))
+}
+
+func TestCreateOrderChecksAvailableStock(t *testing.T) {
+	t.Run("reserved units are not available", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("sqlmock: %v", err)
+		}
+		defer db.Close()
+
+		expectOrderHeader(mock, 2)
+		mock.ExpectRollback()
+
+		order := &model.Order{ClientID: 7, SellerID: 9, PaymentMethod: "PIX", Items: []model.OrderItem{{PlanID: 2, Quantity: 3}}}
+		if _, err := NewOrderRepository(db).CreateOrder(context.Background(), order, "client:7"); !errors.Is(err, ErrInsufficientStock) {
+			t.Errorf("err = %v, want ErrInsufficientStock", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("the last available units can be ordered", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("sqlmock: %v", err)
+		}
+		defer db.Close()
+
+		expectOrderHeader(mock, 3)
+		mock.ExpectQuery(`INSERT INTO order_items`).WithArgs(int64(40), int64(2), 3, int64(500)).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(60))
+		mock.ExpectExec(`UPDATE orders SET subtotal_cents=\$1`).WithArgs(int64(1500), int64(40)).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		order := &model.Order{ClientID: 7, SellerID: 9, PaymentMethod: "PIX", Items: []model.OrderItem{{PlanID: 2, Quantity: 3}}}
+		id, err := NewOrderRepository(db).CreateOrder(context.Background(), order, "client:7")
+		if err != nil {
+			t.Fatalf("CreateOrder: %v", err)
+		}
+		if id != 40 || order.TotalCents != 1500 || order.Items[0].ID != 60 {
+			t.Errorf("order %d = %+v, want order 40 totalling 1500 with item 60", id, order)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestExpirePendingSparesOrdersWithOpenCharges(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectBegin()
+	mock.ExpectExec(`set_config\('app.actor'`).WithArgs("system:order-expiry", "").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`NOT EXISTS \(\s+SELECT 1 FROM payment_charges c\s+WHERE c.order_id = o.id AND c.status = 'PENDING'\s+AND COALESCE\(c.expires_at, o.expires_at, o.created_at \+ make_interval\(secs => ttl.seconds\)\) > \$1\)`).
+		WithArgs(now, sqlmock.AnyArg(), sqlmock.AnyArg(), 100).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(4))
+	mock.ExpectCommit()
+
+	ids, err := NewOrderRepository(db).ExpirePending(context.Background(), now, map[string]time.Duration{"PIX": 30 * time.Minute}, 100)
+	if err != nil {
+		t.Fatalf("ExpirePending: %v", err)
+	}
+	if len(ids) != 1 || ids[0] != 4 {
+		t.Errorf("ids = %v, want [4]", ids)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestListOrderEvents(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewOrderRepository(db)
+
+	mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM orders WHERE id = \$1\)`).WithArgs(int64(40)).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery(`FROM order_events WHERE order_id = \$1 ORDER BY id`).WithArgs(int64(40)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "order_id", "type", "actor", "payload", "created_at"}).
+			AddRow(1, 40, "CREATED", "client:7", []byte(`{"payment_status":"PENDING"}`), time.Now()).
+			AddRow(2, 40, "STATUS_CHANGED", "payment:fake", []byte(`{"from":"PENDING","to":"CONFIRMED"}`), time.Now()))
+	events, err := repo.ListOrderEvents(context.Background(), 40)
+	if err != nil {
+		t.Fatalf("ListOrderEvents: %v", err)
+	}
+	if len(events) != 2 || events[1].Type != "STATUS_CHANGED" || string(events[1].Payload) != `{"from":"PENDING","to":"CONFIRMED"}` {
+		t.Errorf("events = %+v, want CREATED then STATUS_CHANGED with its payload", events)
+	}
+
+	mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM orders WHERE id = \$1\)`).WithArgs(int64(41)).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	if _, err := repo.ListOrderEvents(context.Background(), 41); !errors.Is(err, ErrOrderNotFound) {
+		t.Errorf("unknown order: err = %v, want ErrOrderNotFound", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// expectCart expects editCart to lock order 40 in the given state.
+func expectCart(mock sqlmock.Sqlmock, status string, checkedOutAt *time.Time) {
+	mock.ExpectBegin()
+	mock.ExpectExec(`set_config\('app.actor'`).WithArgs("client:7", "").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT payment_status::text, checked_out_at FROM orders WHERE id = \$1 FOR UPDATE`).WithArgs(int64(40)).
+		WillReturnRows(sqlmock.NewRows([]string{"payment_status", "checked_out_at"}).AddRow(status, checkedOutAt))
+}
+
+func TestAddItemKeepsLockedLineAtItsPrice(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	expectCart(mock, "PENDING", nil)
+	mock.ExpectQuery(`SELECT price_cents, stock - reserved_stock FROM plans`).WithArgs(int64(2)).
+		WillReturnRows(sqlmock.NewRows([]string{"price_cents", "available"}).AddRow(600, 10))
+	// The existing line is locked at 500, so it matches no line priced 600.
+	mock.ExpectExec(`UPDATE order_items SET quantity = quantity \+ \$3\s+WHERE id = \(SELECT id FROM order_items WHERE order_id = \$1 AND plan_id = \$2 AND unit_price_cents = \$4`).
+		WithArgs(int64(40), int64(2), 1, int64(600)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO order_items`).WithArgs(int64(40), int64(2), 1, int64(600)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`SELECT sp_recalculate_order\(\$1, false\)`).WithArgs(int64(40)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	if err := NewOrderRepository(db).AddItem(context.Background(), 40, 2, 1, "client:7"); err != nil {
+		t.Fatalf("AddItem: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestEditCartRefusesSettledOrCheckedOutOrders(t *testing.T) {
+	checkedOut := time.Now()
+	tests := []struct {
+		name         string
+		status       string
+		checkedOutAt *time.Time
+		want         error
+	}{
+		{"confirmed", "CONFIRMED", nil, ErrOrderNotPending},
+		{"checked out", "PENDING", &checkedOut, ErrOrderCheckedOut},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("sqlmock: %v", err)
+			}
+			defer db.Close()
+
+			expectCart(mock, tt.status, tt.checkedOutAt)
+			mock.ExpectRollback()
+
+			if err := NewOrderRepository(db).UpdateItemQuantity(context.Background(), 40, 60, 2, "client:7"); !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestCheckoutFixesPricesThroughRecalculation(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewOrderRepository(db)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`set_config\('app.actor'`).WithArgs("client:7", "").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`SELECT sp_recalculate_order\(\$1, true\)`).WithArgs(int64(40)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	if err := repo.Checkout(context.Background(), 40, "client:7"); err != nil {
+		t.Fatalf("Checkout: %v", err)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`set_config\('app.actor'`).WithArgs("client:7", "").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`SELECT sp_recalculate_order\(\$1, true\)`).WithArgs(int64(40)).
+		WillReturnError(&pq.Error{Code: "P0001", Message: "order 40 is not pending (CONFIRMED)"})
+	mock.ExpectRollback()
+	if err := repo.Checkout(context.Background(), 40, "client:7"); !errors.Is(err, ErrOrderNotPending) {
+		t.Errorf("checkout of a confirmed order: err = %v, want ErrOrderNotPending", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,302 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Enilsonn/CRUD-Postgres/internal/model"
+	"github.com/lib/pq"
+)
+
+const (
+	OrgRoleOwner  = "OWNER"
+	OrgRoleAdmin  = "ADMIN"
+	OrgRoleMember = "MEMBER"
+)
+
+var (
+	ErrOrganizationNotFound = NotFoundf("organization not found")
+	ErrMemberNotFound       = NotFoundf("organization member not found")
+	ErrAlreadyMember        = errors.New("client already belongs to an organization")
+	ErrLastOwner            = errors.New("organization must keep at least one owner")
+)
+
+type OrganizationRepository struct {
+	db *sql.DB
+}
+
+func NewOrganizationRepository(db *sql.DB) *OrganizationRepository {
+	return &OrganizationRepository{db: db}
+}
+
+// monthlySpentQuery sums a member's USAGE debits against an organization
+// wallet since the start of the current month.
+const monthlySpentQuery = `SELECT COALESCE(-SUM(credits_delta), 0)
+	FROM credit_ledger
+	WHERE org_id = $1 AND member_client_id = $2 AND type = 'USAGE'
+	  AND created_at >= date_trunc('month', NOW())`
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+func isCheckViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23514"
+}
+
+// Create registers the organization around an existing billing client, whose
+// wallet becomes the shared wallet, and enrolls ownerClientID as its OWNER.
+func (r *OrganizationRepository) Create(ctx context.Context, name string, billingClientID, ownerClientID int64) (*model.Organization, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin create organization: %w", err)
+	}
+	defer tx.Rollback()
+
+	var member bool
+	if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM organization_members WHERE client_id = $1)`,
+		billingClientID).Scan(&member); err != nil {
+		return nil, fmt.Errorf("check billing client membership: %w", err)
+	}
+	if member {
+		return nil, Invalidf("invalid billing client: client %d is already an organization member", billingClientID)
+	}
+
+	org := &model.Organization{Name: name, BillingClientID: billingClientID}
+	err = tx.QueryRowContext(ctx, `INSERT INTO organizations (name, billing_client_id) VALUES ($1, $2)
+		RETURNING id, created_at`, name, billingClientID).Scan(&org.ID, &org.CreatedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, Invalidf("invalid organization: name or billing client already in use")
+		}
+		return nil, fmt.Errorf("insert organization: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `INSERT INTO wallets (client_id, balance_credits) VALUES ($1, 0)
+		ON CONFLICT (client_id) DO NOTHING`, billingClientID); err != nil {
+		return nil, fmt.Errorf("create organization wallet: %w", err)
+	}
+
+	owner, err := addMember(ctx, tx, org.ID, ownerClientID, OrgRoleOwner, nil)
+	if err != nil {
+		return nil, err
+	}
+	org.Members = []model.OrganizationMember{*owner}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit create organization: %w", err)
+	}
+
+	return org, nil
+}
+
+func (r *OrganizationRepository) GetByID(ctx context.Context, id int64) (*model.Organization, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	org := &model.Organization{}
+	err := r.db.QueryRowContext(ctx, `SELECT id, name, billing_client_id, created_at FROM organizations WHERE id = $1`, id).
+		Scan(&org.ID, &org.Name, &org.BillingClientID, &org.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrOrganizationNotFound
+		}
+		return nil, fmt.Errorf("query organization %d: %w", id, err)
+	}
+
+	return org, nil
+}
+
+const memberColumns = `m.org_id, m.client_id, m.role::text, m.monthly_limit_credits, m.joined_at,
+	COALESCE((SELECT -SUM(l.credits_delta) FROM credit_ledger l
+		WHERE l.org_id = m.org_id AND l.member_client_id = m.client_id AND l.type = 'USAGE'
+		  AND l.created_at >= date_trunc('month', NOW())), 0)`
+
+func scanMember(row interface{ Scan(...any) error }) (*model.OrganizationMember, error) {
+	member := &model.OrganizationMember{}
+	err := row.Scan(&member.OrgID, &member.ClientID, &member.Role, &member.MonthlyLimitCredits, &member.JoinedAt, &member.SpentThisMonth)
+	return member, err
+}
+
+func (r *OrganizationRepository) ListMembers(ctx context.Context, orgID int64) ([]model.OrganizationMember, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `SELECT `+memberColumns+`
+		FROM organization_members m WHERE m.org_id = $1
+		ORDER BY m.role, m.client_id`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("list members of organization %d: %w", orgID, err)
+	}
+	defer rows.Close()
+
+	var members []model.OrganizationMember
+	for rows.Next() {
+		member, err := scanMember(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan organization member: %w", err)
+		}
+		members = append(members, *member)
+	}
+
+	return members, rows.Err()
+}
+
+func (r *OrganizationRepository) GetMember(ctx context.Context, orgID, clientID int64) (*model.OrganizationMember, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	member, err := scanMember(r.db.QueryRowContext(ctx, `SELECT `+memberColumns+`
+		FROM organization_members m WHERE m.org_id = $1 AND m.client_id = $2`, orgID, clientID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrMemberNotFound
+		}
+		return nil, fmt.Errorf("query organization member: %w", err)
+	}
+
+	return member, nil
+}
+
+func (r *OrganizationRepository) AddMember(ctx context.Context, orgID, clientID int64, role string, monthlyLimit *int64) (*model.OrganizationMember, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	return addMember(ctx, r.db, orgID, clientID, role, monthlyLimit)
+}
+
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func addMember(ctx context.Context, q queryRower, orgID, clientID int64, role string, monthlyLimit *int64) (*model.OrganizationMember, error) {
+	// Billing clients pay for their organization; letting them join one
+	// would route their usage to a different wallet than their own.
+	member := &model.OrganizationMember{}
+	err := q.QueryRowContext(ctx, `INSERT INTO organization_members (org_id, client_id, role, monthly_limit_credits)
+		SELECT $1, $2, $3::org_role, $4
+		WHERE NOT EXISTS (SELECT 1 FROM organizations WHERE billing_client_id = $2)
+		RETURNING org_id, client_id, role::text, monthly_limit_credits, joined_at`,
+		orgID, clientID, role, monthlyLimit,
+	).Scan(&member.OrgID, &member.ClientID, &member.Role, &member.MonthlyLimitCredits, &member.JoinedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, Invalidf("invalid member: client %d is an organization billing client", clientID)
+		}
+		if isUniqueViolation(err) {
+			return nil, ErrAlreadyMember
+		}
+		return nil, fmt.Errorf("insert organization member: %w", err)
+	}
+
+	return member, nil
+}
+
+// UpdateMember changes a member's role and monthly cap. Demoting the last
+// OWNER is refused so an organization can never be left unmanaged.
+func (r *OrganizationRepository) UpdateMember(ctx context.Context, orgID, clientID int64, role string, monthlyLimit *int64) (*model.OrganizationMember, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin update member: %w", err)
+	}
+	defer tx.Rollback()
+
+	if role != OrgRoleOwner {
+		if err := ensureOtherOwner(ctx, tx, orgID, clientID); err != nil {
+			return nil, err
+		}
+	}
+
+	res, err := tx.ExecContext(ctx, `UPDATE organization_members SET role = $3::org_role, monthly_limit_credits = $4
+		WHERE org_id = $1 AND client_id = $2`, orgID, clientID, role, monthlyLimit)
+	if err != nil {
+		return nil, fmt.Errorf("update organization member: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, ErrMemberNotFound
+	}
+
+	member, err := scanMember(tx.QueryRowContext(ctx, `SELECT `+memberColumns+`
+		FROM organization_members m WHERE m.org_id = $1 AND m.client_id = $2`, orgID, clientID))
+	if err != nil {
+		return nil, fmt.Errorf("reload organization member: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit update member: %w", err)
+	}
+
+	return member, nil
+}
+
+func (r *OrganizationRepository) RemoveMember(ctx context.Context, orgID, clientID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin remove member: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := ensureOtherOwner(ctx, tx, orgID, clientID); err != nil {
+		return err
+	}
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM organization_members WHERE org_id = $1 AND client_id = $2`, orgID, clientID)
+	if err != nil {
+		return fmt.Errorf("delete organization member: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrMemberNotFound
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit remove member: %w", err)
+	}
+
+	return nil
+}
+
+// ensureOtherOwner fails with ErrLastOwner when clientID is the only OWNER of
+// the organization. Owner rows are locked so concurrent demotions serialize.
+func ensureOtherOwner(ctx context.Context, tx *sql.Tx, orgID, clientID int64) error {
+	rows, err := tx.QueryContext(ctx, `SELECT client_id FROM organization_members
+		WHERE org_id = $1 AND role = 'OWNER' FOR UPDATE`, orgID)
+	if err != nil {
+		return fmt.Errorf("lock organization owners: %w", err)
+	}
+	defer rows.Close()
+
+	var isOwner, others bool
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return fmt.Errorf("scan organization owner: %w", err)
+		}
+		if id == clientID {
+			isOwner = true
+		} else {
+			others = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterate organization owners: %w", err)
+	}
+
+	if isOwner && !others {
+		return ErrLastOwner
+	}
+	return nil
+}
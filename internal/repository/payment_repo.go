@@ -0,0 +1,222 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Enilsonn/CRUD-Postgres/internal/model"
+)
+
+var (
+	ErrChargeNotFound = NotFoundf("payment charge not found")
+	// ErrChargeNotSaved is a webhook that beat its charge into the database;
+	// the provider should deliver it again.
+	ErrChargeNotSaved = errors.New("payment charge not saved yet")
+)
+
+// PaymentNotification is a verified provider webhook reduced to what the
+// order needs: which charge it is about, the status it reports and, for
+// confirmations, the amount paid.
+type PaymentNotification struct {
+	Provider    string
+	EventID     string
+	EventType   string
+	ProviderRef string
+	AmountCents int64
+	Status      string
+	Reason      string
+	Payload     []byte
+}
+
+type PaymentRepository struct {
+	db *sql.DB
+}
+
+func NewPaymentRepository(db *sql.DB) *PaymentRepository {
+	return &PaymentRepository{db: db}
+}
+
+const paymentChargeColumns = `id, order_id, provider, provider_ref, method::text, status::text, amount_cents,
+	COALESCE(pix_payload, ''), COALESCE(boleto_line, ''), expires_at, COALESCE(failure_reason, ''), created_at, updated_at`
+
+func scanPaymentCharge(row interface{ Scan(...any) error }) (*model.PaymentCharge, error) {
+	c := &model.PaymentCharge{}
+	err := row.Scan(
+		&c.ID,
+		&c.OrderID,
+		&c.Provider,
+		&c.ProviderRef,
+		&c.Method,
+		&c.Status,
+		&c.AmountCents,
+		&c.PixPayload,
+		&c.BoletoLine,
+		&c.ExpiresAt,
+		&c.FailureReason,
+		&c.CreatedAt,
+		&c.UpdatedAt,
+	)
+	return c, err
+}
+
+// SaveCharge records the provider charge for an order, replacing an earlier
+// one that was never confirmed.
+func (r *PaymentRepository) SaveCharge(ctx context.Context, c *model.PaymentCharge) (*model.PaymentCharge, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	saved, err := scanPaymentCharge(r.db.QueryRowContext(ctx, `INSERT INTO payment_charges
+			(order_id, provider, provider_ref, method, amount_cents, pix_payload, boleto_line, expires_at)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), NULLIF($7, ''), $8)
+		ON CONFLICT (order_id) DO UPDATE SET
+			provider = EXCLUDED.provider,
+			provider_ref = EXCLUDED.provider_ref,
+			method = EXCLUDED.method,
+			status = 'PENDING',
+			amount_cents = EXCLUDED.amount_cents,
+			pix_payload = EXCLUDED.pix_payload,
+			boleto_line = EXCLUDED.boleto_line,
+			expires_at = EXCLUDED.expires_at,
+			failure_reason = NULL,
+			updated_at = now()
+		WHERE payment_charges.status <> 'CONFIRMED'
+		RETURNING `+paymentChargeColumns,
+		c.OrderID, c.Provider, c.ProviderRef, c.Method, c.AmountCents, c.PixPayload, c.BoletoLine, c.ExpiresAt))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("charge for order %d: %w", c.OrderID, ErrOrderNotPending)
+		}
+		return nil, fmt.Errorf("save payment charge: %w", err)
+	}
+
+	return saved, nil
+}
+
+func (r *PaymentRepository) GetChargeByOrder(ctx context.Context, orderID int64) (*model.PaymentCharge, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	c, err := scanPaymentCharge(r.db.QueryRowContext(ctx, `SELECT `+paymentChargeColumns+` FROM payment_charges WHERE order_id = $1`, orderID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrChargeNotFound
+		}
+		return nil, fmt.Errorf("query payment charge for order %d: %w", orderID, err)
+	}
+
+	return c, nil
+}
+
+// ApplyNotification settles the order behind a webhook exactly once. The
+// event is stored under its provider id first, so a redelivery returns the
+// original result with duplicate set and changes nothing. A confirmation
+// finalizes the order in the same transaction; if that fails nothing is
+// stored and the provider's retry gets another chance. So does a webhook for
+// a charge not saved yet, which fails with ErrChargeNotSaved. A confirmation
+// whose amount differs from the order total is recorded as rejected and
+// leaves the order pending.
+func (r *PaymentRepository) ApplyNotification(ctx context.Context, n PaymentNotification) (result string, duplicate bool, err error) {
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", false, fmt.Errorf("begin payment notification: %w", err)
+	}
+	defer tx.Rollback()
+
+	var eventID int64
+	err = tx.QueryRowContext(ctx, `INSERT INTO payment_webhook_events (provider, event_id, event_type, provider_ref, payload, result)
+		VALUES ($1, $2, $3, $4, $5, 'received')
+		ON CONFLICT (provider, event_id) DO NOTHING
+		RETURNING id`, n.Provider, n.EventID, n.EventType, n.ProviderRef, string(n.Payload)).Scan(&eventID)
+	if err == sql.ErrNoRows {
+		if err := tx.QueryRowContext(ctx, `SELECT result FROM payment_webhook_events WHERE provider = $1 AND event_id = $2`,
+			n.Provider, n.EventID).Scan(&result); err != nil {
+			return "", false, fmt.Errorf("query webhook event %s: %w", n.EventID, err)
+		}
+		return result, true, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("insert webhook event: %w", err)
+	}
+
+	if err := setOrderContext(ctx, tx, "payment:"+n.Provider, n.Reason); err != nil {
+		return "", false, err
+	}
+
+	result, err = applyChargeStatus(ctx, tx, n)
+	if err != nil {
+		return "", false, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE payment_webhook_events SET result = $2 WHERE id = $1`, eventID, result); err != nil {
+		return "", false, fmt.Errorf("update webhook event %d: %w", eventID, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", false, fmt.Errorf("commit payment notification: %w", err)
+	}
+
+	return result, false, nil
+}
+
+func applyChargeStatus(ctx context.Context, tx *sql.Tx, n PaymentNotification) (string, error) {
+	var chargeID, orderID int64
+	err := tx.QueryRowContext(ctx, `SELECT id, order_id FROM payment_charges
+		WHERE provider = $1 AND provider_ref = $2 FOR UPDATE`, n.Provider, n.ProviderRef).Scan(&chargeID, &orderID)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("%w: %s charge %s", ErrChargeNotSaved, n.Provider, n.ProviderRef)
+	}
+	if err != nil {
+		return "", fmt.Errorf("lock payment charge %s: %w", n.ProviderRef, err)
+	}
+
+	var (
+		orderStatus string
+		totalCents  int64
+	)
+	if err := tx.QueryRowContext(ctx, `SELECT payment_status::text, total_cents FROM orders WHERE id = $1 FOR UPDATE`,
+		orderID).Scan(&orderStatus, &totalCents); err != nil {
+		return "", fmt.Errorf("lock order %d: %w", orderID, err)
+	}
+	if orderStatus != "PENDING" {
+		return "ignored: order already " + orderStatus, nil
+	}
+	if n.Status == "CONFIRMED" && n.AmountCents != totalCents {
+		reason := fmt.Sprintf("paid %d cents, order total is %d", n.AmountCents, totalCents)
+		if _, err := tx.ExecContext(ctx, `UPDATE payment_charges SET failure_reason = $2, updated_at = now() WHERE id = $1`,
+			chargeID, reason); err != nil {
+			return "", fmt.Errorf("update payment charge %d: %w", chargeID, err)
+		}
+		return "rejected: " + reason, nil
+	}
+
+	switch n.Status {
+	case "CONFIRMED":
+		if _, err := tx.ExecContext(ctx, `SELECT sp_finalize_order($1)`, orderID); err != nil {
+			return "", orderStateError("finalize", orderID, err)
+		}
+	case "FAILED":
+		if _, err := tx.ExecContext(ctx, `UPDATE orders SET payment_status = 'FAILED' WHERE id = $1`, orderID); err != nil {
+			return "", fmt.Errorf("fail order %d: %w", orderID, err)
+		}
+	default:
+		return "", Invalidf("invalid payment status %q", n.Status)
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE payment_charges
+		SET status = $2, failure_reason = NULLIF($3, ''), updated_at = now()
+		WHERE id = $1`, chargeID, n.Status, n.Reason); err != nil {
+		return "", fmt.Errorf("update payment charge %d: %w", chargeID, err)
+	}
+	if err := settleCycle(ctx, tx, orderID, n.Status == "CONFIRMED", n.Reason, time.Now()); err != nil {
+		return "", err
+	}
+
+	return "order " + strings.ToLower(n.Status), nil
+}
@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func confirmation(amountCents int64) PaymentNotification {
+	return PaymentNotification{
+		Provider:    "fake",
+		EventID:     "evt_1",
+		EventType:   "payment.confirmed",
+		ProviderRef: "ch_1",
+		AmountCents: amountCents,
+		Status:      "CONFIRMED",
+		Payload:     []byte(`{}`),
+	}
+}
+
+func expectEventStored(mock sqlmock.Sqlmock) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO payment_webhook_events`).WithArgs("fake", "evt_1", "payment.confirmed", "ch_1", "{}").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(11))
+	mock.ExpectExec(`set_config\('app.actor'`).WithArgs("payment:fake", "").WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+func TestApplyNotificationReturnsStoredResultForDuplicate(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO payment_webhook_events`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`SELECT result FROM payment_webhook_events`).WithArgs("fake", "evt_1").
+		WillReturnRows(sqlmock.NewRows([]string{"result"}).AddRow("order confirmed"))
+	mock.ExpectRollback()
+
+	result, duplicate, err := NewPaymentRepository(db).ApplyNotification(context.Background(), confirmation(1000))
+	if err != nil {
+		t.Fatalf("ApplyNotification: %v", err)
+	}
+	if !duplicate || result != "order confirmed" {
+		t.Errorf("result = %q, duplicate = %v; want the stored result marked duplicate", result, duplicate)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestApplyNotificationForUnsavedChargeAsksForRetry(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	expectEventStored(mock)
+	mock.ExpectQuery(`SELECT id, order_id FROM payment_charges`).WithArgs("fake", "ch_1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "order_id"}))
+	// Rolled back, so the redelivery is not taken for a duplicate.
+	mock.ExpectRollback()
+
+	_, _, err = NewPaymentRepository(db).ApplyNotification(context.Background(), confirmation(1000))
+	if !errors.Is(err, ErrChargeNotSaved) {
+		t.Errorf("err = %v, want ErrChargeNotSaved", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestApplyNotificationRejectsWrongAmount(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	expectEventStored(mock)
+	mock.ExpectQuery(`SELECT id, order_id FROM payment_charges`).WithArgs("fake", "ch_1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "order_id"}).AddRow(3, 50))
+	mock.ExpectQuery(`SELECT payment_status::text, total_cents FROM orders`).WithArgs(int64(50)).
+		WillReturnRows(sqlmock.NewRows([]string{"payment_status", "total_cents"}).AddRow("PENDING", 1000))
+	// No sp_finalize_order: the order stays pending.
+	mock.ExpectExec(`UPDATE payment_charges SET failure_reason = \$2`).WithArgs(int64(3), "paid 900 cents, order total is 1000").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE payment_webhook_events SET result = \$2`).WithArgs(int64(11), "rejected: paid 900 cents, order total is 1000").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	result, _, err := NewPaymentRepository(db).ApplyNotification(context.Background(), confirmation(900))
+	if err != nil {
+		t.Fatalf("ApplyNotification: %v", err)
+	}
+	if result != "rejected: paid 900 cents, order total is 1000" {
+		t.Errorf("result = %q", result)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
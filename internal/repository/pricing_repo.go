@@ -9,6 +9,8 @@ import (
 	"github.com/Enilsonn/CRUD-Postgres/internal/model"
 )
 
+var ErrPricingRuleNotFound = NotFoundf("pricing rule not found")
+
 type PricingRepository struct {
 	db *sql.DB
 }
@@ -17,7 +19,9 @@ func NewPricingRepository(db *sql.DB) *PricingRepository {
 	return &PricingRepository{db: db}
 }
 
-func (r *PricingRepository) FindRate(ctx context.Context, model string) (ppk, cpk float64, ok bool, err error) {
+// FindRate returns the first active rule, in match order, whose pattern
+// matches modelName, or nil when none does.
+func (r *PricingRepository) FindRate(ctx context.Context, modelName string) (*model.ModelPricing, error) {
 	const query = `
 		SELECT pattern, credits_per_1k_prompt, credits_per_1k_completion
 		FROM model_pricing
@@ -26,48 +30,52 @@ func (r *PricingRepository) FindRate(ctx context.Context, model string) (ppk, cp
 
 	rows, err := r.db.QueryContext(ctx, query)
 	if err != nil {
-		return 0, 0, false, fmt.Errorf("query model pricing: %w", err)
+		return nil, fmt.Errorf("query model pricing: %w", err)
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var (
-			pattern        string
-			promptRate     float64
-			completionRate float64
-		)
-
-		if err := rows.Scan(&pattern, &promptRate, &completionRate); err != nil {
-			return 0, 0, false, fmt.Errorf("scan pricing row: %w", err)
+		rate := &model.ModelPricing{Active: true}
+		if err := rows.Scan(&rate.Pattern, &rate.CreditsPer1KPrompt, &rate.CreditsPer1KCompletion); err != nil {
+			return nil, fmt.Errorf("scan pricing row: %w", err)
 		}
 
-		re, err := regexp.Compile(pattern)
+		re, err := regexp.Compile(rate.Pattern)
 		if err != nil {
-			return 0, 0, false, fmt.Errorf("invalid pricing pattern %q: %w", pattern, err)
+			return nil, Invalidf("invalid pricing pattern %q: %w", rate.Pattern, err)
 		}
 
-		if re.MatchString(model) {
-			return promptRate, completionRate, true, nil
+		if re.MatchString(modelName) {
+			return rate, nil
 		}
 	}
 
 	if err := rows.Err(); err != nil {
-		return 0, 0, false, fmt.Errorf("iterate pricing rows: %w", err)
+		return nil, fmt.Errorf("iterate pricing rows: %w", err)
 	}
 
-	return 0, 0, false, nil
+	return nil, nil
 }
 
 func (r *PricingRepository) ListActive(ctx context.Context) ([]*model.ModelPricing, error) {
+	return r.list(ctx, true)
+}
+
+// ListAll returns every rule, including disabled ones, in match order.
+func (r *PricingRepository) ListAll(ctx context.Context) ([]*model.ModelPricing, error) {
+	return r.list(ctx, false)
+}
+
+func (r *PricingRepository) list(ctx context.Context, activeOnly bool) ([]*model.ModelPricing, error) {
 	const query = `
-		SELECT id, pattern, credits_per_1k_prompt, credits_per_1k_completion, priority, active, updated_at
+		SELECT pattern, credits_per_1k_prompt, credits_per_1k_completion, priority, active, updated_at
 		FROM model_pricing
-		WHERE active = true
+		WHERE active OR NOT $1
 		ORDER BY priority ASC, id ASC`
 
-	rows, err := r.db.QueryContext(ctx, query)
+	rows, err := r.db.QueryContext(ctx, query, activeOnly)
 	if err != nil {
-		return nil, fmt.Errorf("query active pricing: %w", err)
+		return nil, fmt.Errorf("query pricing: %w", err)
 	}
 	defer rows.Close()
 
@@ -149,3 +157,21 @@ func (r *PricingRepository) Upsert(ctx context.Context, rate *model.ModelPricing
 
 	return updated, nil
 }
+
+// SetActive enables or disables a rule without touching its rates.
+func (r *PricingRepository) SetActive(ctx context.Context, id int64, active bool) error {
+	res, err := r.db.ExecContext(ctx, `UPDATE model_pricing SET active = $2, updated_at = NOW() WHERE id = $1`, id, active)
+	if err != nil {
+		return fmt.Errorf("update pricing rule %d: %w", id, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("update pricing rule %d: %w", id, err)
+	}
+	if n == 0 {
+		return ErrPricingRuleNotFound
+	}
+
+	return nil
+}
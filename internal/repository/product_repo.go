@@ -27,8 +27,8 @@ type PlanSearchFilters struct {
 }
 
 func (r *ProductRepository) CreateClientProduct(ctx context.Context, plan model.Plan) (int64, error) {
-	sql := `INSERT INTO plans (plan_name, price_cents, amount_credits, status, category, manufactured_in_mari, stock)
-			VALUES ($1, $2, $3, $4, $5, $6, $7)
+	sql := `INSERT INTO plans (plan_name, price_cents, amount_credits, status, category, manufactured_in_mari, stock, validity_days)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 			RETURNING id
 	`
 	var id int64
@@ -45,6 +45,7 @@ func (r *ProductRepository) CreateClientProduct(ctx context.Context, plan model.
 		plan.Category,
 		plan.ManufacturedInMari,
 		plan.Stock,
+		plan.ValidityDays,
 	).Scan(&id)
 	if err != nil {
 		return 0, fmt.Errorf("error to create a new plan: %w", err)
@@ -54,7 +55,7 @@ func (r *ProductRepository) CreateClientProduct(ctx context.Context, plan model.
 }
 
 func (r *ProductRepository) GetProductByID(ctx context.Context, id int64) (*model.Plan, error) {
-	sql := `SELECT id, plan_name, price_cents, amount_credits, status, category, manufactured_in_mari, stock
+	sql := `SELECT id, plan_name, price_cents, amount_credits, status, category, manufactured_in_mari, stock, reserved_stock, stock - reserved_stock, validity_days
 			FROM plans
 			WHERE id=$1
 			AND status=true
@@ -77,6 +78,9 @@ func (r *ProductRepository) GetProductByID(ctx context.Context, id int64) (*mode
 		&plan.Category,
 		&plan.ManufacturedInMari,
 		&plan.Stock,
+		&plan.ReservedStock,
+		&plan.AvailableStock,
+		&plan.ValidityDays,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("error to find plan with id %d: %w", id, err)
@@ -86,7 +90,7 @@ func (r *ProductRepository) GetProductByID(ctx context.Context, id int64) (*mode
 }
 
 func (r *ProductRepository) GetClientProductByName(ctx context.Context, plan_name string) (*model.Plan, error) {
-	sql := `SELECT id, plan_name, price_cents, amount_credits, status, category, manufactured_in_mari, stock
+	sql := `SELECT id, plan_name, price_cents, amount_credits, status, category, manufactured_in_mari, stock, reserved_stock, stock - reserved_stock, validity_days
 			FROM plans
 			WHERE plan_name=$1
 	`
@@ -108,6 +112,9 @@ func (r *ProductRepository) GetClientProductByName(ctx context.Context, plan_nam
 		&plan.Category,
 		&plan.ManufacturedInMari,
 		&plan.Stock,
+		&plan.ReservedStock,
+		&plan.AvailableStock,
+		&plan.ValidityDays,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("error to find plan with name %s: %w", plan_name, err)
@@ -117,7 +124,7 @@ func (r *ProductRepository) GetClientProductByName(ctx context.Context, plan_nam
 }
 
 func (r *ProductRepository) GetAllClientProduct(ctx context.Context) ([]model.Plan, error) {
-	sql := `SELECT id, plan_name, price_cents, amount_credits, status, category, manufactured_in_mari, stock
+	sql := `SELECT id, plan_name, price_cents, amount_credits, status, category, manufactured_in_mari, stock, reserved_stock, stock - reserved_stock, validity_days
 			FROM plans
 			WHERE status=true
 	`
@@ -146,6 +153,9 @@ func (r *ProductRepository) GetAllClientProduct(ctx context.Context) ([]model.Pl
 			&plan.Category,
 			&plan.ManufacturedInMari,
 			&plan.Stock,
+			&plan.ReservedStock,
+			&plan.AvailableStock,
+			&plan.ValidityDays,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("error to access plan: %w", err)
@@ -157,16 +167,28 @@ func (r *ProductRepository) GetAllClientProduct(ctx context.Context) ([]model.Pl
 	return plans, nil
 }
 
-func (r *ProductRepository) UpdateClientProduct(ctx context.Context, id int64, plan model.Plan) (int64, error) {
+// UpdateClientProduct saves plan; a stock change is logged as a CORRECTION by
+// actor.
+func (r *ProductRepository) UpdateClientProduct(ctx context.Context, id int64, plan model.Plan, actor string) (int64, error) {
 	sql := `UPDATE plans
-			SET plan_name=$1, price_cents=$2, amount_credits=$3, category=$4, manufactured_in_mari=$5, stock=$6
-			WHERE id=$7
+			SET plan_name=$1, price_cents=$2, amount_credits=$3, category=$4, manufactured_in_mari=$5, stock=$6, validity_days=$7
+			WHERE id=$8
 			AND status=true
 	`
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	resp, err := r.db.ExecContext(
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin plan update: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := setStockContext(ctx, tx, "CORRECTION", actor, "plan update"); err != nil {
+		return 0, err
+	}
+
+	resp, err := tx.ExecContext(
 		ctx,
 		sql,
 		plan.PlanName,
@@ -175,6 +197,7 @@ func (r *ProductRepository) UpdateClientProduct(ctx context.Context, id int64, p
 		plan.Category,
 		plan.ManufacturedInMari,
 		plan.Stock,
+		plan.ValidityDays,
 		id,
 	)
 	if err != nil {
@@ -189,6 +212,10 @@ func (r *ProductRepository) UpdateClientProduct(ctx context.Context, id int64, p
 		return 0, fmt.Errorf("no plan found with id %d was updated", id)
 	}
 
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit plan update: %w", err)
+	}
+
 	return rowsAffected, nil
 }
 
@@ -222,7 +249,7 @@ func (r *ProductRepository) SearchPlans(ctx context.Context, filters PlanSearchF
 	defer cancel()
 
 	query := strings.Builder{}
-	query.WriteString(`SELECT id, plan_name, price_cents, amount_credits, status, category, manufactured_in_mari, stock FROM plans WHERE status = true`)
+	query.WriteString(`SELECT id, plan_name, price_cents, amount_credits, status, category, manufactured_in_mari, stock, reserved_stock, stock - reserved_stock, validity_days FROM plans WHERE status = true`)
 
 	var args []any
 	argPos := 1
@@ -273,6 +300,9 @@ func (r *ProductRepository) SearchPlans(ctx context.Context, filters PlanSearchF
 			&plan.Category,
 			&plan.ManufacturedInMari,
 			&plan.Stock,
+			&plan.ReservedStock,
+			&plan.AvailableStock,
+			&plan.ValidityDays,
 		); err != nil {
 			return nil, fmt.Errorf("error scanning plan: %w", err)
 		}
@@ -286,7 +316,7 @@ func (r *ProductRepository) ListLowStock(ctx context.Context) ([]model.Plan, err
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	rows, err := r.db.QueryContext(ctx, `SELECT id, plan_name, price_cents, amount_credits, status, category, manufactured_in_mari, stock FROM plans WHERE status = true AND stock < 5 ORDER BY stock ASC, plan_name`)
+	rows, err := r.db.QueryContext(ctx, `SELECT id, plan_name, price_cents, amount_credits, status, category, manufactured_in_mari, stock, reserved_stock, stock - reserved_stock, validity_days FROM plans WHERE status = true AND stock - reserved_stock < 5 ORDER BY stock - reserved_stock ASC, plan_name`)
 	if err != nil {
 		return nil, fmt.Errorf("error listing low stock plans: %w", err)
 	}
@@ -304,6 +334,9 @@ func (r *ProductRepository) ListLowStock(ctx context.Context) ([]model.Plan, err
 			&plan.Category,
 			&plan.ManufacturedInMari,
 			&plan.Stock,
+			&plan.ReservedStock,
+			&plan.AvailableStock,
+			&plan.ValidityDays,
 		); err != nil {
 			return nil, fmt.Errorf("error scanning plan: %w", err)
 		}
@@ -312,3 +345,104 @@ func (r *ProductRepository) ListLowStock(ctx context.Context) ([]model.Plan, err
 
 	return plans, nil
 }
+
+// AdjustStock adds delta to a plan's stock and returns the movement logged
+// for it. Stock never goes below zero.
+func (r *ProductRepository) AdjustStock(ctx context.Context, planID int64, delta int, kind, actor, reason string) (*model.InventoryMovement, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin stock adjustment: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := setStockContext(ctx, tx, kind, actor, reason); err != nil {
+		return nil, err
+	}
+
+	var stock int
+	err = tx.QueryRowContext(ctx, `UPDATE plans SET stock = stock + $2 WHERE id = $1 AND status = true RETURNING stock`,
+		planID, delta).Scan(&stock)
+	if err == sql.ErrNoRows {
+		return nil, NotFoundf("plan %d not found", planID)
+	}
+	if err != nil {
+		if isCheckViolation(err) {
+			return nil, Invalidf("invalid stock adjustment: plan %d would go below zero", planID)
+		}
+		return nil, fmt.Errorf("adjust stock for plan %d: %w", planID, err)
+	}
+
+	movement, err := scanInventoryMovement(tx.QueryRowContext(ctx, `SELECT `+inventoryMovementColumns+`
+		FROM inventory_movements WHERE plan_id = $1 ORDER BY id DESC LIMIT 1`, planID))
+	if err != nil {
+		return nil, fmt.Errorf("query inventory movement: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit stock adjustment: %w", err)
+	}
+
+	return movement, nil
+}
+
+// ListInventoryMovements returns a plan's stock history, newest first. Plans
+// that were deleted keep theirs; ids that never named a plan are not found.
+func (r *ProductRepository) ListInventoryMovements(ctx context.Context, planID int64, limit int) ([]model.InventoryMovement, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `SELECT `+inventoryMovementColumns+`
+		FROM inventory_movements WHERE plan_id = $1
+		ORDER BY created_at DESC, id DESC LIMIT $2`, planID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list inventory movements for plan %d: %w", planID, err)
+	}
+	defer rows.Close()
+
+	var movements []model.InventoryMovement
+	for rows.Next() {
+		m, err := scanInventoryMovement(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan inventory movement: %w", err)
+		}
+		movements = append(movements, *m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate inventory movements: %w", err)
+	}
+
+	if len(movements) == 0 {
+		var exists bool
+		if err := r.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM plans WHERE id = $1)`, planID).Scan(&exists); err != nil {
+			return nil, fmt.Errorf("query plan %d: %w", planID, err)
+		}
+		if !exists {
+			return nil, NotFoundf("plan %d not found", planID)
+		}
+		movements = []model.InventoryMovement{}
+	}
+
+	return movements, nil
+}
+
+const inventoryMovementColumns = `id, plan_id, kind, stock_delta, reserved_delta, stock_after, reserved_after, order_id, actor, COALESCE(reason, ''), created_at`
+
+func scanInventoryMovement(row interface{ Scan(...any) error }) (*model.InventoryMovement, error) {
+	m := &model.InventoryMovement{}
+	err := row.Scan(&m.ID, &m.PlanID, &m.Kind, &m.StockDelta, &m.ReservedDelta, &m.StockAfter, &m.ReservedAfter,
+		&m.OrderID, &m.Actor, &m.Reason, &m.CreatedAt)
+	return m, err
+}
+
+// setStockContext labels the stock changes made later in tx for the
+// inventory_movements trigger.
+func setStockContext(ctx context.Context, tx *sql.Tx, kind, actor, reason string) error {
+	if _, err := tx.ExecContext(ctx, `SELECT set_config('app.stock_kind', $1, true), set_config('app.actor', $2, true), set_config('app.stock_reason', $3, true)`,
+		kind, actor, reason); err != nil {
+		return fmt.Errorf("set stock context: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+)
+
+func movementRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "plan_id", "kind", "stock_delta", "reserved_delta", "stock_after", "reserved_after",
+		"order_id", "actor", "reason", "created_at"})
+}
+
+func expectStockContext(mock sqlmock.Sqlmock) {
+	mock.ExpectBegin()
+	mock.ExpectExec(`set_config\('app.stock_kind', \$1, true\)`).WithArgs("ADJUSTMENT", "employee:3", "recount").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+func TestAdjustStock(t *testing.T) {
+	t.Run("returns the movement the trigger logged", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("sqlmock: %v", err)
+		}
+		defer db.Close()
+
+		expectStockContext(mock)
+		mock.ExpectQuery(`UPDATE plans SET stock = stock \+ \$2 WHERE id = \$1 AND status = true RETURNING stock`).WithArgs(int64(2), -4).
+			WillReturnRows(sqlmock.NewRows([]string{"stock"}).AddRow(6))
+		mock.ExpectQuery(`FROM inventory_movements WHERE plan_id = \$1 ORDER BY id DESC LIMIT 1`).WithArgs(int64(2)).
+			WillReturnRows(movementRows().AddRow(8, 2, "ADJUSTMENT", -4, 0, 6, 1, nil, "employee:3", "recount", time.Now()))
+		mock.ExpectCommit()
+
+		m, err := NewProductRepository(db).AdjustStock(context.Background(), 2, -4, "ADJUSTMENT", "employee:3", "recount")
+		if err != nil {
+			t.Fatalf("AdjustStock: %v", err)
+		}
+		if m.ID != 8 || m.StockDelta != -4 || m.StockAfter != 6 {
+			t.Errorf("movement = %+v, want movement 8 taking stock to 6", m)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("stock cannot go below zero", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("sqlmock: %v", err)
+		}
+		defer db.Close()
+
+		expectStockContext(mock)
+		mock.ExpectQuery(`UPDATE plans SET stock`).WithArgs(int64(2), -40).WillReturnError(&pq.Error{Code: "23514"})
+		mock.ExpectRollback()
+
+		_, err = NewProductRepository(db).AdjustStock(context.Background(), 2, -40, "ADJUSTMENT", "employee:3", "recount")
+		if !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("err = %v, want ErrInvalidInput", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("unknown or deleted plan", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("sqlmock: %v", err)
+		}
+		defer db.Close()
+
+		expectStockContext(mock)
+		mock.ExpectQuery(`UPDATE plans SET stock`).WithArgs(int64(2), 5).WillReturnRows(sqlmock.NewRows([]string{"stock"}))
+		mock.ExpectRollback()
+
+		_, err = NewProductRepository(db).AdjustStock(context.Background(), 2, 5, "ADJUSTMENT", "employee:3", "recount")
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("err = %v, want ErrNotFound", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestListInventoryMovementsOfUnknownPlan(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewProductRepository(db)
+
+	mock.ExpectQuery(`FROM inventory_movements WHERE plan_id = \$1`).WithArgs(int64(2), 200).WillReturnRows(movementRows())
+	mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM plans WHERE id = \$1\)`).WithArgs(int64(2)).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	movements, err := repo.ListInventoryMovements(context.Background(), 2, 200)
+	if err != nil || movements == nil || len(movements) != 0 {
+		t.Errorf("plan without history: movements = %#v, err = %v; want an empty list", movements, err)
+	}
+
+	mock.ExpectQuery(`FROM inventory_movements WHERE plan_id = \$1`).WithArgs(int64(99), 200).WillReturnRows(movementRows())
+	mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM plans WHERE id = \$1\)`).WithArgs(int64(99)).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	if _, err := repo.ListInventoryMovements(context.Background(), 99, 200); !errors.Is(err, ErrNotFound) {
+		t.Errorf("unknown plan: err = %v, want ErrNotFound", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
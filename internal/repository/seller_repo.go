@@ -88,7 +88,7 @@ func (r *SellerRepository) GetByID(ctx context.Context, id int64) (*model.Seller
 	var seller model.Seller
 	if err := r.db.QueryRowContext(ctx, `SELECT id, name FROM sellers WHERE id = $1`, id).Scan(&seller.ID, &seller.Name); err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("seller %d not found", id)
+			return nil, NotFoundf("seller %d not found", id)
 		}
 		return nil, fmt.Errorf("query seller %d: %w", id, err)
 	}
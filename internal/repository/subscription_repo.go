@@ -0,0 +1,753 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/Enilsonn/CRUD-Postgres/internal/model"
+)
+
+const (
+	SubscriptionIncomplete = "INCOMPLETE"
+	SubscriptionActive     = "ACTIVE"
+	SubscriptionPastDue    = "PAST_DUE"
+	SubscriptionPaused     = "PAUSED"
+	SubscriptionCanceled   = "CANCELED"
+
+	cycleInitial   = "INITIAL"
+	cycleRenewal   = "RENEWAL"
+	cycleProration = "PRORATION"
+
+	cyclePending = "PENDING"
+	cycleFailed  = "FAILED"
+)
+
+var (
+	ErrSubscriptionNotFound = NotFoundf("subscription not found")
+	ErrSubscriptionExists   = errors.New("client already subscribes to this plan")
+	ErrSubscriptionStatus   = errors.New("subscription status does not allow this change")
+	ErrChargeFailed         = errors.New("subscription charge failed")
+)
+
+type SubscriptionRepository struct {
+	db *sql.DB
+}
+
+func NewSubscriptionRepository(db *sql.DB) *SubscriptionRepository {
+	return &SubscriptionRepository{db: db}
+}
+
+// RenewalPolicy controls how failed renewals are retried. A subscription
+// stays PAST_DUE, retried every RetryInterval, until GracePeriod after the
+// end of the period it failed to renew; then it is canceled.
+type RenewalPolicy struct {
+	RetryInterval time.Duration
+	GracePeriod   time.Duration
+}
+
+func advancePeriod(t time.Time, interval string) time.Time {
+	switch interval {
+	case "WEEKLY":
+		return t.AddDate(0, 0, 7)
+	case "YEARLY":
+		return t.AddDate(1, 0, 0)
+	default:
+		return t.AddDate(0, 1, 0)
+	}
+}
+
+const subscriptionColumns = `id, client_id, plan_id, pending_plan_id, quantity, billing_interval, payment_method::text, status::text,
+	current_period_start, current_period_end, next_renewal_at, failed_attempts, grace_until, cancel_at_period_end,
+	COALESCE(cancel_reason, ''), paused_at, canceled_at, created_at`
+
+func scanSubscription(row interface{ Scan(...any) error }) (*model.Subscription, error) {
+	sub := &model.Subscription{}
+	err := row.Scan(
+		&sub.ID,
+		&sub.ClientID,
+		&sub.PlanID,
+		&sub.PendingPlanID,
+		&sub.Quantity,
+		&sub.BillingInterval,
+		&sub.PaymentMethod,
+		&sub.Status,
+		&sub.CurrentPeriodStart,
+		&sub.CurrentPeriodEnd,
+		&sub.NextRenewalAt,
+		&sub.FailedAttempts,
+		&sub.GraceUntil,
+		&sub.CancelAtPeriodEnd,
+		&sub.CancelReason,
+		&sub.PausedAt,
+		&sub.CanceledAt,
+		&sub.CreatedAt,
+	)
+	return sub, err
+}
+
+// Create starts an INCOMPLETE subscription and opens the order for its first
+// cycle, which the caller charges. The subscription becomes ACTIVE once the
+// provider confirms that payment; if the provider refuses the charge the
+// caller discards it. If the order cannot be opened nothing is kept and the
+// error wraps ErrChargeFailed.
+func (r *SubscriptionRepository) Create(ctx context.Context, sub *model.Subscription, sellerID int64, now time.Time) (*model.Subscription, error) {
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin create subscription: %w", err)
+	}
+	defer tx.Rollback()
+
+	start := now.UTC()
+	end := advancePeriod(start, sub.BillingInterval)
+
+	saved, err := scanSubscription(tx.QueryRowContext(ctx, `INSERT INTO subscriptions
+			(client_id, plan_id, quantity, billing_interval, payment_method, status, current_period_start, current_period_end)
+		VALUES ($1, $2, $3, $4, $5, 'INCOMPLETE', $6, $7)
+		RETURNING `+subscriptionColumns,
+		sub.ClientID, sub.PlanID, sub.Quantity, sub.BillingInterval, sub.PaymentMethod, start, end))
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, ErrSubscriptionExists
+		}
+		return nil, fmt.Errorf("insert subscription: %w", err)
+	}
+
+	cycle, chargeErr, err := chargeCycle(ctx, tx, saved, sellerID, cycleInitial, start, end, nil)
+	if err != nil {
+		return nil, err
+	}
+	if chargeErr != nil {
+		return nil, fmt.Errorf("%w: %w", ErrChargeFailed, chargeErr)
+	}
+	saved.Cycles = []model.SubscriptionCycle{*cycle}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit create subscription: %w", err)
+	}
+
+	return saved, nil
+}
+
+func (r *SubscriptionRepository) GetByID(ctx context.Context, id int64) (*model.Subscription, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	sub, err := scanSubscription(r.db.QueryRowContext(ctx, `SELECT `+subscriptionColumns+` FROM subscriptions WHERE id = $1`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrSubscriptionNotFound
+		}
+		return nil, fmt.Errorf("query subscription %d: %w", id, err)
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT id, subscription_id, order_id, kind, status, period_start, period_end,
+			amount_cents, credits_granted, COALESCE(error, ''), created_at
+		FROM subscription_cycles WHERE subscription_id = $1
+		ORDER BY created_at DESC, id DESC LIMIT 50`, id)
+	if err != nil {
+		return nil, fmt.Errorf("query subscription cycles: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c model.SubscriptionCycle
+		if err := rows.Scan(&c.ID, &c.SubscriptionID, &c.OrderID, &c.Kind, &c.Status, &c.PeriodStart, &c.PeriodEnd,
+			&c.AmountCents, &c.CreditsGranted, &c.Error, &c.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan subscription cycle: %w", err)
+		}
+		sub.Cycles = append(sub.Cycles, c)
+	}
+
+	return sub, rows.Err()
+}
+
+// ClientOf returns the id of the client a subscription belongs to.
+func (r *SubscriptionRepository) ClientOf(ctx context.Context, id int64) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var clientID int64
+	if err := r.db.QueryRowContext(ctx, `SELECT client_id FROM subscriptions WHERE id = $1`, id).Scan(&clientID); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, ErrSubscriptionNotFound
+		}
+		return 0, fmt.Errorf("query subscription %d: %w", id, err)
+	}
+	return clientID, nil
+}
+
+func (r *SubscriptionRepository) ListByClient(ctx context.Context, clientID int64) ([]*model.Subscription, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `SELECT `+subscriptionColumns+` FROM subscriptions
+		WHERE client_id = $1 ORDER BY created_at DESC, id DESC`, clientID)
+	if err != nil {
+		return nil, fmt.Errorf("list subscriptions for client %d: %w", clientID, err)
+	}
+	defer rows.Close()
+
+	var subs []*model.Subscription
+	for rows.Next() {
+		sub, err := scanSubscription(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan subscription: %w", err)
+		}
+		subs = append(subs, sub)
+	}
+
+	return subs, rows.Err()
+}
+
+// RenewNext processes the single most overdue subscription, if any, and
+// reports whether one was found along with the order, if any, the caller
+// must now charge. Concurrent schedulers skip rows another one already holds.
+func (r *SubscriptionRepository) RenewNext(ctx context.Context, now time.Time, sellerID int64, policy RenewalPolicy) (found bool, orderID int64, err error) {
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, 0, fmt.Errorf("begin renewal: %w", err)
+	}
+	defer tx.Rollback()
+
+	sub, err := scanSubscription(tx.QueryRowContext(ctx, `SELECT `+subscriptionColumns+` FROM subscriptions
+		WHERE status IN ('ACTIVE', 'PAST_DUE') AND next_renewal_at <= $1
+		ORDER BY next_renewal_at, id
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED`, now.UTC()))
+	if err == sql.ErrNoRows {
+		return false, 0, nil
+	}
+	if err != nil {
+		return false, 0, fmt.Errorf("claim due subscription: %w", err)
+	}
+
+	if sub.CancelAtPeriodEnd {
+		if err := setCanceled(ctx, tx, sub.ID, now, "canceled at period end"); err != nil {
+			return false, 0, err
+		}
+	} else if orderID, err = renew(ctx, tx, sub, sellerID, now, policy); err != nil {
+		return false, 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, 0, fmt.Errorf("commit renewal: %w", err)
+	}
+
+	return true, orderID, nil
+}
+
+// renew opens the order for the cycle following sub's current period and
+// returns it for the caller to charge. A scheduled plan change takes effect
+// with that cycle. The period only advances once the provider confirms the
+// payment; until then the subscription is due again at the next retry, when
+// a charge still awaiting the provider is given more time rather than
+// duplicated. Periods stay anchored to the original start, so a late retry
+// does not shift later renewal dates.
+func renew(ctx context.Context, tx *sql.Tx, sub *model.Subscription, sellerID int64, now time.Time, policy RenewalPolicy) (int64, error) {
+	graceUntil := sub.CurrentPeriodEnd.Add(policy.GracePeriod)
+	if sub.GraceUntil != nil {
+		graceUntil = *sub.GraceUntil
+	}
+	retryAt := now.Add(policy.RetryInterval)
+	if retryAt.After(graceUntil) {
+		retryAt = graceUntil
+	}
+
+	awaiting, err := hasPendingCycle(ctx, tx, sub.ID)
+	if err != nil {
+		return 0, err
+	}
+	if awaiting {
+		if !now.Before(graceUntil) {
+			return 0, setCanceled(ctx, tx, sub.ID, now, "renewal not paid within the grace period")
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE subscriptions SET next_renewal_at = $2, updated_at = $3 WHERE id = $1`,
+			sub.ID, retryAt.UTC(), now.UTC()); err != nil {
+			return 0, fmt.Errorf("postpone subscription %d: %w", sub.ID, err)
+		}
+		return 0, nil
+	}
+
+	next := *sub
+	if sub.PendingPlanID != nil {
+		next.PlanID = *sub.PendingPlanID
+	}
+	start := sub.CurrentPeriodEnd
+	end := advancePeriod(start, sub.BillingInterval)
+
+	cycle, chargeErr, err := chargeCycle(ctx, tx, &next, sellerID, cycleRenewal, start, end, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	if chargeErr == nil {
+		if _, err := tx.ExecContext(ctx, `UPDATE subscriptions SET next_renewal_at = $2, updated_at = $3 WHERE id = $1`,
+			sub.ID, retryAt.UTC(), now.UTC()); err != nil {
+			return 0, fmt.Errorf("schedule retry of subscription %d: %w", sub.ID, err)
+		}
+		return *cycle.OrderID, nil
+	}
+
+	if !now.Before(graceUntil) {
+		return 0, setCanceled(ctx, tx, sub.ID, now, "renewal failed: "+chargeErr.Error())
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE subscriptions
+		SET status = 'PAST_DUE', failed_attempts = failed_attempts + 1, next_renewal_at = $2, grace_until = $3, updated_at = $4
+		WHERE id = $1`, sub.ID, retryAt.UTC(), graceUntil.UTC(), now.UTC()); err != nil {
+		return 0, fmt.Errorf("mark subscription %d past due: %w", sub.ID, err)
+	}
+	return 0, nil
+}
+
+func (r *SubscriptionRepository) Pause(ctx context.Context, id int64, now time.Time) (*model.Subscription, error) {
+	return r.update(ctx, id, func(tx *sql.Tx, sub *model.Subscription) error {
+		if sub.Status != SubscriptionActive {
+			return fmt.Errorf("%w: subscription %d is %s", ErrSubscriptionStatus, id, sub.Status)
+		}
+		_, err := tx.ExecContext(ctx, `UPDATE subscriptions
+			SET status = 'PAUSED', paused_at = $2, next_renewal_at = NULL, updated_at = $2
+			WHERE id = $1`, id, now.UTC())
+		return err
+	})
+}
+
+// Resume opens the order for a fresh period starting now and returns it
+// for the caller to charge. The subscription stays paused until the provider
+// confirms that payment. If the order cannot be opened the error wraps
+// ErrChargeFailed and nothing is kept.
+func (r *SubscriptionRepository) Resume(ctx context.Context, id, sellerID int64, now time.Time) (*model.Subscription, int64, error) {
+	var orderID int64
+	sub, err := r.update(ctx, id, func(tx *sql.Tx, sub *model.Subscription) error {
+		if sub.Status != SubscriptionPaused {
+			return fmt.Errorf("%w: subscription %d is %s", ErrSubscriptionStatus, id, sub.Status)
+		}
+		if err := refuseWhileAwaiting(ctx, tx, sub.ID); err != nil {
+			return err
+		}
+
+		start := now.UTC()
+		cycle, chargeErr, err := chargeCycle(ctx, tx, sub, sellerID, cycleRenewal, start, advancePeriod(start, sub.BillingInterval), nil)
+		if err != nil {
+			return err
+		}
+		if chargeErr != nil {
+			return fmt.Errorf("%w: %w", ErrChargeFailed, chargeErr)
+		}
+		orderID = *cycle.OrderID
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return sub, orderID, nil
+}
+
+// Cancel ends the subscription now, or at the end of the paid period when
+// atPeriodEnd is set and the subscription is in good standing.
+func (r *SubscriptionRepository) Cancel(ctx context.Context, id int64, atPeriodEnd bool, now time.Time) (*model.Subscription, error) {
+	return r.update(ctx, id, func(tx *sql.Tx, sub *model.Subscription) error {
+		if sub.Status == SubscriptionCanceled {
+			return fmt.Errorf("%w: subscription %d is already canceled", ErrSubscriptionStatus, id)
+		}
+		if atPeriodEnd && sub.Status == SubscriptionActive {
+			_, err := tx.ExecContext(ctx, `UPDATE subscriptions SET cancel_at_period_end = true, updated_at = $2 WHERE id = $1`, id, now.UTC())
+			return err
+		}
+		return setCanceled(ctx, tx, id, now, "canceled by request")
+	})
+}
+
+// ChangePlan switches an active subscription to newPlanID. Downgrades wait
+// for the renewal. Upgrades open an order for the price difference, prorated
+// over the rest of the period and carrying the prorated credit difference,
+// and return it for the caller to charge; the new plan applies once the
+// provider confirms that payment.
+func (r *SubscriptionRepository) ChangePlan(ctx context.Context, id, newPlanID, sellerID int64, now time.Time) (*model.Subscription, int64, error) {
+	var orderID int64
+	sub, err := r.update(ctx, id, func(tx *sql.Tx, sub *model.Subscription) error {
+		if sub.Status != SubscriptionActive {
+			return fmt.Errorf("%w: subscription %d is %s", ErrSubscriptionStatus, id, sub.Status)
+		}
+		if err := refuseWhileAwaiting(ctx, tx, sub.ID); err != nil {
+			return err
+		}
+
+		if newPlanID == sub.PlanID {
+			if sub.PendingPlanID == nil {
+				return Invalidf("invalid plan change: subscription %d is already on plan %d", id, newPlanID)
+			}
+			_, err := tx.ExecContext(ctx, `UPDATE subscriptions SET pending_plan_id = NULL, updated_at = $2 WHERE id = $1`, id, now.UTC())
+			return err
+		}
+
+		var oldPrice, oldCredits, newPrice, newCredits int64
+		if err := tx.QueryRowContext(ctx, `SELECT price_cents, amount_credits FROM plans WHERE id = $1`, sub.PlanID).
+			Scan(&oldPrice, &oldCredits); err != nil {
+			return fmt.Errorf("query current plan %d: %w", sub.PlanID, err)
+		}
+		if err := tx.QueryRowContext(ctx, `SELECT price_cents, amount_credits FROM plans WHERE id = $1 AND status = true`, newPlanID).
+			Scan(&newPrice, &newCredits); err != nil {
+			if err == sql.ErrNoRows {
+				return NotFoundf("plan %d not found", newPlanID)
+			}
+			return fmt.Errorf("query new plan %d: %w", newPlanID, err)
+		}
+
+		if newPrice <= oldPrice {
+			_, err := tx.ExecContext(ctx, `UPDATE subscriptions SET pending_plan_id = $2, updated_at = $3 WHERE id = $1`, id, newPlanID, now.UTC())
+			return err
+		}
+
+		period := sub.CurrentPeriodEnd.Sub(sub.CurrentPeriodStart)
+		fraction := math.Min(math.Max(float64(sub.CurrentPeriodEnd.Sub(now))/float64(period), 0), 1)
+
+		upgraded := *sub
+		upgraded.PlanID = newPlanID
+		cycle, chargeErr, err := chargeCycle(ctx, tx, &upgraded, sellerID, cycleProration, now.UTC(), sub.CurrentPeriodEnd, &proratedItem{
+			unitPriceCents: int64(math.Round(float64(newPrice-oldPrice) * fraction)),
+			credits:        max(int64(math.Round(float64(newCredits-oldCredits)*fraction)), 0),
+		})
+		if err != nil {
+			return err
+		}
+		if chargeErr != nil {
+			return fmt.Errorf("%w: %w", ErrChargeFailed, chargeErr)
+		}
+		orderID = *cycle.OrderID
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return sub, orderID, nil
+}
+
+// FailCharge fails the order of a cycle whose charge the provider would not
+// even create, and settles the cycle as if the provider had reported it.
+func (r *SubscriptionRepository) FailCharge(ctx context.Context, orderID int64, reason string, now time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin fail subscription charge: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := setOrderContext(ctx, tx, "subscriptions", reason); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE orders SET payment_status = 'FAILED' WHERE id = $1 AND payment_status = 'PENDING'`, orderID); err != nil {
+		return fmt.Errorf("fail order %d: %w", orderID, err)
+	}
+	if err := settleCycle(ctx, tx, orderID, false, reason, now); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit fail subscription charge: %w", err)
+	}
+	return nil
+}
+
+// Discard fails the order of an INCOMPLETE subscription's first cycle and
+// deletes the subscription with its cycles, for a first charge the provider
+// would not even create. The client can then subscribe again from scratch.
+func (r *SubscriptionRepository) Discard(ctx context.Context, id, orderID int64, reason string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin discard subscription: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := setOrderContext(ctx, tx, fmt.Sprintf("subscription:%d", id), reason); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE orders SET payment_status = 'FAILED' WHERE id = $1 AND payment_status = 'PENDING'`, orderID); err != nil {
+		return fmt.Errorf("fail order %d: %w", orderID, err)
+	}
+	res, err := tx.ExecContext(ctx, `DELETE FROM subscriptions WHERE id = $1 AND status = 'INCOMPLETE'`, id)
+	if err != nil {
+		return fmt.Errorf("delete subscription %d: %w", id, err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("delete subscription %d: %w", id, err)
+	} else if n == 0 {
+		return fmt.Errorf("%w: subscription %d is no longer incomplete", ErrSubscriptionStatus, id)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit discard subscription: %w", err)
+	}
+	return nil
+}
+
+// update locks the subscription, runs apply and returns the reloaded row.
+func (r *SubscriptionRepository) update(ctx context.Context, id int64, apply func(tx *sql.Tx, sub *model.Subscription) error) (*model.Subscription, error) {
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin subscription update: %w", err)
+	}
+	defer tx.Rollback()
+
+	sub, err := scanSubscription(tx.QueryRowContext(ctx, `SELECT `+subscriptionColumns+` FROM subscriptions WHERE id = $1 FOR UPDATE`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrSubscriptionNotFound
+		}
+		return nil, fmt.Errorf("lock subscription %d: %w", id, err)
+	}
+
+	if err := apply(tx, sub); err != nil {
+		return nil, err
+	}
+
+	updated, err := scanSubscription(tx.QueryRowContext(ctx, `SELECT `+subscriptionColumns+` FROM subscriptions WHERE id = $1`, id))
+	if err != nil {
+		return nil, fmt.Errorf("reload subscription %d: %w", id, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit subscription update: %w", err)
+	}
+
+	return updated, nil
+}
+
+func setCanceled(ctx context.Context, tx *sql.Tx, id int64, now time.Time, reason string) error {
+	if _, err := tx.ExecContext(ctx, `UPDATE subscriptions
+		SET status = 'CANCELED', canceled_at = $2, cancel_reason = $3, next_renewal_at = NULL, updated_at = $2
+		WHERE id = $1`, id, now.UTC(), reason); err != nil {
+		return fmt.Errorf("cancel subscription %d: %w", id, err)
+	}
+	return nil
+}
+
+// proratedItem overrides the price and credits per unit of a cycle's order.
+type proratedItem struct {
+	unitPriceCents int64
+	credits        int64
+}
+
+// cycleTotals sums what a cycle's order costs and how many credits it grants.
+const cycleTotals = `SELECT o.total_cents, SUM(oi.quantity * COALESCE(oi.credits_per_unit, p.amount_credits))
+	FROM orders o
+	JOIN order_items oi ON oi.order_id = o.id
+	JOIN plans p ON p.id = oi.plan_id
+	WHERE o.id = $1
+	GROUP BY o.total_cents`
+
+// chargeCycle opens the PENDING order for one billing cycle of sub and
+// records the cycle as PENDING against it. The order is finalized, and the
+// cycle settled, once the provider confirms the payment: as soon as it is
+// charged for a card the provider captures, through its webhook for PIX and
+// boleto, which wait on the payer. An order
+// that cannot be opened is rolled back to a savepoint, recorded as a FAILED
+// cycle and returned as chargeErr; err is only set when recording itself
+// fails.
+func chargeCycle(ctx context.Context, tx *sql.Tx, sub *model.Subscription, sellerID int64, kind string, start, end time.Time, prorated *proratedItem) (cycle *model.SubscriptionCycle, chargeErr error, err error) {
+	if _, err := tx.ExecContext(ctx, `SAVEPOINT subscription_charge`); err != nil {
+		return nil, nil, fmt.Errorf("savepoint subscription charge: %w", err)
+	}
+
+	cycle = &model.SubscriptionCycle{
+		SubscriptionID: sub.ID,
+		Kind:           kind,
+		Status:         cyclePending,
+		PeriodStart:    start,
+		PeriodEnd:      end,
+	}
+
+	orderID, chargeErr := insertSubscriptionOrder(ctx, tx, sub, sellerID, prorated)
+	if chargeErr == nil {
+		chargeErr = tx.QueryRowContext(ctx, cycleTotals, orderID).Scan(&cycle.AmountCents, &cycle.CreditsGranted)
+	}
+
+	if chargeErr != nil {
+		if _, err := tx.ExecContext(ctx, `ROLLBACK TO SAVEPOINT subscription_charge`); err != nil {
+			return nil, nil, fmt.Errorf("rollback subscription charge: %w", err)
+		}
+		cycle.Status = cycleFailed
+		cycle.Error = chargeErr.Error()
+		cycle.AmountCents = 0
+		cycle.CreditsGranted = 0
+	} else {
+		if _, err := tx.ExecContext(ctx, `RELEASE SAVEPOINT subscription_charge`); err != nil {
+			return nil, nil, fmt.Errorf("release subscription charge: %w", err)
+		}
+		cycle.OrderID = &orderID
+	}
+
+	if err := insertCycle(ctx, tx, cycle); err != nil {
+		return nil, nil, err
+	}
+
+	return cycle, chargeErr, nil
+}
+
+// settleCycle applies the outcome of the payment for orderID to the pending
+// cycle it bills, if any. A paid cycle advances the subscription to its
+// period and plan; one paid after the subscription was canceled keeps its
+// credits but revives nothing. A failed first charge cancels the
+// subscription, a failed renewal leaves it PAST_DUE for the next retry, and
+// a failed upgrade or resume leaves it as it was.
+func settleCycle(ctx context.Context, tx *sql.Tx, orderID int64, paid bool, reason string, now time.Time) error {
+	var c model.SubscriptionCycle
+	err := tx.QueryRowContext(ctx, `SELECT id, subscription_id, kind, period_start, period_end FROM subscription_cycles
+		WHERE order_id = $1 AND status = 'PENDING' FOR UPDATE`, orderID).Scan(&c.ID, &c.SubscriptionID, &c.Kind, &c.PeriodStart, &c.PeriodEnd)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("lock cycle of order %d: %w", orderID, err)
+	}
+
+	sub, err := scanSubscription(tx.QueryRowContext(ctx, `SELECT `+subscriptionColumns+` FROM subscriptions WHERE id = $1 FOR UPDATE`, c.SubscriptionID))
+	if err != nil {
+		return fmt.Errorf("lock subscription %d: %w", c.SubscriptionID, err)
+	}
+
+	if !paid {
+		if _, err := tx.ExecContext(ctx, `UPDATE subscription_cycles
+			SET status = 'FAILED', error = NULLIF($2, ''), amount_cents = 0, credits_granted = 0
+			WHERE id = $1`, c.ID, reason); err != nil {
+			return fmt.Errorf("fail subscription cycle %d: %w", c.ID, err)
+		}
+		switch {
+		case sub.Status == SubscriptionCanceled:
+		case c.Kind == cycleInitial:
+			return setCanceled(ctx, tx, sub.ID, now, "first charge failed: "+reason)
+		case c.Kind == cycleRenewal && (sub.Status == SubscriptionActive || sub.Status == SubscriptionPastDue):
+			if _, err := tx.ExecContext(ctx, `UPDATE subscriptions
+				SET status = 'PAST_DUE', failed_attempts = failed_attempts + 1, updated_at = $2
+				WHERE id = $1`, sub.ID, now.UTC()); err != nil {
+				return fmt.Errorf("mark subscription %d past due: %w", sub.ID, err)
+			}
+		}
+		return nil
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE subscription_cycles c
+		SET status = 'PAID', amount_cents = t.total_cents, credits_granted = t.credits
+		FROM (`+cycleTotals+`) AS t (total_cents, credits)
+		WHERE c.id = $2`, orderID, c.ID); err != nil {
+		return fmt.Errorf("settle subscription cycle %d: %w", c.ID, err)
+	}
+	if sub.Status == SubscriptionCanceled {
+		return nil
+	}
+
+	var planID int64
+	if err := tx.QueryRowContext(ctx, `SELECT plan_id FROM order_items WHERE order_id = $1 ORDER BY id LIMIT 1`, orderID).Scan(&planID); err != nil {
+		return fmt.Errorf("query plan of order %d: %w", orderID, err)
+	}
+
+	if c.Kind == cycleProration {
+		if _, err := tx.ExecContext(ctx, `UPDATE subscriptions SET plan_id = $2, pending_plan_id = NULL, updated_at = $3 WHERE id = $1`,
+			sub.ID, planID, now.UTC()); err != nil {
+			return fmt.Errorf("upgrade subscription %d: %w", sub.ID, err)
+		}
+		return nil
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE subscriptions
+		SET plan_id = $2, pending_plan_id = NULLIF(pending_plan_id, $2), status = 'ACTIVE', paused_at = NULL,
+		    current_period_start = $3, current_period_end = $4, next_renewal_at = $4,
+		    failed_attempts = 0, grace_until = NULL, updated_at = $5
+		WHERE id = $1`, sub.ID, planID, c.PeriodStart.UTC(), c.PeriodEnd.UTC(), now.UTC()); err != nil {
+		return fmt.Errorf("advance subscription %d: %w", sub.ID, err)
+	}
+	return nil
+}
+
+func hasPendingCycle(ctx context.Context, tx *sql.Tx, subscriptionID int64) (bool, error) {
+	var pending bool
+	if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM subscription_cycles WHERE subscription_id = $1 AND status = 'PENDING')`,
+		subscriptionID).Scan(&pending); err != nil {
+		return false, fmt.Errorf("query pending cycles of subscription %d: %w", subscriptionID, err)
+	}
+	return pending, nil
+}
+
+func refuseWhileAwaiting(ctx context.Context, tx *sql.Tx, subscriptionID int64) error {
+	pending, err := hasPendingCycle(ctx, tx, subscriptionID)
+	if err != nil {
+		return err
+	}
+	if pending {
+		return fmt.Errorf("%w: subscription %d has a charge awaiting payment", ErrSubscriptionStatus, subscriptionID)
+	}
+	return nil
+}
+
+// insertSubscriptionOrder creates a PENDING order for sub's plan and
+// quantity, priced and credited per prorated when given or at the plan's
+// current price and credits otherwise.
+func insertSubscriptionOrder(ctx context.Context, tx *sql.Tx, sub *model.Subscription, sellerID int64, prorated *proratedItem) (int64, error) {
+	if err := setOrderContext(ctx, tx, fmt.Sprintf("subscription:%d", sub.ID), ""); err != nil {
+		return 0, err
+	}
+
+	var price int64
+	var available int
+	if err := tx.QueryRowContext(ctx, `SELECT price_cents, stock - reserved_stock FROM plans WHERE id = $1 AND status = true FOR UPDATE`,
+		sub.PlanID).Scan(&price, &available); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, NotFoundf("plan %d is no longer available", sub.PlanID)
+		}
+		return 0, fmt.Errorf("query plan price for plan %d: %w", sub.PlanID, err)
+	}
+	if available < sub.Quantity {
+		return 0, fmt.Errorf("plan %d has %d available: %w", sub.PlanID, available, ErrInsufficientStock)
+	}
+	var credits *int64
+	if prorated != nil {
+		price = prorated.unitPriceCents
+		credits = &prorated.credits
+	}
+
+	total := price * int64(sub.Quantity)
+
+	var orderID int64
+	if err := tx.QueryRowContext(ctx, `INSERT INTO orders (client_id, seller_id, payment_method, payment_status, subtotal_cents, total_cents)
+		VALUES ($1, $2, $3, 'PENDING', $4, $4) RETURNING id`,
+		sub.ClientID, sellerID, sub.PaymentMethod, total).Scan(&orderID); err != nil {
+		return 0, fmt.Errorf("insert subscription order: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `INSERT INTO order_items (order_id, plan_id, quantity, unit_price_cents, credits_per_unit) VALUES ($1, $2, $3, $4, $5)`,
+		orderID, sub.PlanID, sub.Quantity, price, credits); err != nil {
+		return 0, fmt.Errorf("insert subscription order item: %w", err)
+	}
+
+	return orderID, nil
+}
+
+func insertCycle(ctx context.Context, tx *sql.Tx, c *model.SubscriptionCycle) error {
+	if err := tx.QueryRowContext(ctx, `INSERT INTO subscription_cycles
+			(subscription_id, order_id, kind, status, period_start, period_end, amount_cents, credits_granted, error)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''))
+		RETURNING id, created_at`,
+		c.SubscriptionID, c.OrderID, c.Kind, c.Status, c.PeriodStart.UTC(), c.PeriodEnd.UTC(), c.AmountCents, c.CreditsGranted, c.Error,
+	).Scan(&c.ID, &c.CreatedAt); err != nil {
+		return fmt.Errorf("insert subscription cycle: %w", err)
+	}
+	return nil
+}
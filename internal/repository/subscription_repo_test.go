@@ -0,0 +1,220 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+var (
+	periodStart = time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	periodEnd   = time.Date(2025, 3, 31, 0, 0, 0, 0, time.UTC)
+)
+
+// subscriptionRow is subscription 5 of client 7 on plan 1, in the March
+// period.
+func subscriptionRow(status string) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "client_id", "plan_id", "pending_plan_id", "quantity", "billing_interval", "payment_method", "status",
+		"current_period_start", "current_period_end", "next_renewal_at", "failed_attempts", "grace_until", "cancel_at_period_end",
+		"cancel_reason", "paused_at", "canceled_at", "created_at"}).
+		AddRow(5, 7, 1, nil, 1, "MONTHLY", "PIX", status, periodStart, periodEnd, periodEnd, 0, nil, false, "", nil, nil, periodStart)
+}
+
+func expectPendingCycle(mock sqlmock.Sqlmock, kind string, start, end time.Time) {
+	mock.ExpectQuery(`FROM subscription_cycles\s+WHERE order_id = \$1 AND status = 'PENDING' FOR UPDATE`).WithArgs(int64(50)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "subscription_id", "kind", "period_start", "period_end"}).AddRow(3, 5, kind, start, end))
+}
+
+func TestSettleCycle(t *testing.T) {
+	now := periodEnd.Add(time.Hour)
+	april := periodEnd.AddDate(0, 1, 0)
+
+	tests := []struct {
+		name   string
+		paid   bool
+		kind   string
+		status string
+		expect func(mock sqlmock.Sqlmock)
+	}{
+		{
+			name: "paid renewal advances the period", paid: true, kind: cycleRenewal, status: SubscriptionPastDue,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(`UPDATE subscription_cycles c\s+SET status = 'PAID'`).WithArgs(int64(50), int64(3)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(`SELECT plan_id FROM order_items`).WithArgs(int64(50)).
+					WillReturnRows(sqlmock.NewRows([]string{"plan_id"}).AddRow(2))
+				mock.ExpectExec(`UPDATE subscriptions\s+SET plan_id = \$2, pending_plan_id = NULLIF\(pending_plan_id, \$2\), status = 'ACTIVE'`).
+					WithArgs(int64(5), int64(2), periodEnd, april, now).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+		{
+			name: "paid after cancel keeps the subscription canceled", paid: true, kind: cycleRenewal, status: SubscriptionCanceled,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(`UPDATE subscription_cycles c\s+SET status = 'PAID'`).WithArgs(int64(50), int64(3)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+		{
+			name: "failed first charge cancels", kind: cycleInitial, status: SubscriptionIncomplete,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(`UPDATE subscription_cycles\s+SET status = 'FAILED'`).WithArgs(int64(3), "card declined").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`SET status = 'CANCELED'`).WithArgs(int64(5), now, "first charge failed: card declined").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+		{
+			name: "failed renewal is past due", kind: cycleRenewal, status: SubscriptionActive,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(`UPDATE subscription_cycles\s+SET status = 'FAILED'`).WithArgs(int64(3), "card declined").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`SET status = 'PAST_DUE', failed_attempts = failed_attempts \+ 1`).WithArgs(int64(5), now).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+		{
+			name: "failed upgrade leaves the plan alone", kind: cycleProration, status: SubscriptionActive,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(`UPDATE subscription_cycles\s+SET status = 'FAILED'`).WithArgs(int64(3), "card declined").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("sqlmock: %v", err)
+			}
+			defer db.Close()
+
+			mock.ExpectBegin()
+			expectPendingCycle(mock, tt.kind, periodEnd, april)
+			mock.ExpectQuery(`FROM subscriptions WHERE id = \$1 FOR UPDATE`).WithArgs(int64(5)).WillReturnRows(subscriptionRow(tt.status))
+			tt.expect(mock)
+
+			tx, err := db.Begin()
+			if err != nil {
+				t.Fatal(err)
+			}
+			reason := ""
+			if !tt.paid {
+				reason = "card declined"
+			}
+			if err := settleCycle(context.Background(), tx, 50, tt.paid, reason, now); err != nil {
+				t.Fatalf("settleCycle: %v", err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestRenewWaitsOnChargeAwaitingPayment(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	now := periodEnd.Add(time.Hour)
+	policy := RenewalPolicy{RetryInterval: 6 * time.Hour, GracePeriod: 72 * time.Hour}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FOR UPDATE SKIP LOCKED`).WillReturnRows(subscriptionRow(SubscriptionActive))
+	mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM subscription_cycles`).WithArgs(int64(5)).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	// No new order: the charge already out is given until the next retry.
+	mock.ExpectExec(`UPDATE subscriptions SET next_renewal_at = \$2`).WithArgs(int64(5), now.Add(6*time.Hour), now).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	found, orderID, err := NewSubscriptionRepository(db).RenewNext(context.Background(), now, 9, policy)
+	if err != nil {
+		t.Fatalf("RenewNext: %v", err)
+	}
+	if !found || orderID != 0 {
+		t.Errorf("found = %v, orderID = %d; want the subscription handled with nothing to charge", found, orderID)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestChangePlanUpgradeAwaitsPayment(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	midway := periodStart.Add(periodEnd.Sub(periodStart) / 2)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM subscriptions WHERE id = \$1 FOR UPDATE`).WithArgs(int64(5)).WillReturnRows(subscriptionRow(SubscriptionActive))
+	mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM subscription_cycles`).WithArgs(int64(5)).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectQuery(`SELECT price_cents, amount_credits FROM plans WHERE id = \$1$`).WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"price_cents", "amount_credits"}).AddRow(1000, 100))
+	mock.ExpectQuery(`SELECT price_cents, amount_credits FROM plans WHERE id = \$1 AND status = true`).WithArgs(int64(2)).
+		WillReturnRows(sqlmock.NewRows([]string{"price_cents", "amount_credits"}).AddRow(3000, 400))
+	mock.ExpectExec(`SAVEPOINT subscription_charge`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`set_config\('app.actor'`).WithArgs("subscription:5", "").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT price_cents, stock - reserved_stock FROM plans`).WithArgs(int64(2)).
+		WillReturnRows(sqlmock.NewRows([]string{"price_cents", "available"}).AddRow(3000, 10))
+	mock.ExpectQuery(`INSERT INTO orders .*'PENDING'`).WithArgs(int64(7), int64(9), "PIX", int64(1000)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(50))
+	// Half the period is left: half the price and credit difference.
+	mock.ExpectExec(`INSERT INTO order_items .*credits_per_unit`).WithArgs(int64(50), int64(2), 1, int64(1000), int64(150)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT o.total_cents, SUM`).WithArgs(int64(50)).
+		WillReturnRows(sqlmock.NewRows([]string{"total_cents", "credits"}).AddRow(1000, 150))
+	mock.ExpectExec(`RELEASE SAVEPOINT subscription_charge`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`INSERT INTO subscription_cycles`).
+		WithArgs(int64(5), sqlmock.AnyArg(), cycleProration, cyclePending, midway, periodEnd, int64(1000), int64(150), "").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(3, midway))
+	// The plan stays as it is until the provider confirms the order.
+	mock.ExpectQuery(`FROM subscriptions WHERE id = \$1$`).WithArgs(int64(5)).WillReturnRows(subscriptionRow(SubscriptionActive))
+	mock.ExpectCommit()
+
+	sub, orderID, err := NewSubscriptionRepository(db).ChangePlan(context.Background(), 5, 2, 9, midway)
+	if err != nil {
+		t.Fatalf("ChangePlan: %v", err)
+	}
+	if orderID != 50 || sub.PlanID != 1 {
+		t.Errorf("orderID = %d, plan = %d; want order 50 to charge and plan 1 kept", orderID, sub.PlanID)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// A subscription whose first payment was confirmed in the meantime is no
+// longer INCOMPLETE, and Discard must not delete it.
+func TestDiscardKeepsSubscriptionNoLongerIncomplete(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`set_config\('app.actor'`).WithArgs("subscription:5", "card declined").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`UPDATE orders SET payment_status = 'FAILED'`).WithArgs(int64(50)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`DELETE FROM subscriptions WHERE id = \$1 AND status = 'INCOMPLETE'`).WithArgs(int64(5)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	err = NewSubscriptionRepository(db).Discard(context.Background(), 5, 50, "card declined")
+	if !errors.Is(err, ErrSubscriptionStatus) {
+		t.Errorf("Discard err = %v, want ErrSubscriptionStatus", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,345 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Enilsonn/CRUD-Postgres/internal/model"
+	"github.com/lib/pq"
+)
+
+const (
+	TransferPendingApproval = "PENDING_APPROVAL"
+	TransferCompleted       = "COMPLETED"
+	TransferRejected        = "REJECTED"
+)
+
+var (
+	ErrTransferNotFound   = NotFoundf("transfer not found")
+	ErrTransferNotPending = errors.New("transfer is not pending approval")
+	ErrTransferReplayed   = errors.New("request_id was already used for a different transfer")
+)
+
+type TransferRepository struct {
+	db *sql.DB
+}
+
+func NewTransferRepository(db *sql.DB) *TransferRepository {
+	return &TransferRepository{db: db}
+}
+
+const transferColumns = `id, from_client_id, to_client_id, credits, status, note, COALESCE(request_id, ''), requested_by,
+	COALESCE(reviewed_by, ''), debit_entry_id, credit_entry_id, created_at, completed_at`
+
+func scanTransfer(row interface{ Scan(...any) error }) (*model.CreditTransfer, error) {
+	t := &model.CreditTransfer{}
+	err := row.Scan(
+		&t.ID,
+		&t.FromClientID,
+		&t.ToClientID,
+		&t.Credits,
+		&t.Status,
+		&t.Note,
+		&t.RequestID,
+		&t.RequestedBy,
+		&t.ReviewedBy,
+		&t.DebitEntryID,
+		&t.CreditEntryID,
+		&t.CreatedAt,
+		&t.CompletedAt,
+	)
+	return t, err
+}
+
+// Create records a transfer. When execute is true the credits move in the
+// same transaction; otherwise the transfer waits for an employee to approve.
+// Replaying a request_id returns the transfer created the first time, or
+// ErrTransferReplayed if the replay names another recipient, amount or note.
+func (r *TransferRepository) Create(ctx context.Context, t *model.CreditTransfer, execute bool) (*model.CreditTransfer, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin transfer transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	saved, err := scanTransfer(tx.QueryRowContext(ctx, `INSERT INTO credit_transfers
+			(from_client_id, to_client_id, credits, status, note, request_id, requested_by)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7)
+		ON CONFLICT (from_client_id, request_id) WHERE request_id IS NOT NULL DO NOTHING
+		RETURNING `+transferColumns,
+		t.FromClientID, t.ToClientID, t.Credits, TransferPendingApproval, t.Note, t.RequestID, t.RequestedBy,
+	))
+	if err == sql.ErrNoRows {
+		original, err := r.getByRequestID(ctx, t.FromClientID, t.RequestID)
+		if err != nil {
+			return nil, err
+		}
+		if original.ToClientID != t.ToClientID || original.Credits != t.Credits || original.Note != t.Note {
+			return nil, fmt.Errorf("%w: transfer %d", ErrTransferReplayed, original.ID)
+		}
+		return original, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("insert transfer: %w", err)
+	}
+
+	if execute {
+		if err := completeTransfer(ctx, tx, saved, t.RequestedBy); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit transfer: %w", err)
+	}
+
+	return saved, nil
+}
+
+func (r *TransferRepository) Approve(ctx context.Context, id int64, reviewer string) (*model.CreditTransfer, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin transfer approval: %w", err)
+	}
+	defer tx.Rollback()
+
+	t, err := lockPendingTransfer(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := completeTransfer(ctx, tx, t, reviewer); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit transfer approval: %w", err)
+	}
+
+	return t, nil
+}
+
+func (r *TransferRepository) Reject(ctx context.Context, id int64, reviewer string) (*model.CreditTransfer, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin transfer rejection: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := lockPendingTransfer(ctx, tx, id); err != nil {
+		return nil, err
+	}
+
+	t, err := scanTransfer(tx.QueryRowContext(ctx, `UPDATE credit_transfers
+		SET status = $2, reviewed_by = $3, completed_at = NOW()
+		WHERE id = $1
+		RETURNING `+transferColumns, id, TransferRejected, reviewer))
+	if err != nil {
+		return nil, fmt.Errorf("reject transfer %d: %w", id, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit transfer rejection: %w", err)
+	}
+
+	return t, nil
+}
+
+func (r *TransferRepository) GetByID(ctx context.Context, id int64) (*model.CreditTransfer, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	t, err := scanTransfer(r.db.QueryRowContext(ctx, `SELECT `+transferColumns+` FROM credit_transfers WHERE id = $1`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrTransferNotFound
+		}
+		return nil, fmt.Errorf("query transfer %d: %w", id, err)
+	}
+
+	return t, nil
+}
+
+func (r *TransferRepository) ListByClient(ctx context.Context, clientID int64) ([]*model.CreditTransfer, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `SELECT `+transferColumns+`
+		FROM credit_transfers
+		WHERE from_client_id = $1 OR to_client_id = $1
+		ORDER BY created_at DESC, id DESC`, clientID)
+	if err != nil {
+		return nil, fmt.Errorf("list transfers for client %d: %w", clientID, err)
+	}
+	defer rows.Close()
+
+	var transfers []*model.CreditTransfer
+	for rows.Next() {
+		t, err := scanTransfer(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan transfer: %w", err)
+		}
+		transfers = append(transfers, t)
+	}
+
+	return transfers, rows.Err()
+}
+
+func (r *TransferRepository) getByRequestID(ctx context.Context, fromClientID int64, requestID string) (*model.CreditTransfer, error) {
+	t, err := scanTransfer(r.db.QueryRowContext(ctx, `SELECT `+transferColumns+`
+		FROM credit_transfers WHERE from_client_id = $1 AND request_id = $2`, fromClientID, requestID))
+	if err != nil {
+		return nil, fmt.Errorf("query transfer by request id %q: %w", requestID, err)
+	}
+	return t, nil
+}
+
+func lockPendingTransfer(ctx context.Context, tx *sql.Tx, id int64) (*model.CreditTransfer, error) {
+	t, err := scanTransfer(tx.QueryRowContext(ctx, `SELECT `+transferColumns+` FROM credit_transfers WHERE id = $1 FOR UPDATE`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrTransferNotFound
+		}
+		return nil, fmt.Errorf("lock transfer %d: %w", id, err)
+	}
+	if t.Status != TransferPendingApproval {
+		return nil, ErrTransferNotPending
+	}
+	return t, nil
+}
+
+// completeTransfer moves the credits for t inside tx and fills in its ledger
+// references. Both wallets are locked in client id order so two opposite
+// transfers cannot deadlock, and the destination receives lots that keep the
+// expiry dates of the lots drawn from the source.
+func completeTransfer(ctx context.Context, tx *sql.Tx, t *model.CreditTransfer, actor string) error {
+	if _, err := tx.ExecContext(ctx, `INSERT INTO wallets (client_id, balance_credits) VALUES ($1, 0) ON CONFLICT (client_id) DO NOTHING`, t.ToClientID); err != nil {
+		return fmt.Errorf("ensure destination wallet: %w", err)
+	}
+
+	rows, err := tx.QueryContext(ctx, `SELECT client_id, balance_credits FROM wallets
+		WHERE client_id = ANY($1) ORDER BY client_id FOR UPDATE`, pq.Array([]int64{t.FromClientID, t.ToClientID}))
+	if err != nil {
+		return fmt.Errorf("lock wallets: %w", err)
+	}
+	balances := make(map[int64]int64, 2)
+	for rows.Next() {
+		var clientID, balance int64
+		if err := rows.Scan(&clientID, &balance); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan wallet: %w", err)
+		}
+		balances[clientID] = balance
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return fmt.Errorf("iterate wallets: %w", err)
+	}
+	rows.Close()
+
+	sourceBalance, ok := balances[t.FromClientID]
+	if !ok {
+		return ErrWalletNotFound
+	}
+	if sourceBalance < t.Credits {
+		return ErrInsufficientCredits
+	}
+
+	draws, err := consumeLots(ctx, tx, t.FromClientID, t.Credits)
+	if err != nil {
+		return err
+	}
+
+	var debitID, creditID int64
+	debitMeta, _ := json.Marshal(map[string]any{
+		"transfer_id":            t.ID,
+		"counterparty_client_id": t.ToClientID,
+	})
+	if err := tx.QueryRowContext(ctx, `INSERT INTO credit_ledger (client_id, type, credits_delta, price_cents_delta, meta)
+		VALUES ($1, 'TRANSFER_OUT', $2, 0, $3) RETURNING id`, t.FromClientID, -t.Credits, debitMeta).Scan(&debitID); err != nil {
+		return fmt.Errorf("insert transfer debit entry: %w", err)
+	}
+
+	creditMeta, _ := json.Marshal(map[string]any{
+		"transfer_id":            t.ID,
+		"counterparty_client_id": t.FromClientID,
+		"counterpart_entry_id":   debitID,
+	})
+	if err := tx.QueryRowContext(ctx, `INSERT INTO credit_ledger (client_id, type, credits_delta, price_cents_delta, meta)
+		VALUES ($1, 'TRANSFER_IN', $2, 0, $3) RETURNING id`, t.ToClientID, t.Credits, creditMeta).Scan(&creditID); err != nil {
+		return fmt.Errorf("insert transfer credit entry: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE credit_ledger SET meta = meta || jsonb_build_object('counterpart_entry_id', $2::bigint) WHERE id = $1`, debitID, creditID); err != nil {
+		return fmt.Errorf("link transfer debit entry: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE wallets SET balance_credits = balance_credits - $2 WHERE client_id = $1`, t.FromClientID, t.Credits); err != nil {
+		return fmt.Errorf("debit source wallet: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE wallets SET balance_credits = balance_credits + $2 WHERE client_id = $1`, t.ToClientID, t.Credits); err != nil {
+		return fmt.Errorf("credit destination wallet: %w", err)
+	}
+
+	// Credits that pay back the destination's overdraft are not lotted; the
+	// soonest-expiring ones go first, as they would have been spent first.
+	// consumeLots drew exactly t.Credits, so the draws cover every credit
+	// that is not skipped.
+	skip, err := settleDebt(ctx, tx, t.ToClientID, balances[t.ToClientID], t.Credits, creditID)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range draws {
+		used := min(skip, d.amount)
+		skip -= used
+		if d.amount == used {
+			continue
+		}
+		if err := insertTransferLot(ctx, tx, t.ToClientID, creditID, d.amount-used, d.expiresAt); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now().UTC()
+	reviewer := sql.NullString{}
+	if t.Status == TransferPendingApproval && actor != t.RequestedBy {
+		reviewer = sql.NullString{String: actor, Valid: true}
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE credit_transfers
+		SET status = $2, reviewed_by = COALESCE($3, reviewed_by), debit_entry_id = $4, credit_entry_id = $5, completed_at = $6
+		WHERE id = $1`, t.ID, TransferCompleted, reviewer, debitID, creditID, now); err != nil {
+		return fmt.Errorf("complete transfer %d: %w", t.ID, err)
+	}
+
+	t.Status = TransferCompleted
+	if reviewer.Valid {
+		t.ReviewedBy = reviewer.String
+	}
+	t.DebitEntryID = &debitID
+	t.CreditEntryID = &creditID
+	t.CompletedAt = &now
+
+	return nil
+}
+
+func insertTransferLot(ctx context.Context, tx *sql.Tx, clientID, ledgerID, credits int64, expiresAt *time.Time) error {
+	if _, err := tx.ExecContext(ctx, `INSERT INTO credit_lots (client_id, source, ledger_id, credits_total, credits_remaining, expires_at)
+		VALUES ($1, 'TRANSFER', $2, $3, $3, $4)`, clientID, ledgerID, credits, expiresAt); err != nil {
+		return fmt.Errorf("insert transfer lot: %w", err)
+	}
+	return nil
+}
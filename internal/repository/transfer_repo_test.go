@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/Enilsonn/CRUD-Postgres/internal/model"
+)
+
+var transferColumnNames = []string{"id", "from_client_id", "to_client_id", "credits", "status", "note", "request_id",
+	"requested_by", "reviewed_by", "debit_entry_id", "credit_entry_id", "created_at", "completed_at"}
+
+func TestTransferReplay(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		replay  model.CreditTransfer
+		wantErr error
+	}{
+		{"same payload returns the original", model.CreditTransfer{ToClientID: 2, Credits: 500, Note: "rent"}, nil},
+		{"other recipient", model.CreditTransfer{ToClientID: 3, Credits: 500, Note: "rent"}, ErrTransferReplayed},
+		{"other amount", model.CreditTransfer{ToClientID: 2, Credits: 501, Note: "rent"}, ErrTransferReplayed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("sqlmock: %v", err)
+			}
+			defer db.Close()
+
+			mock.ExpectBegin()
+			// ON CONFLICT DO NOTHING returns no row for a replay.
+			mock.ExpectQuery(`INSERT INTO credit_transfers`).WillReturnRows(sqlmock.NewRows(transferColumnNames))
+			mock.ExpectQuery(`FROM credit_transfers WHERE from_client_id = \$1 AND request_id = \$2`).
+				WithArgs(int64(1), "req-1").WillReturnRows(sqlmock.NewRows(transferColumnNames).
+				AddRow(9, 1, 2, 500, TransferCompleted, "rent", "req-1", "client:1", "", 31, 32, now, now))
+			mock.ExpectRollback()
+
+			replay := tt.replay
+			replay.FromClientID = 1
+			replay.RequestID = "req-1"
+			got, err := NewTransferRepository(db).Create(context.Background(), &replay, true)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && got.ID != 9 {
+				t.Errorf("got transfer %d, want the original 9", got.ID)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
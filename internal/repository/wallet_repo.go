@@ -4,9 +4,21 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/Enilsonn/CRUD-Postgres/internal/model"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrWalletNotFound      = NotFoundf("wallet not found")
+	ErrInsufficientCredits = errors.New("insufficient credits")
+	ErrMemberLimitExceeded = errors.New("member monthly spending limit exceeded")
+	ErrCreditLimitExceeded = errors.New("credit limit exceeded")
 )
 
 type WalletRepository struct {
@@ -17,15 +29,86 @@ func NewWalletRepository(db *sql.DB) *WalletRepository {
 	return &WalletRepository{db: db}
 }
 
+// LedgerFilters narrows credit_ledger reads. A nil ClientID spans every client.
+type LedgerFilters struct {
+	ClientID *int64
+	Types    []string
+	From     *time.Time
+	To       *time.Time
+	Model    string
+	OrderID  *int64
+	OrgID    *int64
+	MemberID *int64
+}
+
+// LedgerCursor is the keyset position of the last entry already returned.
+type LedgerCursor struct {
+	CreatedAt time.Time
+	ID        int64
+}
+
+func (f LedgerFilters) where(argPos int) (string, []any) {
+	var (
+		clauses []string
+		args    []any
+	)
+
+	if f.ClientID != nil {
+		clauses = append(clauses, fmt.Sprintf("client_id = $%d", argPos))
+		args = append(args, *f.ClientID)
+		argPos++
+	}
+	if len(f.Types) > 0 {
+		clauses = append(clauses, fmt.Sprintf("type::text = ANY($%d)", argPos))
+		args = append(args, pq.Array(f.Types))
+		argPos++
+	}
+	if f.From != nil {
+		clauses = append(clauses, fmt.Sprintf("created_at >= $%d", argPos))
+		args = append(args, f.From.UTC())
+		argPos++
+	}
+	if f.To != nil {
+		clauses = append(clauses, fmt.Sprintf("created_at < $%d", argPos))
+		args = append(args, f.To.UTC())
+		argPos++
+	}
+	if f.Model != "" {
+		clauses = append(clauses, fmt.Sprintf("meta->>'model' = $%d", argPos))
+		args = append(args, f.Model)
+		argPos++
+	}
+	if f.OrderID != nil {
+		clauses = append(clauses, fmt.Sprintf("meta->>'order_id' = $%d", argPos))
+		args = append(args, strconv.FormatInt(*f.OrderID, 10))
+		argPos++
+	}
+	if f.OrgID != nil {
+		clauses = append(clauses, fmt.Sprintf("org_id = $%d", argPos))
+		args = append(args, *f.OrgID)
+		argPos++
+	}
+	if f.MemberID != nil {
+		clauses = append(clauses, fmt.Sprintf("member_client_id = $%d", argPos))
+		args = append(args, *f.MemberID)
+		argPos++
+	}
+
+	if len(clauses) == 0 {
+		return "TRUE", args
+	}
+	return strings.Join(clauses, " AND "), args
+}
+
 func (r *WalletRepository) GetWalletByClientID(ctx context.Context, clientID int64) (*model.Wallet, error) {
 	wallet := &model.Wallet{}
 
 	sqlGet := `
-		SELECT client_id, balance_credits
+		SELECT client_id, balance_credits, credit_limit_credits
 		FROM wallets
 		WHERE client_id = $1`
 	err := r.db.QueryRowContext(ctx, sqlGet,
-		clientID).Scan(&wallet.ClientID, &wallet.BalanceCredits)
+		clientID).Scan(&wallet.ClientID, &wallet.BalanceCredits, &wallet.CreditLimitCredits)
 
 	sqlInsert := `
 			INSERT INTO wallets (client_id, balance_credits)
@@ -46,9 +129,75 @@ func (r *WalletRepository) GetWalletByClientID(ctx context.Context, clientID int
 		return nil, fmt.Errorf("failed to get wallet: %w", err)
 	}
 
+	wallet.DebtCredits = max(-wallet.BalanceCredits, 0)
+	wallet.AvailableCredits = wallet.BalanceCredits + wallet.CreditLimitCredits
 	return wallet, nil
 }
 
+// SetCreditLimit changes how far below zero the client's wallet may go. A
+// limit smaller than the debt already owed is refused.
+func (r *WalletRepository) SetCreditLimit(ctx context.Context, clientID, limit int64) (*model.Wallet, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin set credit limit: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `INSERT INTO wallets (client_id, balance_credits) VALUES ($1, 0)
+		ON CONFLICT (client_id) DO NOTHING`, clientID); err != nil {
+		return nil, fmt.Errorf("ensure wallet for client %d: %w", clientID, err)
+	}
+
+	wallet := &model.Wallet{ClientID: clientID}
+	if err := tx.QueryRowContext(ctx, `SELECT balance_credits FROM wallets WHERE client_id = $1 FOR UPDATE`,
+		clientID).Scan(&wallet.BalanceCredits); err != nil {
+		return nil, fmt.Errorf("lock wallet for client %d: %w", clientID, err)
+	}
+	if -wallet.BalanceCredits > limit {
+		return nil, Invalidf("invalid credit limit: client %d owes %d credits", clientID, -wallet.BalanceCredits)
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE wallets SET credit_limit_credits = $2 WHERE client_id = $1`, clientID, limit); err != nil {
+		return nil, fmt.Errorf("update credit limit for client %d: %w", clientID, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit set credit limit: %w", err)
+	}
+
+	wallet.CreditLimitCredits = limit
+	wallet.DebtCredits = max(-wallet.BalanceCredits, 0)
+	wallet.AvailableCredits = wallet.BalanceCredits + limit
+	return wallet, nil
+}
+
+// settleDebt books a DEBT_SETTLEMENT entry when credits arrive at a wallet
+// that was overdrawn, and returns how many of them paid the debt back. The
+// entry moves no credits itself; it documents how sourceEntryID was applied.
+func settleDebt(ctx context.Context, tx *sql.Tx, clientID, balanceBefore, credits, sourceEntryID int64) (int64, error) {
+	settled := min(max(-balanceBefore, 0), credits)
+	if settled == 0 {
+		return 0, nil
+	}
+
+	meta, _ := json.Marshal(map[string]any{
+		"type":                "debt_settlement",
+		"settled_credits":     settled,
+		"debt_before":         -balanceBefore,
+		"debt_after":          -balanceBefore - settled,
+		"settled_by_entry_id": sourceEntryID,
+	})
+	if _, err := tx.ExecContext(ctx, `INSERT INTO credit_ledger (client_id, type, credits_delta, price_cents_delta, meta)
+		VALUES ($1, 'DEBT_SETTLEMENT', 0, 0, $2)`, clientID, meta); err != nil {
+		return 0, fmt.Errorf("insert debt settlement entry: %w", err)
+	}
+
+	return settled, nil
+}
+
 func (r *WalletRepository) GetLedgerEntries(ctx context.Context, clientID int64, limit, offset int) ([]*model.CreditLedgerEntry, error) {
 	sql := `
 		SELECT id, client_id, type, credits_delta, price_cents_delta, meta, created_at
@@ -88,7 +237,196 @@ func (r *WalletRepository) GetLedgerEntries(ctx context.Context, clientID int64,
 	return entries, nil
 }
 
-func (r *WalletRepository) ProcessTopUp(ctx context.Context, clientID int64, credits int, priceCents int64, requestID string) (int64, error) {
+func (r *WalletRepository) SearchLedger(ctx context.Context, filters LedgerFilters, after *LedgerCursor, limit int) ([]*model.CreditLedgerEntry, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	where, args := filters.where(1)
+
+	query := strings.Builder{}
+	query.WriteString(`SELECT id, client_id, type::text, credits_delta, price_cents_delta, meta, org_id, member_client_id, created_at
+		FROM credit_ledger WHERE `)
+	query.WriteString(where)
+
+	if after != nil {
+		query.WriteString(fmt.Sprintf(" AND (created_at, id) < ($%d, $%d)", len(args)+1, len(args)+2))
+		args = append(args, after.CreatedAt.UTC(), after.ID)
+	}
+
+	query.WriteString(fmt.Sprintf(" ORDER BY created_at DESC, id DESC LIMIT $%d", len(args)+1))
+	args = append(args, limit)
+
+	rows, err := r.db.QueryContext(ctx, query.String(), args...)
+	if err != nil {
+		return nil, fmt.Errorf("search ledger entries: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []*model.CreditLedgerEntry
+	for rows.Next() {
+		entry := &model.CreditLedgerEntry{}
+		var metaBytes []byte
+		if err := rows.Scan(
+			&entry.ID,
+			&entry.ClientID,
+			&entry.Type,
+			&entry.CreditsDelta,
+			&entry.PriceCentsDelta,
+			&metaBytes,
+			&entry.OrgID,
+			&entry.MemberClientID,
+			&entry.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("scan ledger entry: %w", err)
+		}
+		entry.Meta = json.RawMessage(metaBytes)
+		entries = append(entries, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate ledger entries: %w", err)
+	}
+
+	return entries, nil
+}
+
+func (r *WalletRepository) SumLedger(ctx context.Context, filters LedgerFilters) (*model.LedgerTotals, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	where, args := filters.where(1)
+
+	rows, err := r.db.QueryContext(ctx, `SELECT type::text,
+			COUNT(*),
+			COALESCE(SUM(credits_delta) FILTER (WHERE credits_delta > 0), 0),
+			COALESCE(SUM(credits_delta) FILTER (WHERE credits_delta < 0), 0),
+			COALESCE(SUM(price_cents_delta), 0)
+		FROM credit_ledger WHERE `+where+`
+		GROUP BY type`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("sum ledger entries: %w", err)
+	}
+	defer rows.Close()
+
+	totals := &model.LedgerTotals{CreditsByType: map[string]int64{}}
+	for rows.Next() {
+		var (
+			entryType  string
+			count      int64
+			creditsIn  int64
+			creditsOut int64
+			priceCents int64
+		)
+		if err := rows.Scan(&entryType, &count, &creditsIn, &creditsOut, &priceCents); err != nil {
+			return nil, fmt.Errorf("scan ledger totals: %w", err)
+		}
+
+		totals.EntriesCount += count
+		totals.CreditsIn += creditsIn
+		totals.CreditsOut += -creditsOut
+		totals.PriceCentsTotal += priceCents
+		totals.CreditsByType[entryType] = creditsIn + creditsOut
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate ledger totals: %w", err)
+	}
+
+	totals.NetCredits = totals.CreditsIn - totals.CreditsOut
+	return totals, nil
+}
+
+// Statement reads a client's totals for [from, to) and hands them to begin,
+// then walks the period's entries oldest first, handing each row to fn as it
+// is scanned so callers never hold the whole period in memory. Both reads
+// share one REPEATABLE READ snapshot: entries committed in between would
+// otherwise appear in the rows but not in the totals printed above them.
+func (r *WalletRepository) Statement(ctx context.Context, clientID int64, from, to time.Time, begin func(*model.WalletStatement) error, fn func(*model.CreditLedgerEntry) error) error {
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("begin statement for client %d: %w", clientID, err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := statementTotals(ctx, tx, clientID, from, to)
+	if err != nil {
+		return err
+	}
+	if err := begin(stmt); err != nil {
+		return err
+	}
+
+	return streamLedger(ctx, tx, clientID, stmt.PeriodStart, stmt.PeriodEnd, fn)
+}
+
+func statementTotals(ctx context.Context, tx *sql.Tx, clientID int64, from, to time.Time) (*model.WalletStatement, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	stmt := &model.WalletStatement{
+		ClientID:    clientID,
+		PeriodStart: from.UTC(),
+		PeriodEnd:   to.UTC(),
+	}
+
+	err := tx.QueryRowContext(ctx, `SELECT
+			COALESCE(SUM(credits_delta) FILTER (WHERE created_at < $2), 0),
+			COALESCE(SUM(credits_delta) FILTER (WHERE created_at >= $2 AND credits_delta > 0), 0),
+			COALESCE(-SUM(credits_delta) FILTER (WHERE created_at >= $2 AND credits_delta < 0), 0),
+			COALESCE(SUM(price_cents_delta) FILTER (WHERE created_at >= $2), 0),
+			COUNT(*) FILTER (WHERE created_at >= $2)
+		FROM credit_ledger
+		WHERE client_id = $1 AND created_at < $3`,
+		clientID, stmt.PeriodStart, stmt.PeriodEnd,
+	).Scan(&stmt.OpeningBalance, &stmt.CreditsIn, &stmt.CreditsOut, &stmt.CentsSpent, &stmt.EntriesCount)
+	if err != nil {
+		return nil, fmt.Errorf("query statement totals for client %d: %w", clientID, err)
+	}
+
+	stmt.ClosingBalance = stmt.OpeningBalance + stmt.CreditsIn - stmt.CreditsOut
+	return stmt, nil
+}
+
+func streamLedger(ctx context.Context, tx *sql.Tx, clientID int64, from, to time.Time, fn func(*model.CreditLedgerEntry) error) error {
+	rows, err := tx.QueryContext(ctx, `SELECT id, client_id, type::text, credits_delta, price_cents_delta, meta, created_at
+		FROM credit_ledger
+		WHERE client_id = $1 AND created_at >= $2 AND created_at < $3
+		ORDER BY created_at ASC, id ASC`,
+		clientID, from.UTC(), to.UTC())
+	if err != nil {
+		return fmt.Errorf("stream ledger for client %d: %w", clientID, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		entry := &model.CreditLedgerEntry{}
+		var metaBytes []byte
+		if err := rows.Scan(
+			&entry.ID,
+			&entry.ClientID,
+			&entry.Type,
+			&entry.CreditsDelta,
+			&entry.PriceCentsDelta,
+			&metaBytes,
+			&entry.CreatedAt,
+		); err != nil {
+			return fmt.Errorf("scan ledger entry: %w", err)
+		}
+		entry.Meta = json.RawMessage(metaBytes)
+
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterate ledger entries: %w", err)
+	}
+
+	return nil
+}
+
+func (r *WalletRepository) ProcessTopUp(ctx context.Context, clientID int64, credits int, priceCents int64, validityDays *int, requestID string) (int64, error) {
 	tx, err := r.db.Begin()
 	if err != nil {
 		return 0, fmt.Errorf("failed to begin transaction: %w", err)
@@ -103,12 +441,14 @@ func (r *WalletRepository) ProcessTopUp(ctx context.Context, clientID int64, cre
 	metaBytes, _ := json.Marshal(meta)
 
 	// Insert into ledger
+	var ledgerID int64
 	sql := `
 		INSERT INTO credit_ledger (client_id, type, credits_delta, price_cents_delta, meta)
-		VALUES ($1, 'TOPUP', $2, $3, $4)`
-	_, err = tx.ExecContext(ctx,
+		VALUES ($1, 'TOPUP', $2, $3, $4)
+		RETURNING id`
+	err = tx.QueryRowContext(ctx,
 		sql,
-		clientID, int64(credits), priceCents, metaBytes)
+		clientID, int64(credits), priceCents, metaBytes).Scan(&ledgerID)
 	if err != nil {
 		return 0, fmt.Errorf("failed to insert ledger entry: %w", err)
 	}
@@ -129,6 +469,25 @@ func (r *WalletRepository) ProcessTopUp(ctx context.Context, clientID int64, cre
 		return 0, fmt.Errorf("failed to update wallet balance: %w", err)
 	}
 
+	// Credits that pay back an overdraft never reach a lot
+	settled, err := settleDebt(ctx, tx, clientID, newBalance-int64(credits), int64(credits), ledgerID)
+	if err != nil {
+		return 0, err
+	}
+
+	// Track the purchase as a lot so it can expire on its own schedule
+	if lotCredits := int64(credits) - settled; lotCredits > 0 {
+		sql = `
+		INSERT INTO credit_lots (client_id, source, ledger_id, credits_total, credits_remaining, expires_at)
+		VALUES ($1, 'TOPUP', $2, $3, $3, CASE WHEN $4::int IS NULL THEN NULL ELSE NOW() + make_interval(days => $4::int) END)`
+		_, err = tx.ExecContext(ctx,
+			sql,
+			clientID, ledgerID, lotCredits, validityDays)
+		if err != nil {
+			return 0, fmt.Errorf("failed to insert credit lot: %w", err)
+		}
+	}
+
 	if err = tx.Commit(); err != nil {
 		return 0, fmt.Errorf("failed to commit transaction: %w", err)
 	}
@@ -136,31 +495,91 @@ func (r *WalletRepository) ProcessTopUp(ctx context.Context, clientID int64, cre
 	return newBalance, nil
 }
 
-func (r *WalletRepository) ProcessUsage(ctx context.Context, clientID int64, model string, promptTokens, completionTokens, creditsSpent int64, meta map[string]any) (int64, error) {
+// TopUpsSince sums the TOPUP ledger entries after afterID booked before
+// settledBefore and returns the highest id summed, see
+// OrderRepository.StatusChangesSince.
+func (r *WalletRepository) TopUpsSince(ctx context.Context, afterID int64, settledBefore time.Time) (model.TopUpTotals, int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var totals model.TopUpTotals
+	lastID := afterID
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*), COALESCE(SUM(credits_delta), 0), COALESCE(SUM(price_cents_delta), 0), COALESCE(MAX(id), $1)
+		FROM credit_ledger
+		WHERE type = 'TOPUP' AND id > $1 AND created_at < $2`, afterID, settledBefore.UTC()).
+		Scan(&totals.Entries, &totals.Credits, &totals.PriceCents, &lastID)
+	if err != nil {
+		return model.TopUpTotals{}, afterID, fmt.Errorf("sum top-ups: %w", err)
+	}
+
+	return totals, lastID, nil
+}
+
+// ProcessUsage debits creditsSpent for clientID's usage. Members of an
+// organization are charged against the organization's shared wallet, within
+// their monthly cap, and the ledger entry records both the org and the member.
+func (r *WalletRepository) ProcessUsage(ctx context.Context, clientID int64, modelName string, promptTokens, completionTokens, creditsSpent int64, meta map[string]any) (*model.UsageCharge, error) {
 	tx, err := r.db.Begin()
 	if err != nil {
-		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	defer tx.Rollback()
 
-	// Check current balance
-	var currentBalance int64
+	// Resolve which wallet pays: the client's own or its organization's
+	charge := &model.UsageCharge{WalletClientID: clientID}
+	var (
+		memberID     *int64
+		monthlyLimit *int64
+	)
 	sqlQuerie := `
-		SELECT COALESCE(balance_credits, 0)
+		SELECT m.org_id, o.billing_client_id, m.monthly_limit_credits
+		FROM organization_members m
+		JOIN organizations o ON o.id = m.org_id
+		WHERE m.client_id = $1`
+	var orgID int64
+	err = tx.QueryRowContext(ctx,
+		sqlQuerie,
+		clientID).Scan(&orgID, &charge.WalletClientID, &monthlyLimit)
+	if err == nil {
+		charge.OrgID = &orgID
+		memberID = &clientID
+	} else if err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to resolve organization membership: %w", err)
+	}
+
+	// Check current balance and credit line
+	var currentBalance, creditLimit int64
+	sqlQuerie = `
+		SELECT COALESCE(balance_credits, 0), credit_limit_credits
 		FROM wallets
-		WHERE client_id = $1`
+		WHERE client_id = $1
+		FOR UPDATE`
 	err = tx.QueryRowContext(ctx,
 		sqlQuerie,
-		clientID).Scan(&currentBalance)
+		charge.WalletClientID).Scan(&currentBalance, &creditLimit)
 	if err == sql.ErrNoRows {
-		return 0, fmt.Errorf("wallet not found")
+		return nil, ErrWalletNotFound
 	} else if err != nil {
-		return 0, fmt.Errorf("failed to check wallet balance: %w", err)
+		return nil, fmt.Errorf("failed to check wallet balance: %w", err)
 	}
 
-	// Check if sufficient balance
-	if currentBalance < creditsSpent {
-		return 0, fmt.Errorf("insufficient credits")
+	// Check if sufficient balance, drawing on the credit line if there is one
+	if currentBalance+creditLimit < creditsSpent {
+		if creditLimit > 0 {
+			return nil, ErrCreditLimitExceeded
+		}
+		return nil, ErrInsufficientCredits
+	}
+
+	// The org wallet lock above serializes members, so the cap check is safe
+	if monthlyLimit != nil {
+		var spent int64
+		if err = tx.QueryRowContext(ctx, monthlySpentQuery, orgID, clientID).Scan(&spent); err != nil {
+			return nil, fmt.Errorf("failed to sum member spending: %w", err)
+		}
+		if spent+creditsSpent > *monthlyLimit {
+			return nil, ErrMemberLimitExceeded
+		}
 	}
 
 	// Insert usage event
@@ -169,9 +588,9 @@ func (r *WalletRepository) ProcessUsage(ctx context.Context, clientID int64, mod
 		VALUES ($1, $2, $3, $4, $5)`
 	_, err = tx.ExecContext(ctx,
 		sqlQuerie,
-		clientID, model, promptTokens, completionTokens, creditsSpent)
+		clientID, modelName, promptTokens, completionTokens, creditsSpent)
 	if err != nil {
-		return 0, fmt.Errorf("failed to insert usage event: %w", err)
+		return nil, fmt.Errorf("failed to insert usage event: %w", err)
 	}
 
 	// Create metadata snapshot for the ledger entry
@@ -179,24 +598,36 @@ func (r *WalletRepository) ProcessUsage(ctx context.Context, clientID int64, mod
 	for k, v := range meta {
 		metaCopy[k] = v
 	}
-	metaCopy["model"] = model
+	metaCopy["model"] = modelName
 	metaCopy["prompt_tokens"] = promptTokens
 	metaCopy["completion_tokens"] = completionTokens
+	if charge.OrgID != nil {
+		metaCopy["org_id"] = orgID
+		metaCopy["member_client_id"] = clientID
+	}
+	if overdraft := creditsSpent - max(currentBalance, 0); overdraft > 0 {
+		metaCopy["overdraft_credits"] = overdraft
+	}
 	metaBytes, _ := json.Marshal(metaCopy)
 
 	// Insert into ledger (negative for usage)
 	sqlQuerie = `
-		INSERT INTO credit_ledger (client_id, type, credits_delta, price_cents_delta, meta)
-		VALUES ($1, 'USAGE', $2, 0, $3)`
+		INSERT INTO credit_ledger (client_id, type, credits_delta, price_cents_delta, meta, org_id, member_client_id)
+		VALUES ($1, 'USAGE', $2, 0, $3, $4, $5)`
 	_, err = tx.ExecContext(ctx,
 		sqlQuerie,
-		clientID, -creditsSpent, metaBytes)
+		charge.WalletClientID, -creditsSpent, metaBytes, charge.OrgID, memberID)
 	if err != nil {
-		return 0, fmt.Errorf("failed to insert ledger entry: %w", err)
+		return nil, fmt.Errorf("failed to insert ledger entry: %w", err)
+	}
+
+	// Lots back only the positive balance; whatever runs into the credit
+	// line is debt and draws on no lot.
+	if _, err = consumeLots(ctx, tx, charge.WalletClientID, min(creditsSpent, max(currentBalance, 0))); err != nil {
+		return nil, err
 	}
 
 	// Update wallet balance
-	var newBalance int64
 	sqlQuerie = `
 		UPDATE wallets
 		SET balance_credits = balance_credits - $2
@@ -204,14 +635,370 @@ func (r *WalletRepository) ProcessUsage(ctx context.Context, clientID int64, mod
 		RETURNING balance_credits`
 	err = tx.QueryRowContext(ctx,
 		sqlQuerie,
-		clientID, creditsSpent).Scan(&newBalance)
+		charge.WalletClientID, creditsSpent).Scan(&charge.BalanceCredits)
 	if err != nil {
-		return 0, fmt.Errorf("failed to update wallet balance: %w", err)
+		return nil, fmt.Errorf("failed to update wallet balance: %w", err)
 	}
 
 	if err = tx.Commit(); err != nil {
-		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
-	return newBalance, nil
+	return charge, nil
+}
+
+// creditGrant describes credits added to a wallet outside an order. The
+// ledger entry is a TOPUP unless entryType says otherwise.
+type creditGrant struct {
+	entryType  string
+	clientID   int64
+	credits    int64
+	priceCents int64
+	meta       map[string]any
+	lotSource  string
+	orderID    *int64
+	planID     *int64
+	expiresAt  *time.Time
+}
+
+// grantCredits books a TOPUP entry for g, credits the wallet, settles any
+// overdraft first and puts the remainder in a lot. It returns the entry id.
+func grantCredits(ctx context.Context, tx *sql.Tx, g creditGrant) (int64, error) {
+	meta, _ := json.Marshal(g.meta)
+	entryType := g.entryType
+	if entryType == "" {
+		entryType = "TOPUP"
+	}
+
+	var ledgerID int64
+	if err := tx.QueryRowContext(ctx, `INSERT INTO credit_ledger (client_id, type, credits_delta, price_cents_delta, meta)
+		VALUES ($1, $5::credit_type, $2, $3, $4) RETURNING id`, g.clientID, g.credits, g.priceCents, meta, entryType).Scan(&ledgerID); err != nil {
+		return 0, fmt.Errorf("insert credit grant entry: %w", err)
+	}
+
+	var balance int64
+	if err := tx.QueryRowContext(ctx, `INSERT INTO wallets (client_id, balance_credits) VALUES ($1, $2)
+		ON CONFLICT (client_id) DO UPDATE SET balance_credits = wallets.balance_credits + EXCLUDED.balance_credits
+		RETURNING balance_credits`, g.clientID, g.credits).Scan(&balance); err != nil {
+		return 0, fmt.Errorf("credit wallet for client %d: %w", g.clientID, err)
+	}
+
+	settled, err := settleDebt(ctx, tx, g.clientID, balance-g.credits, g.credits, ledgerID)
+	if err != nil {
+		return 0, err
+	}
+
+	if rest := g.credits - settled; rest > 0 {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO credit_lots (client_id, source, ledger_id, order_id, plan_id, credits_total, credits_remaining, expires_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $6, $7)`, g.clientID, g.lotSource, ledgerID, g.orderID, g.planID, rest, g.expiresAt); err != nil {
+			return 0, fmt.Errorf("insert credit lot: %w", err)
+		}
+	}
+
+	return ledgerID, nil
+}
+
+// GrantCredits gives clientID free credits as a TOPUP entry priced at zero,
+// in a GRANT lot that expires after validityDays when set.
+func (r *WalletRepository) GrantCredits(ctx context.Context, clientID, credits int64, validityDays *int, reason, actor string) (*model.Wallet, error) {
+	if credits <= 0 {
+		return nil, Invalidf("invalid grant of %d credits: must be positive", credits)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin credit grant: %w", err)
+	}
+	defer tx.Rollback()
+
+	g := creditGrant{
+		clientID:  clientID,
+		credits:   credits,
+		meta:      map[string]any{"type": "grant", "reason": reason, "actor": actor},
+		lotSource: "GRANT",
+	}
+	if validityDays != nil {
+		expiresAt := time.Now().AddDate(0, 0, *validityDays)
+		g.expiresAt = &expiresAt
+	}
+	if _, err := grantCredits(ctx, tx, g); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit credit grant: %w", err)
+	}
+
+	return r.GetWalletByClientID(ctx, clientID)
+}
+
+// AdjustCredits books a manual ADJUST entry of delta credits. Credits added
+// settle any debt first, like a top-up; credits removed come out of the
+// client's lots and may not take the balance below zero.
+func (r *WalletRepository) AdjustCredits(ctx context.Context, clientID, delta int64, reason, actor string) (*model.Wallet, error) {
+	if delta == 0 {
+		return nil, Invalidf("invalid adjustment: delta cannot be zero")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin credit adjustment: %w", err)
+	}
+	defer tx.Rollback()
+
+	meta := map[string]any{"type": "adjustment", "reason": reason, "actor": actor}
+
+	if delta > 0 {
+		if _, err := grantCredits(ctx, tx, creditGrant{
+			entryType: "ADJUST",
+			clientID:  clientID,
+			credits:   delta,
+			meta:      meta,
+			lotSource: "ADJUST",
+		}); err != nil {
+			return nil, err
+		}
+	} else {
+		var balance int64
+		err := tx.QueryRowContext(ctx, `SELECT balance_credits FROM wallets WHERE client_id = $1 FOR UPDATE`, clientID).Scan(&balance)
+		if err == sql.ErrNoRows {
+			return nil, ErrWalletNotFound
+		}
+		if err != nil {
+			return nil, fmt.Errorf("lock wallet for client %d: %w", clientID, err)
+		}
+		if balance+delta < 0 {
+			return nil, ErrInsufficientCredits
+		}
+
+		metaBytes, _ := json.Marshal(meta)
+		if _, err := tx.ExecContext(ctx, `INSERT INTO credit_ledger (client_id, type, credits_delta, price_cents_delta, meta)
+			VALUES ($1, 'ADJUST', $2, 0, $3)`, clientID, delta, metaBytes); err != nil {
+			return nil, fmt.Errorf("insert adjustment entry: %w", err)
+		}
+		if _, err := consumeLots(ctx, tx, clientID, -delta); err != nil {
+			return nil, err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE wallets SET balance_credits = balance_credits + $2 WHERE client_id = $1`, clientID, delta); err != nil {
+			return nil, fmt.Errorf("debit wallet for client %d: %w", clientID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit credit adjustment: %w", err)
+	}
+
+	return r.GetWalletByClientID(ctx, clientID)
+}
+
+// ReconcileWallets lists every wallet whose balance disagrees with its
+// ledger, or whose positive balance is not exactly covered by its lots.
+func (r *WalletRepository) ReconcileWallets(ctx context.Context) ([]model.WalletDrift, error) {
+	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT w.client_id, w.balance_credits, COALESCE(l.credits, 0), COALESCE(lots.credits, 0)
+		FROM wallets w
+		LEFT JOIN (
+			SELECT client_id, SUM(credits_delta) AS credits FROM credit_ledger GROUP BY client_id
+		) l ON l.client_id = w.client_id
+		LEFT JOIN (
+			SELECT client_id, SUM(credits_remaining) AS credits FROM credit_lots GROUP BY client_id
+		) lots ON lots.client_id = w.client_id
+		WHERE w.balance_credits <> COALESCE(l.credits, 0)
+		   OR GREATEST(w.balance_credits, 0) <> COALESCE(lots.credits, 0)
+		ORDER BY w.client_id`)
+	if err != nil {
+		return nil, fmt.Errorf("reconcile wallets: %w", err)
+	}
+	defer rows.Close()
+
+	var drifts []model.WalletDrift
+	for rows.Next() {
+		var d model.WalletDrift
+		if err := rows.Scan(&d.ClientID, &d.BalanceCredits, &d.LedgerCredits, &d.LotCredits); err != nil {
+			return nil, fmt.Errorf("scan wallet drift: %w", err)
+		}
+		drifts = append(drifts, d)
+	}
+
+	return drifts, rows.Err()
+}
+
+// lotDraw is the part of a lot taken by consumeLots.
+type lotDraw struct {
+	lotID     int64
+	amount    int64
+	expiresAt *time.Time
+}
+
+// consumeLots draws credits from the client's open lots, soonest expiry first,
+// with non-expiring lots used last. The wallet row must already be locked.
+// If the open lots hold less than credits, nothing is drawn and the error
+// wraps ErrInsufficientCredits: the balance counts credits that have lapsed
+// or were never backed by a lot, and spending them would hide the drift.
+func consumeLots(ctx context.Context, tx *sql.Tx, clientID, credits int64) ([]lotDraw, error) {
+	if credits <= 0 {
+		return nil, nil
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, credits_remaining, expires_at
+		FROM credit_lots
+		WHERE client_id = $1
+		  AND credits_remaining > 0
+		  AND (expires_at IS NULL OR expires_at > NOW())
+		ORDER BY expires_at ASC NULLS LAST, id ASC
+		FOR UPDATE`, clientID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock credit lots: %w", err)
+	}
+
+	var draws []lotDraw
+	remaining := credits
+	for rows.Next() && remaining > 0 {
+		var (
+			d         lotDraw
+			available int64
+		)
+		if err := rows.Scan(&d.lotID, &available, &d.expiresAt); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan credit lot: %w", err)
+		}
+		d.amount = min(available, remaining)
+		draws = append(draws, d)
+		remaining -= d.amount
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return nil, fmt.Errorf("failed to iterate credit lots: %w", err)
+	}
+	rows.Close()
+	if remaining > 0 {
+		return nil, fmt.Errorf("client %d has %d credits in open lots, %d short of %d: %w",
+			clientID, credits-remaining, remaining, credits, ErrInsufficientCredits)
+	}
+
+	for _, d := range draws {
+		if _, err := tx.ExecContext(ctx, `UPDATE credit_lots SET credits_remaining = credits_remaining - $2 WHERE id = $1`, d.lotID, d.amount); err != nil {
+			return nil, fmt.Errorf("failed to consume credit lot %d: %w", d.lotID, err)
+		}
+	}
+
+	return draws, nil
+}
+
+func (r *WalletRepository) ListOpenLots(ctx context.Context, clientID int64) ([]model.CreditLot, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `SELECT id, client_id, source, order_id, plan_id, credits_total, credits_remaining, expires_at, created_at
+		FROM credit_lots
+		WHERE client_id = $1 AND credits_remaining > 0 AND (expires_at IS NULL OR expires_at > NOW())
+		ORDER BY expires_at ASC NULLS LAST, id ASC`, clientID)
+	if err != nil {
+		return nil, fmt.Errorf("list credit lots for client %d: %w", clientID, err)
+	}
+	defer rows.Close()
+
+	var lots []model.CreditLot
+	for rows.Next() {
+		var lot model.CreditLot
+		if err := rows.Scan(&lot.ID, &lot.ClientID, &lot.Source, &lot.OrderID, &lot.PlanID, &lot.CreditsTotal, &lot.CreditsRemaining, &lot.ExpiresAt, &lot.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan credit lot: %w", err)
+		}
+		lots = append(lots, lot)
+	}
+
+	return lots, rows.Err()
+}
+
+// ExpireLots zeroes every lapsed lot that still holds credits and books a
+// matching EXPIRE ledger entry. At most batchSize lots are handled per call;
+// concurrent runners skip lots another transaction already holds.
+func (r *WalletRepository) ExpireLots(ctx context.Context, now time.Time, batchSize int) (lots int, credits int64, err error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, fmt.Errorf("begin expire lots transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, client_id, credits_remaining, expires_at
+		FROM credit_lots
+		WHERE credits_remaining > 0 AND expires_at IS NOT NULL AND expires_at <= $1
+		ORDER BY expires_at, id
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED`, now.UTC(), batchSize)
+	if err != nil {
+		return 0, 0, fmt.Errorf("select expired lots: %w", err)
+	}
+
+	type lapsed struct {
+		id        int64
+		clientID  int64
+		remaining int64
+		expiresAt time.Time
+	}
+	var expired []lapsed
+	for rows.Next() {
+		var l lapsed
+		if err := rows.Scan(&l.id, &l.clientID, &l.remaining, &l.expiresAt); err != nil {
+			rows.Close()
+			return 0, 0, fmt.Errorf("scan expired lot: %w", err)
+		}
+		expired = append(expired, l)
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return 0, 0, fmt.Errorf("iterate expired lots: %w", err)
+	}
+	rows.Close()
+
+	for _, l := range expired {
+		// Never take the wallet below zero if it already drifted from its lots.
+		var debited int64
+		err := tx.QueryRowContext(ctx, `
+			WITH w AS (
+				SELECT client_id, LEAST(GREATEST(balance_credits, 0), $2) AS amount
+				FROM wallets WHERE client_id = $1 FOR UPDATE
+			)
+			UPDATE wallets SET balance_credits = wallets.balance_credits - w.amount
+			FROM w WHERE wallets.client_id = w.client_id
+			RETURNING w.amount`, l.clientID, l.remaining).Scan(&debited)
+		if err != nil && err != sql.ErrNoRows {
+			return 0, 0, fmt.Errorf("debit wallet for lot %d: %w", l.id, err)
+		}
+
+		meta, _ := json.Marshal(map[string]any{
+			"lot_id":     l.id,
+			"expires_at": l.expiresAt.UTC(),
+		})
+		if _, err := tx.ExecContext(ctx, `INSERT INTO credit_ledger (client_id, type, credits_delta, price_cents_delta, meta)
+			VALUES ($1, 'EXPIRE', $2, 0, $3)`, l.clientID, -debited, meta); err != nil {
+			return 0, 0, fmt.Errorf("insert expire ledger entry for lot %d: %w", l.id, err)
+		}
+
+		if _, err := tx.ExecContext(ctx, `UPDATE credit_lots SET credits_remaining = 0, expired_at = $2 WHERE id = $1`, l.id, now.UTC()); err != nil {
+			return 0, 0, fmt.Errorf("close expired lot %d: %w", l.id, err)
+		}
+
+		credits += debited
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, 0, fmt.Errorf("commit expire lots: %w", err)
+	}
+
+	return len(expired), credits, nil
 }
@@ -0,0 +1,296 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+
+	"github.com/Enilsonn/CRUD-Postgres/internal/model"
+)
+
+func lotRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "credits_remaining", "expires_at"})
+}
+
+func TestConsumeLotsDrawsSoonestExpiryFirst(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	soon := time.Now().Add(24 * time.Hour)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM credit_lots`).WithArgs(int64(7)).
+		WillReturnRows(lotRows().AddRow(1, 30, soon).AddRow(2, 100, nil))
+	mock.ExpectExec(`UPDATE credit_lots SET credits_remaining = credits_remaining - \$2 WHERE id = \$1`).
+		WithArgs(int64(1), int64(30)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE credit_lots`).WithArgs(int64(2), int64(20)).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	draws, err := consumeLots(context.Background(), tx, 7, 50)
+	if err != nil {
+		t.Fatalf("consumeLots: %v", err)
+	}
+	if len(draws) != 2 || draws[0].amount != 30 || draws[1].amount != 20 {
+		t.Errorf("draws = %+v, want 30 from lot 1 then 20 from lot 2", draws)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestConsumeLotsRefusesToOverdraw(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM credit_lots`).WithArgs(int64(7)).
+		WillReturnRows(lotRows().AddRow(1, 30, nil))
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// No UPDATE is expected: a short draw must leave every lot untouched.
+	if _, err := consumeLots(context.Background(), tx, 7, 50); !errors.Is(err, ErrInsufficientCredits) {
+		t.Errorf("err = %v, want ErrInsufficientCredits", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func walletRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"client_id", "balance_credits", "credit_limit_credits"})
+}
+
+func TestGrantCreditsSettlesDebtBeforeFillingALot(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	// The wallet owes 30, so only 70 of the 100 credits end up in a lot.
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO credit_ledger .* RETURNING id`).WithArgs(int64(7), int64(100), int64(0), sqlmock.AnyArg(), "TOPUP").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(55))
+	mock.ExpectQuery(`INSERT INTO wallets .* RETURNING balance_credits`).WithArgs(int64(7), int64(100)).
+		WillReturnRows(sqlmock.NewRows([]string{"balance_credits"}).AddRow(70))
+	mock.ExpectExec(`VALUES \(\$1, 'DEBT_SETTLEMENT', 0, 0, \$2\)`).WithArgs(int64(7), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(56, 1))
+	mock.ExpectExec(`INSERT INTO credit_lots`).WithArgs(int64(7), "GRANT", int64(55), nil, nil, int64(70), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(9, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`FROM wallets`).WithArgs(int64(7)).WillReturnRows(walletRows().AddRow(7, 70, 50))
+
+	days := 30
+	wallet, err := NewWalletRepository(db).GrantCredits(context.Background(), 7, 100, &days, "goodwill", "employee")
+	if err != nil {
+		t.Fatalf("GrantCredits: %v", err)
+	}
+	if wallet.BalanceCredits != 70 || wallet.AvailableCredits != 120 {
+		t.Errorf("wallet = %+v, want balance 70 and 120 available", wallet)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGrantCreditsRejectsNonPositiveAmount(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := NewWalletRepository(db).GrantCredits(context.Background(), 7, 0, nil, "", "employee"); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("err = %v, want ErrInvalidInput", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAdjustCredits(t *testing.T) {
+	t.Run("positive goes through a lot", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("sqlmock: %v", err)
+		}
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`INSERT INTO credit_ledger .* RETURNING id`).WithArgs(int64(7), int64(25), int64(0), sqlmock.AnyArg(), "ADJUST").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(60))
+		mock.ExpectQuery(`INSERT INTO wallets .* RETURNING balance_credits`).WithArgs(int64(7), int64(25)).
+			WillReturnRows(sqlmock.NewRows([]string{"balance_credits"}).AddRow(75))
+		mock.ExpectExec(`INSERT INTO credit_lots`).WithArgs(int64(7), "ADJUST", int64(60), nil, nil, int64(25), nil).
+			WillReturnResult(sqlmock.NewResult(10, 1))
+		mock.ExpectCommit()
+		mock.ExpectQuery(`FROM wallets`).WithArgs(int64(7)).WillReturnRows(walletRows().AddRow(7, 75, 0))
+
+		if _, err := NewWalletRepository(db).AdjustCredits(context.Background(), 7, 25, "fix", "employee"); err != nil {
+			t.Fatalf("AdjustCredits: %v", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("negative draws on lots", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("sqlmock: %v", err)
+		}
+		defer db.Close()
+
+		soon := time.Now().Add(24 * time.Hour)
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT balance_credits FROM wallets WHERE client_id = \$1 FOR UPDATE`).WithArgs(int64(7)).
+			WillReturnRows(sqlmock.NewRows([]string{"balance_credits"}).AddRow(130))
+		mock.ExpectExec(`VALUES \(\$1, 'ADJUST', \$2, 0, \$3\)`).WithArgs(int64(7), int64(-40), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(61, 1))
+		mock.ExpectQuery(`FROM credit_lots`).WithArgs(int64(7)).
+			WillReturnRows(lotRows().AddRow(1, 30, soon).AddRow(2, 100, nil))
+		mock.ExpectExec(`UPDATE credit_lots`).WithArgs(int64(1), int64(30)).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`UPDATE credit_lots`).WithArgs(int64(2), int64(10)).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`UPDATE wallets SET balance_credits = balance_credits \+ \$2`).WithArgs(int64(7), int64(-40)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		mock.ExpectQuery(`FROM wallets`).WithArgs(int64(7)).WillReturnRows(walletRows().AddRow(7, 90, 0))
+
+		wallet, err := NewWalletRepository(db).AdjustCredits(context.Background(), 7, -40, "chargeback", "employee")
+		if err != nil {
+			t.Fatalf("AdjustCredits: %v", err)
+		}
+		if wallet.BalanceCredits != 90 {
+			t.Errorf("balance = %d, want 90", wallet.BalanceCredits)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("negative below zero", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("sqlmock: %v", err)
+		}
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT balance_credits FROM wallets WHERE client_id = \$1 FOR UPDATE`).WithArgs(int64(7)).
+			WillReturnRows(sqlmock.NewRows([]string{"balance_credits"}).AddRow(30))
+		mock.ExpectRollback()
+
+		if _, err := NewWalletRepository(db).AdjustCredits(context.Background(), 7, -40, "chargeback", "employee"); !errors.Is(err, ErrInsufficientCredits) {
+			t.Errorf("err = %v, want ErrInsufficientCredits", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("negative short of lots", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("sqlmock: %v", err)
+		}
+		defer db.Close()
+
+		// The balance says 50 but only 20 are left in lots: the whole
+		// adjustment rolls back rather than hide the drift.
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT balance_credits FROM wallets WHERE client_id = \$1 FOR UPDATE`).WithArgs(int64(7)).
+			WillReturnRows(sqlmock.NewRows([]string{"balance_credits"}).AddRow(50))
+		mock.ExpectExec(`VALUES \(\$1, 'ADJUST', \$2, 0, \$3\)`).WithArgs(int64(7), int64(-40), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(62, 1))
+		mock.ExpectQuery(`FROM credit_lots`).WithArgs(int64(7)).WillReturnRows(lotRows().AddRow(1, 20, nil))
+		mock.ExpectRollback()
+
+		if _, err := NewWalletRepository(db).AdjustCredits(context.Background(), 7, -40, "chargeback", "employee"); !errors.Is(err, ErrInsufficientCredits) {
+			t.Errorf("err = %v, want ErrInsufficientCredits", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestReconcileWalletsReportsDrift(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(`FROM wallets w\s+LEFT JOIN .*credit_ledger.*LEFT JOIN .*credit_lots`).
+		WillReturnRows(sqlmock.NewRows([]string{"client_id", "balance_credits", "ledger", "lots"}).
+			AddRow(3, 100, 90, 90).
+			AddRow(8, -20, -20, 5))
+
+	drifts, err := NewWalletRepository(db).ReconcileWallets(context.Background())
+	if err != nil {
+		t.Fatalf("ReconcileWallets: %v", err)
+	}
+	if len(drifts) != 2 {
+		t.Fatalf("drifts = %+v, want 2", drifts)
+	}
+	if d := drifts[0]; d.ClientID != 3 || d.BalanceCredits != 100 || d.LedgerCredits != 90 || d.LotCredits != 90 {
+		t.Errorf("drifts[0] = %+v", d)
+	}
+	if d := drifts[1]; d.ClientID != 8 || d.LotCredits != 5 {
+		t.Errorf("drifts[1] = %+v", d)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestStatementReadsTotalsAndEntriesInOneTransaction(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	from := time.Date(2025, time.March, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, 0)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM credit_ledger\s+WHERE client_id = \$1 AND created_at < \$3`).WithArgs(int64(7), from, to).
+		WillReturnRows(sqlmock.NewRows([]string{"opening", "in", "out", "cents", "count"}).AddRow(100, 50, 20, 900, 2))
+	mock.ExpectQuery(`ORDER BY created_at ASC, id ASC`).WithArgs(int64(7), from, to).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "client_id", "type", "credits_delta", "price_cents_delta", "meta", "created_at"}).
+			AddRow(1, 7, "TOPUP", 50, 900, []byte(`{}`), from.Add(time.Hour)).
+			AddRow(2, 7, "USAGE", -20, 0, []byte(`{}`), from.Add(2*time.Hour)))
+	mock.ExpectRollback()
+
+	var closing, streamed int64
+	err = NewWalletRepository(db).Statement(context.Background(), 7, from, to, func(stmt *model.WalletStatement) error {
+		closing = stmt.ClosingBalance
+		return nil
+	}, func(entry *model.CreditLedgerEntry) error {
+		streamed += entry.CreditsDelta
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Statement: %v", err)
+	}
+	if closing != 130 || streamed != 30 {
+		t.Errorf("closing = %d, streamed = %d, want 130 and 30", closing, streamed)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
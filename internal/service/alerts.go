@@ -0,0 +1,287 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/mail"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Enilsonn/CRUD-Postgres/internal/model"
+	"github.com/Enilsonn/CRUD-Postgres/internal/notify"
+	"github.com/Enilsonn/CRUD-Postgres/internal/repository"
+)
+
+const (
+	alertEventNotify   = "NOTIFY"
+	alertEventRecharge = "RECHARGE"
+
+	alertStatusSent      = "SENT"
+	alertStatusFailed    = "FAILED"
+	alertStatusRequested = "REQUESTED"
+	alertStatusSucceeded = "SUCCEEDED"
+	alertStatusSkipped   = "SKIPPED"
+
+	autoRechargeSellerName = "AutoRecharge"
+	autoRechargeActor      = "system:auto-recharge"
+)
+
+type BalanceAlertService struct {
+	alerts   *repository.AlertRepository
+	plans    *repository.ProductRepository
+	sellers  *repository.SellerRepository
+	orders   *OrderService
+	payments *PaymentService
+	sender   notify.Sender
+
+	// inflight tracks checks started by CheckAsync so shutdown can wait.
+	inflight sync.WaitGroup
+}
+
+type SaveBalanceAlertRequest struct {
+	ClientID           int64
+	ThresholdCredits   int64
+	WebhookURL         string
+	Email              string
+	AutoRechargePlanID *int64
+	MaxRechargesPerDay *int
+	CooldownMinutes    *int
+	Enabled            *bool
+}
+
+func NewBalanceAlertService(
+	alerts *repository.AlertRepository,
+	plans *repository.ProductRepository,
+	sellers *repository.SellerRepository,
+	orders *OrderService,
+	payments *PaymentService,
+	sender notify.Sender,
+) *BalanceAlertService {
+	return &BalanceAlertService{
+		alerts:   alerts,
+		plans:    plans,
+		sellers:  sellers,
+		orders:   orders,
+		payments: payments,
+		sender:   sender,
+	}
+}
+
+func (s *BalanceAlertService) Get(ctx context.Context, clientID int64) (*model.BalanceAlert, error) {
+	return s.alerts.Get(ctx, clientID)
+}
+
+func (s *BalanceAlertService) Events(ctx context.Context, clientID int64) ([]model.BalanceAlertEvent, error) {
+	return s.alerts.ListEvents(ctx, clientID, 100)
+}
+
+func (s *BalanceAlertService) Save(ctx context.Context, req SaveBalanceAlertRequest) (*model.BalanceAlert, error) {
+	if req.ClientID <= 0 {
+		return nil, repository.Invalidf("client_id must be positive")
+	}
+	if req.ThresholdCredits < 0 {
+		return nil, repository.Invalidf("invalid threshold: threshold_credits must be non-negative")
+	}
+
+	alert := &model.BalanceAlert{
+		ClientID:           req.ClientID,
+		ThresholdCredits:   req.ThresholdCredits,
+		WebhookURL:         strings.TrimSpace(req.WebhookURL),
+		Email:              strings.TrimSpace(req.Email),
+		AutoRechargePlanID: req.AutoRechargePlanID,
+		MaxRechargesPerDay: 1,
+		CooldownMinutes:    60,
+		Enabled:            true,
+	}
+
+	if alert.WebhookURL != "" {
+		u, err := url.Parse(alert.WebhookURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, repository.Invalidf("invalid webhook_url: must be an absolute http(s) URL")
+		}
+	}
+	if alert.Email != "" {
+		// Only a bare address: display names and anything that could break
+		// out of the To header are refused.
+		if addr, err := mail.ParseAddress(alert.Email); err != nil || addr.Address != alert.Email {
+			return nil, repository.Invalidf("invalid email address")
+		}
+	}
+	if req.MaxRechargesPerDay != nil {
+		if *req.MaxRechargesPerDay < 0 {
+			return nil, repository.Invalidf("invalid max_recharges_per_day: must be non-negative")
+		}
+		alert.MaxRechargesPerDay = *req.MaxRechargesPerDay
+	}
+	if req.CooldownMinutes != nil {
+		if *req.CooldownMinutes < 0 {
+			return nil, repository.Invalidf("invalid cooldown_minutes: must be non-negative")
+		}
+		alert.CooldownMinutes = *req.CooldownMinutes
+	}
+	if req.Enabled != nil {
+		alert.Enabled = *req.Enabled
+	}
+	if alert.AutoRechargePlanID != nil {
+		if _, err := s.plans.GetProductByID(ctx, *alert.AutoRechargePlanID); err != nil {
+			return nil, repository.NotFoundf("auto recharge plan %d not found", *alert.AutoRechargePlanID)
+		}
+	}
+
+	return s.alerts.Upsert(ctx, alert)
+}
+
+// CheckAsync runs Check in the background, tracked so that Wait can let it
+// finish before the process exits.
+func (s *BalanceAlertService) CheckAsync(clientID, balance int64) {
+	if s == nil {
+		return
+	}
+	s.inflight.Add(1)
+	go func() {
+		defer s.inflight.Done()
+		s.Check(context.Background(), clientID, balance)
+	}()
+}
+
+// Wait blocks until every check started by CheckAsync is done or ctx ends.
+func (s *BalanceAlertService) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.inflight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Check evaluates the client's alert against a freshly debited balance. It is
+// meant to run off the request path and only logs failures.
+func (s *BalanceAlertService) Check(ctx context.Context, clientID, balance int64) {
+	if s == nil || s.alerts == nil {
+		return
+	}
+
+	alert, triggered, err := s.alerts.Claim(ctx, clientID, balance, time.Now())
+	if err != nil {
+		slog.ErrorContext(ctx, "balance alert check failed", "client_id", clientID, "err", err)
+		return
+	}
+	if !triggered {
+		return
+	}
+
+	s.notify(ctx, alert, balance)
+
+	if alert.AutoRechargePlanID != nil {
+		s.recharge(ctx, alert, balance)
+	}
+}
+
+func (s *BalanceAlertService) notify(ctx context.Context, alert *model.BalanceAlert, balance int64) {
+	if s.sender == nil || (alert.WebhookURL == "" && alert.Email == "") {
+		return
+	}
+
+	n := notify.Notification{
+		Event:      "wallet.low_balance",
+		ClientID:   alert.ClientID,
+		Email:      alert.Email,
+		WebhookURL: alert.WebhookURL,
+		Subject:    fmt.Sprintf("Low credit balance: %d credits left", balance),
+		Body: fmt.Sprintf("Your wallet balance dropped to %d credits, below your alert threshold of %d credits.\n",
+			balance, alert.ThresholdCredits),
+		Payload: map[string]any{
+			"balance_credits":   balance,
+			"threshold_credits": alert.ThresholdCredits,
+			"auto_recharge":     alert.AutoRechargePlanID != nil,
+		},
+	}
+	if alert.AutoRechargePlanID != nil {
+		n.Body += "An automatic recharge has been requested.\n"
+	}
+
+	status := alertStatusSent
+	detail := map[string]any{"balance_credits": balance, "threshold_credits": alert.ThresholdCredits}
+	if err := s.sender.Send(ctx, n); err != nil {
+		status = alertStatusFailed
+		detail["error"] = err.Error()
+		slog.ErrorContext(ctx, "balance alert failed", "client_id", alert.ClientID, "err", err)
+	}
+
+	if err := s.alerts.RecordEvent(ctx, alert.ClientID, alertEventNotify, status, detail); err != nil {
+		slog.ErrorContext(ctx, "balance alert failed", "client_id", alert.ClientID, "err", err)
+	}
+}
+
+func (s *BalanceAlertService) recharge(ctx context.Context, alert *model.BalanceAlert, balance int64) {
+	planID := *alert.AutoRechargePlanID
+	detail := map[string]any{"plan_id": planID, "balance_credits": balance}
+
+	record := func(status string) {
+		if err := s.alerts.RecordEvent(ctx, alert.ClientID, alertEventRecharge, status, detail); err != nil {
+			slog.ErrorContext(ctx, "auto recharge failed", "client_id", alert.ClientID, "plan_id", planID, "err", err)
+		}
+	}
+
+	done, err := s.alerts.CountEventsSince(ctx, alert.ClientID, alertEventRecharge, time.Now().Add(-24*time.Hour),
+		alertStatusSucceeded, alertStatusRequested)
+	if err != nil {
+		slog.ErrorContext(ctx, "auto recharge failed", "client_id", alert.ClientID, "plan_id", planID, "err", err)
+		return
+	}
+	if done >= alert.MaxRechargesPerDay {
+		detail["reason"] = "daily recharge limit reached"
+		record(alertStatusSkipped)
+		return
+	}
+
+	fail := func(err error) {
+		detail["error"] = err.Error()
+		slog.ErrorContext(ctx, "auto recharge failed", "client_id", alert.ClientID, "plan_id", planID, "err", err)
+		record(alertStatusFailed)
+	}
+
+	sellerID, err := s.sellers.GetOrCreateByName(ctx, autoRechargeSellerName)
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	order, err := s.orders.CreateOrder(ctx, CreateOrderRequest{
+		ClientID:      alert.ClientID,
+		SellerID:      sellerID,
+		PaymentMethod: "CARD",
+		Items:         []OrderItemRequest{{PlanID: planID, Quantity: 1}},
+		Actor:         autoRechargeActor,
+	})
+	if err != nil {
+		fail(err)
+		return
+	}
+	detail["order_id"] = order.ID
+
+	// A card captured on the spot finalizes the order right here; otherwise
+	// the credits arrive when the provider's webhook confirms the charge.
+	charge, err := s.payments.CreateCharge(ctx, order.ID, autoRechargeActor)
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	detail["provider"] = charge.Provider
+	detail["provider_ref"] = charge.ProviderRef
+	if charge.Status != "CONFIRMED" {
+		record(alertStatusRequested)
+		return
+	}
+	record(alertStatusSucceeded)
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/Enilsonn/CRUD-Postgres/internal/model"
+	"github.com/Enilsonn/CRUD-Postgres/internal/payments"
+	"github.com/Enilsonn/CRUD-Postgres/internal/repository"
+)
+
+func TestSaveAlertRejectsEmailThatIsNotABareAddress(t *testing.T) {
+	s := NewBalanceAlertService(nil, nil, nil, nil, nil, nil)
+
+	for _, email := range []string{
+		"ops",
+		"ops@example.com\r\nBcc: everyone@example.com",
+		"Ops <ops@example.com>",
+		"ops@example.com, other@example.com",
+	} {
+		_, err := s.Save(context.Background(), SaveBalanceAlertRequest{ClientID: 1, Email: email})
+		if !errors.Is(err, repository.ErrInvalidInput) {
+			t.Errorf("Save(email %q) err = %v, want ErrInvalidInput", email, err)
+		}
+	}
+}
+
+// An auto-recharge paid by a card the provider captures grants the plan's
+// credits right away instead of waiting on a webhook.
+func TestRechargeFinalizesCapturedCardOrder(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	plans := repository.NewProductRepository(db)
+	sellers := repository.NewSellerRepository(db)
+	orderRepo := repository.NewOrderRepository(db)
+	clients := repository.NewClientRepository(db)
+	orders := NewOrderService(orderRepo, clients, sellers, plans, repository.NewWalletRepository(db), nil)
+	paymentService := NewPaymentService(repository.NewPaymentRepository(db), orderRepo, clients, &payments.FakeProvider{})
+	s := NewBalanceAlertService(repository.NewAlertRepository(db), plans, sellers, orders, paymentService, nil)
+
+	now := time.Now().UTC()
+	planID := int64(2)
+	alert := &model.BalanceAlert{ClientID: 7, ThresholdCredits: 100, AutoRechargePlanID: &planID, MaxRechargesPerDay: 1}
+
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM balance_alert_events`).
+		WithArgs(int64(7), alertEventRecharge, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT id FROM sellers WHERE lower\(name\)`).WithArgs(autoRechargeSellerName).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`FROM clients`).WithArgs(int64(7)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email", "phone", "status", "registration_data",
+			"supports_flamengo", "watches_one_piece", "city"}).
+			AddRow(7, "Ana", "ana@example.com", "81999990000", true, now, false, false, nil))
+	mock.ExpectQuery(`SELECT id, name FROM sellers WHERE id = \$1`).WithArgs(int64(5)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(5, autoRechargeSellerName))
+	mock.ExpectQuery(`FROM plans`).WithArgs(planID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "plan_name", "price_cents", "amount_credits", "status", "category",
+			"manufactured_in_mari", "stock", "reserved_stock", "available", "validity_days"}).
+			AddRow(2, "Basic", 990, 500, true, "BASIC", false, 10, 0, 10, nil))
+	mock.ExpectBegin()
+	mock.ExpectExec(`set_config\('app.actor'`).WithArgs(autoRechargeActor, "").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`INSERT INTO orders`).WithArgs(int64(7), int64(5), "CARD", nil, repository.PriceLockItem).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(40, now))
+	price := mock.ExpectPrepare(`SELECT price_cents, stock - reserved_stock FROM plans`)
+	item := mock.ExpectPrepare(`INSERT INTO order_items`)
+	price.ExpectQuery().WithArgs(planID).WillReturnRows(sqlmock.NewRows([]string{"price_cents", "available"}).AddRow(990, 10))
+	item.ExpectQuery().WithArgs(int64(40), planID, 1, int64(990)).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectExec(`UPDATE orders SET subtotal_cents`).WithArgs(int64(990), int64(40)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	expectCapturedCardCharge(mock, 40, 7, autoRechargeActor)
+	mock.ExpectExec(`INSERT INTO balance_alert_events`).
+		WithArgs(int64(7), alertEventRecharge, alertStatusSucceeded, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	s.recharge(context.Background(), alert, 40)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/Enilsonn/CRUD-Postgres/internal/repository"
+)
+
+const (
+	creditExpiryBatchSize = 500
+	orderExpiryBatchSize  = 500
+)
+
+type CreditExpiryService struct {
+	wallets *repository.WalletRepository
+}
+
+func NewCreditExpiryService(wallets *repository.WalletRepository) *CreditExpiryService {
+	return &CreditExpiryService{wallets: wallets}
+}
+
+// ExpireDue closes every lot whose expiry has passed, batch by batch.
+func (s *CreditExpiryService) ExpireDue(ctx context.Context, now time.Time) (int, int64, error) {
+	var (
+		totalLots    int
+		totalCredits int64
+	)
+	for {
+		lots, credits, err := s.wallets.ExpireLots(ctx, now, creditExpiryBatchSize)
+		if err != nil {
+			return totalLots, totalCredits, err
+		}
+		totalLots += lots
+		totalCredits += credits
+		if lots < creditExpiryBatchSize {
+			return totalLots, totalCredits, nil
+		}
+	}
+}
+
+// Run calls ExpireDue on every tick until ctx is canceled.
+func (s *CreditExpiryService) Run(ctx context.Context, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for {
+		lots, credits, err := s.ExpireDue(ctx, time.Now())
+		if err != nil {
+			slog.ErrorContext(ctx, "credit expiry failed", "err", err)
+		} else if lots > 0 {
+			slog.InfoContext(ctx, "credit expiry: expired lots", "lots", lots, "credits", credits)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+type OrderExpiryService struct {
+	orders     *repository.OrderRepository
+	pendingTTL map[string]time.Duration
+}
+
+func NewOrderExpiryService(orders *repository.OrderRepository, pendingTTL map[string]time.Duration) *OrderExpiryService {
+	return &OrderExpiryService{orders: orders, pendingTTL: pendingTTL}
+}
+
+// ExpireDue cancels every PENDING order whose payment deadline has passed.
+func (s *OrderExpiryService) ExpireDue(ctx context.Context, now time.Time) ([]int64, error) {
+	var expired []int64
+	for {
+		ids, err := s.orders.ExpirePending(ctx, now, s.pendingTTL, orderExpiryBatchSize)
+		expired = append(expired, ids...)
+		if err != nil || len(ids) < orderExpiryBatchSize {
+			return expired, err
+		}
+	}
+}
+
+// Run calls ExpireDue on every tick until ctx is canceled.
+func (s *OrderExpiryService) Run(ctx context.Context, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for {
+		ids, err := s.ExpireDue(ctx, time.Now())
+		if err != nil {
+			slog.ErrorContext(ctx, "order expiry failed", "err", err)
+		} else if len(ids) > 0 {
+			slog.InfoContext(ctx, "order expiry: canceled unpaid orders", "count", len(ids), "order_ids", ids)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/Enilsonn/CRUD-Postgres/internal/model"
+	"github.com/Enilsonn/CRUD-Postgres/internal/repository"
+)
+
+type InvoiceService struct {
+	invoices *repository.InvoiceRepository
+	clients  *repository.ClientRepository
+	rates    repository.InvoiceRates
+}
+
+func NewInvoiceService(invoices *repository.InvoiceRepository, clients *repository.ClientRepository, rates repository.InvoiceRates) *InvoiceService {
+	return &InvoiceService{
+		invoices: invoices,
+		clients:  clients,
+		rates:    rates,
+	}
+}
+
+// Generate drafts invoices for the calendar month containing month (UTC).
+// With clientID 0 every client with billable activity gets one; clients whose
+// invoice was already issued are skipped.
+func (s *InvoiceService) Generate(ctx context.Context, clientID int64, month time.Time) ([]*model.Invoice, error) {
+	from := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, 0)
+	if !from.Before(time.Now().UTC()) {
+		return nil, repository.Invalidf("invalid period: %s has not started yet", from.Format("2006-01"))
+	}
+
+	if clientID > 0 {
+		if _, err := s.clients.GetClientByID(ctx, clientID); err != nil {
+			return nil, repository.NotFoundf("client %d not found", clientID)
+		}
+		inv, err := s.invoices.GenerateDraft(ctx, clientID, from, to, s.rates)
+		if err != nil {
+			return nil, err
+		}
+		return []*model.Invoice{inv}, nil
+	}
+
+	ids, err := s.invoices.ClientsToInvoice(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	invoices := make([]*model.Invoice, 0, len(ids))
+	for _, id := range ids {
+		inv, err := s.invoices.GenerateDraft(ctx, id, from, to, s.rates)
+		if errors.Is(err, repository.ErrInvoiceFinalized) || errors.Is(err, repository.ErrNothingToInvoice) {
+			continue
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "invoice generation failed", "client_id", id, "month", from.Format("2006-01"), "err", err)
+			continue
+		}
+		invoices = append(invoices, inv)
+	}
+
+	return invoices, nil
+}
+
+func (s *InvoiceService) Get(ctx context.Context, id int64) (*model.Invoice, error) {
+	return s.invoices.GetByID(ctx, id)
+}
+
+// ClientOf returns the client an invoice bills.
+func (s *InvoiceService) ClientOf(ctx context.Context, id int64) (int64, error) {
+	return s.invoices.ClientOf(ctx, id)
+}
+
+func (s *InvoiceService) ListByClient(ctx context.Context, clientID int64) ([]*model.Invoice, error) {
+	return s.invoices.ListByClient(ctx, clientID)
+}
+
+func (s *InvoiceService) Issue(ctx context.Context, id int64) (*model.Invoice, error) {
+	return s.invoices.Issue(ctx, id, time.Now())
+}
+
+func (s *InvoiceService) MarkPaid(ctx context.Context, id int64) (*model.Invoice, error) {
+	return s.invoices.MarkPaid(ctx, id, time.Now())
+}
+
+func (s *InvoiceService) Void(ctx context.Context, id int64) (*model.Invoice, error) {
+	return s.invoices.Void(ctx, id, time.Now())
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/Enilsonn/CRUD-Postgres/internal/repository"
+)
+
+func invoiceFixture(t *testing.T) (*InvoiceService, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return NewInvoiceService(repository.NewInvoiceRepository(db), repository.NewClientRepository(db), repository.InvoiceRates{}), mock
+}
+
+func TestGenerateRejectsMonthNotStarted(t *testing.T) {
+	s, mock := invoiceFixture(t)
+	if _, err := s.Generate(context.Background(), 0, time.Now().AddDate(0, 1, 0)); !errors.Is(err, repository.ErrInvalidInput) {
+		t.Errorf("err = %v, want ErrInvalidInput", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGenerateSkipsClientsAlreadyInvoiced(t *testing.T) {
+	s, mock := invoiceFixture(t)
+	month := time.Date(2025, 3, 15, 0, 0, 0, 0, time.UTC)
+	from := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(`SELECT client_id FROM orders`).WithArgs(from, from.AddDate(0, 1, 0)).
+		WillReturnRows(sqlmock.NewRows([]string{"client_id"}).AddRow(7))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT id, status::text FROM invoices`).WithArgs(int64(7), from).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status"}).AddRow(9, repository.InvoiceIssued))
+	mock.ExpectRollback()
+
+	invoices, err := s.Generate(context.Background(), 0, month)
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if len(invoices) != 0 {
+		t.Errorf("got %d invoices, want none", len(invoices))
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,172 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Enilsonn/CRUD-Postgres/internal/model"
+	"github.com/Enilsonn/CRUD-Postgres/internal/repository"
+)
+
+const (
+	defaultLedgerPageSize = 50
+	maxLedgerPageSize     = 200
+)
+
+var (
+	ErrInvalidLedgerCursor = repository.Invalidf("invalid ledger cursor")
+	ErrInvalidLedgerType   = repository.Invalidf("invalid ledger entry type")
+)
+
+var allowedLedgerTypes = map[string]struct{}{
+	"TOPUP":           {},
+	"USAGE":           {},
+	"REFUND":          {},
+	"ADJUST":          {},
+	"EXPIRE":          {},
+	"TRANSFER_OUT":    {},
+	"TRANSFER_IN":     {},
+	"DEBT_SETTLEMENT": {},
+}
+
+type LedgerService struct {
+	wallets *repository.WalletRepository
+}
+
+// LedgerQuery is the caller-facing ledger filter. ClientID 0 means every client.
+type LedgerQuery struct {
+	ClientID int64
+	Types    []string
+	From     *time.Time
+	To       *time.Time
+	Model    string
+	OrderID  *int64
+	OrgID    *int64
+	MemberID *int64
+	Cursor   string
+	Limit    int
+}
+
+func NewLedgerService(wallets *repository.WalletRepository) *LedgerService {
+	return &LedgerService{wallets: wallets}
+}
+
+func (s *LedgerService) Search(ctx context.Context, q LedgerQuery) (*model.LedgerPage, error) {
+	filters := repository.LedgerFilters{
+		From:     q.From,
+		To:       q.To,
+		Model:    strings.TrimSpace(q.Model),
+		OrderID:  q.OrderID,
+		OrgID:    q.OrgID,
+		MemberID: q.MemberID,
+	}
+	if q.ClientID > 0 {
+		clientID := q.ClientID
+		filters.ClientID = &clientID
+	}
+
+	for _, raw := range q.Types {
+		t := strings.ToUpper(strings.TrimSpace(raw))
+		if t == "" {
+			continue
+		}
+		if _, ok := allowedLedgerTypes[t]; !ok {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidLedgerType, raw)
+		}
+		filters.Types = append(filters.Types, t)
+	}
+
+	if q.From != nil && q.To != nil && !q.From.Before(*q.To) {
+		return nil, repository.Invalidf("invalid date range: from must be before to")
+	}
+
+	var after *repository.LedgerCursor
+	if q.Cursor != "" {
+		cursor, err := DecodeLedgerCursor(q.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		after = cursor
+	}
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultLedgerPageSize
+	}
+	if limit > maxLedgerPageSize {
+		limit = maxLedgerPageSize
+	}
+
+	// One extra row tells us whether another page exists without a COUNT.
+	entries, err := s.wallets.SearchLedger(ctx, filters, after, limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &model.LedgerPage{Entries: entries}
+	if len(entries) > limit {
+		page.Entries = entries[:limit]
+		last := page.Entries[limit-1]
+		page.NextCursor = EncodeLedgerCursor(repository.LedgerCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+	if page.Entries == nil {
+		page.Entries = []*model.CreditLedgerEntry{}
+	}
+
+	totals, err := s.wallets.SumLedger(ctx, filters)
+	if err != nil {
+		return nil, err
+	}
+	page.Totals = *totals
+
+	return page, nil
+}
+
+// Statement summarises a client's ledger for the calendar month containing
+// month (UTC) and hands the summary to begin, then streams the month's
+// entries to fn. Both come from the same snapshot of the ledger.
+func (s *LedgerService) Statement(ctx context.Context, clientID int64, month time.Time, begin func(*model.WalletStatement) error, fn func(*model.CreditLedgerEntry) error) error {
+	if clientID <= 0 {
+		return repository.Invalidf("client_id must be positive")
+	}
+
+	from := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, 0)
+
+	return s.wallets.Statement(ctx, clientID, from, to, func(stmt *model.WalletStatement) error {
+		stmt.Month = from.Format("2006-01")
+		return begin(stmt)
+	}, fn)
+}
+
+func EncodeLedgerCursor(c repository.LedgerCursor) string {
+	raw := c.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + strconv.FormatInt(c.ID, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func DecodeLedgerCursor(token string) (*repository.LedgerCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidLedgerCursor
+	}
+
+	createdAt, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return nil, ErrInvalidLedgerCursor
+	}
+
+	ts, err := time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return nil, ErrInvalidLedgerCursor
+	}
+	parsedID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || parsedID <= 0 {
+		return nil, ErrInvalidLedgerCursor
+	}
+
+	return &repository.LedgerCursor{CreatedAt: ts, ID: parsedID}, nil
+}
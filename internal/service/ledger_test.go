@@ -0,0 +1,32 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Enilsonn/CRUD-Postgres/internal/repository"
+)
+
+func TestLedgerCursorRoundTrip(t *testing.T) {
+	want := repository.LedgerCursor{
+		CreatedAt: time.Date(2025, 3, 14, 15, 9, 26, 535897000, time.UTC),
+		ID:        42,
+	}
+
+	got, err := DecodeLedgerCursor(EncodeLedgerCursor(want))
+	if err != nil {
+		t.Fatalf("decode cursor: %v", err)
+	}
+	if !got.CreatedAt.Equal(want.CreatedAt) || got.ID != want.ID {
+		t.Fatalf("expected %+v got %+v", want, *got)
+	}
+}
+
+func TestDecodeLedgerCursorRejectsGarbage(t *testing.T) {
+	for _, token := range []string{"", "not-base64!", "bm8tc2VwYXJhdG9y", "MjAyNS0wMS0wMVQwMDowMDowMFp8LTE"} {
+		if _, err := DecodeLedgerCursor(token); !errors.Is(err, ErrInvalidLedgerCursor) {
+			t.Fatalf("token %q: expected ErrInvalidLedgerCursor got %v", token, err)
+		}
+	}
+}
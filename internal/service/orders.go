@@ -2,25 +2,44 @@ package service
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Enilsonn/CRUD-Postgres/internal/model"
 	"github.com/Enilsonn/CRUD-Postgres/internal/repository"
 )
 
+const (
+	defaultOrderPageSize = 50
+	maxOrderPageSize     = 200
+)
+
+var ErrInvalidOrderCursor = repository.Invalidf("invalid order cursor")
+
 var allowedPaymentMethods = map[string]struct{}{
 	"CARD":   {},
 	"BOLETO": {},
 	"PIX":    {},
 }
 
+var allowedPaymentStatuses = map[string]struct{}{
+	"PENDING":   {},
+	"CONFIRMED": {},
+	"FAILED":    {},
+	"CANCELED":  {},
+}
+
 type OrderService struct {
 	orders  *repository.OrderRepository
 	clients *repository.ClientRepository
 	sellers *repository.SellerRepository
 	plans   *repository.ProductRepository
 	wallets *repository.WalletRepository
+	// pendingTTL is how long an order may wait for payment, per method.
+	pendingTTL map[string]time.Duration
 }
 
 type OrderItemRequest struct {
@@ -33,6 +52,10 @@ type CreateOrderRequest struct {
 	SellerID      int64
 	PaymentMethod string
 	Items         []OrderItemRequest
+	// PriceLock is ITEM (default) or CHECKOUT; see repository.PriceLockCheckout.
+	PriceLock string
+	// Actor is recorded on the order's events.
+	Actor string
 }
 
 type FinalizeOrderResponse struct {
@@ -40,28 +63,48 @@ type FinalizeOrderResponse struct {
 	WalletBalance int64
 }
 
+// OrderQuery is the back-office order filter. Zero IDs match every client or
+// seller; Sort is created_at (default) or total_cents, Direction asc or desc
+// (default).
+type OrderQuery struct {
+	Statuses       []string
+	PaymentMethods []string
+	ClientID       int64
+	SellerID       int64
+	From           *time.Time
+	To             *time.Time
+	MinTotalCents  *int64
+	MaxTotalCents  *int64
+	Sort           string
+	Direction      string
+	Cursor         string
+	Limit          int
+}
+
 func NewOrderService(
 	orders *repository.OrderRepository,
 	clients *repository.ClientRepository,
 	sellers *repository.SellerRepository,
 	plans *repository.ProductRepository,
 	wallets *repository.WalletRepository,
+	pendingTTL map[string]time.Duration,
 ) *OrderService {
 	return &OrderService{
-		orders:  orders,
-		clients: clients,
-		sellers: sellers,
-		plans:   plans,
-		wallets: wallets,
+		orders:     orders,
+		clients:    clients,
+		sellers:    sellers,
+		plans:      plans,
+		wallets:    wallets,
+		pendingTTL: pendingTTL,
 	}
 }
 
 func (s *OrderService) CreateOrder(ctx context.Context, req CreateOrderRequest) (*model.Order, error) {
 	if req.ClientID <= 0 {
-		return nil, fmt.Errorf("client_id must be positive")
+		return nil, repository.Invalidf("client_id must be positive")
 	}
 	if req.SellerID <= 0 {
-		return nil, fmt.Errorf("seller_id must be positive")
+		return nil, repository.Invalidf("seller_id must be positive")
 	}
 	if len(req.Items) == 0 {
 		return nil, repository.ErrOrderWithoutItems
@@ -69,7 +112,16 @@ func (s *OrderService) CreateOrder(ctx context.Context, req CreateOrderRequest)
 
 	paymentMethod := strings.ToUpper(strings.TrimSpace(req.PaymentMethod))
 	if _, ok := allowedPaymentMethods[paymentMethod]; !ok {
-		return nil, fmt.Errorf("invalid payment method: %s", req.PaymentMethod)
+		return nil, repository.Invalidf("invalid payment method: %s", req.PaymentMethod)
+	}
+
+	priceLock := strings.ToUpper(strings.TrimSpace(req.PriceLock))
+	switch priceLock {
+	case "":
+		priceLock = repository.PriceLockItem
+	case repository.PriceLockItem, repository.PriceLockCheckout:
+	default:
+		return nil, repository.Invalidf("invalid price_lock %q: use ITEM or CHECKOUT", req.PriceLock)
 	}
 
 	if _, err := s.clients.GetClientByID(ctx, req.ClientID); err != nil {
@@ -84,23 +136,28 @@ func (s *OrderService) CreateOrder(ctx context.Context, req CreateOrderRequest)
 		ClientID:      req.ClientID,
 		SellerID:      req.SellerID,
 		PaymentMethod: paymentMethod,
+		PriceLock:     priceLock,
 		Items:         make([]model.OrderItem, len(req.Items)),
 	}
+	if ttl, ok := s.pendingTTL[paymentMethod]; ok && ttl > 0 {
+		expiresAt := time.Now().UTC().Add(ttl)
+		order.ExpiresAt = &expiresAt
+	}
 
 	for idx, item := range req.Items {
 		if item.PlanID <= 0 {
-			return nil, fmt.Errorf("plan_id must be positive")
+			return nil, repository.Invalidf("plan_id must be positive")
 		}
 		if item.Quantity <= 0 {
-			return nil, fmt.Errorf("quantity must be positive for plan %d", item.PlanID)
+			return nil, repository.Invalidf("quantity must be positive for plan %d", item.PlanID)
 		}
 
 		plan, err := s.plans.GetProductByID(ctx, item.PlanID)
 		if err != nil {
 			return nil, fmt.Errorf("plan %d retrieval failed: %w", item.PlanID, err)
 		}
-		if plan.Stock < item.Quantity {
-			return nil, fmt.Errorf("plan %d has insufficient stock", item.PlanID)
+		if plan.AvailableStock < item.Quantity {
+			return nil, fmt.Errorf("plan %d: %w", item.PlanID, repository.ErrInsufficientStock)
 		}
 
 		order.Items[idx] = model.OrderItem{
@@ -109,19 +166,19 @@ func (s *OrderService) CreateOrder(ctx context.Context, req CreateOrderRequest)
 		}
 	}
 
-	if _, err := s.orders.CreateOrder(ctx, order); err != nil {
+	if _, err := s.orders.CreateOrder(ctx, order, req.Actor); err != nil {
 		return nil, err
 	}
 
 	return order, nil
 }
 
-func (s *OrderService) FinalizeOrder(ctx context.Context, orderID int64) (*FinalizeOrderResponse, error) {
+func (s *OrderService) FinalizeOrder(ctx context.Context, orderID int64, actor string) (*FinalizeOrderResponse, error) {
 	if orderID <= 0 {
-		return nil, fmt.Errorf("order_id must be positive")
+		return nil, repository.Invalidf("order_id must be positive")
 	}
 
-	if err := s.orders.FinalizeOrder(ctx, orderID); err != nil {
+	if err := s.orders.FinalizeOrder(ctx, orderID, actor); err != nil {
 		return nil, err
 	}
 
@@ -143,7 +200,262 @@ func (s *OrderService) FinalizeOrder(ctx context.Context, orderID int64) (*Final
 
 func (s *OrderService) ListOrdersByClient(ctx context.Context, clientID int64) ([]model.Order, error) {
 	if clientID <= 0 {
-		return nil, fmt.Errorf("client_id must be positive")
+		return nil, repository.Invalidf("client_id must be positive")
 	}
 	return s.orders.ListOrdersByClient(ctx, clientID)
 }
+
+func (s *OrderService) GetOrder(ctx context.Context, orderID int64) (*model.Order, error) {
+	if orderID <= 0 {
+		return nil, repository.Invalidf("order_id must be positive")
+	}
+	return s.orders.GetOrderByID(ctx, orderID)
+}
+
+// ClientOf returns the client an order belongs to.
+func (s *OrderService) ClientOf(ctx context.Context, orderID int64) (int64, error) {
+	return s.orders.ClientOf(ctx, orderID)
+}
+
+// AddItem adds units of a plan to a PENDING order that has not been checked
+// out yet and returns the updated order.
+func (s *OrderService) AddItem(ctx context.Context, orderID int64, item OrderItemRequest, actor string) (*model.Order, error) {
+	if orderID <= 0 {
+		return nil, repository.Invalidf("order_id must be positive")
+	}
+	if item.PlanID <= 0 {
+		return nil, repository.Invalidf("invalid item: plan_id must be positive")
+	}
+	if item.Quantity <= 0 {
+		return nil, repository.Invalidf("invalid item: quantity must be positive for plan %d", item.PlanID)
+	}
+
+	if err := s.orders.AddItem(ctx, orderID, item.PlanID, item.Quantity, actor); err != nil {
+		return nil, err
+	}
+	return s.orders.GetOrderByID(ctx, orderID)
+}
+
+func (s *OrderService) UpdateItem(ctx context.Context, orderID, itemID int64, quantity int, actor string) (*model.Order, error) {
+	if orderID <= 0 || itemID <= 0 {
+		return nil, repository.Invalidf("order_id and item_id must be positive")
+	}
+	if quantity <= 0 {
+		return nil, repository.Invalidf("invalid item: quantity must be positive; remove the item instead")
+	}
+
+	if err := s.orders.UpdateItemQuantity(ctx, orderID, itemID, quantity, actor); err != nil {
+		return nil, err
+	}
+	return s.orders.GetOrderByID(ctx, orderID)
+}
+
+func (s *OrderService) RemoveItem(ctx context.Context, orderID, itemID int64, actor string) (*model.Order, error) {
+	if orderID <= 0 || itemID <= 0 {
+		return nil, repository.Invalidf("order_id and item_id must be positive")
+	}
+
+	if err := s.orders.RemoveItem(ctx, orderID, itemID, actor); err != nil {
+		return nil, err
+	}
+	return s.orders.GetOrderByID(ctx, orderID)
+}
+
+// Checkout freezes a PENDING order's items and prices ahead of payment.
+func (s *OrderService) Checkout(ctx context.Context, orderID int64, actor string) (*model.Order, error) {
+	if orderID <= 0 {
+		return nil, repository.Invalidf("order_id must be positive")
+	}
+
+	if err := s.orders.Checkout(ctx, orderID, actor); err != nil {
+		return nil, err
+	}
+	return s.orders.GetOrderByID(ctx, orderID)
+}
+
+// Events returns the order's timeline, oldest first.
+func (s *OrderService) Events(ctx context.Context, orderID int64) ([]model.OrderEvent, error) {
+	if orderID <= 0 {
+		return nil, repository.Invalidf("order_id must be positive")
+	}
+	return s.orders.ListOrderEvents(ctx, orderID)
+}
+
+// SearchOrders returns one page of orders across every client.
+func (s *OrderService) SearchOrders(ctx context.Context, q OrderQuery) (*model.OrderPage, error) {
+	filters, sort, err := q.build()
+	if err != nil {
+		return nil, err
+	}
+
+	var after *repository.OrderCursor
+	if q.Cursor != "" {
+		cursor, err := DecodeOrderCursor(q.Cursor, sort)
+		if err != nil {
+			return nil, err
+		}
+		after = cursor
+	}
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultOrderPageSize
+	}
+	if limit > maxOrderPageSize {
+		limit = maxOrderPageSize
+	}
+
+	// One extra row tells us whether another page exists without a COUNT.
+	orders, err := s.orders.SearchOrders(ctx, filters, sort, after, limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &model.OrderPage{Orders: orders}
+	if len(orders) > limit {
+		page.Orders = orders[:limit]
+		last := page.Orders[limit-1]
+		page.NextCursor = EncodeOrderCursor(sort, repository.OrderCursor{
+			CreatedAt:  last.CreatedAt,
+			TotalCents: last.TotalCents,
+			ID:         last.ID,
+		})
+	}
+	if page.Orders == nil {
+		page.Orders = []model.Order{}
+	}
+
+	return page, nil
+}
+
+// ValidateOrderQuery reports the error SearchOrders or ExportOrders would
+// return for q's filters, without touching the database.
+func (s *OrderService) ValidateOrderQuery(q OrderQuery) error {
+	_, _, err := q.build()
+	return err
+}
+
+// ExportOrders streams every order matching q, ignoring its cursor and limit.
+func (s *OrderService) ExportOrders(ctx context.Context, q OrderQuery, fn func(*model.Order) error) error {
+	filters, sort, err := q.build()
+	if err != nil {
+		return err
+	}
+	return s.orders.StreamOrders(ctx, filters, sort, fn)
+}
+
+func (q OrderQuery) build() (repository.OrderFilters, repository.OrderSort, error) {
+	filters := repository.OrderFilters{
+		From:          q.From,
+		To:            q.To,
+		MinTotalCents: q.MinTotalCents,
+		MaxTotalCents: q.MaxTotalCents,
+	}
+	sort := repository.OrderSort{Field: repository.OrderSortCreatedAt, Desc: true}
+
+	for _, raw := range q.Statuses {
+		status := strings.ToUpper(strings.TrimSpace(raw))
+		if status == "" {
+			continue
+		}
+		if _, ok := allowedPaymentStatuses[status]; !ok {
+			return filters, sort, repository.Invalidf("invalid payment status: %s", raw)
+		}
+		filters.Statuses = append(filters.Statuses, status)
+	}
+	for _, raw := range q.PaymentMethods {
+		method := strings.ToUpper(strings.TrimSpace(raw))
+		if method == "" {
+			continue
+		}
+		if _, ok := allowedPaymentMethods[method]; !ok {
+			return filters, sort, repository.Invalidf("invalid payment method: %s", raw)
+		}
+		filters.PaymentMethods = append(filters.PaymentMethods, method)
+	}
+
+	if q.ClientID > 0 {
+		clientID := q.ClientID
+		filters.ClientID = &clientID
+	}
+	if q.SellerID > 0 {
+		sellerID := q.SellerID
+		filters.SellerID = &sellerID
+	}
+
+	if q.From != nil && q.To != nil && !q.From.Before(*q.To) {
+		return filters, sort, repository.Invalidf("invalid date range: from must be before to")
+	}
+	if q.MinTotalCents != nil && q.MaxTotalCents != nil && *q.MinTotalCents > *q.MaxTotalCents {
+		return filters, sort, repository.Invalidf("invalid total range: min_total must not exceed max_total")
+	}
+
+	switch strings.ToLower(strings.TrimSpace(q.Sort)) {
+	case "", "created_at":
+	case "total", "total_cents":
+		sort.Field = repository.OrderSortTotal
+	default:
+		return filters, sort, repository.Invalidf("invalid sort %q: use created_at or total_cents", q.Sort)
+	}
+	switch strings.ToLower(strings.TrimSpace(q.Direction)) {
+	case "", "desc":
+	case "asc":
+		sort.Desc = false
+	default:
+		return filters, sort, repository.Invalidf("invalid order %q: use asc or desc", q.Direction)
+	}
+
+	return filters, sort, nil
+}
+
+// EncodeOrderCursor records the sort alongside the position so a cursor
+// cannot be replayed against a listing ordered differently.
+func EncodeOrderCursor(sort repository.OrderSort, c repository.OrderCursor) string {
+	value := c.CreatedAt.UTC().Format(time.RFC3339Nano)
+	if sort.Field == repository.OrderSortTotal {
+		value = strconv.FormatInt(c.TotalCents, 10)
+	}
+	raw := strings.Join([]string{orderSortKey(sort), value, strconv.FormatInt(c.ID, 10)}, "|")
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func DecodeOrderCursor(token string, sort repository.OrderSort) (*repository.OrderCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidOrderCursor
+	}
+
+	parts := strings.Split(string(raw), "|")
+	if len(parts) != 3 || parts[0] != orderSortKey(sort) {
+		return nil, ErrInvalidOrderCursor
+	}
+
+	cursor := &repository.OrderCursor{}
+	if sort.Field == repository.OrderSortTotal {
+		total, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil || total < 0 {
+			return nil, ErrInvalidOrderCursor
+		}
+		cursor.TotalCents = total
+	} else {
+		ts, err := time.Parse(time.RFC3339Nano, parts[1])
+		if err != nil {
+			return nil, ErrInvalidOrderCursor
+		}
+		cursor.CreatedAt = ts
+	}
+
+	cursor.ID, err = strconv.ParseInt(parts[2], 10, 64)
+	if err != nil || cursor.ID <= 0 {
+		return nil, ErrInvalidOrderCursor
+	}
+
+	return cursor, nil
+}
+
+func orderSortKey(sort repository.OrderSort) string {
+	if sort.Desc {
+		return sort.Field + ":desc"
+	}
+	return sort.Field + ":asc"
+}
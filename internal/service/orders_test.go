@@ -0,0 +1,52 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Enilsonn/CRUD-Postgres/internal/repository"
+)
+
+func TestOrderCursorRoundTrip(t *testing.T) {
+	byDate := repository.OrderSort{Field: repository.OrderSortCreatedAt, Desc: true}
+	byTotal := repository.OrderSort{Field: repository.OrderSortTotal}
+	want := repository.OrderCursor{
+		CreatedAt:  time.Date(2025, 3, 14, 15, 9, 26, 535897000, time.UTC),
+		TotalCents: 4990,
+		ID:         42,
+	}
+
+	got, err := DecodeOrderCursor(EncodeOrderCursor(byDate, want), byDate)
+	if err != nil {
+		t.Fatalf("decode date cursor: %v", err)
+	}
+	if !got.CreatedAt.Equal(want.CreatedAt) || got.ID != want.ID {
+		t.Fatalf("expected %+v got %+v", want, *got)
+	}
+
+	got, err = DecodeOrderCursor(EncodeOrderCursor(byTotal, want), byTotal)
+	if err != nil {
+		t.Fatalf("decode total cursor: %v", err)
+	}
+	if got.TotalCents != want.TotalCents || got.ID != want.ID {
+		t.Fatalf("expected %+v got %+v", want, *got)
+	}
+}
+
+func TestDecodeOrderCursorRejectsOtherSort(t *testing.T) {
+	byDate := repository.OrderSort{Field: repository.OrderSortCreatedAt, Desc: true}
+	token := EncodeOrderCursor(byDate, repository.OrderCursor{CreatedAt: time.Now(), ID: 1})
+
+	for _, sort := range []repository.OrderSort{
+		{Field: repository.OrderSortCreatedAt},
+		{Field: repository.OrderSortTotal, Desc: true},
+	} {
+		if _, err := DecodeOrderCursor(token, sort); !errors.Is(err, ErrInvalidOrderCursor) {
+			t.Fatalf("sort %+v: expected ErrInvalidOrderCursor got %v", sort, err)
+		}
+	}
+	if _, err := DecodeOrderCursor("not-base64!", byDate); !errors.Is(err, ErrInvalidOrderCursor) {
+		t.Fatalf("garbage token: expected ErrInvalidOrderCursor got %v", err)
+	}
+}
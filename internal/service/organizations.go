@@ -0,0 +1,214 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/Enilsonn/CRUD-Postgres/internal/model"
+	"github.com/Enilsonn/CRUD-Postgres/internal/repository"
+)
+
+var (
+	// ErrOrgForbidden is returned when the caller may not manage an organization.
+	ErrOrgForbidden = errors.New("only organization owners and admins may do this")
+	// ErrOrgNotMember is returned when the caller may not even see it.
+	ErrOrgNotMember = errors.New("only organization members may see this")
+)
+
+type OrganizationService struct {
+	orgs    *repository.OrganizationRepository
+	clients *repository.ClientRepository
+}
+
+type CreateOrganizationRequest struct {
+	Name            string
+	BillingClientID int64
+	OwnerClientID   int64
+}
+
+type SaveMemberRequest struct {
+	OrgID               int64
+	ClientID            int64
+	Role                string
+	MonthlyLimitCredits *int64
+}
+
+// OrgActor is who is asking: an employee, or a client identified by ClientID.
+type OrgActor struct {
+	ClientID   int64
+	IsEmployee bool
+}
+
+func NewOrganizationService(orgs *repository.OrganizationRepository, clients *repository.ClientRepository) *OrganizationService {
+	return &OrganizationService{orgs: orgs, clients: clients}
+}
+
+func (s *OrganizationService) Create(ctx context.Context, req CreateOrganizationRequest) (*model.Organization, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, repository.Invalidf("invalid organization: name is required")
+	}
+	if req.BillingClientID <= 0 || req.OwnerClientID <= 0 {
+		return nil, repository.Invalidf("invalid organization: billing_client_id and owner_client_id must be positive")
+	}
+	if req.BillingClientID == req.OwnerClientID {
+		return nil, repository.Invalidf("invalid organization: the billing client cannot also be a member")
+	}
+
+	for _, id := range []int64{req.BillingClientID, req.OwnerClientID} {
+		if _, err := s.clients.GetClientByID(ctx, id); err != nil {
+			return nil, repository.NotFoundf("client %d not found", id)
+		}
+	}
+
+	return s.orgs.Create(ctx, name, req.BillingClientID, req.OwnerClientID)
+}
+
+// Get returns the organization with its members and their spending limits,
+// for employees, its billing client and its members.
+func (s *OrganizationService) Get(ctx context.Context, actor OrgActor, id int64) (*model.Organization, error) {
+	org, err := s.view(ctx, actor, id)
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := s.orgs.ListMembers(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	org.Members = members
+
+	return org, nil
+}
+
+func (s *OrganizationService) Member(ctx context.Context, actor OrgActor, orgID, clientID int64) (*model.OrganizationMember, error) {
+	if _, err := s.view(ctx, actor, orgID); err != nil {
+		return nil, err
+	}
+	return s.orgs.GetMember(ctx, orgID, clientID)
+}
+
+func (s *OrganizationService) AddMember(ctx context.Context, actor OrgActor, req SaveMemberRequest) (*model.OrganizationMember, error) {
+	role, _, err := s.validateMember(ctx, actor, req)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.clients.GetClientByID(ctx, req.ClientID); err != nil {
+		return nil, repository.NotFoundf("client %d not found", req.ClientID)
+	}
+
+	return s.orgs.AddMember(ctx, req.OrgID, req.ClientID, role, req.MonthlyLimitCredits)
+}
+
+func (s *OrganizationService) UpdateMember(ctx context.Context, actor OrgActor, req SaveMemberRequest) (*model.OrganizationMember, error) {
+	role, actorRole, err := s.validateMember(ctx, actor, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.authorizeTarget(ctx, actorRole, req.OrgID, req.ClientID); err != nil {
+		return nil, err
+	}
+
+	return s.orgs.UpdateMember(ctx, req.OrgID, req.ClientID, role, req.MonthlyLimitCredits)
+}
+
+func (s *OrganizationService) RemoveMember(ctx context.Context, actor OrgActor, orgID, clientID int64) error {
+	actorRole, err := s.authorize(ctx, actor, orgID)
+	if err != nil {
+		return err
+	}
+	if err := s.authorizeTarget(ctx, actorRole, orgID, clientID); err != nil {
+		return err
+	}
+
+	return s.orgs.RemoveMember(ctx, orgID, clientID)
+}
+
+func (s *OrganizationService) validateMember(ctx context.Context, actor OrgActor, req SaveMemberRequest) (role, actorRole string, err error) {
+	role = strings.ToUpper(strings.TrimSpace(req.Role))
+	if role == "" {
+		role = repository.OrgRoleMember
+	}
+	switch role {
+	case repository.OrgRoleOwner, repository.OrgRoleAdmin, repository.OrgRoleMember:
+	default:
+		return "", "", repository.Invalidf("invalid role %q: must be OWNER, ADMIN or MEMBER", req.Role)
+	}
+	if req.ClientID <= 0 {
+		return "", "", repository.Invalidf("invalid member: client_id must be positive")
+	}
+	if req.MonthlyLimitCredits != nil && *req.MonthlyLimitCredits < 0 {
+		return "", "", repository.Invalidf("invalid monthly_limit_credits: must be non-negative")
+	}
+
+	actorRole, err = s.authorize(ctx, actor, req.OrgID)
+	if err != nil {
+		return "", "", err
+	}
+	// Admins manage members; only owners hand out ownership.
+	if role == repository.OrgRoleOwner && actorRole != repository.OrgRoleOwner {
+		return "", "", ErrOrgForbidden
+	}
+
+	return role, actorRole, nil
+}
+
+// authorizeTarget checks that an actor with actorRole may change or remove the existing member
+// clientID: admins manage members and admins, only owners touch owners.
+func (s *OrganizationService) authorizeTarget(ctx context.Context, actorRole string, orgID, clientID int64) error {
+	target, err := s.orgs.GetMember(ctx, orgID, clientID)
+	if err != nil {
+		return err
+	}
+	if target.Role == repository.OrgRoleOwner && actorRole != repository.OrgRoleOwner {
+		return ErrOrgForbidden
+	}
+
+	return nil
+}
+
+// view checks that actor may read orgID: employees, the billing client and
+// members of any role may.
+func (s *OrganizationService) view(ctx context.Context, actor OrgActor, orgID int64) (*model.Organization, error) {
+	org, err := s.orgs.GetByID(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	if actor.IsEmployee || (actor.ClientID > 0 && actor.ClientID == org.BillingClientID) {
+		return org, nil
+	}
+
+	if _, err := s.orgs.GetMember(ctx, orgID, actor.ClientID); err != nil {
+		if errors.Is(err, repository.ErrMemberNotFound) {
+			return nil, ErrOrgNotMember
+		}
+		return nil, err
+	}
+
+	return org, nil
+}
+
+// authorize checks that actor may manage orgID and returns the role it acts
+// with. Employees act as owners.
+func (s *OrganizationService) authorize(ctx context.Context, actor OrgActor, orgID int64) (string, error) {
+	if _, err := s.orgs.GetByID(ctx, orgID); err != nil {
+		return "", err
+	}
+	if actor.IsEmployee {
+		return repository.OrgRoleOwner, nil
+	}
+
+	member, err := s.orgs.GetMember(ctx, orgID, actor.ClientID)
+	if err != nil {
+		if errors.Is(err, repository.ErrMemberNotFound) {
+			return "", ErrOrgForbidden
+		}
+		return "", err
+	}
+	if member.Role != repository.OrgRoleOwner && member.Role != repository.OrgRoleAdmin {
+		return "", ErrOrgForbidden
+	}
+
+	return member.Role, nil
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/Enilsonn/CRUD-Postgres/internal/repository"
+)
+
+// Organization 1 is billed to client 10; client 20 owns it, 30 administers
+// it and 40 is a plain member.
+func orgFixture(t *testing.T) (*OrganizationService, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return NewOrganizationService(repository.NewOrganizationRepository(db), nil), mock
+}
+
+func expectOrg(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(`FROM organizations WHERE id = \$1`).WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "billing_client_id", "created_at"}).AddRow(1, "Acme", 10, time.Now()))
+}
+
+func expectMember(mock sqlmock.Sqlmock, clientID int64, role string) {
+	rows := sqlmock.NewRows([]string{"org_id", "client_id", "role", "monthly_limit_credits", "joined_at", "spent"})
+	if role != "" {
+		rows.AddRow(1, clientID, role, nil, time.Now(), 0)
+	}
+	mock.ExpectQuery(`FROM organization_members m WHERE m.org_id = \$1 AND m.client_id = \$2`).
+		WithArgs(int64(1), clientID).WillReturnRows(rows)
+}
+
+func TestAdminCannotDemoteOrRemoveOwner(t *testing.T) {
+	admin := OrgActor{ClientID: 30}
+
+	s, mock := orgFixture(t)
+	expectOrg(mock)
+	expectMember(mock, 30, repository.OrgRoleAdmin)
+	expectMember(mock, 20, repository.OrgRoleOwner)
+	_, err := s.UpdateMember(context.Background(), admin, SaveMemberRequest{OrgID: 1, ClientID: 20, Role: repository.OrgRoleMember})
+	if !errors.Is(err, ErrOrgForbidden) {
+		t.Errorf("admin demoting owner: err = %v, want ErrOrgForbidden", err)
+	}
+
+	s, mock = orgFixture(t)
+	expectOrg(mock)
+	expectMember(mock, 30, repository.OrgRoleAdmin)
+	expectMember(mock, 20, repository.OrgRoleOwner)
+	if err := s.RemoveMember(context.Background(), admin, 1, 20); !errors.Is(err, ErrOrgForbidden) {
+		t.Errorf("admin removing owner: err = %v, want ErrOrgForbidden", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestOrganizationIsVisibleOnlyToMembers(t *testing.T) {
+	s, mock := orgFixture(t)
+	expectOrg(mock)
+	expectMember(mock, 99, "")
+	if _, err := s.Member(context.Background(), OrgActor{ClientID: 99}, 1, 40); !errors.Is(err, ErrOrgNotMember) {
+		t.Errorf("outsider: err = %v, want ErrOrgNotMember", err)
+	}
+
+	for _, actor := range []OrgActor{{ClientID: 10}, {IsEmployee: true}} {
+		// The billing client and employees need no membership lookup.
+		s, mock = orgFixture(t)
+		expectOrg(mock)
+		expectMember(mock, 40, repository.OrgRoleMember)
+		if _, err := s.Member(context.Background(), actor, 1, 40); err != nil {
+			t.Errorf("%+v reading member 40: %v", actor, err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	}
+
+	s, mock = orgFixture(t)
+	expectOrg(mock)
+	expectMember(mock, 40, repository.OrgRoleMember)
+	expectMember(mock, 40, repository.OrgRoleMember)
+	if _, err := s.Member(context.Background(), OrgActor{ClientID: 40}, 1, 40); err != nil {
+		t.Errorf("member reading itself: %v", err)
+	}
+}
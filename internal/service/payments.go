@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/Enilsonn/CRUD-Postgres/internal/model"
+	"github.com/Enilsonn/CRUD-Postgres/internal/payments"
+	"github.com/Enilsonn/CRUD-Postgres/internal/repository"
+)
+
+const pixQRCodeSize = 320
+
+// paymentSimulator is implemented by providers that can fake their own
+// webhooks, so local setups can settle orders without a real gateway.
+type paymentSimulator interface {
+	SimulateWebhook(providerRef, eventType string, amountCents int64, reason string) (http.Header, []byte, error)
+}
+
+type PaymentService struct {
+	payments *repository.PaymentRepository
+	orders   *repository.OrderRepository
+	clients  *repository.ClientRepository
+	provider payments.Provider
+}
+
+// WebhookResult reports what an inbound webhook did to its order.
+type WebhookResult struct {
+	EventID   string `json:"event_id"`
+	Result    string `json:"result"`
+	Duplicate bool   `json:"duplicate"`
+}
+
+func NewPaymentService(
+	paymentRepo *repository.PaymentRepository,
+	orders *repository.OrderRepository,
+	clients *repository.ClientRepository,
+	provider payments.Provider,
+) *PaymentService {
+	return &PaymentService{
+		payments: paymentRepo,
+		orders:   orders,
+		clients:  clients,
+		provider: provider,
+	}
+}
+
+// CreateCharge checks a pending order out and asks the provider to charge it
+// with its payment method. Calling it again replaces the previous, unpaid
+// charge. A charge the provider captured on the spot confirms the order
+// right away, through the same path as a webhook; if that fails the charge
+// stays pending for the provider's own notification.
+func (s *PaymentService) CreateCharge(ctx context.Context, orderID int64, actor string) (*model.PaymentCharge, error) {
+	if err := s.orders.Checkout(ctx, orderID, actor); err != nil {
+		return nil, err
+	}
+
+	order, err := s.orders.GetOrderByID(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if order.PaymentStatus != "PENDING" {
+		return nil, fmt.Errorf("order %d is %s: %w", orderID, order.PaymentStatus, repository.ErrOrderNotPending)
+	}
+
+	client, err := s.clients.GetClientByID(ctx, order.ClientID)
+	if err != nil {
+		return nil, fmt.Errorf("client lookup failed: %w", err)
+	}
+
+	charge, err := s.provider.CreateCharge(ctx, payments.ChargeRequest{
+		OrderID:     order.ID,
+		Method:      order.PaymentMethod,
+		AmountCents: order.TotalCents,
+		PayerName:   client.Name,
+		Description: fmt.Sprintf("Order #%d", order.ID),
+		ExpiresAt:   order.ExpiresAt,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create %s charge: %w", s.provider.Name(), err)
+	}
+
+	saved, err := s.payments.SaveCharge(ctx, &model.PaymentCharge{
+		OrderID:     order.ID,
+		Provider:    s.provider.Name(),
+		ProviderRef: charge.ProviderRef,
+		Method:      order.PaymentMethod,
+		AmountCents: order.TotalCents,
+		PixPayload:  charge.PixPayload,
+		BoletoLine:  charge.BoletoLine,
+		ExpiresAt:   charge.ExpiresAt,
+	})
+	if err != nil || !charge.Captured {
+		return saved, err
+	}
+
+	if _, _, err := s.payments.ApplyNotification(ctx, repository.PaymentNotification{
+		Provider:    s.provider.Name(),
+		EventID:     "capture:" + charge.ProviderRef,
+		EventType:   payments.EventPaymentConfirmed,
+		ProviderRef: charge.ProviderRef,
+		AmountCents: order.TotalCents,
+		Status:      "CONFIRMED",
+		Payload:     []byte(`{}`),
+	}); err != nil {
+		slog.ErrorContext(ctx, "captured charge not applied", "order_id", order.ID, "provider_ref", charge.ProviderRef, "err", err)
+		return saved, nil
+	}
+
+	return s.payments.GetChargeByOrder(ctx, order.ID)
+}
+
+func (s *PaymentService) GetCharge(ctx context.Context, orderID int64) (*model.PaymentCharge, error) {
+	return s.payments.GetChargeByOrder(ctx, orderID)
+}
+
+// PixQRCode renders the QR code for an order's PIX copy-and-paste payload.
+func (s *PaymentService) PixQRCode(ctx context.Context, orderID int64) ([]byte, error) {
+	charge, err := s.payments.GetChargeByOrder(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if charge.PixPayload == "" {
+		return nil, repository.Invalidf("invalid request: order %d is not paid with PIX", orderID)
+	}
+	return payments.PixQRCodePNG(charge.PixPayload, pixQRCodeSize)
+}
+
+// HandleWebhook verifies and applies a provider notification. Redelivered
+// events are acknowledged without touching the order again.
+func (s *PaymentService) HandleWebhook(ctx context.Context, provider string, header http.Header, body []byte) (*WebhookResult, error) {
+	if !strings.EqualFold(provider, s.provider.Name()) {
+		return nil, repository.NotFoundf("payment provider %s not found", provider)
+	}
+
+	event, err := s.provider.ParseWebhook(header, body)
+	if err != nil {
+		return nil, err
+	}
+
+	status := "CONFIRMED"
+	if event.Type == payments.EventPaymentFailed {
+		status = "FAILED"
+	}
+
+	result, duplicate, err := s.payments.ApplyNotification(ctx, repository.PaymentNotification{
+		Provider:    s.provider.Name(),
+		EventID:     event.ID,
+		EventType:   event.Type,
+		ProviderRef: event.ProviderRef,
+		AmountCents: event.AmountCents,
+		Status:      status,
+		Reason:      event.Reason,
+		Payload:     event.Payload,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &WebhookResult{EventID: event.ID, Result: result, Duplicate: duplicate}, nil
+}
+
+// Simulate settles an order's charge through the regular webhook path, for
+// providers that support it.
+func (s *PaymentService) Simulate(ctx context.Context, orderID int64, status, reason string) (*WebhookResult, error) {
+	simulator, ok := s.provider.(paymentSimulator)
+	if !ok {
+		return nil, repository.Invalidf("invalid request: provider %s cannot simulate payments", s.provider.Name())
+	}
+
+	eventType := payments.EventPaymentConfirmed
+	switch strings.ToUpper(strings.TrimSpace(status)) {
+	case "", "CONFIRMED":
+	case "FAILED":
+		eventType = payments.EventPaymentFailed
+	default:
+		return nil, repository.Invalidf("invalid status %q: use CONFIRMED or FAILED", status)
+	}
+
+	charge, err := s.payments.GetChargeByOrder(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	header, body, err := simulator.SimulateWebhook(charge.ProviderRef, eventType, charge.AmountCents, reason)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.HandleWebhook(ctx, s.provider.Name(), header, body)
+}
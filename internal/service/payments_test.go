@@ -0,0 +1,129 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/Enilsonn/CRUD-Postgres/internal/payments"
+	"github.com/Enilsonn/CRUD-Postgres/internal/repository"
+)
+
+// A PIX charge must carry the order's deadline: ExpirePending leaves orders
+// with an unexpired charge alone, so one without a deadline could hold its
+// stock reservation forever.
+func TestCreateChargeGivesPixChargeTheOrderDeadline(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	provider := &payments.FakeProvider{PixKey: "pix@example.com", MerchantName: "Loja", MerchantCity: "Recife"}
+	s := NewPaymentService(repository.NewPaymentRepository(db), repository.NewOrderRepository(db), repository.NewClientRepository(db), provider)
+
+	now := time.Now().UTC()
+	deadline := now.Add(30 * time.Minute)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`set_config\('app.actor'`).WithArgs("client:7", "").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`SELECT sp_recalculate_order\(\$1, true\)`).WithArgs(int64(40)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`FROM orders WHERE id = \$1`).WithArgs(int64(40)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "client_id", "seller_id", "created_at", "payment_method", "payment_status",
+			"subtotal_cents", "discount_cents", "total_cents", "expires_at", "cancel_reason", "canceled_at", "price_lock", "checked_out_at"}).
+			AddRow(40, 7, 1, now, "PIX", "PENDING", 990, 0, 990, deadline, "", nil, "ITEM", now))
+	mock.ExpectQuery(`FROM order_items oi`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "order_id", "plan_id", "plan_name", "quantity", "unit_price_cents"}).
+			AddRow(1, 40, 2, "Basic", 1, 990))
+	mock.ExpectQuery(`FROM clients`).WithArgs(int64(7)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email", "phone", "status", "registration_data",
+			"supports_flamengo", "watches_one_piece", "city"}).
+			AddRow(7, "Ana", "ana@example.com", "81999990000", true, now, false, false, nil))
+	mock.ExpectQuery(`INSERT INTO payment_charges`).
+		WithArgs(int64(40), "fake", sqlmock.AnyArg(), "PIX", int64(990), sqlmock.AnyArg(), "", deadline).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "order_id", "provider", "provider_ref", "method", "status", "amount_cents",
+			"pix_payload", "boleto_line", "expires_at", "failure_reason", "created_at", "updated_at"}).
+			AddRow(3, 40, "fake", "fake_ch_1", "PIX", "PENDING", 990, "000201", "", deadline, "", now, now))
+
+	charge, err := s.CreateCharge(context.Background(), 40, "client:7")
+	if err != nil {
+		t.Fatalf("CreateCharge: %v", err)
+	}
+	if charge.ExpiresAt == nil || !charge.ExpiresAt.Equal(deadline) {
+		t.Errorf("expires_at = %v, want %v", charge.ExpiresAt, deadline)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// A card charge the provider captured on the spot must finalize its order
+// without waiting for a webhook that will never come.
+func TestCreateChargeConfirmsCapturedCardCharge(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	s := NewPaymentService(repository.NewPaymentRepository(db), repository.NewOrderRepository(db), repository.NewClientRepository(db), &payments.FakeProvider{})
+	expectCapturedCardCharge(mock, 40, 7, "client:7")
+
+	charge, err := s.CreateCharge(context.Background(), 40, "client:7")
+	if err != nil {
+		t.Fatalf("CreateCharge: %v", err)
+	}
+	if charge.Status != "CONFIRMED" {
+		t.Errorf("status = %s, want CONFIRMED", charge.Status)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// expectCapturedCardCharge expects CreateCharge to check out a 990 cents
+// CARD order and confirm the charge the fake provider captures for it.
+func expectCapturedCardCharge(mock sqlmock.Sqlmock, orderID, clientID int64, actor string) {
+	now := time.Now().UTC()
+	chargeColumns := []string{"id", "order_id", "provider", "provider_ref", "method", "status", "amount_cents",
+		"pix_payload", "boleto_line", "expires_at", "failure_reason", "created_at", "updated_at"}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`set_config\('app.actor'`).WithArgs(actor, "").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`SELECT sp_recalculate_order\(\$1, true\)`).WithArgs(orderID).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`FROM orders WHERE id = \$1`).WithArgs(orderID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "client_id", "seller_id", "created_at", "payment_method", "payment_status",
+			"subtotal_cents", "discount_cents", "total_cents", "expires_at", "cancel_reason", "canceled_at", "price_lock", "checked_out_at"}).
+			AddRow(orderID, clientID, 1, now, "CARD", "PENDING", 990, 0, 990, nil, "", nil, "ITEM", now))
+	mock.ExpectQuery(`FROM order_items oi`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "order_id", "plan_id", "plan_name", "quantity", "unit_price_cents"}).
+			AddRow(1, orderID, 2, "Basic", 1, 990))
+	mock.ExpectQuery(`FROM clients`).WithArgs(clientID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email", "phone", "status", "registration_data",
+			"supports_flamengo", "watches_one_piece", "city"}).
+			AddRow(clientID, "Ana", "ana@example.com", "81999990000", true, now, false, false, nil))
+	mock.ExpectQuery(`INSERT INTO payment_charges`).
+		WillReturnRows(sqlmock.NewRows(chargeColumns).
+			AddRow(3, orderID, "fake", "fake_ch_1", "CARD", "PENDING", 990, "", "", nil, "", now, now))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO payment_webhook_events`).
+		WithArgs("fake", sqlmock.AnyArg(), payments.EventPaymentConfirmed, sqlmock.AnyArg(), "{}").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(9))
+	mock.ExpectExec(`set_config\('app.actor'`).WithArgs("payment:fake", "").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT id, order_id FROM payment_charges`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "order_id"}).AddRow(3, orderID))
+	mock.ExpectQuery(`SELECT payment_status::text, total_cents FROM orders`).WithArgs(orderID).
+		WillReturnRows(sqlmock.NewRows([]string{"payment_status", "total_cents"}).AddRow("PENDING", 990))
+	mock.ExpectExec(`SELECT sp_finalize_order\(\$1\)`).WithArgs(orderID).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`UPDATE payment_charges`).WithArgs(int64(3), "CONFIRMED", "").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`FROM subscription_cycles`).WithArgs(orderID).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectExec(`UPDATE payment_webhook_events SET result`).WithArgs(int64(9), "order confirmed").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`FROM payment_charges WHERE order_id = \$1`).WithArgs(orderID).
+		WillReturnRows(sqlmock.NewRows(chargeColumns).
+			AddRow(3, orderID, "fake", "fake_ch_1", "CARD", "CONFIRMED", 990, "", "", nil, "", now, now))
+}
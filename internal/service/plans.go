@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"strings"
 
 	"github.com/Enilsonn/CRUD-Postgres/internal/model"
 	"github.com/Enilsonn/CRUD-Postgres/internal/repository"
@@ -37,3 +38,17 @@ func (s *PlanService) Search(ctx context.Context, filters PlanSearchFilters) ([]
 func (s *PlanService) LowStock(ctx context.Context) ([]model.Plan, error) {
 	return s.plans.ListLowStock(ctx)
 }
+
+const inventoryHistoryLimit = 200
+
+// Restock adds quantity units to a plan's stock on behalf of actor.
+func (s *PlanService) Restock(ctx context.Context, planID int64, quantity int, actor, reason string) (*model.InventoryMovement, error) {
+	if quantity <= 0 {
+		return nil, repository.Invalidf("invalid quantity: must be positive")
+	}
+	return s.plans.AdjustStock(ctx, planID, quantity, "RESTOCK", actor, strings.TrimSpace(reason))
+}
+
+func (s *PlanService) Inventory(ctx context.Context, planID int64) ([]model.InventoryMovement, error) {
+	return s.plans.ListInventoryMovements(ctx, planID, inventoryHistoryLimit)
+}
@@ -5,35 +5,70 @@ import (
 	"math"
 
 	"github.com/Enilsonn/CRUD-Postgres/internal/repository"
+	"github.com/Enilsonn/CRUD-Postgres/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type PricingService struct {
 	Repo *repository.PricingRepository
+
+	// DefaultRates, when set, gives the per-1K rates charged for models no
+	// rule matches. It is asked on every call so the rates can be reloaded.
+	DefaultRates func() (prompt, completion float64)
 }
 
 func NewPricingService(repo *repository.PricingRepository) *PricingService {
 	return &PricingService{Repo: repo}
 }
 
-func (s *PricingService) ComputeCredits(ctx context.Context, model string, pt, ct int64) (int64, float64, float64, error) {
-	ppk := 1.0
-	cpk := 1.0
+// ModelRate is what a model is billed at. Rule is the pattern of the pricing
+// rule that matched, empty when the default rates apply; unlike the model
+// name a caller sends, it is one of a few values employees configured.
+type ModelRate struct {
+	Rule            string
+	PromptPer1K     float64
+	CompletionPer1K float64
+}
 
-	if s != nil && s.Repo != nil {
-		if ctx == nil {
-			ctx = context.Background()
-		}
+// Credits prices pt prompt and ct completion tokens, rounding up.
+func (r ModelRate) Credits(pt, ct int64) int64 {
+	return int64(math.Ceil((float64(pt)*r.PromptPer1K + float64(ct)*r.CompletionPer1K) / 1000.0))
+}
 
-		matchPPK, matchCPK, ok, err := s.Repo.FindRate(ctx, model)
+// RateFor finds the rate model is billed at. A nil service bills every model
+// one credit per 1K tokens.
+func (s *PricingService) RateFor(ctx context.Context, model string) (ModelRate, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, span := tracing.Tracer().Start(ctx, "PricingService.RateFor", trace.WithAttributes(
+		attribute.String("gen_ai.request.model", model),
+	))
+	defer span.End()
+
+	rate := ModelRate{PromptPer1K: 1.0, CompletionPer1K: 1.0}
+	if s != nil && s.DefaultRates != nil {
+		rate.PromptPer1K, rate.CompletionPer1K = s.DefaultRates()
+	}
+
+	if s != nil && s.Repo != nil {
+		rule, err := s.Repo.FindRate(ctx, model)
 		if err != nil {
-			return 0, 0, 0, err
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return ModelRate{}, err
 		}
-		if ok {
-			ppk = matchPPK
-			cpk = matchCPK
+		if rule != nil {
+			rate = ModelRate{Rule: rule.Pattern, PromptPer1K: rule.CreditsPer1KPrompt, CompletionPer1K: rule.CreditsPer1KCompletion}
 		}
 	}
 
-	credits := int64(math.Ceil((float64(pt)*ppk + float64(ct)*cpk) / 1000.0))
-	return credits, ppk, cpk, nil
+	span.SetAttributes(
+		attribute.Bool("pricing.rule_matched", rate.Rule != ""),
+		attribute.Float64("pricing.prompt_per_1k", rate.PromptPer1K),
+		attribute.Float64("pricing.completion_per_1k", rate.CompletionPer1K),
+	)
+	return rate, nil
 }
@@ -0,0 +1,246 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/Enilsonn/CRUD-Postgres/internal/model"
+	"github.com/Enilsonn/CRUD-Postgres/internal/repository"
+)
+
+const subscriptionSellerName = "Subscriptions"
+
+var allowedBillingIntervals = map[string]struct{}{
+	"WEEKLY":  {},
+	"MONTHLY": {},
+	"YEARLY":  {},
+}
+
+type SubscriptionService struct {
+	subscriptions *repository.SubscriptionRepository
+	clients       *repository.ClientRepository
+	plans         *repository.ProductRepository
+	sellers       *repository.SellerRepository
+	payments      *PaymentService
+	policy        repository.RenewalPolicy
+}
+
+type SubscribeRequest struct {
+	ClientID        int64
+	PlanID          int64
+	Quantity        int
+	BillingInterval string
+	PaymentMethod   string
+}
+
+func NewSubscriptionService(
+	subscriptions *repository.SubscriptionRepository,
+	clients *repository.ClientRepository,
+	plans *repository.ProductRepository,
+	sellers *repository.SellerRepository,
+	payments *PaymentService,
+	policy repository.RenewalPolicy,
+) *SubscriptionService {
+	return &SubscriptionService{
+		subscriptions: subscriptions,
+		clients:       clients,
+		plans:         plans,
+		sellers:       sellers,
+		payments:      payments,
+		policy:        policy,
+	}
+}
+
+// Subscribe starts a subscription and charges its first cycle through the
+// payment provider. It stays INCOMPLETE until that payment is confirmed,
+// which for a captured card is before Subscribe returns. If the provider
+// refuses the charge the subscription is discarded, so retrying subscribes
+// afresh.
+func (s *SubscriptionService) Subscribe(ctx context.Context, req SubscribeRequest) (*model.Subscription, error) {
+	interval := strings.ToUpper(strings.TrimSpace(req.BillingInterval))
+	if interval == "" {
+		interval = "MONTHLY"
+	}
+	if _, ok := allowedBillingIntervals[interval]; !ok {
+		return nil, repository.Invalidf("invalid billing interval: %s", req.BillingInterval)
+	}
+
+	paymentMethod := strings.ToUpper(strings.TrimSpace(req.PaymentMethod))
+	if paymentMethod == "" {
+		paymentMethod = "CARD"
+	}
+	if _, ok := allowedPaymentMethods[paymentMethod]; !ok {
+		return nil, repository.Invalidf("invalid payment method: %s", req.PaymentMethod)
+	}
+
+	if req.Quantity == 0 {
+		req.Quantity = 1
+	}
+	if req.Quantity < 0 {
+		return nil, repository.Invalidf("invalid quantity: must be positive")
+	}
+
+	if _, err := s.clients.GetClientByID(ctx, req.ClientID); err != nil {
+		return nil, repository.NotFoundf("client %d not found", req.ClientID)
+	}
+	if _, err := s.plans.GetProductByID(ctx, req.PlanID); err != nil {
+		return nil, repository.NotFoundf("plan %d not found", req.PlanID)
+	}
+
+	sellerID, err := s.sellers.GetOrCreateByName(ctx, subscriptionSellerName)
+	if err != nil {
+		return nil, err
+	}
+
+	sub, err := s.subscriptions.Create(ctx, &model.Subscription{
+		ClientID:        req.ClientID,
+		PlanID:          req.PlanID,
+		Quantity:        req.Quantity,
+		BillingInterval: interval,
+		PaymentMethod:   paymentMethod,
+	}, sellerID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	orderID := *sub.Cycles[0].OrderID
+	if err := s.createCharge(ctx, sub.ID, orderID); err != nil {
+		return nil, chargeFailed(err, s.subscriptions.Discard(ctx, sub.ID, orderID, err.Error()))
+	}
+	return s.subscriptions.GetByID(ctx, sub.ID)
+}
+
+// ClientOf returns the client a subscription belongs to.
+func (s *SubscriptionService) ClientOf(ctx context.Context, id int64) (int64, error) {
+	return s.subscriptions.ClientOf(ctx, id)
+}
+
+func (s *SubscriptionService) Get(ctx context.Context, id int64) (*model.Subscription, error) {
+	return s.subscriptions.GetByID(ctx, id)
+}
+
+func (s *SubscriptionService) ListByClient(ctx context.Context, clientID int64) ([]*model.Subscription, error) {
+	return s.subscriptions.ListByClient(ctx, clientID)
+}
+
+func (s *SubscriptionService) Pause(ctx context.Context, id int64) (*model.Subscription, error) {
+	return s.subscriptions.Pause(ctx, id, time.Now())
+}
+
+func (s *SubscriptionService) Resume(ctx context.Context, id int64) (*model.Subscription, error) {
+	sellerID, err := s.sellers.GetOrCreateByName(ctx, subscriptionSellerName)
+	if err != nil {
+		return nil, err
+	}
+	_, orderID, err := s.subscriptions.Resume(ctx, id, sellerID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if err := s.charge(ctx, id, orderID); err != nil {
+		return nil, err
+	}
+	return s.subscriptions.GetByID(ctx, id)
+}
+
+func (s *SubscriptionService) Cancel(ctx context.Context, id int64, atPeriodEnd bool) (*model.Subscription, error) {
+	return s.subscriptions.Cancel(ctx, id, atPeriodEnd, time.Now())
+}
+
+func (s *SubscriptionService) ChangePlan(ctx context.Context, id, planID int64) (*model.Subscription, error) {
+	if planID <= 0 {
+		return nil, repository.Invalidf("invalid plan id")
+	}
+	sellerID, err := s.sellers.GetOrCreateByName(ctx, subscriptionSellerName)
+	if err != nil {
+		return nil, err
+	}
+	sub, orderID, err := s.subscriptions.ChangePlan(ctx, id, planID, sellerID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if orderID == 0 {
+		return sub, nil
+	}
+	if err := s.charge(ctx, id, orderID); err != nil {
+		return nil, err
+	}
+	return s.subscriptions.GetByID(ctx, id)
+}
+
+// RenewDue processes every subscription due at now, one at a time, and
+// returns how many were handled. A renewal paid by a card the provider
+// captures is finalized here; PIX and boleto renewals wait for the payer and
+// settle through the provider's webhook.
+func (s *SubscriptionService) RenewDue(ctx context.Context, now time.Time) (int, error) {
+	sellerID, err := s.sellers.GetOrCreateByName(ctx, subscriptionSellerName)
+	if err != nil {
+		return 0, err
+	}
+
+	handled := 0
+	for {
+		ok, orderID, err := s.subscriptions.RenewNext(ctx, now, sellerID, s.policy)
+		if err != nil {
+			return handled, err
+		}
+		if !ok {
+			return handled, nil
+		}
+		if orderID != 0 {
+			if err := s.charge(ctx, 0, orderID); err != nil {
+				slog.ErrorContext(ctx, "subscription renewal charge failed", "order_id", orderID, "err", err)
+			}
+		}
+		handled++
+	}
+}
+
+// charge asks the payment provider to collect a cycle's order. A charge the
+// provider will not even create fails the cycle now, since no webhook will
+// ever settle it.
+func (s *SubscriptionService) charge(ctx context.Context, subscriptionID, orderID int64) error {
+	if err := s.createCharge(ctx, subscriptionID, orderID); err != nil {
+		return chargeFailed(err, s.subscriptions.FailCharge(ctx, orderID, err.Error(), time.Now()))
+	}
+	return nil
+}
+
+func (s *SubscriptionService) createCharge(ctx context.Context, subscriptionID, orderID int64) error {
+	actor := "subscriptions"
+	if subscriptionID != 0 {
+		actor = fmt.Sprintf("subscription:%d", subscriptionID)
+	}
+	_, err := s.payments.CreateCharge(ctx, orderID, actor)
+	return err
+}
+
+// chargeFailed wraps a refused charge in ErrChargeFailed, noting recordErr if
+// recording the failure went wrong too.
+func chargeFailed(err, recordErr error) error {
+	if recordErr != nil {
+		return fmt.Errorf("%w: %w (recording it also failed: %v)", repository.ErrChargeFailed, err, recordErr)
+	}
+	return fmt.Errorf("%w: %w", repository.ErrChargeFailed, err)
+}
+
+// Run calls RenewDue on every tick until ctx is canceled.
+func (s *SubscriptionService) Run(ctx context.Context, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for {
+		if n, err := s.RenewDue(ctx, time.Now()); err != nil {
+			slog.ErrorContext(ctx, "subscription renewal failed", "err", err)
+		} else if n > 0 {
+			slog.InfoContext(ctx, "subscriptions: processed due subscriptions", "count", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
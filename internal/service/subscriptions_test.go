@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/Enilsonn/CRUD-Postgres/internal/payments"
+	"github.com/Enilsonn/CRUD-Postgres/internal/repository"
+)
+
+// decliningProvider refuses every charge it is asked to create.
+type decliningProvider struct{}
+
+func (decliningProvider) Name() string { return "declining" }
+
+func (decliningProvider) CreateCharge(context.Context, payments.ChargeRequest) (*payments.Charge, error) {
+	return nil, errors.New("card declined")
+}
+
+func (decliningProvider) ParseWebhook(http.Header, []byte) (*payments.WebhookEvent, error) {
+	return nil, payments.ErrInvalidWebhook
+}
+
+// A refused first charge must not leave the subscription behind, or the
+// client's retry would be turned away as a duplicate.
+func TestSubscribeDiscardsSubscriptionWhenChargeIsRefused(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	orders := repository.NewOrderRepository(db)
+	clients := repository.NewClientRepository(db)
+	s := NewSubscriptionService(repository.NewSubscriptionRepository(db), clients, repository.NewProductRepository(db),
+		repository.NewSellerRepository(db), NewPaymentService(repository.NewPaymentRepository(db), orders, clients, decliningProvider{}),
+		repository.RenewalPolicy{})
+
+	now := time.Now().UTC()
+	clientRows := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "name", "email", "phone", "status", "registration_data",
+			"supports_flamengo", "watches_one_piece", "city"}).
+			AddRow(7, "Ana", "ana@example.com", "81999990000", true, now, false, false, nil)
+	}
+
+	mock.ExpectQuery(`FROM clients`).WithArgs(int64(7)).WillReturnRows(clientRows())
+	mock.ExpectQuery(`FROM plans`).WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "plan_name", "price_cents", "amount_credits", "status", "category",
+			"manufactured_in_mari", "stock", "reserved_stock", "available", "validity_days"}).
+			AddRow(1, "Basic", 990, 500, true, "BASIC", false, 10, 0, 10, nil))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT id FROM sellers WHERE lower\(name\)`).WithArgs(subscriptionSellerName).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(9))
+	mock.ExpectCommit()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO subscriptions`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "client_id", "plan_id", "pending_plan_id", "quantity", "billing_interval",
+			"payment_method", "status", "current_period_start", "current_period_end", "next_renewal_at", "failed_attempts",
+			"grace_until", "cancel_at_period_end", "cancel_reason", "paused_at", "canceled_at", "created_at"}).
+			AddRow(5, 7, 1, nil, 1, "MONTHLY", "CARD", repository.SubscriptionIncomplete, now, now.AddDate(0, 1, 0), nil, 0,
+				nil, false, "", nil, nil, now))
+	mock.ExpectExec(`SAVEPOINT subscription_charge`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`set_config\('app.actor'`).WithArgs("subscription:5", "").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT price_cents, stock - reserved_stock FROM plans`).WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"price_cents", "available"}).AddRow(990, 10))
+	mock.ExpectQuery(`INSERT INTO orders`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(50))
+	mock.ExpectExec(`INSERT INTO order_items`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT o.total_cents, SUM`).WithArgs(int64(50)).
+		WillReturnRows(sqlmock.NewRows([]string{"total_cents", "credits"}).AddRow(990, 500))
+	mock.ExpectExec(`RELEASE SAVEPOINT subscription_charge`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`INSERT INTO subscription_cycles`).WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(3, now))
+	mock.ExpectCommit()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`set_config\('app.actor'`).WithArgs("subscription:5", "").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`SELECT sp_recalculate_order\(\$1, true\)`).WithArgs(int64(50)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`FROM orders WHERE id = \$1`).WithArgs(int64(50)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "client_id", "seller_id", "created_at", "payment_method", "payment_status",
+			"subtotal_cents", "discount_cents", "total_cents", "expires_at", "cancel_reason", "canceled_at", "price_lock", "checked_out_at"}).
+			AddRow(50, 7, 9, now, "CARD", "PENDING", 990, 0, 990, nil, "", nil, "ITEM", now))
+	mock.ExpectQuery(`FROM order_items oi`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "order_id", "plan_id", "plan_name", "quantity", "unit_price_cents"}).
+			AddRow(1, 50, 1, "Basic", 1, 990))
+	mock.ExpectQuery(`FROM clients`).WithArgs(int64(7)).WillReturnRows(clientRows())
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`set_config\('app.actor'`).WithArgs("subscription:5", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`UPDATE orders SET payment_status = 'FAILED'`).WithArgs(int64(50)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM subscriptions WHERE id = \$1 AND status = 'INCOMPLETE'`).WithArgs(int64(5)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	_, err = s.Subscribe(context.Background(), SubscribeRequest{ClientID: 7, PlanID: 1})
+	if !errors.Is(err, repository.ErrChargeFailed) {
+		t.Fatalf("Subscribe err = %v, want ErrChargeFailed", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
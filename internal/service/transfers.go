@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"strings"
+
+	"github.com/Enilsonn/CRUD-Postgres/internal/model"
+	"github.com/Enilsonn/CRUD-Postgres/internal/repository"
+)
+
+type TransferService struct {
+	transfers     *repository.TransferRepository
+	clients       *repository.ClientRepository
+	approvalLimit int64
+}
+
+type CreateTransferRequest struct {
+	FromClientID int64
+	ToClientID   int64
+	Credits      int64
+	Note         string
+	RequestID    string
+	RequestedBy  string
+	ByEmployee   bool
+}
+
+// NewTransferService builds the service. Client-initiated transfers above
+// approvalLimit credits wait for an employee; a limit of 0 disables approval.
+func NewTransferService(transfers *repository.TransferRepository, clients *repository.ClientRepository, approvalLimit int64) *TransferService {
+	return &TransferService{
+		transfers:     transfers,
+		clients:       clients,
+		approvalLimit: approvalLimit,
+	}
+}
+
+func (s *TransferService) Create(ctx context.Context, req CreateTransferRequest) (*model.CreditTransfer, error) {
+	if req.FromClientID <= 0 || req.ToClientID <= 0 {
+		return nil, repository.Invalidf("invalid transfer: client ids must be positive")
+	}
+	if req.FromClientID == req.ToClientID {
+		return nil, repository.Invalidf("invalid transfer: source and destination must differ")
+	}
+	if req.Credits <= 0 {
+		return nil, repository.Invalidf("invalid transfer: credits must be positive")
+	}
+
+	if _, err := s.clients.GetClientByID(ctx, req.ToClientID); err != nil {
+		return nil, repository.NotFoundf("destination client %d not found", req.ToClientID)
+	}
+
+	needsApproval := !req.ByEmployee && s.approvalLimit > 0 && req.Credits > s.approvalLimit
+
+	return s.transfers.Create(ctx, &model.CreditTransfer{
+		FromClientID: req.FromClientID,
+		ToClientID:   req.ToClientID,
+		Credits:      req.Credits,
+		Note:         strings.TrimSpace(req.Note),
+		RequestID:    strings.TrimSpace(req.RequestID),
+		RequestedBy:  req.RequestedBy,
+	}, !needsApproval)
+}
+
+func (s *TransferService) Approve(ctx context.Context, id int64, reviewer string) (*model.CreditTransfer, error) {
+	return s.transfers.Approve(ctx, id, reviewer)
+}
+
+func (s *TransferService) Reject(ctx context.Context, id int64, reviewer string) (*model.CreditTransfer, error) {
+	return s.transfers.Reject(ctx, id, reviewer)
+}
+
+func (s *TransferService) Get(ctx context.Context, id int64) (*model.CreditTransfer, error) {
+	return s.transfers.GetByID(ctx, id)
+}
+
+func (s *TransferService) ListByClient(ctx context.Context, clientID int64) ([]*model.CreditTransfer, error) {
+	return s.transfers.ListByClient(ctx, clientID)
+}
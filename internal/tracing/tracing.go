@@ -0,0 +1,96 @@
+// Package tracing sets up OpenTelemetry tracing and the spans the service
+// records: one per HTTP request, per database statement (see
+// database.OpenConnection), per pricing lookup and per Ollama call.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/Enilsonn/CRUD-Postgres/cmd/configs"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentation = "github.com/Enilsonn/CRUD-Postgres"
+
+var enabled atomic.Bool
+
+// Setup installs the exporter conf names as the global tracer provider and
+// W3C trace context as the propagator. The returned function flushes
+// buffered spans and must run before exit. With the "none" exporter nothing
+// is installed and spans cost next to nothing.
+func Setup(ctx context.Context, conf configs.TracingConf) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	switch conf.Exporter {
+	case "none":
+		return func(context.Context) error { return nil }, nil
+	case "stdout":
+		exp, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout), stdouttrace.WithPrettyPrint())
+		if err != nil {
+			return nil, fmt.Errorf("create stdout trace exporter: %w", err)
+		}
+		exporter = exp
+	case "otlp":
+		opts := []otlptracehttp.Option{otlptracehttp.WithEndpointURL(conf.OTLPEndpoint)}
+		if headers := parseHeaders(conf.OTLPHeaders); len(headers) > 0 {
+			opts = append(opts, otlptracehttp.WithHeaders(headers))
+		}
+		exp, err := otlptracehttp.New(ctx, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("create otlp trace exporter: %w", err)
+		}
+		exporter = exp
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", conf.Exporter)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(conf.ServiceName)))
+	if err != nil {
+		return nil, fmt.Errorf("build trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(conf.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	enabled.Store(true)
+
+	return provider.Shutdown, nil
+}
+
+// Enabled reports whether Setup installed an exporter.
+func Enabled() bool {
+	return enabled.Load()
+}
+
+// Tracer is the tracer every span in the service is started from.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentation)
+}
+
+// parseHeaders reads key=value pairs separated by commas.
+func parseHeaders(raw string) map[string]string {
+	headers := map[string]string{}
+	for _, pair := range strings.Split(raw, ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		if key = strings.TrimSpace(key); ok && key != "" {
+			headers[key] = strings.TrimSpace(value)
+		}
+	}
+	return headers
+}
@@ -0,0 +1,54 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Enilsonn/CRUD-Postgres/cmd/configs"
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestMiddlewareContinuesTraceAndNamesSpanByRoute(t *testing.T) {
+	shutdown, err := Setup(context.Background(), configs.TracingConf{Exporter: "stdout", ServiceName: "test", SampleRatio: 1})
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	defer shutdown(context.Background())
+
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	r := chi.NewRouter()
+	r.Use(Middleware)
+	r.Get("/api/orders/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/orders/42", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(spans))
+	}
+	span := spans[0]
+	if span.Name() != "GET /api/orders/{id}" {
+		t.Errorf("span name = %q, want the route pattern", span.Name())
+	}
+	if got := span.SpanContext().TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("trace id = %s, want the caller's", got)
+	}
+	if got := span.Parent().SpanID().String(); got != "00f067aa0ba902b7" {
+		t.Errorf("parent span id = %s, want the caller's", got)
+	}
+	if span.Status().Code != codes.Error {
+		t.Errorf("status = %v, want an error for a 5xx", span.Status())
+	}
+}
@@ -6,7 +6,17 @@ import (
 	"net/http"
 )
 
+// EncodeJson writes data as the JSON response. Error bodies, maps sent with
+// a 4xx or 5xx status, also get the request_id so a caller can quote it.
 func EncodeJson[T any](w http.ResponseWriter, r *http.Request, statusCode int, data T) error {
+	if statusCode >= http.StatusBadRequest && r != nil {
+		if body, ok := any(data).(map[string]any); ok {
+			if id := RequestIDFrom(r.Context()); id != "" {
+				body["request_id"] = id
+			}
+		}
+	}
+
 	w.Header().Add("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
 
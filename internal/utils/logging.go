@@ -0,0 +1,173 @@
+package utils
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type logFieldsKey struct{}
+
+// logFields holds what handlers learn about a request while serving it,
+// such as the client a JSON body names.
+type logFields struct {
+	mu    sync.Mutex
+	attrs []slog.Attr
+}
+
+// routeIDFields names the {id} parameter by the route it appears under.
+// {client_id} parameters are logged as client_id wherever they appear.
+var routeIDFields = []struct{ prefix, field string }{
+	{"/api/clients/", "client_id"},
+	{"/api/orders/", "order_id"},
+}
+
+// AddLogAttrs attaches attrs to every later log line written with ctx, the
+// request log included. It does nothing outside a request.
+func AddLogAttrs(ctx context.Context, attrs ...slog.Attr) {
+	fields, ok := ctx.Value(logFieldsKey{}).(*logFields)
+	if !ok {
+		return
+	}
+	fields.mu.Lock()
+	fields.attrs = append(fields.attrs, attrs...)
+	fields.mu.Unlock()
+}
+
+// NewLogHandler writes JSON lines, or text when format is "text", to w. Logs
+// written with a request's context also get its request_id, trace_id,
+// client_id and order_id where known.
+func NewLogHandler(w io.Writer, format string, level slog.Leveler) slog.Handler {
+	opts := &slog.HandlerOptions{Level: level}
+	if format == "text" {
+		return contextHandler{slog.NewTextHandler(w, opts)}
+	}
+	return contextHandler{slog.NewJSONHandler(w, opts)}
+}
+
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, rec slog.Record) error {
+	seen := map[string]bool{}
+	rec.Attrs(func(a slog.Attr) bool {
+		seen[a.Key] = true
+		return true
+	})
+	add := func(a slog.Attr) {
+		if !seen[a.Key] {
+			seen[a.Key] = true
+			rec.AddAttrs(a)
+		}
+	}
+
+	if id := RequestIDFrom(ctx); id != "" {
+		add(slog.String("request_id", id))
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		add(slog.String("trace_id", sc.TraceID().String()))
+	}
+	if fields, ok := ctx.Value(logFieldsKey{}).(*logFields); ok {
+		fields.mu.Lock()
+		for _, a := range fields.attrs {
+			add(a)
+		}
+		fields.mu.Unlock()
+	}
+	for _, a := range routeAttrs(ctx) {
+		add(a)
+	}
+
+	return h.Handler.Handle(ctx, rec)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// routeAttrs reads client and order ids from the matched route's URL
+// parameters.
+func routeAttrs(ctx context.Context) []slog.Attr {
+	rctx := chi.RouteContext(ctx)
+	if rctx == nil {
+		return nil
+	}
+
+	var attrs []slog.Attr
+	pattern := rctx.RoutePattern()
+	for i, key := range rctx.URLParams.Keys {
+		field := ""
+		switch key {
+		case "client_id":
+			field = "client_id"
+		case "id":
+			for _, r := range routeIDFields {
+				if strings.HasPrefix(pattern, r.prefix) {
+					field = r.field
+					break
+				}
+			}
+		}
+		if field == "" || i >= len(rctx.URLParams.Values) {
+			continue
+		}
+
+		value := rctx.URLParams.Values[i]
+		if id, err := strconv.ParseInt(value, 10, 64); err == nil {
+			attrs = append(attrs, slog.Int64(field, id))
+		} else {
+			attrs = append(attrs, slog.String(field, value))
+		}
+	}
+	return attrs
+}
+
+// RequestLogger logs one line per request once it is served: at error level
+// for 5xx responses, warn for 4xx and info otherwise.
+func RequestLogger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		start := time.Now()
+
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", status),
+			slog.Int("bytes", ww.BytesWritten()),
+			slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("remote_addr", r.RemoteAddr),
+		}
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			attrs = append(attrs, slog.String("route", rctx.RoutePattern()))
+		}
+		slog.LogAttrs(r.Context(), level, "request", attrs...)
+	})
+}
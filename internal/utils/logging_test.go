@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestRequestIDReachesErrorBodyAndLogs(t *testing.T) {
+	var logs bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(NewLogHandler(&logs, "json", slog.LevelInfo)))
+	defer slog.SetDefault(prev)
+
+	r := chi.NewRouter()
+	r.Use(RequestID)
+	r.Use(RequestLogger)
+	r.Get("/api/orders/{id}", func(w http.ResponseWriter, r *http.Request) {
+		AddLogAttrs(r.Context(), slog.Int64("client_id", 7))
+		EncodeJson(w, r, http.StatusConflict, map[string]any{"error": true, "code": "ORDER_NOT_PENDING"})
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/orders/42", nil)
+	req.Header.Set(RequestIDHeader, "abc-123")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get(RequestIDHeader); got != "abc-123" {
+		t.Errorf("%s = %q, want the caller's id echoed", RequestIDHeader, got)
+	}
+	var body map[string]any
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body["request_id"] != "abc-123" {
+		t.Errorf("error body %v lacks the request id", body)
+	}
+
+	var line map[string]any
+	if err := json.Unmarshal(logs.Bytes(), &line); err != nil {
+		t.Fatalf("log %q is not one JSON line: %v", logs.String(), err)
+	}
+	want := map[string]any{
+		"msg":        "request",
+		"level":      "WARN",
+		"request_id": "abc-123",
+		"route":      "/api/orders/{id}",
+		"client_id":  float64(7),
+		"order_id":   float64(42),
+		"status":     float64(http.StatusConflict),
+	}
+	for key, value := range want {
+		if line[key] != value {
+			t.Errorf("log %s = %v, want %v", key, line[key], value)
+		}
+	}
+
+	// Ids that could smuggle text into logs are replaced.
+	req = httptest.NewRequest(http.MethodGet, "/api/orders/1", nil)
+	req.Header.Set(RequestIDHeader, "bad id\n")
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if got := rec.Header().Get(RequestIDHeader); got == "" || strings.ContainsAny(got, " \n") {
+		t.Errorf("%s = %q, want a generated id", RequestIDHeader, got)
+	}
+}
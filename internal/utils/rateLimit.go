@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimit allows each caller perMinute() requests per clock minute. Callers
+// are told apart by address, not X-Client-ID: the header is the caller's own
+// claim, and a fresh value on every request would reset its count. The
+// address is the remote one unless that is a trusted proxy, in which case
+// X-Forwarded-For is followed back past trusted hops. Both functions are
+// read on every request so they can change at runtime; a limit of zero or
+// less turns limiting off.
+func RateLimit(perMinute func() int, trustedProxies func() []netip.Prefix) func(http.Handler) http.Handler {
+	var (
+		mu     sync.Mutex
+		window time.Time
+		counts = map[string]int{}
+	)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limit := perMinute()
+			if limit <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key := callerAddr(r, trustedProxies())
+
+			now := time.Now()
+			mu.Lock()
+			if current := now.Truncate(time.Minute); !current.Equal(window) {
+				window = current
+				clear(counts)
+			}
+			counts[key]++
+			allowed := counts[key] <= limit
+			reset := window.Add(time.Minute)
+			mu.Unlock()
+
+			if !allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(int(reset.Sub(now).Seconds())+1))
+				EncodeJson(w, r, http.StatusTooManyRequests, map[string]any{
+					"error":   true,
+					"code":    "RATE_LIMITED",
+					"message": "too many requests, retry after " + reset.UTC().Format(time.RFC3339),
+				})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// callerAddr is the address of whoever sent r: the remote address, or, when
+// that is a trusted proxy, the nearest X-Forwarded-For hop that is not. Hops
+// further left are the caller's own claim and are never believed.
+func callerAddr(r *http.Request, trusted []netip.Prefix) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !isTrusted(host, trusted) {
+		return host
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		host = hop
+		if !isTrusted(hop, trusted) {
+			break
+		}
+	}
+	return host
+}
+
+func isTrusted(host string, trusted []netip.Prefix) bool {
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
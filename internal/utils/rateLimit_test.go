@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"testing"
+)
+
+func TestRateLimitIgnoresClientHeader(t *testing.T) {
+	h := RateLimit(func() int { return 2 }, func() []netip.Prefix { return nil })(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	send := func(remote, clientID string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/chat/ollama", nil)
+		req.RemoteAddr = remote
+		req.Header.Set("X-Client-ID", clientID)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// A new X-Client-ID on every request does not buy a fresh allowance.
+	for i := range 2 {
+		if code := send("203.0.113.5:4000", strconv.Itoa(i)); code != http.StatusNoContent {
+			t.Fatalf("request %d: status %d, want 204", i, code)
+		}
+	}
+	if code := send("203.0.113.5:4001", "99"); code != http.StatusTooManyRequests {
+		t.Errorf("third request from the same address: status %d, want 429", code)
+	}
+	if code := send("198.51.100.8:4000", "0"); code != http.StatusNoContent {
+		t.Errorf("another address: status %d, want 204", code)
+	}
+}
+
+func TestRateLimitFollowsForwardedForOnlyFromTrustedProxies(t *testing.T) {
+	proxy := netip.MustParsePrefix("10.0.0.0/8")
+	h := RateLimit(func() int { return 1 }, func() []netip.Prefix { return []netip.Prefix{proxy} })(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	send := func(remote, forwardedFor string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/chat/ollama", nil)
+		req.RemoteAddr = remote
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// Behind the proxy, callers are told apart by the hop it appended.
+	if code := send("10.0.0.1:4000", "192.0.2.1"); code != http.StatusNoContent {
+		t.Fatalf("first caller behind the proxy: status %d, want 204", code)
+	}
+	if code := send("10.0.0.1:4001", "192.0.2.2"); code != http.StatusNoContent {
+		t.Errorf("second caller behind the proxy: status %d, want 204", code)
+	}
+	// A forged leftmost hop does not hide the address the proxy saw.
+	if code := send("10.0.0.1:4002", "198.51.100.77, 192.0.2.1"); code != http.StatusTooManyRequests {
+		t.Errorf("forged hop in front of a known caller: status %d, want 429", code)
+	}
+	// Straight from an untrusted address, the header is ignored.
+	if code := send("203.0.113.5:4000", "192.0.2.9"); code != http.StatusNoContent {
+		t.Fatalf("direct caller: status %d, want 204", code)
+	}
+	if code := send("203.0.113.5:4001", "192.0.2.10"); code != http.StatusTooManyRequests {
+		t.Errorf("direct caller with a new forwarded address: status %d, want 429", code)
+	}
+}
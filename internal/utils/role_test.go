@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestRequireOwnerOf(t *testing.T) {
+	owners := map[int64]int64{5: 7}
+	owner := func(_ context.Context, id int64) (int64, error) {
+		if clientID, ok := owners[id]; ok {
+			return clientID, nil
+		}
+		return 0, errors.New("not found")
+	}
+
+	r := chi.NewRouter()
+	r.With(RequireOwnerOf("id", owner)).Get("/things/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		name   string
+		path   string
+		header map[string]string
+		want   int
+	}{
+		{"owner", "/things/5", map[string]string{"X-Client-ID": "7"}, http.StatusNoContent},
+		{"someone else", "/things/5", map[string]string{"X-Client-ID": "8"}, http.StatusForbidden},
+		{"anonymous", "/things/5", nil, http.StatusForbidden},
+		{"unknown id", "/things/6", map[string]string{"X-Client-ID": "0"}, http.StatusForbidden},
+		{"malformed id", "/things/x", map[string]string{"X-Client-ID": "0"}, http.StatusForbidden},
+		{"employee", "/things/6", map[string]string{"X-Role": "employee"}, http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
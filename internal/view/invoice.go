@@ -0,0 +1,96 @@
+package view
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"strconv"
+
+	"github.com/Enilsonn/CRUD-Postgres/internal/model"
+)
+
+var invoiceTemplate = template.Must(template.New("invoice").Funcs(template.FuncMap{
+	"cents": FormatCents,
+	"date":  func(t interface{ Format(string) string }) string { return t.Format("2006-01-02") },
+	"bp":    func(bp int) string { return fmt.Sprintf("%d.%02d%%", bp/100, bp%100) },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Invoice {{if .Number}}{{.Number}}{{else}}draft #{{.ID}}{{end}}</title>
+<style>
+body { font-family: sans-serif; margin: 2rem; color: #222; }
+table { border-collapse: collapse; width: 100%; margin-top: 1rem; }
+th, td { border-bottom: 1px solid #ddd; padding: .4rem; text-align: left; }
+td.num, th.num { text-align: right; }
+.status { font-weight: bold; }
+</style>
+</head>
+<body>
+<h1>Invoice {{if .Number}}{{.Number}}{{else}}(draft #{{.ID}}){{end}}</h1>
+<p>Client: {{.ClientName}} (#{{.ClientID}})<br>
+Period: {{date .PeriodStart}} to {{date .PeriodEnd}}<br>
+Status: <span class="status">{{.Status}}</span>{{if .IssuedAt}}<br>
+Issued: {{date .IssuedAt}}{{end}}{{if .PaidAt}}<br>
+Paid: {{date .PaidAt}}{{end}}</p>
+<table>
+<thead><tr><th>Description</th><th class="num">Qty</th><th class="num">Unit price</th><th class="num">Amount</th></tr></thead>
+<tbody>
+{{range .Lines}}<tr><td>{{.Description}}</td><td class="num">{{.Quantity}}</td><td class="num">{{cents .UnitPriceCents}}</td><td class="num">{{cents .AmountCents}}</td></tr>
+{{end}}</tbody>
+<tfoot>
+<tr><td colspan="3" class="num">Subtotal</td><td class="num">{{cents .SubtotalCents}}</td></tr>
+<tr><td colspan="3" class="num">Tax ({{bp .TaxRateBP}})</td><td class="num">{{cents .TaxCents}}</td></tr>
+<tr><th colspan="3" class="num">Total ({{.Currency}})</th><th class="num">{{cents .TotalCents}}</th></tr>
+</tfoot>
+</table>
+</body>
+</html>
+`))
+
+// RenderInvoiceHTML writes a standalone HTML page for the invoice.
+func RenderInvoiceHTML(w io.Writer, inv *model.Invoice) error {
+	return invoiceTemplate.Execute(w, inv)
+}
+
+const pdfInvoiceRow = "%-50s %6s %14s %14s"
+
+// RenderInvoicePDF writes the invoice as a plain text PDF document.
+func RenderInvoicePDF(w io.Writer, inv *model.Invoice) error {
+	pdf := NewPDFWriter(w)
+
+	title := "Invoice " + inv.Number
+	if inv.Number == "" {
+		title = fmt.Sprintf("Invoice (draft #%d)", inv.ID)
+	}
+
+	lines := []string{
+		title,
+		fmt.Sprintf("Client: %s (#%d)", inv.ClientName, inv.ClientID),
+		fmt.Sprintf("Period: %s to %s", inv.PeriodStart.Format("2006-01-02"), inv.PeriodEnd.Format("2006-01-02")),
+		"Status: " + inv.Status,
+		"",
+		fmt.Sprintf(pdfInvoiceRow, "Description", "Qty", "Unit price", "Amount"),
+	}
+	for _, line := range inv.Lines {
+		lines = append(lines, fmt.Sprintf(pdfInvoiceRow,
+			truncate(line.Description, 50),
+			strconv.FormatInt(line.Quantity, 10),
+			FormatCents(line.UnitPriceCents),
+			FormatCents(line.AmountCents),
+		))
+	}
+	lines = append(lines,
+		"",
+		fmt.Sprintf("%72s %14s", "Subtotal", FormatCents(inv.SubtotalCents)),
+		fmt.Sprintf("%72s %14s", fmt.Sprintf("Tax (%d.%02d%%)", inv.TaxRateBP/100, inv.TaxRateBP%100), FormatCents(inv.TaxCents)),
+		fmt.Sprintf("%72s %14s", "Total ("+inv.Currency+")", FormatCents(inv.TotalCents)),
+	)
+
+	for _, line := range lines {
+		if err := pdf.Line(line); err != nil {
+			return err
+		}
+	}
+	return pdf.Close()
+}
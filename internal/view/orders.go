@@ -0,0 +1,59 @@
+package view
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/Enilsonn/CRUD-Postgres/internal/model"
+)
+
+// OrderCSV writes one row per order, flushing periodically so large exports
+// reach the client while they are still being read from the database.
+type OrderCSV struct {
+	w    *csv.Writer
+	rows int
+}
+
+func NewOrderCSV(w io.Writer) *OrderCSV {
+	c := &OrderCSV{w: csv.NewWriter(w)}
+	c.w.Write([]string{"order_id", "created_at", "client_id", "seller_id", "payment_method", "payment_status",
+		"subtotal_cents", "discount_cents", "total_cents", "expires_at", "canceled_at", "cancel_reason"})
+	return c
+}
+
+func (c *OrderCSV) Order(o *model.Order) error {
+	c.w.Write([]string{
+		strconv.FormatInt(o.ID, 10),
+		o.CreatedAt.UTC().Format(time.RFC3339),
+		strconv.FormatInt(o.ClientID, 10),
+		strconv.FormatInt(o.SellerID, 10),
+		o.PaymentMethod,
+		o.PaymentStatus,
+		strconv.FormatInt(o.SubtotalCents, 10),
+		strconv.FormatInt(o.DiscountCents, 10),
+		strconv.FormatInt(o.TotalCents, 10),
+		formatOptionalTime(o.ExpiresAt),
+		formatOptionalTime(o.CanceledAt),
+		o.CancelReason,
+	})
+
+	c.rows++
+	if c.rows%500 == 0 {
+		c.w.Flush()
+	}
+	return c.w.Error()
+}
+
+func (c *OrderCSV) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func formatOptionalTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,176 @@
+package view
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	pdfPageWidth    = 595 // A4 in points
+	pdfPageHeight   = 842
+	pdfMargin       = 40
+	pdfFontSize     = 9
+	pdfLeading      = 12
+	pdfLinesPerPage = (pdfPageHeight - 2*pdfMargin) / pdfLeading
+)
+
+// PDFWriter emits a plain monospaced text document page by page. Only the
+// current page is buffered, so arbitrarily long documents stream straight
+// to the underlying writer.
+type PDFWriter struct {
+	w       *countingWriter
+	offsets []int64
+	pages   []int
+	lines   []string
+	err     error
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Object numbers 1 and 2 are reserved for the catalog and page tree, which
+// can only be written once every page is known.
+const (
+	pdfCatalogObj = 1
+	pdfPagesObj   = 2
+	pdfFontObj    = 3
+)
+
+func NewPDFWriter(w io.Writer) *PDFWriter {
+	p := &PDFWriter{
+		w:       &countingWriter{w: w},
+		offsets: make([]int64, pdfFontObj+1),
+	}
+
+	p.printf("%%PDF-1.4\n%%\xe2\xe3\xcf\xd3\n")
+	p.beginObject(pdfFontObj)
+	p.printf("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>\nendobj\n")
+
+	return p
+}
+
+// Line appends a text line, starting a new page when the current one is full.
+func (p *PDFWriter) Line(text string) error {
+	if p.err != nil {
+		return p.err
+	}
+
+	p.lines = append(p.lines, text)
+	if len(p.lines) >= pdfLinesPerPage {
+		p.flushPage()
+	}
+	return p.err
+}
+
+func (p *PDFWriter) Close() error {
+	if p.err != nil {
+		return p.err
+	}
+
+	if len(p.lines) > 0 || len(p.pages) == 0 {
+		p.flushPage()
+	}
+
+	kids := make([]string, len(p.pages))
+	for i, obj := range p.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", obj)
+	}
+
+	p.beginObject(pdfPagesObj)
+	p.printf("<< /Type /Pages /Kids [%s] /Count %d >>\nendobj\n", strings.Join(kids, " "), len(p.pages))
+
+	p.beginObject(pdfCatalogObj)
+	p.printf("<< /Type /Catalog /Pages %d 0 R >>\nendobj\n", pdfPagesObj)
+
+	xref := p.w.n
+	p.printf("xref\n0 %d\n0000000000 65535 f \n", len(p.offsets))
+	for _, off := range p.offsets[1:] {
+		p.printf("%010d 00000 n \n", off)
+	}
+	p.printf("trailer\n<< /Size %d /Root %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(p.offsets), pdfCatalogObj, xref)
+
+	return p.err
+}
+
+func (p *PDFWriter) flushPage() {
+	var content bytes.Buffer
+	fmt.Fprintf(&content, "BT\n/F1 %d Tf\n%d TL\n%d %d Td\n", pdfFontSize, pdfLeading, pdfMargin, pdfPageHeight-pdfMargin)
+	for _, line := range p.lines {
+		fmt.Fprintf(&content, "(%s) '\n", pdfEscape(line))
+	}
+	content.WriteString("ET\n")
+	p.lines = p.lines[:0]
+
+	contentObj := p.newObject()
+	p.printf("<< /Length %d >>\nstream\n", content.Len())
+	if p.err == nil {
+		_, p.err = p.w.Write(content.Bytes())
+	}
+	p.printf("endstream\nendobj\n")
+
+	pageObj := p.newObject()
+	p.printf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 %d 0 R >> >> /Contents %d 0 R >>\nendobj\n",
+		pdfPagesObj, pdfPageWidth, pdfPageHeight, pdfFontObj, contentObj)
+	p.pages = append(p.pages, pageObj)
+}
+
+func (p *PDFWriter) newObject() int {
+	p.offsets = append(p.offsets, 0)
+	num := len(p.offsets) - 1
+	p.beginObject(num)
+	return num
+}
+
+func (p *PDFWriter) beginObject(num int) {
+	p.offsets[num] = p.w.n
+	p.printf("%d 0 obj\n", num)
+}
+
+func (p *PDFWriter) printf(format string, args ...any) {
+	if p.err != nil {
+		return
+	}
+	_, p.err = fmt.Fprintf(p.w, format, args...)
+}
+
+// truncate shortens s to at most width characters, ending in "..." when
+// cut. It counts runes so accented text is never split mid-character.
+func truncate(s string, width int) string {
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	return string([]rune(s)[:width-3]) + "..."
+}
+
+// pdfEscape keeps text inside a PDF string literal. Characters outside
+// Latin-1 have no glyph in the standard Courier font and become '?'.
+func pdfEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20:
+			b.WriteByte(' ')
+		case r < 0x80:
+			b.WriteRune(r)
+		case r <= 0xff:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
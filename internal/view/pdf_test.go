@@ -0,0 +1,58 @@
+package view
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestPDFWriterXrefOffsets(t *testing.T) {
+	var buf bytes.Buffer
+	pdf := NewPDFWriter(&buf)
+	for i := 0; i < pdfLinesPerPage*2+3; i++ {
+		if err := pdf.Line(fmt.Sprintf("line %d (café)", i)); err != nil {
+			t.Fatalf("write line: %v", err)
+		}
+	}
+	if err := pdf.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	out := buf.String()
+	if !strings.HasPrefix(out, "%PDF-1.4") || !strings.HasSuffix(out, "%%EOF\n") {
+		t.Fatalf("missing pdf header or trailer")
+	}
+	if !strings.Contains(out, "/Count 3") {
+		t.Fatalf("expected 3 pages")
+	}
+
+	xref := strings.Index(out, "xref\n")
+	start, _ := strconv.Atoi(regexp.MustCompile(`startxref\n(\d+)`).FindStringSubmatch(out)[1])
+	if start != xref {
+		t.Fatalf("startxref %d does not point at xref table %d", start, xref)
+	}
+
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllStringSubmatch(out[xref:], -1)
+	for i, entry := range entries {
+		off, _ := strconv.Atoi(entry[1])
+		want := fmt.Sprintf("%d 0 obj", i+1)
+		if !strings.HasPrefix(out[off:], want) {
+			t.Fatalf("xref entry %d points at %q", i+1, out[off:off+len(want)])
+		}
+	}
+}
+
+func TestTruncateKeepsRunesWhole(t *testing.T) {
+	desc := "Recarga automática: créditos de conversação"
+	got := truncate(desc, 20)
+	if !utf8.ValidString(got) || utf8.RuneCountInString(got) != 20 || !strings.HasSuffix(got, "...") {
+		t.Errorf("truncate(%q, 20) = %q", desc, got)
+	}
+	if got := truncate("ação", 4); got != "ação" {
+		t.Errorf("short text changed to %q", got)
+	}
+}
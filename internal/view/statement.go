@@ -0,0 +1,207 @@
+package view
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/Enilsonn/CRUD-Postgres/internal/model"
+)
+
+// StatementRenderer writes a wallet statement incrementally: Begin once with
+// the period summary, Entry for every ledger row in chronological order, End once.
+type StatementRenderer interface {
+	ContentType() string
+	FileExtension() string
+	Begin(stmt *model.WalletStatement) error
+	Entry(entry *model.CreditLedgerEntry) error
+	End() error
+}
+
+func NewStatementRenderer(format string, w io.Writer) (StatementRenderer, error) {
+	switch format {
+	case "", "json":
+		return &jsonStatement{w: w}, nil
+	case "csv":
+		return &csvStatement{w: csv.NewWriter(w)}, nil
+	case "pdf":
+		return &pdfStatement{pdf: NewPDFWriter(w)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported statement format: %s", format)
+	}
+}
+
+// DescribeEntry turns the ledger meta into a short human readable label.
+func DescribeEntry(entry *model.CreditLedgerEntry) string {
+	var meta map[string]any
+	_ = json.Unmarshal(entry.Meta, &meta)
+
+	if orderID, ok := meta["order_id"]; ok {
+		return fmt.Sprintf("Order #%v", orderID)
+	}
+	if m, ok := meta["model"].(string); ok && m != "" {
+		return fmt.Sprintf("%s (%v prompt / %v completion tokens)", m, meta["prompt_tokens"], meta["completion_tokens"])
+	}
+	if t, ok := meta["type"].(string); ok && t != "" {
+		return t
+	}
+	return entry.Type
+}
+
+type csvStatement struct {
+	w       *csv.Writer
+	stmt    *model.WalletStatement
+	balance int64
+	rows    int
+}
+
+func (c *csvStatement) ContentType() string   { return "text/csv; charset=utf-8" }
+func (c *csvStatement) FileExtension() string { return "csv" }
+
+func (c *csvStatement) Begin(stmt *model.WalletStatement) error {
+	c.stmt = stmt
+	c.balance = stmt.OpeningBalance
+
+	c.w.Write([]string{"date", "entry_id", "type", "description", "credits_delta", "price_cents_delta", "balance_credits"})
+	c.w.Write([]string{stmt.PeriodStart.Format(time.RFC3339), "", "OPENING_BALANCE", "", "", "", strconv.FormatInt(stmt.OpeningBalance, 10)})
+	return c.w.Error()
+}
+
+func (c *csvStatement) Entry(entry *model.CreditLedgerEntry) error {
+	c.balance += entry.CreditsDelta
+	c.w.Write([]string{
+		entry.CreatedAt.UTC().Format(time.RFC3339),
+		strconv.FormatInt(entry.ID, 10),
+		entry.Type,
+		DescribeEntry(entry),
+		strconv.FormatInt(entry.CreditsDelta, 10),
+		strconv.FormatInt(entry.PriceCentsDelta, 10),
+		strconv.FormatInt(c.balance, 10),
+	})
+
+	c.rows++
+	if c.rows%500 == 0 {
+		c.w.Flush()
+	}
+	return c.w.Error()
+}
+
+func (c *csvStatement) End() error {
+	c.w.Write([]string{c.stmt.PeriodEnd.Format(time.RFC3339), "", "CLOSING_BALANCE", "", "", strconv.FormatInt(c.stmt.CentsSpent, 10), strconv.FormatInt(c.stmt.ClosingBalance, 10)})
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type jsonStatement struct {
+	w     io.Writer
+	first bool
+}
+
+func (j *jsonStatement) ContentType() string   { return "application/json" }
+func (j *jsonStatement) FileExtension() string { return "json" }
+
+func (j *jsonStatement) Begin(stmt *model.WalletStatement) error {
+	summary, err := json.Marshal(stmt)
+	if err != nil {
+		return err
+	}
+	j.first = true
+	_, err = fmt.Fprintf(j.w, `{"statement":%s,"entries":[`, summary)
+	return err
+}
+
+func (j *jsonStatement) Entry(entry *model.CreditLedgerEntry) error {
+	row, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if !j.first {
+		if _, err := io.WriteString(j.w, ","); err != nil {
+			return err
+		}
+	}
+	j.first = false
+	_, err = j.w.Write(row)
+	return err
+}
+
+func (j *jsonStatement) End() error {
+	_, err := io.WriteString(j.w, "]}\n")
+	return err
+}
+
+type pdfStatement struct {
+	pdf     *PDFWriter
+	stmt    *model.WalletStatement
+	balance int64
+}
+
+func (p *pdfStatement) ContentType() string   { return "application/pdf" }
+func (p *pdfStatement) FileExtension() string { return "pdf" }
+
+// The type column fits the longest ledger type, DEBT_SETTLEMENT; a row is 94
+// characters, what fits between the margins in 9pt Courier.
+const pdfStatementRow = "%-16s %8s %-15s %-30s %10s %10s"
+
+func (p *pdfStatement) Begin(stmt *model.WalletStatement) error {
+	p.stmt = stmt
+	p.balance = stmt.OpeningBalance
+
+	for _, line := range []string{
+		fmt.Sprintf("Wallet statement - client %d - %s", stmt.ClientID, stmt.Month),
+		fmt.Sprintf("Period: %s to %s (UTC)", stmt.PeriodStart.Format("2006-01-02"), stmt.PeriodEnd.AddDate(0, 0, -1).Format("2006-01-02")),
+		"",
+		fmt.Sprintf("Opening balance: %d credits", stmt.OpeningBalance),
+		"",
+		fmt.Sprintf(pdfStatementRow, "Date", "Entry", "Type", "Description", "Credits", "Balance"),
+	} {
+		if err := p.pdf.Line(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *pdfStatement) Entry(entry *model.CreditLedgerEntry) error {
+	p.balance += entry.CreditsDelta
+
+	desc := truncate(DescribeEntry(entry), 30)
+
+	return p.pdf.Line(fmt.Sprintf(pdfStatementRow,
+		entry.CreatedAt.UTC().Format("2006-01-02 15:04"),
+		strconv.FormatInt(entry.ID, 10),
+		entry.Type,
+		desc,
+		strconv.FormatInt(entry.CreditsDelta, 10),
+		strconv.FormatInt(p.balance, 10),
+	))
+}
+
+func (p *pdfStatement) End() error {
+	for _, line := range []string{
+		"",
+		fmt.Sprintf("Entries:         %d", p.stmt.EntriesCount),
+		fmt.Sprintf("Credits in:      %d", p.stmt.CreditsIn),
+		fmt.Sprintf("Credits out:     %d", p.stmt.CreditsOut),
+		fmt.Sprintf("Closing balance: %d credits", p.stmt.ClosingBalance),
+		fmt.Sprintf("Amount spent:    %s", FormatCents(p.stmt.CentsSpent)),
+	} {
+		if err := p.pdf.Line(line); err != nil {
+			return err
+		}
+	}
+	return p.pdf.Close()
+}
+
+// FormatCents renders an amount in cents as BRL, e.g. 12345 -> "R$ 123.45".
+func FormatCents(cents int64) string {
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%sR$ %d.%02d", sign, cents/100, cents%100)
+}
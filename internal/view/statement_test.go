@@ -0,0 +1,19 @@
+package view
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPDFStatementRowFitsEveryLedgerType(t *testing.T) {
+	header := fmt.Sprintf(pdfStatementRow, "Date", "Entry", "Type", "Description", "Credits", "Balance")
+	for _, typ := range []string{"TOPUP", "USAGE", "REFUND", "ADJUST", "EXPIRE", "TRANSFER_OUT", "TRANSFER_IN", "DEBT_SETTLEMENT"} {
+		row := fmt.Sprintf(pdfStatementRow, "2025-01-31 23:59", "123456", typ, truncate("Order #42 paid by card in full", 30), "-1500", "98500")
+		if len(row) != len(header) {
+			t.Errorf("%s row is %d characters, header is %d", typ, len(row), len(header))
+		}
+	}
+	if max := (pdfPageWidth - 2*pdfMargin) * 10 / (6 * pdfFontSize); len(header) > max {
+		t.Errorf("row is %d characters, only %d fit on the page", len(header), max)
+	}
+}